@@ -1,17 +1,34 @@
 package cmd
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"os/exec"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/vim-volt/volt/cmd/builder"
 	"github.com/vim-volt/volt/cmd/buildinfo"
 	"github.com/vim-volt/volt/config"
+	"github.com/vim-volt/volt/fileutil"
+	"github.com/vim-volt/volt/gitutil"
+	"github.com/vim-volt/volt/lockjson"
 	"github.com/vim-volt/volt/logger"
 	"github.com/vim-volt/volt/pathutil"
 	"github.com/vim-volt/volt/transaction"
+	"github.com/vim-volt/volt/vimutil"
+	"gopkg.in/src-d/go-git.v4"
 )
 
 func init() {
@@ -19,8 +36,88 @@ func init() {
 }
 
 type buildCmd struct {
-	helped bool
-	full   bool
+	helped      bool
+	full        bool
+	noVimrc     bool
+	backupRC    bool
+	strategy    string
+	strict      bool
+	noHidden    bool
+	maxFileSize int64
+	modeMask    fileModeMaskFlag
+	verifyCopy  string
+	report      string
+	format      string
+	noParallel  bool
+	jobs        int
+	skipMissing bool
+	resume      bool
+	keepOld     bool
+	benchmark   bool
+	dryRun      bool
+	setVersions setVersionFlag
+	excludeDocs excludeDocsFlag
+	// true if called by 'volt profile set', which builds the new profile
+	// over the installed one of the previous profile
+	switchedProfile bool
+}
+
+// The values of -format option
+const (
+	formatText = "text"
+	formatJSON = "json"
+)
+
+// setVersionFlag is the value of -set-version option
+// which can be given multiple times
+type setVersionFlag []string
+
+func (f *setVersionFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *setVersionFlag) Set(value string) error {
+	if !strings.Contains(value, "=") {
+		return errors.New("must be {repository}={revision}: " + value)
+	}
+	*f = append(*f, value)
+	return nil
+}
+
+// excludeDocsFlag is the value of -exclude-docs-from-tags option
+// which can be given multiple times
+type excludeDocsFlag []string
+
+func (f *excludeDocsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *excludeDocsFlag) Set(value string) error {
+	kv := strings.SplitN(value, "=", 2)
+	if len(kv) != 2 {
+		return errors.New("must be {repository}={pattern}: " + value)
+	}
+	if _, err := path.Match(kv[1], ""); err != nil {
+		return errors.New("invalid pattern " + kv[1] + ": " + err.Error())
+	}
+	*f = append(*f, value)
+	return nil
+}
+
+// fileModeMaskFlag is the value of -file-mode-mask option (octal)
+type fileModeMaskFlag os.FileMode
+
+func (f *fileModeMaskFlag) String() string {
+	return fmt.Sprintf("%04o", uint32(*f))
+}
+
+func (f *fileModeMaskFlag) Set(value string) error {
+	mask, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mask&^uint64(os.ModePerm) != 0 {
+		return errors.New("must be octal permission bits (e.g. 0111): " + value)
+	}
+	*f = fileModeMaskFlag(mask)
+	return nil
 }
 
 func (cmd *buildCmd) FlagSet() *flag.FlagSet {
@@ -29,29 +126,129 @@ func (cmd *buildCmd) FlagSet() *flag.FlagSet {
 	fs.Usage = func() {
 		fmt.Print(`
 Usage
-  volt build [-help] [-full]
+  volt build [-help] [-full | -f] [-keep-old] [-dry-run] [-no-vimrc] [-backup-vimrc] [-strategy {strategy}] [-strict] [-no-hidden] [-no-parallel] [-j {count}] [-skip-missing] [-resume] [-max-file-size {bytes}] [-file-mode-mask {mode}] [-verify-copy {mode}] [-report {file}] [-format {format}] [-exclude-docs-from-tags {repository}={pattern} ...] [-set-version {repository}={revision} ...]
+  volt build [-help] -benchmark
 
 Quick example
-  $ volt build        # builds directories under ~/.vim/pack/volt
-  $ volt build -full  # full build (remove ~/.vim/pack/volt, and re-create all)
+  $ volt build            # builds directories under ~/.vim/pack/volt
+  $ volt build -full      # full build (remove ~/.vim/pack/volt, and re-create all)
+  $ volt build -full -keep-old  # full build, but keeps the previous ~/.vim/pack/volt in ~/.vim/volt-backups
+  $ volt build -dry-run   # shows what 'volt build' is going to change without building
+  $ volt build -no-vimrc  # builds directories but does not touch ~/.vim/vimrc and ~/.vim/gvimrc
+  $ volt build -backup-vimrc  # renames your own ~/.vim/vimrc to ~/.vim/vimrc.pre-volt and installs profile vimrc
+  $ volt build -strategy copy  # builds directories with copy strategy only this time
+  $ volt build -strict    # fails if vim does not satisfy requirements of plugins
+  $ volt build -no-hidden # does not install hidden files (e.g. ".editorconfig") of static repositories
+  $ volt build -no-parallel  # builds repositories one by one to make logs easy to read
+  $ volt build -j 4       # copies at most 4 repositories at the same time
+  $ volt build -skip-missing # builds even if some repositories were deleted from $VOLTPATH/repos
+  $ volt build -resume    # resumes the interrupted build without installing finished repositories again
+  $ volt build -full -file-mode-mask 0111  # installs all files as non-executable
+  $ volt build -verify-copy checksum  # fails if installed files of git repositories differ from the blobs
+  $ volt build -exclude-docs-from-tags tyru/caw.vim='caw-*.txt'  # does not index doc/caw-*.txt of tyru/caw.vim in doc/tags
+  $ volt build -benchmark # shows time and disk usage of the build with each strategy
+  $ volt build -set-version tyru/caw.vim=3a12b4c  # installs the commit of tyru/caw.vim instead of locked revision only this time
+  $ VOLT_LOG_FORMAT=compact volt build  # does not show messages per repository, but shows summary
 
 Description
   Build ~/.vim/pack/volt/opt/ directory:
     1. Copy repositories' files into ~/.vim/pack/volt/opt/
       * If the repository is git repository, extract files from locked revision of tree object and copy them into above vim directories
+      * If the repository is bare repository (e.g. a symlink to a bare repository shared as a cache), extract files from locked revision of tree object with any strategy
       * If the repository is static repository (imported non-git directory by "volt add" command), copy files into above vim directories
+      * If the repository is local repository ("type": "local" in $VOLTPATH/lock.json), copy files of its "source" directory (an absolute path or "file://" URL outside $VOLTPATH/repos, e.g. a plugin under development) like static repository. "symlink" strategy links to the directory. The build fails if the directory does not exist
     2. Remove directories from above vim directories, which exist in ~/.vim/pack/volt/build-info.json but not in $VOLTPATH/lock.json
 
   ~/.vim/pack/volt/build-info.json is a file which holds the information that what vim plugins are installed in ~/.vim/pack/volt/ and its type (git repository, static repository, or system repository), its version. A user normally doesn't need to know the contents of build-info.json .
 
-  If -full option was given, remove all directories in ~/.vim/pack/volt/opt/ , and copy repositories' files into above vim directories.
-  Otherwise, it will perform smart build: copy / remove only changed repositories' files.` + "\n\n")
+  The directory name of a repository is its path whose "/" are replaced with "_" (e.g. "github.com_tyru_caw.vim"). If the name is longer than 100 characters, a short hashed name like "~{hash}_{name}" is used instead to keep paths within filesystem limits, and the mapping to the repository path is recorded in ~/.vim/pack/volt/encoded-names.json .
+
+  If -full (or -f) option was given, remove all directories in ~/.vim/pack/volt/opt/ , and copy repositories' files into above vim directories.
+  If -keep-old option was given together, the previous ~/.vim/pack/volt/ is kept in ~/.vim/volt-backups/{time} (e.g. to compare it with the new one) instead of being removed, and the path is shown. If "build.keep_old_max" in $VOLTPATH/config.toml is greater than 0, the oldest kept directories are removed to keep at most the number of them.
+  Otherwise, it will perform smart build: copy / remove only changed repositories' files. Repositories whose type, version (of git repository), placement and subdir are the same as recorded in ~/.vim/pack/volt/build-info.json are skipped as "Already up to date." unless their installed files were removed or damaged.
+  Full build is also done if ~/.vim/pack/volt/ was built for other profile than current profile (e.g. "current_profile_name" of lock.json was changed without 'volt profile set'), with a warning.
+  The version of vim which generated doc/tags files is recorded to build-info.json. If the major version of current vim differs from it (e.g. vim was upgraded from 8.2 to 9.0), full build is done with a warning, and 'volt status' shows it.
+
+  If -dry-run option was given (or VOLT_DRY_RUN environment variable is not empty), the differences which the build is going to change are shown like 'volt status', and nothing is built. The actions of the build are also shown as "Would ..." messages: whether ~/.vim/pack/volt is re-created by full build, ~/.vim/vimrc and ~/.vim/gvimrc to install or remove, and the repositories to copy (git or static) or link, and to remove. No files or directories are created, removed or renamed.
+
+  If -no-vimrc option was given, ~/.vim/vimrc and ~/.vim/gvimrc are neither installed nor removed regardless of profile vimrc and gvimrc.
+
+  ~/.vim/vimrc and ~/.vim/gvimrc which were not installed by volt (they do not have the magic comment) are never overwritten, and the build fails if profile vimrc or gvimrc exists. If -backup-vimrc option was given, they are renamed to ~/.vim/vimrc.pre-volt and ~/.vim/gvimrc.pre-volt (the paths are shown), and profile vimrc and gvimrc are installed instead. The build fails if the backup already exists with different content.
+
+  If "generate_helptags" of current profile in $VOLTPATH/lock.json is false, doc/tags files are not generated for any repositories (e.g. when you maintain a combined help tags file by yourself). Use -full option together to remove doc/tags files which were already generated by copy strategy.
+
+  Doc files which match the glob patterns (relative to doc directory) of the repository in "build.exclude_docs_from_tags" of $VOLTPATH/config.toml are installed, but are not indexed in doc/tags (e.g. huge doc directories which make ":helptags" slow). If -exclude-docs-from-tags option was given, its {pattern} is used for {repository} instead of the patterns in config.toml. This option can be given multiple times. Use -full option together to regenerate doc/tags of repositories which were already installed.
+
+  doc/tags-{lang} files are generated for translated help files (e.g. doc/tags-ja for "*.jax"). If "build.help_languages" is set in $VOLTPATH/config.toml (e.g. ["ja"]), only the listed languages are generated besides doc/tags (English). Use -full option together after changing it.
+
+  "version" of a git repository in $VOLTPATH/lock.json is usually a commit hash, but it can also be a tag (e.g. "v2.1.0") or branch (e.g. "main") name to pin the repository to it. A commit hash is looked up before tags and branches (like "git rev-parse"), and the commit which they point to is installed. 'volt update' replaces it with the commit hash of the latest commit unless "pinned" of the repository is true.
+
+  If "tree_hash" of a git repository in $VOLTPATH/lock.json is given, copy strategy refuses to install the repository when the tree hash of the locked revision differs from it (e.g. the history was rewritten and the contents of the locked revision changed). Run "git rev-parse {version}^{tree}" in the repository to get the tree hash. -set-version option skips this check for the repository.
+
+  If plugconf of a repository has s:requires() (e.g. "return ['+python3', 'vim>=8.0.1453']") and vim does not satisfy them, warnings are shown. If -strict option was given, the build fails instead.
+
+  If -no-hidden option was given (or "build.no_hidden" in $VOLTPATH/config.toml is true), copy strategy does not install hidden files and directories (e.g. ".editorconfig", ".github/") of static repositories. Hidden files of repositories listed in "build.keep_hidden" are installed anyway. Use -full option together to remove hidden files which were already installed.
+
+  If -no-parallel option was given, repositories are processed one by one in the order of installed directory names, instead of concurrently. This is slower, but the logs are in the same order every time, which helps to debug build failures.
+
+  Repositories are copied (or linked) concurrently, at most as many at the same time as the number of CPUs. If -j option was given, at most {count} repositories are processed at the same time instead. Lower it if the build thrashes the disk or fails with "too many open files".
+
+  If -skip-missing option was given, repositories whose source directory ($VOLTPATH/repos/{repository}) does not exist are not installed (warnings are shown instead of failing), and the other repositories are installed. Run 'volt get -l' to fetch the missing repositories again.
+
+  While copy strategy is building, the installed repositories are recorded to ~/.vim/pack/volt/build-checkpoint.json, which is removed when the build finished successfully. If -resume option was given and the checkpoint exists (the previous build failed or was interrupted), ~/.vim/pack/volt/ is not removed even for full build, and the recorded repositories are not installed again unless they were changed. -resume option is available only with copy strategy.
+
+  If the build is interrupted (SIGINT or SIGTERM, e.g. Ctrl-C), no more repositories are installed and the build stops with an error. The previous ~/.vim/pack/volt/ is kept during full build, and it is restored if the full build was interrupted (the checkpoint is removed too). Otherwise, the repositories installed before the interruption are kept, and the build can be resumed with -resume option.
+
+  If -max-file-size option was given, copy strategy does not install files larger than the size (bytes) with warnings naming the files and repositories (e.g. huge binary assets committed by accident). There is no limit by default. Use -full option together to remove large files which were already installed. -max-file-size option is available only with copy strategy.
+
+  If -file-mode-mask option was given, copy strategy clears the permission bits of the octal mode from all installed files of both git and static repositories (e.g. 0111 strips the executable bits, 0022 makes files not writable by group and others). The modes of source files are preserved by default. Use -full option together to apply the mask to files which were already installed. -file-mode-mask option is available only with copy strategy.
+
+  If -verify-copy option was given, each file extracted from the locked revision of git repositories is read again after it was written, and the build of the repository fails if the file differs from the blob in git (e.g. it was truncated because the disk became full). "size" compares the sizes, and "checksum" also compares the SHA-1 (blob hash), which reads all files again. Run the build again after fixing the cause.
+
+  If -report option was given, the report of the build is written to the file as JSON, even if the build failed. It has the start time, current profile, strategy, whether it was full build, the result, the total duration, and the outcome ("installed", "skipped" or "failed"), duration and installed size of each repository of current profile. Unlike ~/.vim/pack/volt/build-info.json which is the state of installed files, it is the log of the run for tools and audits.
+
+  If -format json option was given, no messages but errors (to stderr) are shown, and the report of the build (the same as -report option writes) is shown as JSON to stdout when the build finished, even if it failed. The failed repositories have "error" in the report. This is useful to run volt from scripts and CI. -format json is not available with -dry-run or -benchmark options.
+
+  If -set-version option was given, {revision} (commit hash, branch or tag) of git repository {repository} is installed instead of the locked revision in lock.json. lock.json is not changed, so next 'volt build' installs the locked revision again. This option can be given multiple times, and is available only with copy strategy. The build fails if {revision} is not found in the repository.
+
+  If -benchmark option was given, the repositories of current profile are built with each strategy ("symlink" and "copy") into temporary directories, and the time and disk usage (the total size of regular files, symbolic links are not followed) of each build are shown. ~/.vim is not changed. The other options are ignored.
+
+  The strategy ("symlink" or "copy") is decided by the following order:
+    1. -strategy option
+    2. "default_build" in $VOLTPATH/lock.json (if given)
+    3. "build.strategy" in $VOLTPATH/config.toml
+
+  On Windows, "symlink" strategy creates junctions. If a junction could not be created (e.g. the privilege is not given), the repository is copied instead with a warning, and it is recorded as "copied" in build-info.json.
+
+  If "pre_build" in $VOLTPATH/lock.json is given, the shell command ("sh -c" or "cmd /c" on Windows) is run in the vim directory (~/.vim) before installing repositories, and the build is aborted if it exits with non-zero status. If "post_build" is given, the shell command is run in the same way after the build succeeded (e.g. to regenerate a compiled colorscheme). Its failure is shown as a warning, and the build is kept. The output of the commands is shown as info messages. They are not run by -dry-run option.
+
+  If VOLT_LOG_FORMAT environment variable is "compact", messages per repository (e.g. "Installing ... Done.") are not shown. Errors, warnings and the summary are still shown. This is useful to keep CI logs short.` + "\n\n")
 		fmt.Println("Options")
 		fs.PrintDefaults()
 		fmt.Println()
 		cmd.helped = true
 	}
 	fs.BoolVar(&cmd.full, "full", false, "full build")
+	fs.BoolVar(&cmd.full, "f", false, "same as -full")
+	fs.BoolVar(&cmd.dryRun, "dry-run", cmd.dryRun, "show what the build is going to change instead of building")
+	fs.BoolVar(&cmd.noVimrc, "no-vimrc", false, "do not install vimrc and gvimrc")
+	fs.BoolVar(&cmd.backupRC, "backup-vimrc", false, "rename vimrc and gvimrc without magic comment to {name}.pre-volt and install profile ones")
+	fs.BoolVar(&cmd.strict, "strict", false, "fail if vim does not satisfy requirements of plugins")
+	fs.BoolVar(&cmd.noHidden, "no-hidden", false, "do not install hidden files of static repositories")
+	fs.BoolVar(&cmd.noParallel, "no-parallel", false, "process repositories one by one in deterministic order")
+	fs.IntVar(&cmd.jobs, "j", 0, "copy (or link) at most `count` repositories at the same time (default: the number of CPUs)")
+	fs.BoolVar(&cmd.skipMissing, "skip-missing", false, "skip repositories whose source directory does not exist")
+	fs.BoolVar(&cmd.resume, "resume", false, "resume the interrupted build (copy strategy only)")
+	fs.BoolVar(&cmd.keepOld, "keep-old", false, "keep the previous ~/.vim/pack/volt/ of full build in ~/.vim/volt-backups/")
+	fs.BoolVar(&cmd.benchmark, "benchmark", false, "show time and disk usage of the build with each strategy without changing ~/.vim")
+	fs.Int64Var(&cmd.maxFileSize, "max-file-size", 0, "do not install files larger than this size in bytes (copy strategy only)")
+	fs.Var(&cmd.modeMask, "file-mode-mask", "clear the permission bits of `mode` (octal) from installed files (copy strategy only)")
+	fs.StringVar(&cmd.verifyCopy, "verify-copy", "", "re-read files extracted from git repositories and compare them with blobs by `mode` (\"size\" or \"checksum\")")
+	fs.StringVar(&cmd.report, "report", "", "write the report of this build to the JSON file")
+	fs.StringVar(&cmd.format, "format", formatText, "output `format` (\"text\" or \"json\")")
+	fs.StringVar(&cmd.strategy, "strategy", "", "build strategy (\"symlink\" or \"copy\") instead of the default")
+	fs.Var(&cmd.excludeDocs, "exclude-docs-from-tags", "do not index doc files of {repository}={pattern} in doc/tags instead of config.toml (can be given multiple times)")
+	fs.Var(&cmd.setVersions, "set-version", "install {repository}={revision} instead of locked revision (can be given multiple times)")
 	return fs
 }
 
@@ -62,6 +259,43 @@ func (cmd *buildCmd) Run(args []string) int {
 	if cmd.helped {
 		return 0
 	}
+	if cmd.strategy != "" && cmd.strategy != config.SymlinkBuilder && cmd.strategy != config.CopyBuilder {
+		logger.Errorf("-strategy is %q: valid values are %q or %q", cmd.strategy, config.SymlinkBuilder, config.CopyBuilder)
+		return 10
+	}
+	if cmd.verifyCopy != "" && cmd.verifyCopy != builder.VerifyCopySize && cmd.verifyCopy != builder.VerifyCopyChecksum {
+		logger.Errorf("-verify-copy is %q: valid values are %q or %q", cmd.verifyCopy, builder.VerifyCopySize, builder.VerifyCopyChecksum)
+		return 10
+	}
+	if cmd.format != formatText && cmd.format != formatJSON {
+		logger.Errorf("-format is %q: valid values are %q or %q", cmd.format, formatText, formatJSON)
+		return 10
+	}
+	if cmd.format == formatJSON {
+		if cmd.dryRun || cmd.benchmark {
+			logger.Error("-format json is not available with -dry-run or -benchmark")
+			return 10
+		}
+		// Do not mix messages into the JSON (errors are written to stderr)
+		logger.SetLevel(logger.ErrorLevel)
+	}
+
+	if cmd.dryRun {
+		if err := cmd.showChanges(); err != nil {
+			logger.Error("Failed to get status:", err.Error())
+			return 14
+		}
+		return 0
+	}
+
+	// Each build of benchmark begins its own transaction
+	if cmd.benchmark {
+		if err := cmd.doBenchmark(); err != nil {
+			logger.Error("Failed to benchmark:", err.Error())
+			return 13
+		}
+		return 0
+	}
 
 	// Begin transaction
 	err := transaction.Create()
@@ -80,17 +314,320 @@ func (cmd *buildCmd) Run(args []string) int {
 	return 0
 }
 
+func (cmd *buildCmd) setDryRun() {
+	cmd.dryRun = true
+}
+
+// Show the differences which the build is going to change (see 'volt status')
+func (cmd *buildCmd) showChanges() error {
+	changes, err := (&statusCmd{}).getChanges()
+	if err != nil {
+		return err
+	}
+	if cmd.full {
+		fmt.Println("full build: " + pathutil.VimVoltDir() + " is re-created")
+	} else if len(changes) == 0 {
+		fmt.Println("Up to date.")
+	}
+	for _, change := range changes {
+		fmt.Println(change)
+	}
+	if err := cmd.showActions(); err != nil {
+		return err
+	}
+	logger.Info(pathutil.VimVoltDir() + " was not changed because -dry-run was given")
+	return nil
+}
+
+// Show what the build is going to do: rc files to install or remove, and
+// repositories to install or remove. Nothing is changed.
+func (cmd *buildCmd) showActions() error {
+	cfg, err := config.Read()
+	if err != nil {
+		return errors.New("could not read config.toml: " + err.Error())
+	}
+	lockJSON, err := lockjson.ReadNoMigrationMsg()
+	if err != nil {
+		return errors.New("could not read lock.json: " + err.Error())
+	}
+	profile, err := lockJSON.Profiles.FindByName(lockJSON.CurrentProfileName)
+	if err != nil {
+		return err
+	}
+	reposList, err := lockJSON.GetReposListByProfile(profile)
+	if err != nil {
+		return err
+	}
+	if err := builder.ResolveVersions(reposList); err != nil {
+		return err
+	}
+	buildInfo, err := buildinfo.Read()
+	if err != nil {
+		return err
+	}
+	strategy := cmd.getStrategy(cfg, lockJSON)
+	full := cmd.full || mustFullBuild(buildInfo, strategy, lockJSON.CurrentProfileName, currentVimVersion())
+
+	// vimrc and gvimrc
+	if !cmd.noVimrc {
+		vimDir := pathutil.VimDir()
+		for _, rc := range []struct{ src, dst string }{
+			{pathutil.ProfileVimrc, filepath.Join(vimDir, pathutil.Vimrc)},
+			{pathutil.ProfileGvimrc, filepath.Join(vimDir, pathutil.Gvimrc)},
+		} {
+			changed, err := (&builder.BaseBuilder{}).RCFileChanged(lockJSON.CurrentProfileName, rc.src, rc.dst)
+			if err != nil {
+				return err
+			}
+			if !changed {
+				continue
+			}
+			src := filepath.Join(pathutil.RCDir(lockJSON.CurrentProfileName), rc.src)
+			if pathutil.Exists(src) {
+				logger.Info("Would install " + src + " to " + rc.dst)
+			} else {
+				logger.Info("Would remove " + rc.dst)
+			}
+		}
+	}
+
+	// Repositories
+	installed := make(map[pathutil.ReposPath]bool, len(reposList))
+	if full {
+		logger.Info("Would remove " + pathutil.VimVoltDir() + " and re-create it (full build)")
+		for i := range reposList {
+			installed[reposList[i].Path] = true
+		}
+	} else {
+		for _, reposPath := range buildInfo.ChangedReposPathList(reposList) {
+			if !reposList.Contains(reposPath) {
+				logger.Info("Would remove " + pathutil.EncodeReposPath(reposPath) + " (" + reposPath.String() + ")")
+				continue
+			}
+			installed[reposPath] = true
+		}
+		if strategy == config.CopyBuilder {
+			// Static (and local) repositories are copied again when they are
+			// modified
+			for i := range reposList {
+				r := buildInfo.Repos.FindByReposPath(reposList[i].Path)
+				isDir := reposList[i].Type == lockjson.ReposStaticType || reposList[i].Type == lockjson.ReposLocalType
+				if isDir && r != nil && (&statusCmd{}).modifiedAfter(reposList[i].ReposDir(), r.Version) {
+					installed[r.Path] = true
+				}
+			}
+		}
+	}
+	for i := range reposList {
+		repos := &reposList[i]
+		if !installed[repos.Path] {
+			continue
+		}
+		switch {
+		case strategy == config.SymlinkBuilder:
+			logger.Info("Would link " + repos.EncodedPath() + " to " + repos.SourceDir())
+		case repos.Type == lockjson.ReposGitType:
+			logger.Info("Would copy git repository " + repos.Path.String() + " (" + repos.Version + ") to " + repos.EncodedPath())
+		default:
+			logger.Info("Would copy " + string(repos.Type) + " repository " + repos.Path.String() + " to " + repos.EncodedPath())
+		}
+	}
+	return nil
+}
+
+// Returns repositories listed in "build.keep_hidden" of config.toml
+func keepHiddenRepos(cfg *config.Config) (map[pathutil.ReposPath]bool, error) {
+	keepHidden := make(map[pathutil.ReposPath]bool, len(cfg.Build.KeepHidden))
+	for _, path := range cfg.Build.KeepHidden {
+		reposPath, err := pathutil.NormalizeRepos(path)
+		if err != nil {
+			return nil, err
+		}
+		keepHidden[reposPath] = true
+	}
+	return keepHidden, nil
+}
+
+// Returns "build.exclude_docs_from_tags" of config.toml by repository path
+func excludeDocsRepos(cfg *config.Config) (map[pathutil.ReposPath][]string, error) {
+	excludeDocs := make(map[pathutil.ReposPath][]string, len(cfg.Build.ExcludeDocsFromTags))
+	for path, patterns := range cfg.Build.ExcludeDocsFromTags {
+		reposPath, err := pathutil.NormalizeRepos(path)
+		if err != nil {
+			return nil, err
+		}
+		excludeDocs[reposPath] = patterns
+	}
+	return excludeDocs, nil
+}
+
+// Returns excludeDocsRepos(cfg) whose patterns are replaced with the ones of
+// -exclude-docs-from-tags options for the given repositories
+func (cmd *buildCmd) excludeDocsRepos(cfg *config.Config) (map[pathutil.ReposPath][]string, error) {
+	excludeDocs, err := excludeDocsRepos(cfg)
+	if err != nil {
+		return nil, err
+	}
+	overridden := make(map[pathutil.ReposPath]bool, len(cmd.excludeDocs))
+	for _, value := range cmd.excludeDocs {
+		kv := strings.SplitN(value, "=", 2)
+		reposPath, err := pathutil.NormalizeRepos(kv[0])
+		if err != nil {
+			return nil, errors.New("-exclude-docs-from-tags: " + err.Error())
+		}
+		if !overridden[reposPath] {
+			excludeDocs[reposPath] = nil
+			overridden[reposPath] = true
+		}
+		excludeDocs[reposPath] = append(excludeDocs[reposPath], kv[1])
+	}
+	return excludeDocs, nil
+}
+
+// Returns true if full build is needed regardless of -full option:
+// * build-info.json's version is different with current version
+// * build-info.json's strategy is different with current strategy
+// * build-info.json's profile is different with current profile
+// * build-info.json's vim is different major version with current vim
+// * current strategy is symlink
+func mustFullBuild(buildInfo *buildinfo.BuildInfo, strategy, profileName string, vimInfo *vimutil.VersionInfo) bool {
+	return buildInfo.Version != currentBuildInfoVersion ||
+		buildInfo.Strategy != strategy ||
+		(buildInfo.Profile != "" && buildInfo.Profile != profileName) ||
+		(vimInfo != nil && buildInfo.VimVersion != "" && !vimInfo.SameMajor(buildInfo.VimVersion)) ||
+		strategy == config.SymlinkBuilder
+}
+
 const currentBuildInfoVersion = 2
 
-func (cmd *buildCmd) doBuild(full bool) error {
+// Returns the version of the vim which generates doc/tags files,
+// or nil if it was not detected
+func currentVimVersion() *vimutil.VersionInfo {
+	vimExePath, err := pathutil.VimExecutable()
+	if err != nil {
+		return nil
+	}
+	info, _ := vimutil.CheckVersion(vimExePath)
+	return info
+}
+
+// Returns the strategy of the build.
+// -strategy option > "default_build" in lock.json > "build.strategy" in config.toml
+func (cmd *buildCmd) getStrategy(cfg *config.Config, lockJSON *lockjson.LockJSON) string {
+	if cmd.strategy != "" {
+		return cmd.strategy
+	}
+	if lockJSON.DefaultBuild != "" {
+		return lockJSON.DefaultBuild
+	}
+	return cfg.Build.Strategy
+}
+
+func (cmd *buildCmd) doBuild(full bool) (err error) {
 	// Read config.toml
 	cfg, err := config.Read()
 	if err != nil {
 		return errors.New("could not read config.toml: " + err.Error())
 	}
 
+	// Read lock.json
+	lockJSON, err := lockjson.ReadNoMigrationMsg()
+	if err != nil {
+		return errors.New("could not read lock.json: " + err.Error())
+	}
+	strategy := cmd.getStrategy(cfg, lockJSON)
+
+	// Write the report even if the build failed
+	var report *builder.Report
+	if cmd.report != "" || cmd.format == formatJSON {
+		report = builder.NewReport(lockJSON.CurrentProfileName, strategy)
+		defer func() {
+			if werr := cmd.writeReport(report, lockJSON, err); err == nil {
+				err = werr
+			}
+		}()
+	}
+
+	versionOverrides, err := cmd.resolveVersionOverrides(lockJSON)
+	if err != nil {
+		return err
+	}
+	if len(versionOverrides) > 0 && strategy != config.CopyBuilder {
+		return errors.New("-set-version is available only with copy strategy (try '-strategy copy')")
+	}
+	if cmd.maxFileSize < 0 {
+		return errors.New("-max-file-size must not be negative")
+	}
+	if cmd.jobs < 0 {
+		return errors.New("-j must not be negative")
+	}
+	if cmd.maxFileSize > 0 && strategy != config.CopyBuilder {
+		return errors.New("-max-file-size is available only with copy strategy (try '-strategy copy')")
+	}
+	if cmd.modeMask != 0 && strategy != config.CopyBuilder {
+		return errors.New("-file-mode-mask is available only with copy strategy (try '-strategy copy')")
+	}
+
+	// Read the checkpoint of the interrupted build if -resume option was
+	// given, otherwise start over
+	var checkpoint buildinfo.ReposList
+	if cmd.resume {
+		if strategy != config.CopyBuilder {
+			return errors.New("-resume is available only with copy strategy (try '-strategy copy')")
+		}
+		checkpoint, err = buildinfo.ReadCheckpoint()
+		if err != nil {
+			return errors.New("could not read build checkpoint: " + err.Error())
+		}
+	} else if err = buildinfo.RemoveCheckpoint(); err != nil {
+		return err
+	}
+
+	missing, err := cmd.getMissingRepos(lockJSON)
+	if err != nil {
+		return err
+	}
+
 	// Get builder
-	builder, err := builder.Get(cfg.Build.Strategy)
+	excludeDocs, err := cmd.excludeDocsRepos(cfg)
+	if err != nil {
+		return err
+	}
+	keepHidden, err := keepHiddenRepos(cfg)
+	if err != nil {
+		return err
+	}
+	noHelptags := false
+	if profile, err := lockJSON.Profiles.FindByName(lockJSON.CurrentProfileName); err == nil {
+		noHelptags = !profile.GeneratesHelptags()
+	}
+	builder, err := builder.NewBuilder(strategy, &builder.Options{
+		NoVimrc:             cmd.noVimrc,
+		BackupRC:            cmd.backupRC,
+		ReposTimeout:        time.Duration(*cfg.Build.ReposTimeout) * time.Second,
+		GitRetries:          *cfg.Build.GitRetries,
+		ExcludeDocsFromTags: excludeDocs,
+		NoHelptags:          noHelptags,
+		HelpLanguages:       cfg.Build.HelpLanguages,
+		HelptagsWorkers:     cfg.Build.HelptagsWorkers,
+		Strict:              cmd.strict,
+		VersionOverrides:    versionOverrides,
+		NoHidden:            cmd.noHidden || *cfg.Build.NoHidden,
+		KeepHidden:          keepHidden,
+		NoParallel:          cmd.noParallel,
+		Jobs:                cmd.jobs,
+		SkipRepos:           missing,
+		MaxFileSize:         cmd.maxFileSize,
+		FileModeMask:        os.FileMode(cmd.modeMask),
+		VerifyCopy:          cmd.verifyCopy,
+		Report:              report,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Validate all repositories before modifying anything
+	err = builder.Preflight()
 	if err != nil {
 		return err
 	}
@@ -101,17 +638,49 @@ func (cmd *buildCmd) doBuild(full bool) error {
 		return err
 	}
 
-	// Do full build when:
-	// * build-info.json's version is different with current version
-	// * build-info.json's strategy is different with config
-	// * config strategy is symlink
-	if buildInfo.Version != currentBuildInfoVersion ||
-		buildInfo.Strategy != cfg.Build.Strategy ||
-		cfg.Build.Strategy == config.SymlinkBuilder {
+	// Do full build if needed (see mustFullBuild())
+	profileChanged := buildInfo.Profile != "" && buildInfo.Profile != lockJSON.CurrentProfileName
+	if profileChanged && !cmd.switchedProfile {
+		logger.Warnf("%s was built for profile '%s', but current profile is '%s'. Full building ...",
+			pathutil.VimVoltDir(), buildInfo.Profile, lockJSON.CurrentProfileName)
+	}
+	vimInfo := currentVimVersion()
+	vimChanged := vimInfo != nil && buildInfo.VimVersion != "" && !vimInfo.SameMajor(buildInfo.VimVersion)
+	if vimChanged {
+		logger.Warnf("%s was built by %s, but current vim is %s. Full building ...",
+			pathutil.VimVoltDir(), buildInfo.VimVersion, vimInfo)
+	}
+	if mustFullBuild(buildInfo, strategy, lockJSON.CurrentProfileName, vimInfo) {
 		full = true
 	}
 	buildInfo.Version = currentBuildInfoVersion
-	buildInfo.Strategy = cfg.Build.Strategy
+	buildInfo.Strategy = strategy
+	buildInfo.Profile = lockJSON.CurrentProfileName
+	if vimInfo != nil {
+		buildInfo.VimVersion = vimInfo.String()
+	}
+
+	// Resume the interrupted build: the repositories in the checkpoint are
+	// installed only if they were changed like smart build.
+	// Other repositories are installed again if it was full build.
+	if len(checkpoint) > 0 {
+		logger.Infof("Resuming the interrupted build (%d repositories were already installed) ...", len(checkpoint))
+		if full {
+			buildInfo.Repos = make(buildinfo.ReposList, 0, len(checkpoint))
+		}
+		for i := range checkpoint {
+			if r := buildInfo.Repos.FindByReposPath(checkpoint[i].Path); r != nil {
+				*r = checkpoint[i]
+			} else {
+				buildInfo.Repos = append(buildInfo.Repos, checkpoint[i])
+			}
+		}
+		full = false
+	}
+
+	if report != nil {
+		report.Full = full
+	}
 
 	// Put repos into map to be able to search with O(1).
 	// Use empty build-info.json map if the -full option was given
@@ -130,14 +699,365 @@ func (cmd *buildCmd) doBuild(full bool) error {
 		logger.Info("Building " + optDir + " directory ...")
 	}
 
-	// Remove ~/.vim/pack/volt/ if -full option was given
+	// Cancel the build when SIGINT or SIGTERM is received
+	ctx, stop := withInterrupt(context.Background())
+	defer stop()
+
+	// Run "pre_build" hook of lock.json before modifying anything
+	if err = runBuildHook("pre_build", lockJSON.PreBuild); err != nil {
+		return err
+	}
+
+	// Move ~/.vim/pack/volt/ to the backup directory if -full option was
+	// given. The previous directory is restored if the build was
+	// interrupted, or if the build of symlink builder (which always does
+	// full build) failed. Otherwise the copy builder leaves the installed
+	// repositories to resume the build (see -resume option).
 	if full {
-		vimVoltDir := pathutil.VimVoltDir()
-		os.RemoveAll(vimVoltDir)
-		if pathutil.Exists(vimVoltDir) {
-			return errors.New("failed to remove " + vimVoltDir)
+		var backup string
+		backup, err = cmd.backupVimVoltDir()
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil && (strategy == config.SymlinkBuilder || ctx.Err() != nil) {
+				if e := cmd.restoreVimVoltDir(backup); e != nil {
+					logger.Error("Failed to restore " + pathutil.VimVoltDir() + ": " + e.Error())
+				} else if e := buildinfo.RemoveCheckpoint(); e != nil {
+					logger.Error(e.Error())
+				}
+			} else {
+				cmd.removeBackup(backup, cfg.Build.KeepOldMax)
+			}
+		}()
+	}
+
+	err = builder.Build(ctx, buildInfo, buildReposMap)
+	if err != nil && ctx.Err() != nil {
+		err = errors.New("interrupted")
+	}
+	if err == nil {
+		err = buildinfo.RemoveCheckpoint()
+	}
+	// Run "post_build" hook of lock.json. The build is not rolled back even
+	// if it failed.
+	if err == nil {
+		if e := runBuildHook("post_build", lockJSON.PostBuild); e != nil {
+			logger.Warn(e.Error())
+		}
+	}
+	if err == nil && len(missing) > 0 {
+		list := make([]string, 0, len(missing))
+		for reposPath := range missing {
+			list = append(list, reposPath.String())
+		}
+		sort.Strings(list)
+		logger.Warnf("Skipped %d repositories whose source does not exist: %s", len(list), strings.Join(list, ", "))
+	}
+	return err
+}
+
+// Runs the shell command of "pre_build" or "post_build" hook (name) of
+// lock.json in the vim directory. Each line of the output is shown as info
+// message. It does nothing if command is empty.
+func runBuildHook(name, command string) error {
+	if command == "" {
+		return nil
+	}
+	var hook *exec.Cmd
+	if runtime.GOOS == "windows" {
+		hook = exec.Command("cmd", "/c", command)
+	} else {
+		hook = exec.Command("sh", "-c", command)
+	}
+	hook.Dir = pathutil.VimDir()
+	if err := os.MkdirAll(hook.Dir, 0755); err != nil {
+		return errors.New(name + " hook failed: could not create " + hook.Dir + ": " + err.Error())
+	}
+	logger.Debugf("Running %s hook '%s' in %s ...", name, command, hook.Dir)
+	out, err := hook.CombinedOutput()
+	for _, line := range strings.Split(strings.TrimRight(string(out), "\r\n"), "\n") {
+		if line != "" {
+			logger.Info(name + ": " + strings.TrimRight(line, "\r"))
+		}
+	}
+	if err != nil {
+		return errors.New(name + " hook failed: " + err.Error())
+	}
+	return nil
+}
+
+// Write the report of the build to the file of -report option, and show it
+// if -format json option was given.
+// The repositories of current profile which were not installed are
+// recorded as skipped.
+func (cmd *buildCmd) writeReport(report *builder.Report, lockJSON *lockjson.LockJSON, buildErr error) error {
+	var reposList lockjson.ReposList
+	if profile, err := lockJSON.Profiles.FindByName(lockJSON.CurrentProfileName); err == nil {
+		reposList, _ = lockJSON.GetReposListByProfile(profile)
+	}
+	report.Finish(reposList, buildErr)
+	if cmd.report != "" {
+		if err := report.Write(cmd.report); err != nil {
+			return errors.New("could not write report: " + err.Error())
+		}
+	}
+	if cmd.format == formatJSON {
+		b, err := report.Bytes()
+		if err != nil {
+			return errors.New("could not show report: " + err.Error())
+		}
+		os.Stdout.Write(append(b, '\n'))
+	}
+	return nil
+}
+
+// Returns repositories of current profile whose source directory does not
+// exist if -skip-missing option was given
+func (cmd *buildCmd) getMissingRepos(lockJSON *lockjson.LockJSON) (map[pathutil.ReposPath]bool, error) {
+	if !cmd.skipMissing {
+		return nil, nil
+	}
+	profile, err := lockJSON.Profiles.FindByName(lockJSON.CurrentProfileName)
+	if err != nil {
+		return nil, err
+	}
+	missing := make(map[pathutil.ReposPath]bool)
+	for _, reposPath := range profile.ReposPath {
+		src := pathutil.FullReposPath(reposPath)
+		if repos, err := lockJSON.Repos.FindByPath(reposPath); err == nil {
+			src = repos.ReposDir()
+		}
+		if !pathutil.Exists(src) {
+			logger.Warnf("%s: source does not exist, skipping: %s", reposPath, src)
+			missing[reposPath] = true
+		}
+	}
+	return missing, nil
+}
+
+// Resolve revisions of -set-version options to commit hashes
+func (cmd *buildCmd) resolveVersionOverrides(lockJSON *lockjson.LockJSON) (map[pathutil.ReposPath]string, error) {
+	if len(cmd.setVersions) == 0 {
+		return nil, nil
+	}
+	profile, err := lockJSON.Profiles.FindByName(lockJSON.CurrentProfileName)
+	if err != nil {
+		return nil, err
+	}
+	overrides := make(map[pathutil.ReposPath]string, len(cmd.setVersions))
+	for _, value := range cmd.setVersions {
+		kv := strings.SplitN(value, "=", 2)
+		reposPath, err := pathutil.NormalizeRepos(kv[0])
+		if err != nil {
+			return nil, err
+		}
+		repos, err := lockJSON.Repos.FindByPath(reposPath)
+		if err != nil || !profile.ReposPath.Contains(reposPath) {
+			return nil, errors.New("-set-version: " + reposPath.String() + " is not in current profile '" + profile.Name + "'")
+		}
+		if repos.Type != lockjson.ReposGitType {
+			return nil, errors.New("-set-version: " + reposPath.String() + " is not a git repository")
+		}
+		r, err := git.PlainOpen(pathutil.FullReposPath(reposPath))
+		if err != nil {
+			return nil, errors.New("-set-version: failed to open repository: " + err.Error())
 		}
+		hash, err := gitutil.ResolveCommit(r, kv[1])
+		if err != nil {
+			return nil, errors.New("-set-version: " + reposPath.String() + ": " + err.Error())
+		}
+		logger.Infof("Installing %s of %s instead of locked revision %s", hash, reposPath, repos.Version)
+		overrides[reposPath] = hash
 	}
+	return overrides, nil
+}
 
-	return builder.Build(buildInfo, buildReposMap)
+// Move ~/.vim/pack/volt/ to a backup directory, and copy bundled plugconf to
+// the new one so that Vim can still use the previous one during the build.
+// Returns the path of the backup directory.
+func (*buildCmd) backupVimVoltDir() (string, error) {
+	vimVoltDir := pathutil.VimVoltDir()
+	backup := filepath.Join(filepath.Dir(vimVoltDir), ".volt_backup")
+	// Remove the backup left by the interrupted build
+	os.RemoveAll(backup)
+	if pathutil.Exists(backup) {
+		return "", errors.New("failed to remove " + backup)
+	}
+	if err := os.Rename(vimVoltDir, backup); err != nil {
+		if os.IsNotExist(err) {
+			return backup, nil
+		}
+		return "", errors.New("failed to back up " + vimVoltDir + ": " + err.Error())
+	}
+
+	bundled := pathutil.BundledPlugConf()
+	saved, err := filepath.Rel(vimVoltDir, bundled)
+	if err != nil {
+		return "", err
+	}
+	saved = filepath.Join(backup, saved)
+	if info, err := os.Stat(saved); err == nil {
+		os.MkdirAll(filepath.Dir(bundled), 0755)
+		err = fileutil.CopyFile(saved, bundled, make([]byte, info.Size()), info.Mode())
+		if err != nil {
+			return "", errors.New("failed to copy " + bundled + ": " + err.Error())
+		}
+	}
+	return backup, nil
+}
+
+// Remove the backup directory which backupVimVoltDir() made.
+// If -keep-old option was given, it is moved to ~/.vim/volt-backups/{time}
+// instead, and the oldest ones are removed to keep at most keepMax
+// directories (no limit if keepMax is 0).
+func (cmd *buildCmd) removeBackup(backup string, keepMax int) {
+	if !cmd.keepOld || !pathutil.Exists(backup) {
+		os.RemoveAll(backup)
+		return
+	}
+	dir := pathutil.VoltBackupsDir()
+	name := time.Now().Format("20060102-150405")
+	kept := filepath.Join(dir, name)
+	for i := 1; pathutil.Exists(kept); i++ {
+		kept = filepath.Join(dir, name+"-"+strconv.Itoa(i))
+	}
+	os.MkdirAll(dir, 0755)
+	if err := os.Rename(backup, kept); err != nil {
+		logger.Warn("Could not keep the previous " + pathutil.VimVoltDir() + ": " + err.Error())
+		os.RemoveAll(backup)
+		return
+	}
+	logger.Info("Kept the previous " + pathutil.VimVoltDir() + " in " + kept)
+	if keepMax <= 0 {
+		return
+	}
+	// The names are sorted by the time when they were kept
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		logger.Warn("Could not remove old backups: " + err.Error())
+		return
+	}
+	for i := 0; i < len(entries)-keepMax; i++ {
+		old := filepath.Join(dir, entries[i].Name())
+		if err := os.RemoveAll(old); err != nil {
+			logger.Warn("Could not remove old backup " + old + ": " + err.Error())
+			continue
+		}
+		logger.Debug("Removed old backup " + old)
+	}
+}
+
+// Restore ~/.vim/pack/volt/ from the backup directory which
+// backupVimVoltDir() made
+func (*buildCmd) restoreVimVoltDir(backup string) error {
+	vimVoltDir := pathutil.VimVoltDir()
+	os.RemoveAll(vimVoltDir)
+	if pathutil.Exists(vimVoltDir) {
+		return errors.New("failed to remove " + vimVoltDir)
+	}
+	if !pathutil.Exists(backup) {
+		return nil
+	}
+	return os.Rename(backup, vimVoltDir)
+}
+
+// Returns the context which is cancelled when SIGINT or SIGTERM is received.
+// The signals received after that are ignored until stop is called, so that
+// the previous ~/.vim/pack/volt/ can be restored without being interrupted.
+func withInterrupt(ctx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-sigCh:
+			logger.Warn("Interrupted. Stopping the build ...")
+			cancel()
+		case <-done:
+		}
+	}()
+	stop := func() {
+		signal.Stop(sigCh)
+		close(done)
+		cancel()
+	}
+	return ctx, stop
+}
+
+// The result of a build of -benchmark
+type buildBenchmark struct {
+	strategy string
+	duration time.Duration
+	size     int64
+}
+
+// Run full build of current profile with each strategy in child processes
+// whose HOME is a temporary directory, and show the time and disk usage
+func (cmd *buildCmd) doBenchmark() error {
+	voltExe, err := os.Executable()
+	if err != nil {
+		return errors.New("could not get volt executable: " + err.Error())
+	}
+	tmpdir, err := ioutil.TempDir("", "volt-benchmark-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpdir)
+
+	results := make([]buildBenchmark, 0, len(builder.Strategies()))
+	for _, strategy := range builder.Strategies() {
+		home := filepath.Join(tmpdir, strategy)
+		if err := os.MkdirAll(home, 0755); err != nil {
+			return err
+		}
+		logger.Info("Building with " + strategy + " strategy ...")
+		build := exec.Command(voltExe, "build", "-full", "-no-vimrc", "-strategy", strategy)
+		vimDir := filepath.Join(home, "vim")
+		build.Env = cmd.benchmarkEnv(home, vimDir)
+		start := time.Now()
+		out, err := build.CombinedOutput()
+		duration := time.Since(start)
+		if err != nil {
+			os.Stdout.Write(out)
+			return errors.New("build with " + strategy + " strategy failed: " + err.Error())
+		}
+		usage, err := (&duCmd{}).getUsage(strategy, filepath.Join(vimDir, "pack", pathutil.PackageName()), func(rel []string) string {
+			return rel[0]
+		})
+		if err != nil {
+			return err
+		}
+		results = append(results, buildBenchmark{strategy, duration, usage.total})
+	}
+
+	fmt.Println("strategy\ttime\tdisk usage")
+	for _, r := range results {
+		fmt.Printf("%s\t%dms\t%d bytes\n", r.strategy, int64(r.duration/time.Millisecond), r.size)
+	}
+	return nil
+}
+
+// Returns the environment variables of a build of -benchmark.
+// HOME is replaced with home, VOLT_HOME is replaced with vimDir, and VOLTPATH
+// and VOLT_PACKAGE are kept even if they were not set.
+func (*buildCmd) benchmarkEnv(home, vimDir string) []string {
+	replaced := map[string]string{
+		"HOME":         home,
+		"USERPROFILE":  home,
+		"VOLT_HOME":    vimDir,
+		"VOLTPATH":     pathutil.VoltPath(),
+		"VOLT_PACKAGE": pathutil.PackageName(),
+	}
+	env := make([]string, 0, len(os.Environ())+len(replaced))
+	for _, kv := range os.Environ() {
+		if _, exists := replaced[strings.SplitN(kv, "=", 2)[0]]; !exists {
+			env = append(env, kv)
+		}
+	}
+	for key, value := range replaced {
+		env = append(env, key+"="+value)
+	}
+	return env
 }
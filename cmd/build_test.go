@@ -2,21 +2,31 @@ package cmd
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/haya14busa/go-vimlparser"
 	"github.com/vim-volt/volt/cmd/builder"
+	"github.com/vim-volt/volt/cmd/buildinfo"
 	"github.com/vim-volt/volt/config"
 	"github.com/vim-volt/volt/fileutil"
+	"github.com/vim-volt/volt/gitutil"
 	"github.com/vim-volt/volt/internal/testutil"
 	"github.com/vim-volt/volt/lockjson"
 	"github.com/vim-volt/volt/pathutil"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
 )
 
 // Checks:
@@ -201,6 +211,38 @@ func TestErrVoltBuildT2CannotOverwriteUserVimrc(t *testing.T) {
 	checkRCInstalled(t, 1, 0, 0, -1)
 }
 
+// * Run `volt build -backup-vimrc` (A, B)
+// * (case t2) profile vimrc:exists
+//             profile gvimrc:not exist
+//             user vimrc:exists
+//             user gvimrc:not exist
+//             vimrc magic comment:not exist
+//             gvimrc magic comment:N/A (F, G, !H)
+// * User vimrc is renamed to ~/.vim/vimrc.pre-volt and its path is shown
+func TestVoltBuildT2BackupUserVimrc(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+
+	installProfileRC(t, "default", "vimrc-nomagic.vim", pathutil.ProfileVimrc)
+	installVimRC(t, "vimrc-nomagic.vim", pathutil.Vimrc)
+
+	// =============== run =============== //
+
+	out, err := testutil.RunVolt("build", "-backup-vimrc")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+
+	// (F, G, !H)
+	checkRCInstalled(t, 1, 1, 0, -1)
+
+	backup := filepath.Join(pathutil.VimDir(), pathutil.Vimrc+".pre-volt")
+	checkRCUnchanged(t, "vimrc-nomagic.vim", pathutil.Vimrc+".pre-volt")
+	if !strings.Contains(string(out), backup) {
+		t.Errorf("expected the backup path %s is shown but got: %s", backup, string(out))
+	}
+}
+
 // * Run `volt build` (!A, !B)
 // * (case t2) profile vimrc:not exist
 //             profile gvimrc:exists
@@ -477,6 +519,105 @@ func TestVoltBuildT4NoVimrcGvimrc(t *testing.T) {
 	checkRCInstalled(t, 0, -1, 0, -1)
 }
 
+// * Run `volt build -no-vimrc` (A, B)
+// * (case t2) profile vimrc:exists
+//             profile gvimrc:exists
+//             user vimrc:exists
+//             user gvimrc:exists
+//             vimrc magic comment:not exist
+//             gvimrc magic comment:not exist (F, !G, H, !I)
+func TestVoltBuildNoVimrcKeepsUserVimrcGvimrc(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+
+	installProfileRC(t, "default", "vimrc-nomagic.vim", pathutil.ProfileVimrc)
+	installProfileRC(t, "default", "gvimrc-nomagic.vim", pathutil.ProfileGvimrc)
+	installVimRC(t, "vimrc-nomagic.vim", pathutil.Vimrc)
+	installVimRC(t, "gvimrc-nomagic.vim", pathutil.Gvimrc)
+
+	// =============== run =============== //
+
+	out, err := testutil.RunVolt("build", "-no-vimrc")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+
+	// (F, !G, H, !I)
+	checkRCInstalled(t, 1, 0, 1, 0)
+	checkRCUnchanged(t, "vimrc-nomagic.vim", pathutil.Vimrc)
+	checkRCUnchanged(t, "gvimrc-nomagic.vim", pathutil.Gvimrc)
+}
+
+// * Run `volt build -no-vimrc` (A, B)
+// * (case t3) profile vimrc:not exist
+//             profile gvimrc:not exist
+//             user vimrc:exists
+//             user gvimrc:exists
+//             vimrc magic comment:exists
+//             gvimrc magic comment:exists (F, G, H, I)
+func TestVoltBuildNoVimrcDoesNotRemoveUserVimrcGvimrc(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+
+	installVimRC(t, "vimrc-magic.vim", pathutil.Vimrc)
+	installVimRC(t, "gvimrc-magic.vim", pathutil.Gvimrc)
+
+	// =============== run =============== //
+
+	out, err := testutil.RunVolt("build", "-no-vimrc")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+
+	// (F, G, H, I)
+	checkRCInstalled(t, 1, 1, 1, 1)
+	checkRCUnchanged(t, "vimrc-magic.vim", pathutil.Vimrc)
+	checkRCUnchanged(t, "gvimrc-magic.vim", pathutil.Gvimrc)
+}
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) The user vimrc which has the default magic comment is overwritten
+// (b) The installed vimrc starts with build.magic_comment whose "{version}" is replaced
+// (c) The installed vimrc which has build.magic_comment is overwritten
+//
+// * Run `volt build` (user vimrc: has the default magic comment) (A, B, a, b)
+// * Run `volt build` again (A, B, b, c)
+// * Run `volt build` (build.magic_comment: not a Vim comment) (!B)
+func TestVoltBuildMagicComment(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	installConfigContent(t, "[build]\nmagic_comment = '\" Generated by volt {version}'\n")
+	installProfileRC(t, "default", "vimrc-nomagic.vim", pathutil.ProfileVimrc)
+	installVimRC(t, "vimrc-magic.vim", pathutil.Vimrc)
+
+	expected := "\" Generated by volt " + voltVersion + "\n"
+	vimrc := filepath.Join(pathutil.VimDir(), pathutil.Vimrc)
+
+	// =============== run =============== //
+
+	for i := 0; i < 2; i++ {
+		out, err := testutil.RunVolt("build")
+		// (A, B)
+		testutil.SuccessExit(t, out, err)
+		// (a, b, c)
+		content, err := ioutil.ReadFile(vimrc)
+		if err != nil {
+			t.Fatal("failed to read " + vimrc + ": " + err.Error())
+		}
+		if !strings.HasPrefix(string(content), expected) {
+			t.Errorf("expected %s starts with %q but got: %s", vimrc, expected, string(content))
+		}
+	}
+
+	installConfigContent(t, "[build]\nmagic_comment = 'generated by volt'\n")
+	out, err := testutil.RunVolt("build")
+	// (!B)
+	testutil.FailExit(t, out, err)
+}
+
 // ===========================================================
 
 // * Run `volt build` (repos: exists, vim repos: not exist) (git repository)
@@ -777,186 +918,3612 @@ func voltBuildStaticVimDirNewer(t *testing.T, full bool, strategy string) {
 	checkSyntax(t, bundledPlugconf)
 }
 
-// ============================================
-
-func testBuildMatrix(t *testing.T, f func(*testing.T, bool, string)) {
+// Checks:
+// (a) plugconf shipped with the repository is used when user's plugconf does not exist
+// (b) user's plugconf is used when both exist
+//
+// * Run `volt build` (plugconf: shipped with repository) (A, B, a)
+// * Run `volt build` (plugconf: shipped with repository and user's one) (A, B, b)
+func TestVoltBuildReposPlugconf(t *testing.T) {
 	for _, strategy := range testutil.AvailableStrategies() {
-		for _, full := range []bool{false, true} {
-			t.Run(fmt.Sprintf("full=%v,strategy=%v", full, strategy), func(t *testing.T) {
-				f(t, full, strategy)
-			})
-		}
+		t.Run("strategy="+strategy, func(t *testing.T) {
+			// =============== setup =============== //
+
+			testutil.SetUpEnv(t)
+			reposPath := pathutil.ReposPath("localhost/local/hello")
+			teardown := testutil.SetUpRepos(t, "hello", lockjson.ReposStaticType, []pathutil.ReposPath{reposPath}, strategy)
+			defer teardown()
+			testutil.InstallConfig(t, "strategy-"+strategy+".toml")
+
+			shipped := "function! s:config()\n  let g:hello_config = 'shipped'\nendfunction\n"
+			if err := ioutil.WriteFile(pathutil.ReposPlugconf(reposPath), []byte(shipped), 0644); err != nil {
+				t.Fatal("failed to write plugconf: " + err.Error())
+			}
+
+			// =============== run =============== //
+
+			out, err := testutil.RunVolt("build")
+			// (A, B)
+			testutil.SuccessExit(t, out, err)
+			// (a)
+			checkBundledPlugconfContains(t, "let g:hello_config = 'shipped'", true)
+
+			user := "function! s:config()\n  let g:hello_config = 'user'\nendfunction\n"
+			os.MkdirAll(filepath.Dir(pathutil.Plugconf(reposPath)), 0755)
+			if err := ioutil.WriteFile(pathutil.Plugconf(reposPath), []byte(user), 0644); err != nil {
+				t.Fatal("failed to write plugconf: " + err.Error())
+			}
+
+			out, err = testutil.RunVolt("build")
+			// (A, B)
+			testutil.SuccessExit(t, out, err)
+			// (b)
+			checkBundledPlugconfContains(t, "let g:hello_config = 'user'", true)
+			checkBundledPlugconfContains(t, "let g:hello_config = 'shipped'", false)
+		})
 	}
 }
 
-func touchFiles(t *testing.T, fullpath string) {
-	t.Helper()
-	filepath.Walk(fullpath, func(path string, fi os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		var mtime time.Time
-		if st, err := os.Lstat(path); err != nil {
-			t.Errorf("os.Lstat(%q) failed: %s", path, err.Error())
-		} else {
-			mtime = st.ModTime()
+// Checks:
+// (a) Files matched by .voltignore are not installed
+// (b) Files re-included by negated pattern are installed
+//
+// * Run `volt build` (.voltignore: exists) (A, B, a, b)
+func TestVoltBuildVoltignore(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	reposPath := pathutil.ReposPath("localhost/local/hello")
+	teardown := testutil.SetUpRepos(t, "hello", lockjson.ReposStaticType, []pathutil.ReposPath{reposPath}, config.CopyBuilder)
+	defer teardown()
+	testutil.InstallConfig(t, "strategy-copy.toml")
+
+	src := pathutil.FullReposPath(reposPath)
+	for name, content := range map[string]string{
+		".voltignore":         "# comment\ntest/\n!test/keep.vim\n*.md\n",
+		"README.md":           "readme",
+		"test/test.vim":       "test",
+		"test/sub/nested.vim": "nested",
+		"test/keep.vim":       "keep",
+	} {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal("failed to write " + path)
 		}
-		atime := mtime
-		if err = os.Chtimes(path, atime, mtime); err != nil {
-			t.Errorf("failed to change timestamp %q: %s", path, err.Error())
+	}
+
+	// =============== run =============== //
+
+	out, err := testutil.RunVolt("build")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+
+	dst := pathutil.EncodeReposPath(reposPath)
+	for name, installed := range map[string]bool{
+		"plugin/hello.vim":    true,
+		"test/keep.vim":       true,  // (b)
+		".voltignore":         false, // (a)
+		"README.md":           false, // (a)
+		"test/test.vim":       false, // (a)
+		"test/sub/nested.vim": false, // (a)
+	} {
+		path := filepath.Join(dst, filepath.FromSlash(name))
+		if pathutil.Exists(path) != installed {
+			t.Errorf("expected %s is installed=%v but got %v", path, installed, !installed)
 		}
-		return nil
-	})
+	}
 }
 
-func checkBuildOutput(t *testing.T, full bool, out []byte, strategy string) {
-	t.Helper()
-	if strategy == config.SymlinkBuilder {
-		full = true // symlink builder always perform full build
-	}
-	outstr := string(out)
-	contains := strings.Contains(outstr, "Full building")
-	if !full && contains {
-		t.Errorf("expected smart build but done by full build (strategy=%s): %s", strategy, outstr)
-	} else if full && !contains {
-		t.Errorf("expected full build but done by smart build (strategy=%s): %s", strategy, outstr)
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) doc/tags does not have tags of the doc files excluded by config.toml
+// (b) doc/tags has tags of the other doc files
+// (c) The excluded doc files are still installed
+// (d) -exclude-docs-from-tags option is used instead of config.toml
+//
+// * Run `volt build` (A, B, a, b, c)
+// * Run `volt build -full -exclude-docs-from-tags localhost/local/hello=hello.txt` (A, B, d)
+func TestVoltBuildExcludeDocsFromTags(t *testing.T) {
+	for _, strategy := range testutil.AvailableStrategies() {
+		t.Run("strategy="+strategy, func(t *testing.T) {
+			// =============== setup =============== //
+
+			testutil.SetUpEnv(t)
+			reposPath := pathutil.ReposPath("localhost/local/hello")
+			teardown := testutil.SetUpRepos(t, "hello", lockjson.ReposStaticType, []pathutil.ReposPath{reposPath}, strategy)
+			defer teardown()
+			installConfigContent(t, fmt.Sprintf(`[build]
+strategy = %q
+
+[build.exclude_docs_from_tags]
+%q = ["huge*.txt"]
+`, strategy, reposPath))
+
+			src := pathutil.FullReposPath(reposPath)
+			for name, content := range map[string]string{
+				"doc/hello.txt": "*hello-tag*\n",
+				"doc/huge.txt":  "*huge-tag*\n",
+				"doc/huge2.txt": "*huge2-tag*\n",
+			} {
+				path := filepath.Join(src, filepath.FromSlash(name))
+				os.MkdirAll(filepath.Dir(path), 0755)
+				if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+					t.Fatal("failed to write " + path)
+				}
+			}
+
+			// =============== run =============== //
+
+			out, err := testutil.RunVolt("build")
+			// (A, B)
+			testutil.SuccessExit(t, out, err)
+
+			docDir := filepath.Join(pathutil.EncodeReposPath(reposPath), "doc")
+			tags, err := ioutil.ReadFile(filepath.Join(docDir, "tags"))
+			if err != nil {
+				t.Fatal("could not read doc/tags: " + err.Error())
+			}
+			// (a)
+			for _, tag := range []string{"huge-tag\t", "huge2-tag\t"} {
+				if strings.Contains(string(tags), tag) {
+					t.Errorf("doc/tags has excluded tag %q: %q", tag, string(tags))
+				}
+			}
+			// (b)
+			if !strings.Contains(string(tags), "hello-tag\thello.txt\t") {
+				t.Errorf("doc/tags does not have hello-tag: %q", string(tags))
+			}
+			// (c)
+			if !pathutil.Exists(filepath.Join(docDir, "huge.txt")) {
+				t.Errorf("%s was not installed", filepath.Join(docDir, "huge.txt"))
+			}
+
+			out, err = testutil.RunVolt("build", "-full", "-exclude-docs-from-tags", reposPath.String()+"=hello.txt")
+			// (A, B)
+			testutil.SuccessExit(t, out, err)
+
+			tags, err = ioutil.ReadFile(filepath.Join(docDir, "tags"))
+			if err != nil {
+				t.Fatal("could not read doc/tags: " + err.Error())
+			}
+			// (d)
+			if strings.Contains(string(tags), "hello-tag\t") {
+				t.Errorf("doc/tags has excluded tag %q: %q", "hello-tag", string(tags))
+			}
+			for _, tag := range []string{"huge-tag\thuge.txt\t", "huge2-tag\thuge2.txt\t"} {
+				if !strings.Contains(string(tags), tag) {
+					t.Errorf("doc/tags does not have tag %q: %q", tag, string(tags))
+				}
+			}
+		})
 	}
 }
 
-func checkCopied(t *testing.T, reposPath pathutil.ReposPath, strategy string) {
-	t.Helper()
-	vimReposDir := pathutil.EncodeReposPath(reposPath)
-	reposDir := pathutil.FullReposPath(reposPath)
-	tagsFile := filepath.Join("doc", "tags")
-	filepath.Walk(vimReposDir, func(path string, fi os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if fi.IsDir() {
-			return nil
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) doc/tags is generated
+// (b) doc/tags-{lang} of all languages are generated if build.help_languages is not set
+// (c) Only doc/tags-{lang} of build.help_languages are generated
+//
+// * Run `volt build` (A, B, a, b)
+// * Run `volt build` with `build.help_languages = ["ja"]` (A, B, a, c)
+// * Run `volt build` with `build.help_languages = []` (A, B, a, c)
+func TestVoltBuildHelpLanguages(t *testing.T) {
+	for _, strategy := range testutil.AvailableStrategies() {
+		for _, tt := range []struct {
+			config   string
+			expected map[string]bool
+		}{
+			{"", map[string]bool{"tags-ja": true, "tags-cn": true}},
+			{`help_languages = ["ja"]`, map[string]bool{"tags-ja": true, "tags-cn": false}},
+			{`help_languages = []`, map[string]bool{"tags-ja": false, "tags-cn": false}},
+		} {
+			t.Run(fmt.Sprintf("strategy=%s,config=%s", strategy, tt.config), func(t *testing.T) {
+				// =============== setup =============== //
+
+				testutil.SetUpEnv(t)
+				reposPath := pathutil.ReposPath("localhost/local/hello")
+				teardown := testutil.SetUpRepos(t, "hello", lockjson.ReposStaticType, []pathutil.ReposPath{reposPath}, strategy)
+				defer teardown()
+				installConfigContent(t, fmt.Sprintf("[build]\nstrategy = %q\n%s\n", strategy, tt.config))
+
+				src := pathutil.FullReposPath(reposPath)
+				for name, content := range map[string]string{
+					"doc/hello.txt": "*hello-tag*\n",
+					"doc/hello.jax": "*hello-ja-tag*\n",
+					"doc/hello.cnx": "*hello-cn-tag*\n",
+				} {
+					path := filepath.Join(src, filepath.FromSlash(name))
+					os.MkdirAll(filepath.Dir(path), 0755)
+					if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+						t.Fatal("failed to write " + path)
+					}
+				}
+
+				// =============== run =============== //
+
+				out, err := testutil.RunVolt("build")
+				// (A, B)
+				testutil.SuccessExit(t, out, err)
+
+				docDir := filepath.Join(pathutil.EncodeReposPath(reposPath), "doc")
+				// (a)
+				tags, err := ioutil.ReadFile(filepath.Join(docDir, "tags"))
+				if err != nil {
+					t.Fatal("could not read doc/tags: " + err.Error())
+				}
+				if !strings.Contains(string(tags), "hello-tag\thello.txt\t") {
+					t.Errorf("doc/tags does not have hello-tag: %q", string(tags))
+				}
+				// (b, c)
+				for name, generated := range tt.expected {
+					if pathutil.Exists(filepath.Join(docDir, name)) != generated {
+						t.Errorf("expected doc/%s is generated=%v but got %v", name, generated, !generated)
+					}
+				}
+				if tt.expected["tags-ja"] {
+					tagsJa, err := ioutil.ReadFile(filepath.Join(docDir, "tags-ja"))
+					if err != nil {
+						t.Fatal("could not read doc/tags-ja: " + err.Error())
+					}
+					if !strings.Contains(string(tagsJa), "hello-ja-tag\thello.jax\t") {
+						t.Errorf("doc/tags-ja does not have hello-ja-tag: %q", string(tagsJa))
+					}
+				}
+			})
 		}
+	}
+}
 
-		// symlinks should not be copied
-		if strategy != config.SymlinkBuilder && fi.Mode()&os.ModeSymlink != 0 {
-			t.Error("symlinks are copied: " + path)
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) Hidden files and directories are not installed
+// (b) The other files are installed
+// (c) Hidden files are installed
+//
+// * Run `volt build -no-hidden` (A, B, a, b)
+// * Run `volt build -no-hidden` again (A, B, a, b)
+// * Run `volt build -full` (A, B, b, c)
+// * Run `volt build -full` with `build.no_hidden = true` and the repository in `build.keep_hidden` (A, B, b, c)
+// * Run `volt build -full` with `build.no_hidden = true` (A, B, a, b)
+func TestVoltBuildNoHidden(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	reposPath := pathutil.ReposPath("localhost/local/hello")
+	teardown := testutil.SetUpRepos(t, "hello", lockjson.ReposStaticType, []pathutil.ReposPath{reposPath}, config.CopyBuilder)
+	defer teardown()
+	testutil.InstallConfig(t, "strategy-copy.toml")
+
+	src := pathutil.FullReposPath(reposPath)
+	hiddenFiles := []string{".editorconfig", ".github/workflows/ci.yml"}
+	for _, name := range hiddenFiles {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte("hidden\n"), 0644); err != nil {
+			t.Fatal("failed to write " + path)
 		}
-		rel, err := filepath.Rel(vimReposDir, path)
-		if err != nil {
-			t.Errorf("failed to get relative path of %s: %s", rel, err.Error())
+	}
+	dst := pathutil.EncodeReposPath(reposPath)
+	checkHidden := func(installed bool) {
+		t.Helper()
+		// (a), (c)
+		for _, name := range hiddenFiles {
+			if pathutil.Exists(filepath.Join(dst, filepath.FromSlash(name))) != installed {
+				t.Errorf("expected %s installed=%v", name, installed)
+			}
 		}
-		// doc/tags is created after copy
-		if rel == tagsFile {
-			return nil
+		if pathutil.Exists(filepath.Join(dst, ".github")) != installed {
+			t.Errorf("expected .github/ installed=%v", installed)
 		}
-		// .git, .gitignore should not be copied
-		if rel == ".git" || rel == ".gitignore" {
-			t.Error(".git or .gitignore are copied: " + rel)
+		// (b)
+		if !pathutil.Exists(filepath.Join(dst, "plugin", "hello.vim")) {
+			t.Error("plugin/hello.vim was not installed")
 		}
+	}
 
-		reposFile := filepath.Join(reposDir, rel)
-		if strategy != config.SymlinkBuilder && !sameFile(t, path, reposFile) {
-			t.Errorf("%s and %s are not same", rel, reposFile)
-		}
-		return nil
-	})
-}
+	// =============== run =============== //
 
-func sameFile(t *testing.T, f1, f2 string) bool {
-	t.Helper()
-	fi1, err := os.Lstat(f1)
-	if err != nil {
-		t.Errorf("os.Lstat(%q) returned error: %s", f1, err.Error())
-	}
-	fi2, err := os.Lstat(f2)
-	if err != nil {
-		t.Errorf("os.Lstat(%q) returned error: %s", f2, err.Error())
-	}
-	// Compare metadata
-	if os.SameFile(fi1, fi2) {
-		return true
-	}
-	// Compare content
-	b1, err := ioutil.ReadFile(f1)
-	if err != nil {
-		t.Errorf("cannot read %s: %s", f1, err.Error())
-	}
-	b2, err := ioutil.ReadFile(f2)
-	if err != nil {
-		t.Errorf("cannot read %s: %s", f2, err.Error())
+	for _, args := range [][]string{{"build", "-no-hidden"}, {"build", "-no-hidden"}} {
+		out, err := testutil.RunVolt(args...)
+		// (A, B)
+		testutil.SuccessExit(t, out, err)
+		checkHidden(false)
 	}
-	return bytes.Equal(b1, b2)
+
+	out, err := testutil.RunVolt("build", "-full")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	checkHidden(true)
+
+	installConfigContent(t, fmt.Sprintf(`[build]
+strategy = "copy"
+no_hidden = true
+keep_hidden = [%q]
+`, reposPath))
+	out, err = testutil.RunVolt("build", "-full")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	checkHidden(true)
+
+	installConfigContent(t, `[build]
+strategy = "copy"
+no_hidden = true
+`)
+	out, err = testutil.RunVolt("build", "-full")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	checkHidden(false)
 }
 
-func installProfileRC(t *testing.T, profileName, srcName, dstName string) {
-	t.Helper()
-	src := filepath.Join(testutil.TestdataDir(), "rc", srcName)
-	dst := filepath.Join(pathutil.RCDir(profileName), dstName)
-	os.MkdirAll(filepath.Dir(dst), 0777)
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) Repositories are installed in the order of installed directory names
+// (b) The messages of installed repositories have the progress like "[1/5]"
+//
+// * Run `volt build -full -no-parallel` (A, B, a, b)
+func TestVoltBuildNoParallel(t *testing.T) {
+	for _, strategy := range testutil.AvailableStrategies() {
+		t.Run("strategy="+strategy, func(t *testing.T) {
+			// =============== setup =============== //
+
+			testutil.SetUpEnv(t)
+			testutil.InstallConfig(t, "strategy-"+strategy+".toml")
+			reposPathList := []pathutil.ReposPath{
+				"localhost/local/charlie", "localhost/local/alpha", "localhost/local/echo",
+				"localhost/local/bravo", "localhost/local/delta",
+			}
+			args := []string{"get"}
+			for _, reposPath := range reposPathList {
+				path := filepath.Join(pathutil.FullReposPath(reposPath), "plugin", "foo.vim")
+				os.MkdirAll(filepath.Dir(path), 0755)
+				if err := ioutil.WriteFile(path, []byte("\" foo\n"), 0644); err != nil {
+					t.Fatal("failed to write " + path)
+				}
+				args = append(args, reposPath.String())
+			}
+			out, err := testutil.RunVolt(args...)
+			testutil.SuccessExit(t, out, err)
+
+			// =============== run =============== //
+
+			out, err = testutil.RunVolt("build", "-full", "-no-parallel")
+			// (A, B)
+			testutil.SuccessExit(t, out, err)
+
+			// (a)
+			var installed []string
+			for _, line := range strings.Split(string(out), "\n") {
+				if strings.Contains(line, "Installing static repository ") {
+					installed = append(installed, line)
+				}
+			}
+			expected := []string{"alpha", "bravo", "charlie", "delta", "echo"}
+			if len(installed) != len(expected) {
+				t.Fatalf("expected %d repositories installed but got:\n%s", len(expected), string(out))
+			}
+			for i := range expected {
+				if !strings.Contains(installed[i], "localhost/local/"+expected[i]+" ") {
+					t.Errorf("expected %s at %d but got: %s", expected[i], i, installed[i])
+				}
+				// (b)
+				if progress := fmt.Sprintf("[%d/%d] ", i+1, len(expected)); !strings.Contains(installed[i], progress) {
+					t.Errorf("expected %q at %d but got: %s", progress, i, installed[i])
+				}
+			}
+		})
+	}
+}
+
+// Checks:
+// (A) Shows `[WARN]` message about the missing repository
+// (B) Exit with zero status
+// (a) The other repositories are installed
+// (b) The missing repository is not installed nor loaded by bundled plugconf
+//
+// * Run `volt build` (!B)
+// * Run `volt build -skip-missing` (A, B, a, b)
+func TestVoltBuildSkipMissing(t *testing.T) {
+	for _, strategy := range testutil.AvailableStrategies() {
+		t.Run("strategy="+strategy, func(t *testing.T) {
+			// =============== setup =============== //
+
+			testutil.SetUpEnv(t)
+			testutil.InstallConfig(t, "strategy-"+strategy+".toml")
+			present := []pathutil.ReposPath{"localhost/local/alpha", "localhost/local/bravo"}
+			missing := pathutil.ReposPath("localhost/local/missing")
+			args := []string{"get"}
+			for _, reposPath := range append(present, missing) {
+				path := filepath.Join(pathutil.FullReposPath(reposPath), "plugin", "foo.vim")
+				os.MkdirAll(filepath.Dir(path), 0755)
+				if err := ioutil.WriteFile(path, []byte("\" foo\n"), 0644); err != nil {
+					t.Fatal("failed to write " + path)
+				}
+				args = append(args, reposPath.String())
+			}
+			out, err := testutil.RunVolt(args...)
+			testutil.SuccessExit(t, out, err)
+			os.RemoveAll(pathutil.FullReposPath(missing))
+
+			// =============== run =============== //
+
+			out, err = testutil.RunVolt("build", "-full")
+			// (!B)
+			testutil.FailExit(t, out, err)
+
+			out, err = testutil.RunVolt("build", "-full", "-skip-missing")
+			// (A)
+			expected := "[WARN] Skipped 1 repositories whose source does not exist: " + missing.String()
+			if !strings.Contains(string(out), expected) {
+				t.Errorf("expected %q but got: %s", expected, string(out))
+			}
+			// (B)
+			if err != nil {
+				t.Error("expected success exit but exited with failure: " + err.Error())
+			}
+			// (a)
+			for _, reposPath := range present {
+				if !pathutil.Exists(pathutil.EncodeReposPath(reposPath)) {
+					t.Errorf("%s was not installed", reposPath)
+				}
+			}
+			// (b)
+			if pathutil.Exists(pathutil.EncodeReposPath(missing)) {
+				t.Errorf("%s was installed", missing)
+			}
+			content, err := ioutil.ReadFile(pathutil.BundledPlugConf())
+			if err != nil {
+				t.Fatal("failed to read bundled plugconf: " + err.Error())
+			}
+			if strings.Contains(string(content), filepath.Base(pathutil.EncodeReposPath(missing))) {
+				t.Errorf("bundled plugconf loads %s:\n%s", missing, string(content))
+			}
+		})
+	}
+}
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) Repositories and bundled plugconf are installed under the package name
+// (b) Nothing is installed under the default package
+//
+// * Run `volt get` with build.package_name = "myvolt" (A, B, a, b)
+// * Run `volt build -full` with VOLT_PACKAGE=yourvolt (A, B, a, b)
+// * Run `volt build` with VOLT_PACKAGE=../evil (!B)
+func TestVoltBuildPackageName(t *testing.T) {
+	for _, strategy := range testutil.AvailableStrategies() {
+		t.Run("strategy="+strategy, func(t *testing.T) {
+			// =============== setup =============== //
+
+			testutil.SetUpEnv(t)
+			installConfigContent(t, "[build]\nstrategy = \""+strategy+"\"\npackage_name = \"myvolt\"\n")
+			reposPath := pathutil.ReposPath("localhost/local/hello")
+			path := filepath.Join(pathutil.FullReposPath(reposPath), "plugin", "hello.vim")
+			os.MkdirAll(filepath.Dir(path), 0755)
+			if err := ioutil.WriteFile(path, []byte("\" hello\n"), 0644); err != nil {
+				t.Fatal("failed to write " + path)
+			}
+			defer os.Unsetenv("VOLT_PACKAGE")
+
+			for _, name := range []string{"myvolt", "yourvolt"} {
+				// =============== run =============== //
+
+				var out []byte
+				var err error
+				if name == "myvolt" {
+					out, err = testutil.RunVolt("get", reposPath.String())
+				} else {
+					os.Setenv("VOLT_PACKAGE", name)
+					out, err = testutil.RunVolt("build", "-full")
+				}
+				// (A, B)
+				testutil.SuccessExit(t, out, err)
+
+				// (a)
+				pkgDir := filepath.Join(pathutil.VimDir(), "pack", name)
+				encoded := filepath.Base(pathutil.EncodeReposPath(reposPath))
+				for _, p := range []string{
+					filepath.Join(pkgDir, "opt", encoded, "plugin", "hello.vim"),
+					filepath.Join(pkgDir, "start", "system", "plugin", "bundled_plugconf.vim"),
+					filepath.Join(pkgDir, "build-info.json"),
+				} {
+					if !pathutil.Exists(p) {
+						t.Errorf("%s does not exist", p)
+					}
+				}
+				// (b)
+				if defaultDir := filepath.Join(pathutil.VimDir(), "pack", pathutil.DefaultPackageName); pathutil.Exists(defaultDir) {
+					t.Errorf("%s exists", defaultDir)
+				}
+			}
+
+			os.Setenv("VOLT_PACKAGE", "../evil")
+			out, err := testutil.RunVolt("build")
+			// (!B)
+			testutil.FailExit(t, out, err)
+		})
+	}
+}
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) Repositories, bundled plugconf and vimrc are installed under VOLT_HOME
+// (b) Nothing is installed under the default vim directory
+//
+// * Run `volt build -full` with VOLT_HOME (A, B, a, b)
+func TestVoltBuildVoltHome(t *testing.T) {
+	for _, strategy := range testutil.AvailableStrategies() {
+		t.Run("strategy="+strategy, func(t *testing.T) {
+			// =============== setup =============== //
+
+			testutil.SetUpEnv(t)
+			testutil.InstallConfig(t, "strategy-"+strategy+".toml")
+			installProfileRC(t, "default", "vimrc-nomagic.vim", pathutil.ProfileVimrc)
+			reposPath := pathutil.ReposPath("localhost/local/hello")
+			path := filepath.Join(pathutil.FullReposPath(reposPath), "plugin", "hello.vim")
+			os.MkdirAll(filepath.Dir(path), 0755)
+			if err := ioutil.WriteFile(path, []byte("\" hello\n"), 0644); err != nil {
+				t.Fatal("failed to write " + path)
+			}
+			out, err := testutil.RunVolt("get", reposPath.String())
+			testutil.SuccessExit(t, out, err)
+			defaultVimDir := pathutil.VimDir()
+			os.RemoveAll(defaultVimDir)
+
+			voltHome := filepath.Join(pathutil.VoltPath(), "xdg", "vim")
+			defer os.Unsetenv("VOLT_HOME")
+			os.Setenv("VOLT_HOME", voltHome)
+
+			// =============== run =============== //
+
+			out, err = testutil.RunVolt("build", "-full")
+			// (A, B)
+			testutil.SuccessExit(t, out, err)
+
+			// (a)
+			pkgDir := filepath.Join(voltHome, "pack", pathutil.DefaultPackageName)
+			for _, p := range []string{
+				filepath.Join(pkgDir, "opt", filepath.Base(pathutil.EncodeReposPath(reposPath)), "plugin", "hello.vim"),
+				filepath.Join(pkgDir, "start", "system", "plugin", "bundled_plugconf.vim"),
+				filepath.Join(pkgDir, "build-info.json"),
+				filepath.Join(voltHome, pathutil.Vimrc),
+			} {
+				if !pathutil.Exists(p) {
+					t.Errorf("%s does not exist", p)
+				}
+			}
+			// (b)
+			if pathutil.Exists(defaultVimDir) {
+				t.Errorf("%s exists", defaultVimDir)
+			}
+		})
+	}
+}
+
+// Checks:
+// (A) Shows `[WARN]` message about the damaged repository
+// (B) Exit with zero status
+// (a) The damaged file is copied again though the repository is not changed
+// (b) The repository is not copied again when it is not damaged
+// (c) The file modified without changing its size is copied again
+//
+// * Run `volt build` (b)
+// * Run `volt build` after truncating an installed file (A, B, a)
+// * Run `volt build` after modifying an installed file in the same size (A, B, c)
+func TestVoltBuildRecopiesDamagedRepos(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	reposPath := pathutil.ReposPath("localhost/local/hello")
+	teardown := testutil.SetUpRepos(t, "hello", lockjson.ReposStaticType, []pathutil.ReposPath{reposPath}, config.CopyBuilder)
+	defer teardown()
+	testutil.InstallConfig(t, "strategy-copy.toml")
+
+	// Make the repository older than build-info.json
+	// so that the repository is regarded as unchanged
+	past := time.Now().Add(-time.Hour)
+	err := filepath.Walk(pathutil.FullReposPath(reposPath), func(path string, _ os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Chtimes(path, past, past)
+	})
+	if err != nil {
+		t.Fatal("failed to change mtime: " + err.Error())
+	}
+
+	out, err := testutil.RunVolt("build")
+	testutil.SuccessExit(t, out, err)
+
+	// Not damaged yet
+	out, err = testutil.RunVolt("build")
+	testutil.SuccessExit(t, out, err)
+	if !strings.Contains(string(out), "(1 repositories are up to date)") {
+		t.Errorf("expected the repository is not copied again but got: %s", string(out))
+	}
+
+	// Truncate the installed file as if the previous build crashed.
+	// Remove it first not to truncate hard-linked source file.
+	src := filepath.Join(pathutil.FullReposPath(reposPath), "plugin", "hello.vim")
+	dst := filepath.Join(pathutil.EncodeReposPath(reposPath), "plugin", "hello.vim")
+	if err := os.Remove(dst); err != nil {
+		t.Fatal("failed to remove " + dst)
+	}
+	if err := ioutil.WriteFile(dst, []byte("\"trunc"), 0644); err != nil {
+		t.Fatal("failed to write " + dst)
+	}
+
+	// =============== run =============== //
+
+	out, err = testutil.RunVolt("build")
+	// (A)
+	if !strings.Contains(string(out), "[WARN]") || !strings.Contains(string(out), "damaged") {
+		t.Errorf("expected warning about damaged repository but got: %s", string(out))
+	}
+	// (B)
+	if err != nil {
+		t.Error("expected success exit but exited with failure: " + err.Error())
+	}
+	// (a)
+	srcContent, err := ioutil.ReadFile(src)
+	if err != nil {
+		t.Fatal("failed to read " + src)
+	}
+	dstContent, err := ioutil.ReadFile(dst)
+	if err != nil {
+		t.Fatal("failed to read " + dst)
+	}
+	if string(dstContent) != string(srcContent) {
+		t.Errorf("expected %q but got %q", string(srcContent), string(dstContent))
+	}
+
+	if err := os.Remove(dst); err != nil {
+		t.Fatal("failed to remove " + dst)
+	}
+	if err := ioutil.WriteFile(dst, []byte(strings.Repeat("x", len(srcContent))), 0644); err != nil {
+		t.Fatal("failed to write " + dst)
+	}
+
+	out, err = testutil.RunVolt("build")
+	// (A)
+	if !strings.Contains(string(out), "[WARN]") || !strings.Contains(string(out), "damaged") {
+		t.Errorf("expected warning about damaged repository but got: %s", string(out))
+	}
+	// (B)
+	if err != nil {
+		t.Error("expected success exit but exited with failure: " + err.Error())
+	}
+	// (c)
+	dstContent, err = ioutil.ReadFile(dst)
+	if err != nil {
+		t.Fatal("failed to read " + dst)
+	}
+	if string(dstContent) != string(srcContent) {
+		t.Errorf("expected %q but got %q", string(srcContent), string(dstContent))
+	}
+}
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) The repository which commits doc/tags is not copied again when it is
+//     not changed though ":helptags" re-generated doc/tags
+//
+// * Run `volt build` (A, B)
+// * Run `volt build` again (A, B, a)
+func TestVoltBuildCommittedHelptagsIsNotDamaged(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	testutil.InstallConfig(t, "strategy-copy.toml")
+	reposPath := pathutil.ReposPath("localhost/local/committed-tags")
+	hash := setUpMonorepo(t, reposPath, []string{"doc/hello.txt", "doc/tags", "plugin/hello.vim"})
+	addGitReposToLockJSON(t, reposPath, hash)
+
+	out, err := testutil.RunVolt("build")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+
+	// =============== run =============== //
+
+	out, err = testutil.RunVolt("build")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	// (a)
+	if !strings.Contains(string(out), "(1 repositories are up to date)") {
+		t.Errorf("expected the repository is not copied again but got: %s", string(out))
+	}
+}
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) "default_build" in lock.json is used instead of config.toml
+// (b) -strategy option is used instead of "default_build" in lock.json
+//
+// * Run `volt build` (A, B, a)
+// * Run `volt build -strategy symlink` (A, B, b)
+func TestVoltBuildDefaultBuild(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	reposPath := pathutil.ReposPath("localhost/local/hello")
+	teardown := testutil.SetUpRepos(t, "hello", lockjson.ReposStaticType, []pathutil.ReposPath{reposPath}, config.SymlinkBuilder)
+	defer teardown()
+	testutil.InstallConfig(t, "strategy-symlink.toml")
+
+	lockJSON, err := lockjson.Read()
+	if err != nil {
+		t.Fatal("lockjson.Read() failed: " + err.Error())
+	}
+	lockJSON.DefaultBuild = config.CopyBuilder
+	if err := lockJSON.Write(); err != nil {
+		t.Fatal("lockJSON.Write() failed: " + err.Error())
+	}
+
+	// =============== run =============== //
+
+	out, err := testutil.RunVolt("build")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	// (a)
+	checkBuildStrategy(t, reposPath, config.CopyBuilder)
+
+	out, err = testutil.RunVolt("build", "-strategy", config.SymlinkBuilder)
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	// (b)
+	checkBuildStrategy(t, reposPath, config.SymlinkBuilder)
+}
+
+func checkBuildStrategy(t *testing.T, reposPath pathutil.ReposPath, strategy string) {
+	t.Helper()
+	buildInfo, err := buildinfo.Read()
+	if err != nil {
+		t.Fatal("buildinfo.Read() failed: " + err.Error())
+	}
+	if buildInfo.Strategy != strategy {
+		t.Errorf("expected strategy %q but got %q", strategy, buildInfo.Strategy)
+	}
+	fi, err := os.Lstat(pathutil.EncodeReposPath(reposPath))
+	if err != nil {
+		t.Fatal("failed to stat installed repository: " + err.Error())
+	}
+	isSymlink := fi.Mode()&os.ModeSymlink != 0
+	if isSymlink != (strategy == config.SymlinkBuilder) {
+		t.Errorf("expected %s strategy but installed repository mode is %s", strategy, fi.Mode())
+	}
+}
+
+// Checks:
+// (A) Shows `[WARN]` messages about unsatisfied requirements
+// (B) Exit with zero status
+// (a) Satisfied requirements are not shown
+//
+// * Run `volt build` (A, B, a)
+// * Run `volt build -strict` (!B)
+func TestVoltBuildRequirements(t *testing.T) {
+	for _, strategy := range testutil.AvailableStrategies() {
+		t.Run("strategy="+strategy, func(t *testing.T) {
+			// =============== setup =============== //
+
+			testutil.SetUpEnv(t)
+			reposPath := pathutil.ReposPath("localhost/local/hello")
+			teardown := testutil.SetUpRepos(t, "hello", lockjson.ReposStaticType, []pathutil.ReposPath{reposPath}, strategy)
+			defer teardown()
+			testutil.InstallConfig(t, "strategy-"+strategy+".toml")
+
+			plugconfPath := pathutil.Plugconf(reposPath)
+			os.MkdirAll(filepath.Dir(plugconfPath), 0755)
+			content := "function! s:requires()\n  return ['+lua', '+python3', 'vim>=8.0.1000', 'vim>=8.1']\nendfunction\n"
+			if err := ioutil.WriteFile(plugconfPath, []byte(content), 0644); err != nil {
+				t.Fatal("failed to write " + plugconfPath)
+			}
+
+			// Fake vim executable which does not have +python3
+			fakeVim := filepath.Join(os.Getenv("HOME"), "fake-vim")
+			version := "VIM - Vi IMproved 8.0\nIncluded patches: 1-1000\nHuge version without GUI.  Features included (+) or not (-):\n+lua +packages -python3\n"
+			if err := ioutil.WriteFile(fakeVim, []byte("#!/bin/sh\nprintf '"+version+"'\n"), 0755); err != nil {
+				t.Fatal("failed to write " + fakeVim)
+			}
+			os.Setenv("VOLT_VIM", fakeVim)
+			defer os.Unsetenv("VOLT_VIM")
+
+			// =============== run =============== //
+
+			out, err := testutil.RunVolt("build")
+			// (A)
+			for _, requirement := range []string{"+python3", "vim>=8.1"} {
+				expected := "[WARN] localhost/local/hello requires " + requirement
+				if !strings.Contains(string(out), expected) {
+					t.Errorf("expected %q but got: %s", expected, string(out))
+				}
+			}
+			// (B)
+			if err != nil {
+				t.Error("expected success exit but exited with failure: " + err.Error())
+			}
+			// (a)
+			for _, requirement := range []string{"+lua", "vim>=8.0.1000"} {
+				if strings.Contains(string(out), "requires "+requirement) {
+					t.Errorf("satisfied requirement %q was shown: %s", requirement, string(out))
+				}
+			}
+
+			out, err = testutil.RunVolt("build", "-strict")
+			// (!B)
+			testutil.FailExit(t, out, err)
+			if !strings.Contains(string(out), "localhost/local/hello requires +python3") {
+				t.Errorf("expected error about +python3 but got: %s", string(out))
+			}
+		})
+	}
+}
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (C) Shows `[WARN]` message
+// (a) The version of vim is recorded to build-info.json
+// (b) 'volt status' shows the major version change of vim
+// (c) Full build is done if the major version of vim was changed
+// (d) Minor version change of vim is not shown
+// (e) build-info.json without the version of vim is tolerated
+//
+// * Run `volt build` (A, B, a)
+// * Run `volt status` and `volt build` with newer major version of vim (C, B, a, b, c)
+// * Run `volt status` and `volt build` with newer minor version of vim (A, B, a, d)
+// * Run `volt status` and `volt build` without vim_version in build-info.json (A, B, a, e)
+func TestVoltBuildVimVersion(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	reposPath := pathutil.ReposPath("localhost/local/hello")
+	teardown := testutil.SetUpRepos(t, "hello", lockjson.ReposStaticType, []pathutil.ReposPath{reposPath}, config.CopyBuilder)
+	defer teardown()
+	testutil.InstallConfig(t, "strategy-copy.toml")
+	// Remove ~/.vim/pack/volt which was built by real vim
+	if err := os.RemoveAll(pathutil.VimVoltDir()); err != nil {
+		t.Fatal("failed to remove " + pathutil.VimVoltDir())
+	}
+
+	fakeVim := filepath.Join(os.Getenv("HOME"), "fake-vim")
+	setVimVersion := func(major, minor int) {
+		t.Helper()
+		version := fmt.Sprintf("VIM - Vi IMproved %d.%d\nIncluded patches: 1-100\n", major, minor)
+		if err := ioutil.WriteFile(fakeVim, []byte("#!/bin/sh\nprintf '"+version+"'\n"), 0755); err != nil {
+			t.Fatal("failed to write " + fakeVim)
+		}
+	}
+	checkVimVersion := func(expected string) {
+		t.Helper()
+		buildInfo, err := buildinfo.Read()
+		if err != nil {
+			t.Fatal("buildinfo.Read() failed: " + err.Error())
+		}
+		if buildInfo.VimVersion != expected {
+			t.Errorf("expected vim_version %q but got %q", expected, buildInfo.VimVersion)
+		}
+	}
+	os.Setenv("VOLT_VIM", fakeVim)
+	defer os.Unsetenv("VOLT_VIM")
+
+	// =============== run =============== //
+
+	setVimVersion(8, 2)
+	out, err := testutil.RunVolt("build")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	// (a)
+	checkVimVersion("vim 8.2.100")
+
+	setVimVersion(9, 0)
+	out, err = testutil.RunVolt("status")
+	// (b)
+	if expected := "vim: vim 8.2.100 -> vim 9.0.100\n"; err == nil || !strings.Contains(string(out), expected) {
+		t.Errorf("expected %q and non-zero status but got %v: %s", expected, err, string(out))
+	}
+	out, err = testutil.RunVolt("build")
+	// (C, B, c)
+	if err != nil {
+		t.Error("expected success exit but exited with failure: " + err.Error())
+	}
+	if expected := "[WARN] " + pathutil.VimVoltDir() + " was built by vim 8.2.100, but current vim is vim 9.0.100. Full building ..."; !strings.Contains(string(out), expected) {
+		t.Errorf("expected %q but got: %s", expected, string(out))
+	}
+	// (a)
+	checkVimVersion("vim 9.0.100")
+
+	setVimVersion(9, 1)
+	out, err = testutil.RunVolt("status")
+	// (A, B, d)
+	testutil.SuccessExit(t, out, err)
+	out, err = testutil.RunVolt("build")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+
+	// Remove vim_version from build-info.json
+	buildInfo, err := buildinfo.Read()
+	if err != nil {
+		t.Fatal("buildinfo.Read() failed: " + err.Error())
+	}
+	buildInfo.VimVersion = ""
+	if err := buildInfo.Write(); err != nil {
+		t.Fatal("buildInfo.Write() failed: " + err.Error())
+	}
+	setVimVersion(10, 0)
+	out, err = testutil.RunVolt("status")
+	// (A, B, e)
+	testutil.SuccessExit(t, out, err)
+	out, err = testutil.RunVolt("build", "-full")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	// (a)
+	checkVimVersion("vim 10.0.100")
+}
+
+// Checks:
+// (A) Shows `[ERROR]` message
+// (B) Exit with non-zero status
+// (a) All independent problems are reported at once
+// (b) ~/.vim/pack/volt is not modified
+//
+// * Run `volt build` (missing repository, plugconf parse error, no magic comment in vimrc) (A, B, a, b)
+// * Run `volt build -full` (missing repository, plugconf parse error, no magic comment in vimrc) (A, B, a, b)
+func TestErrVoltBuildPreflight(t *testing.T) {
+	testutil.DefaultMatrix(t, func(t *testing.T, full bool, strategy string) {
+		// =============== setup =============== //
+
+		testutil.SetUpEnv(t)
+		reposPath := pathutil.ReposPath("localhost/local/hello")
+		teardown := testutil.SetUpRepos(t, "hello", lockjson.ReposStaticType, []pathutil.ReposPath{reposPath}, strategy)
+		defer teardown()
+		testutil.InstallConfig(t, "strategy-"+strategy+".toml")
+
+		out, err := testutil.RunVolt("build")
+		testutil.SuccessExit(t, out, err)
+
+		// Add the repository which does not exist
+		missing := pathutil.ReposPath("localhost/local/missing")
+		lockJSON, err := lockjson.Read()
+		if err != nil {
+			t.Fatal("lockjson.Read() failed: " + err.Error())
+		}
+		lockJSON.Repos = append(lockJSON.Repos, lockjson.Repos{Type: lockjson.ReposStaticType, Path: missing})
+		profile, err := lockJSON.Profiles.FindByName(lockJSON.CurrentProfileName)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		profile.ReposPath = append(profile.ReposPath, missing)
+		if err := lockJSON.Write(); err != nil {
+			t.Fatal("lockJSON.Write() failed: " + err.Error())
+		}
+
+		// Make plugconf parse error
+		plugconfPath := pathutil.Plugconf(reposPath)
+		os.MkdirAll(filepath.Dir(plugconfPath), 0755)
+		invalid := "function! s:loaded_on()\n  return 'invalid'\nendfunction\n"
+		if err := ioutil.WriteFile(plugconfPath, []byte(invalid), 0644); err != nil {
+			t.Fatal("failed to write " + plugconfPath)
+		}
+
+		// Put user's vimrc which does not have magic comment
+		installProfileRC(t, "default", "vimrc-nomagic.vim", pathutil.ProfileVimrc)
+		installVimRC(t, "vimrc-nomagic.vim", pathutil.Vimrc)
+		vimrc := filepath.Join(pathutil.VimDir(), pathutil.Vimrc)
+
+		installed := pathutil.EncodeReposPath(reposPath)
+		before, err := os.Lstat(installed)
+		if err != nil {
+			t.Fatal("failed to stat " + installed)
+		}
+
+		// =============== run =============== //
+
+		args := []string{"build"}
+		if full {
+			args = append(args, "-full")
+		}
+		out, err = testutil.RunVolt(args...)
+		// (A, B)
+		testutil.FailExit(t, out, err)
+
+		// (a)
+		for _, expected := range []string{
+			"localhost/local/missing: repository does not exist",
+			"plugconf for localhost/local/hello: 2:",
+			"'" + vimrc + "' does not have magic comment",
+		} {
+			if !strings.Contains(string(out), expected) {
+				t.Errorf("expected %q but got: %s", expected, string(out))
+			}
+		}
+
+		// (b)
+		after, err := os.Lstat(installed)
+		if err != nil {
+			t.Fatal("installed repository was removed: " + err.Error())
+		}
+		if !after.ModTime().Equal(before.ModTime()) {
+			t.Errorf("installed repository was modified")
+		}
+	})
+}
+
+// Checks:
+// (a) Previous bundled plugconf remains when the build failed
+//
+// * Run `volt build` (plugconf: parse error) (!A, !B, a)
+// * Run `volt build -full` (plugconf: parse error) (!A, !B, a)
+func TestErrVoltBuildKeepsBundledPlugconf(t *testing.T) {
+	testutil.DefaultMatrix(t, func(t *testing.T, full bool, strategy string) {
+		// =============== setup =============== //
+
+		testutil.SetUpEnv(t)
+		reposPath := pathutil.ReposPath("localhost/local/hello")
+		teardown := testutil.SetUpRepos(t, "hello", lockjson.ReposStaticType, []pathutil.ReposPath{reposPath}, strategy)
+		defer teardown()
+		testutil.InstallConfig(t, "strategy-"+strategy+".toml")
+
+		out, err := testutil.RunVolt("build")
+		testutil.SuccessExit(t, out, err)
+		oldContent, err := ioutil.ReadFile(pathutil.BundledPlugConf())
+		if err != nil {
+			t.Fatal("could not read bundled plugconf: " + err.Error())
+		}
+
+		// Make the build fail after installing repositories
+		invalid := "function! s:loaded_on()\n  return 'invalid'\nendfunction\n"
+		os.MkdirAll(filepath.Dir(pathutil.Plugconf(reposPath)), 0755)
+		if err := ioutil.WriteFile(pathutil.Plugconf(reposPath), []byte(invalid), 0644); err != nil {
+			t.Fatal("failed to write plugconf: " + err.Error())
+		}
+
+		// =============== run =============== //
+
+		args := []string{"build"}
+		if full {
+			args = append(args, "-full")
+		}
+		out, err = testutil.RunVolt(args...)
+		// (!A, !B)
+		testutil.FailExit(t, out, err)
+
+		// (a)
+		content, err := ioutil.ReadFile(pathutil.BundledPlugConf())
+		if err != nil {
+			t.Fatal("could not read bundled plugconf: " + err.Error())
+		}
+		if string(content) != string(oldContent) {
+			t.Errorf("expected bundled plugconf is not changed but got:\n%s", string(content))
+		}
+	})
+}
+
+// Checks:
+// (a) Messages per repository are not shown
+// (b) Summary is shown
+//
+// * Run `VOLT_LOG_FORMAT=compact volt build` (A, B, a, b)
+func TestVoltBuildCompactLog(t *testing.T) {
+	testutil.DefaultMatrix(t, func(t *testing.T, full bool, strategy string) {
+		// =============== setup =============== //
+
+		testutil.SetUpEnv(t)
+		reposPath := pathutil.ReposPath("localhost/local/hello")
+		teardown := testutil.SetUpRepos(t, "hello", lockjson.ReposStaticType, []pathutil.ReposPath{reposPath}, strategy)
+		defer teardown()
+		testutil.InstallConfig(t, "strategy-"+strategy+".toml")
+		os.Setenv("VOLT_LOG_FORMAT", "compact")
+		defer os.Unsetenv("VOLT_LOG_FORMAT")
+
+		// =============== run =============== //
+
+		args := []string{"build"}
+		if full {
+			args = append(args, "-full")
+		}
+		out, err := testutil.RunVolt(args...)
+		// (A, B)
+		testutil.SuccessExit(t, out, err)
+
+		// (a)
+		if strings.Contains(string(out), reposPath.String()) {
+			t.Errorf("expected no message of %s but got: %s", reposPath, string(out))
+		}
+		// (b)
+		if !strings.Contains(string(out), "Installed 1 repositories") {
+			t.Errorf("expected summary but got: %s", string(out))
+		}
+	})
+}
+
+// * Run `volt build` (repos: too slow to copy) (static repository) (!A, !B)
+func TestErrVoltBuildReposTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake vim executable is a shell script")
+	}
+	for _, strategy := range testutil.AvailableStrategies() {
+		t.Run("strategy="+strategy, func(t *testing.T) {
+			// =============== setup =============== //
+
+			testutil.SetUpEnv(t)
+			reposPathList := []pathutil.ReposPath{"localhost/local/hello"}
+			teardown := testutil.SetUpRepos(t, "hello", lockjson.ReposStaticType, reposPathList, strategy)
+			defer teardown()
+			installConfigContent(t, "[build]\nstrategy = \""+strategy+"\"\nrepos_timeout = 1\n")
+
+			// ":helptags" is executed only when doc directory exists
+			doc := filepath.Join(pathutil.FullReposPath(reposPathList[0]), "doc", "hello.txt")
+			os.MkdirAll(filepath.Dir(doc), 0777)
+			if err := ioutil.WriteFile(doc, []byte("*hello.txt*\n"), 0644); err != nil {
+				t.Fatal("failed to write " + doc)
+			}
+			// Fake vim executable which hangs up
+			slowVim := filepath.Join(os.Getenv("HOME"), "slow-vim")
+			if err := ioutil.WriteFile(slowVim, []byte("#!/bin/sh\nif [ \"$1\" = --version ]; then\n  echo 'VIM - Vi IMproved 8.0'\n  exit\nfi\nexec sleep 30\n"), 0755); err != nil {
+				t.Fatal("failed to write " + slowVim)
+			}
+			os.Setenv("VOLT_VIM", slowVim)
+			defer os.Unsetenv("VOLT_VIM")
+
+			// =============== run =============== //
+
+			start := time.Now()
+			out, err := testutil.RunVolt("build", "-full")
+			// (!A, !B)
+			testutil.FailExit(t, out, err)
+
+			// symlink builder runs ":helptags" after linking all repositories
+			msg := "timed out copying repository 'localhost/local/hello'"
+			if strategy == config.SymlinkBuilder {
+				msg = "timed out making tags file of 'localhost/local/hello'"
+			}
+			if !strings.Contains(string(out), msg) {
+				t.Errorf("expected timeout error but got: %s", string(out))
+			}
+			if elapsed := time.Since(start); elapsed > 20*time.Second {
+				t.Errorf("expected volt build gave up in repos_timeout but took %s", elapsed)
+			}
+		})
+	}
+}
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) ":helptags" is executed for all repositories (at once by symlink builder)
+// (b) No more than build.helptags_workers Vim processes run at the same time
+// (c) No more than {count} repositories of -j option are processed at the same time
+//
+// * Run `volt build -full -j 6` (repos: 6 static repositories with doc directory) (A, B, a, b)
+// * Run `volt build -full -j 1` (repos: 6 static repositories with doc directory) (A, B, a, c)
+func TestVoltBuildHelptagsWorkers(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake vim executable is a shell script")
+	}
+	for _, tt := range []struct {
+		helptagsWorkers int
+		args            []string
+		max             int
+	}{
+		{2, []string{"-j", "6"}, 2},
+		{6, []string{"-j", "1"}, 1},
+	} {
+		for _, strategy := range testutil.AvailableStrategies() {
+			t.Run(fmt.Sprintf("strategy=%s,helptags_workers=%d,args=%v", strategy, tt.helptagsWorkers, tt.args), func(t *testing.T) {
+				testVoltBuildHelptagsWorkers(t, strategy, tt.helptagsWorkers, tt.args, tt.max)
+			})
+		}
+	}
+}
+
+func testVoltBuildHelptagsWorkers(t *testing.T, strategy string, helptagsWorkers int, args []string, max int) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	installConfigContent(t, fmt.Sprintf("[build]\nstrategy = %q\nhelptags_workers = %d\n", strategy, helptagsWorkers))
+
+	lockJSON, err := lockjson.Read()
+	if err != nil {
+		t.Fatal("lockjson.Read() failed: " + err.Error())
+	}
+	profile, err := lockJSON.Profiles.FindByName(lockJSON.CurrentProfileName)
+	if err != nil {
+		t.Fatal("lockJSON.Profiles.FindByName() failed: " + err.Error())
+	}
+	names := strings.Fields("a b c d e f")
+	for _, name := range names {
+		reposPath := pathutil.ReposPath("localhost/local/" + name)
+		// ":helptags" is executed only when doc directory exists
+		doc := filepath.Join(pathutil.FullReposPath(reposPath), "doc", name+".txt")
+		os.MkdirAll(filepath.Dir(doc), 0777)
+		if err := ioutil.WriteFile(doc, []byte("*"+name+".txt*\n"), 0644); err != nil {
+			t.Fatal("failed to write " + doc)
+		}
+		lockJSON.Repos = append(lockJSON.Repos, lockjson.Repos{Type: lockjson.ReposStaticType, Path: reposPath})
+		profile.ReposPath = append(profile.ReposPath, reposPath)
+	}
+	if err := lockJSON.Write(); err != nil {
+		t.Fatal("lockJSON.Write() failed: " + err.Error())
+	}
+
+	// Fake vim executable which records the number of running
+	// processes (including itself) to counts file
+	home := os.Getenv("HOME")
+	running := filepath.Join(home, "running")
+	counts := filepath.Join(home, "counts")
+	os.MkdirAll(running, 0755)
+	fakeVim := filepath.Join(home, "fake-vim")
+	script := "#!/bin/sh\n" +
+		"if [ \"$1\" = --version ]; then\n  echo 'VIM - Vi IMproved 8.0'\n  exit\nfi\n" +
+		"touch " + running + "/$$\n" +
+		"ls " + running + " | wc -l >>" + counts + "\n" +
+		"sleep 0.3\n" +
+		"rm " + running + "/$$\n"
+	if err := ioutil.WriteFile(fakeVim, []byte(script), 0755); err != nil {
+		t.Fatal("failed to write " + fakeVim)
+	}
+	os.Setenv("VOLT_VIM", fakeVim)
+	defer os.Unsetenv("VOLT_VIM")
+
+	// =============== run =============== //
+
+	out, err := testutil.RunVolt(append([]string{"build", "-full"}, args...)...)
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+
+	content, err := ioutil.ReadFile(counts)
+	if err != nil {
+		t.Fatal("failed to read " + counts + ": " + err.Error())
+	}
+	lines := strings.Fields(string(content))
+	// (a)
+	executed := len(names)
+	if strategy == config.SymlinkBuilder {
+		// symlink builder runs ":helptags" for all repositories at once
+		executed = 1
+	}
+	if len(lines) != executed {
+		t.Errorf("expected vim was executed %d times but got %d", executed, len(lines))
+	}
+	// (b, c)
+	for _, line := range lines {
+		if n, err := strconv.Atoi(line); err != nil || n > max {
+			t.Errorf("expected no more than %d vim processes run at the same time but got %q", max, line)
+		}
+	}
+}
+
+// Checks:
+// (A) Does not show `[ERROR]` messages
+// (B) Exit with zero status
+// (a) The error of ":helptags" is shown with the repository path
+// (b) The error is not shown for the other repository
+//
+// * Run `volt build` (repos: 2 static repositories, one has duplicate tags) (!A, !B, a, b)
+func TestVoltBuildHelptagsAll(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	installConfigContent(t, "[build]\nstrategy = \"symlink\"\n")
+
+	lockJSON, err := lockjson.Read()
+	if err != nil {
+		t.Fatal("lockjson.Read() failed: " + err.Error())
+	}
+	profile, err := lockJSON.Profiles.FindByName(lockJSON.CurrentProfileName)
+	if err != nil {
+		t.Fatal("lockJSON.Profiles.FindByName() failed: " + err.Error())
+	}
+	docs := map[pathutil.ReposPath]string{
+		"localhost/local/hello": "*hello*\n",
+		"localhost/local/world": "*world*\n*world*\n",
+	}
+	for reposPath, content := range docs {
+		doc := filepath.Join(pathutil.FullReposPath(reposPath), "doc", "doc.txt")
+		os.MkdirAll(filepath.Dir(doc), 0777)
+		if err := ioutil.WriteFile(doc, []byte(content), 0644); err != nil {
+			t.Fatal("failed to write " + doc)
+		}
+		lockJSON.Repos = append(lockJSON.Repos, lockjson.Repos{Type: lockjson.ReposStaticType, Path: reposPath})
+		profile.ReposPath = append(profile.ReposPath, reposPath)
+	}
+	if err := lockJSON.Write(); err != nil {
+		t.Fatal("lockJSON.Write() failed: " + err.Error())
+	}
+
+	// =============== run =============== //
+
+	out, err := testutil.RunVolt("build")
+	// (!A, !B)
+	testutil.FailExit(t, out, err)
+	// (a)
+	if !strings.Contains(string(out), "localhost/local/world: failed to make tags file: ") {
+		t.Errorf("expected the error about duplicate tags but got: %s", string(out))
+	}
+	// (b)
+	if strings.Contains(string(out), "localhost/local/hello: failed to make tags file: ") {
+		t.Errorf("expected no error about localhost/local/hello but got: %s", string(out))
+	}
+}
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) "pre_build" and "post_build" of lock.json are run in the vim directory
+// (b) The output of the hooks is shown
+// (c) The build is aborted if "pre_build" failed
+// (d) The build is kept with a warning if "post_build" failed
+//
+// * Run `volt build` (A, B, a, b)
+// * Run `volt build` ("pre_build" fails) (!A, !B, c)
+// * Run `volt build` ("post_build" fails) (!A, B, d)
+func TestVoltBuildHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks are written for sh")
+	}
+	for _, tt := range []struct {
+		name      string
+		preBuild  string
+		postBuild string
+	}{
+		{"success", "echo pre >pre.txt", "echo post-out; pwd >post.txt"},
+		{"pre_build fails", "echo pre-out; exit 3", "touch post.txt"},
+		{"post_build fails", "", "exit 4"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			// =============== setup =============== //
+
+			testutil.SetUpEnv(t)
+			reposPath := pathutil.ReposPath("localhost/local/hello")
+			teardown := testutil.SetUpRepos(t, "hello", lockjson.ReposStaticType, []pathutil.ReposPath{reposPath}, config.SymlinkBuilder)
+			defer teardown()
+			lockJSON, err := lockjson.Read()
+			if err != nil {
+				t.Fatal("lockjson.Read() failed: " + err.Error())
+			}
+			lockJSON.PreBuild = tt.preBuild
+			lockJSON.PostBuild = tt.postBuild
+			if err := lockJSON.Write(); err != nil {
+				t.Fatal("lockJSON.Write() failed: " + err.Error())
+			}
+
+			// =============== run =============== //
+
+			out, err := testutil.RunVolt("build", "-full")
+			vimDir := pathutil.VimDir()
+			installed := pathutil.Exists(pathutil.EncodeReposPath(reposPath))
+			switch tt.name {
+			case "success":
+				// (A, B)
+				testutil.SuccessExit(t, out, err)
+				// (a)
+				if b, err := ioutil.ReadFile(filepath.Join(vimDir, "pre.txt")); err != nil || string(b) != "pre\n" {
+					t.Errorf("pre_build was not run in %s: %q", vimDir, string(b))
+				}
+				if b, err := ioutil.ReadFile(filepath.Join(vimDir, "post.txt")); err != nil || strings.TrimSpace(string(b)) != vimDir {
+					t.Errorf("post_build was not run in %s: %q", vimDir, string(b))
+				}
+				// (b)
+				if !strings.Contains(string(out), "[INFO] post_build: post-out") {
+					t.Errorf("expected the output of post_build but got: %s", string(out))
+				}
+			case "pre_build fails":
+				// (!A, !B)
+				testutil.FailExit(t, out, err)
+				// (b)
+				if !strings.Contains(string(out), "[INFO] pre_build: pre-out") {
+					t.Errorf("expected the output of pre_build but got: %s", string(out))
+				}
+				// (c)
+				if !strings.Contains(string(out), "pre_build hook failed: exit status 3") {
+					t.Errorf("expected pre_build failure but got: %s", string(out))
+				}
+				if installed || pathutil.Exists(filepath.Join(vimDir, "post.txt")) {
+					t.Error("the build was not aborted")
+				}
+			case "post_build fails":
+				// (B)
+				if err != nil {
+					t.Fatal("expected success exit but got: " + err.Error())
+				}
+				// (d)
+				if !strings.Contains(string(out), "[WARN] post_build hook failed: exit status 4") {
+					t.Errorf("expected post_build failure but got: %s", string(out))
+				}
+				if !installed {
+					t.Error("the build was not kept")
+				}
+			}
+		})
+	}
+}
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) The files of "source" directory of local repository are installed
+// (b) symlink builder links to "source" directory
+// (c) The build fails if "source" directory does not exist
+//
+// * Run `volt build` (repos: local repository) (A, B, a, b)
+// * Run `volt build` (repos: local repository whose source does not exist) (!A, !B, c)
+func TestVoltBuildLocalRepos(t *testing.T) {
+	for _, exists := range []bool{true, false} {
+		for _, strategy := range testutil.AvailableStrategies() {
+			t.Run(fmt.Sprintf("strategy=%s,exists=%v", strategy, exists), func(t *testing.T) {
+				// =============== setup =============== //
+
+				testutil.SetUpEnv(t)
+				testutil.InstallConfig(t, "strategy-"+strategy+".toml")
+				source := filepath.Join(os.Getenv("HOME"), "dev", "hello")
+				if exists {
+					file := filepath.Join(source, "plugin", "hello.vim")
+					os.MkdirAll(filepath.Dir(file), 0755)
+					if err := ioutil.WriteFile(file, []byte("\" hello\n"), 0644); err != nil {
+						t.Fatal("failed to write " + file)
+					}
+				}
+				reposPath := pathutil.ReposPath("localhost/dev/hello")
+				lockJSON, err := lockjson.Read()
+				if err != nil {
+					t.Fatal("lockjson.Read() failed: " + err.Error())
+				}
+				profile, err := lockJSON.Profiles.FindByName(lockJSON.CurrentProfileName)
+				if err != nil {
+					t.Fatal("lockJSON.Profiles.FindByName() failed: " + err.Error())
+				}
+				lockJSON.Repos = append(lockJSON.Repos, lockjson.Repos{Type: lockjson.ReposLocalType, Path: reposPath, Source: source})
+				profile.ReposPath = append(profile.ReposPath, reposPath)
+				if err := lockJSON.Write(); err != nil {
+					t.Fatal("lockJSON.Write() failed: " + err.Error())
+				}
+
+				// =============== run =============== //
+
+				out, err := testutil.RunVolt("build")
+				if !exists {
+					// (!A, !B)
+					testutil.FailExit(t, out, err)
+					// (c)
+					if !strings.Contains(string(out), "repository does not exist: "+source) {
+						t.Errorf("expected the error about %s but got: %s", source, string(out))
+					}
+					return
+				}
+				// (A, B)
+				testutil.SuccessExit(t, out, err)
+				dst := pathutil.EncodeReposPath(reposPath)
+				// (a)
+				if b, err := ioutil.ReadFile(filepath.Join(dst, "plugin", "hello.vim")); err != nil || string(b) != "\" hello\n" {
+					t.Errorf("plugin/hello.vim was not installed: %q", string(b))
+				}
+				// (b)
+				if strategy == config.SymlinkBuilder {
+					if link, err := os.Readlink(dst); err != nil || link != source {
+						t.Errorf("expected %s links to %s but got %q", dst, source, link)
+					}
+				}
+			})
+		}
+	}
+}
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) The previous ~/.vim/pack/volt is removed without -keep-old option
+// (b) The previous ~/.vim/pack/volt is kept in ~/.vim/volt-backups with -keep-old option
+// (c) At most build.keep_old_max directories are kept
+//
+// * Run `volt build -full` (A, B, a)
+// * Run `volt build -full -keep-old` 3 times (A, B, b, c)
+func TestVoltBuildKeepOld(t *testing.T) {
+	for _, strategy := range testutil.AvailableStrategies() {
+		t.Run("strategy="+strategy, func(t *testing.T) {
+			// =============== setup =============== //
+
+			testutil.SetUpEnv(t)
+			reposPathList := []pathutil.ReposPath{"localhost/local/hello"}
+			teardown := testutil.SetUpRepos(t, "hello", lockjson.ReposStaticType, reposPathList, strategy)
+			defer teardown()
+			installConfigContent(t, fmt.Sprintf("[build]\nstrategy = %q\nkeep_old_max = 2\n", strategy))
+			backups := pathutil.VoltBackupsDir()
+
+			// =============== run =============== //
+
+			out, err := testutil.RunVolt("build", "-full")
+			// (A, B)
+			testutil.SuccessExit(t, out, err)
+			// (a)
+			if pathutil.Exists(backups) {
+				t.Errorf("%s was created without -keep-old option", backups)
+			}
+
+			for i := 0; i < 3; i++ {
+				out, err := testutil.RunVolt("build", "-full", "-keep-old")
+				// (A, B)
+				testutil.SuccessExit(t, out, err)
+				// (b)
+				if !strings.Contains(string(out), "Kept the previous "+pathutil.VimVoltDir()+" in "+backups) {
+					t.Errorf("expected the kept directory is shown but got: %s", string(out))
+				}
+			}
+			entries, err := ioutil.ReadDir(backups)
+			if err != nil {
+				t.Fatal("failed to read " + backups + ": " + err.Error())
+			}
+			// (c)
+			if len(entries) != 2 {
+				t.Errorf("expected 2 directories are kept but got %d", len(entries))
+			}
+			// (b)
+			for _, entry := range entries {
+				buildInfo := filepath.Join(backups, entry.Name(), "build-info.json")
+				if !pathutil.Exists(buildInfo) {
+					t.Errorf("%s does not exist", buildInfo)
+				}
+			}
+		})
+	}
+}
+
+// ============================================
+
+func testBuildMatrix(t *testing.T, f func(*testing.T, bool, string)) {
+	for _, strategy := range testutil.AvailableStrategies() {
+		for _, full := range []bool{false, true} {
+			t.Run(fmt.Sprintf("full=%v,strategy=%v", full, strategy), func(t *testing.T) {
+				f(t, full, strategy)
+			})
+		}
+	}
+}
+
+func touchFiles(t *testing.T, fullpath string) {
+	t.Helper()
+	filepath.Walk(fullpath, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		var mtime time.Time
+		if st, err := os.Lstat(path); err != nil {
+			t.Errorf("os.Lstat(%q) failed: %s", path, err.Error())
+		} else {
+			mtime = st.ModTime()
+		}
+		atime := mtime
+		if err = os.Chtimes(path, atime, mtime); err != nil {
+			t.Errorf("failed to change timestamp %q: %s", path, err.Error())
+		}
+		return nil
+	})
+}
+
+func checkBuildOutput(t *testing.T, full bool, out []byte, strategy string) {
+	t.Helper()
+	if strategy == config.SymlinkBuilder {
+		full = true // symlink builder always perform full build
+	}
+	outstr := string(out)
+	contains := strings.Contains(outstr, "Full building")
+	if !full && contains {
+		t.Errorf("expected smart build but done by full build (strategy=%s): %s", strategy, outstr)
+	} else if full && !contains {
+		t.Errorf("expected full build but done by smart build (strategy=%s): %s", strategy, outstr)
+	}
+}
+
+func checkCopied(t *testing.T, reposPath pathutil.ReposPath, strategy string) {
+	t.Helper()
+	vimReposDir := pathutil.EncodeReposPath(reposPath)
+	reposDir := pathutil.FullReposPath(reposPath)
+	tagsFile := filepath.Join("doc", "tags")
+	filepath.Walk(vimReposDir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() {
+			return nil
+		}
+
+		// symlinks should not be copied
+		if strategy != config.SymlinkBuilder && fi.Mode()&os.ModeSymlink != 0 {
+			t.Error("symlinks are copied: " + path)
+		}
+		rel, err := filepath.Rel(vimReposDir, path)
+		if err != nil {
+			t.Errorf("failed to get relative path of %s: %s", rel, err.Error())
+		}
+		// doc/tags is created after copy
+		if rel == tagsFile {
+			return nil
+		}
+		// .git, .gitignore should not be copied
+		if rel == ".git" || rel == ".gitignore" {
+			t.Error(".git or .gitignore are copied: " + rel)
+		}
+
+		reposFile := filepath.Join(reposDir, rel)
+		if strategy != config.SymlinkBuilder && !sameFile(t, path, reposFile) {
+			t.Errorf("%s and %s are not same", rel, reposFile)
+		}
+		return nil
+	})
+}
+
+func sameFile(t *testing.T, f1, f2 string) bool {
+	t.Helper()
+	fi1, err := os.Lstat(f1)
+	if err != nil {
+		t.Errorf("os.Lstat(%q) returned error: %s", f1, err.Error())
+	}
+	fi2, err := os.Lstat(f2)
+	if err != nil {
+		t.Errorf("os.Lstat(%q) returned error: %s", f2, err.Error())
+	}
+	// Compare metadata
+	if os.SameFile(fi1, fi2) {
+		return true
+	}
+	// Compare content
+	b1, err := ioutil.ReadFile(f1)
+	if err != nil {
+		t.Errorf("cannot read %s: %s", f1, err.Error())
+	}
+	b2, err := ioutil.ReadFile(f2)
+	if err != nil {
+		t.Errorf("cannot read %s: %s", f2, err.Error())
+	}
+	return bytes.Equal(b1, b2)
+}
+
+func checkBundledPlugconfContains(t *testing.T, str string, expected bool) {
+	t.Helper()
+	content, err := ioutil.ReadFile(pathutil.BundledPlugConf())
+	if err != nil {
+		t.Fatal("could not read bundled plugconf: " + err.Error())
+	}
+	if strings.Contains(string(content), str) != expected {
+		t.Errorf("expected bundled plugconf contains %q is %v but got: %s", str, expected, string(content))
+	}
+}
+
+func installConfigContent(t *testing.T, content string) {
+	t.Helper()
+	dst := pathutil.ConfigTOML()
+	os.MkdirAll(filepath.Dir(dst), 0777)
+	if err := ioutil.WriteFile(dst, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write %s: %s", dst, err.Error())
+	}
+}
+
+func installProfileRC(t *testing.T, profileName, srcName, dstName string) {
+	t.Helper()
+	src := filepath.Join(testutil.TestdataDir(), "rc", srcName)
+	dst := filepath.Join(pathutil.RCDir(profileName), dstName)
+	os.MkdirAll(filepath.Dir(dst), 0777)
+	if err := fileutil.CopyFile(src, dst, nil, 0777); err != nil {
+		t.Errorf("cannot copy %s to %s: %s", src, dst, err.Error())
+	}
+}
+
+func installVimRC(t *testing.T, srcName, dstName string) {
+	t.Helper()
+	src := filepath.Join(testutil.TestdataDir(), "rc", srcName)
+	dst := filepath.Join(pathutil.VimDir(), dstName)
+	os.MkdirAll(filepath.Dir(dst), 0777)
 	if err := fileutil.CopyFile(src, dst, nil, 0777); err != nil {
 		t.Errorf("cannot copy %s to %s: %s", src, dst, err.Error())
 	}
 }
 
-func installVimRC(t *testing.T, srcName, dstName string) {
-	t.Helper()
-	src := filepath.Join(testutil.TestdataDir(), "rc", srcName)
-	dst := filepath.Join(pathutil.VimDir(), dstName)
-	os.MkdirAll(filepath.Dir(dst), 0777)
-	if err := fileutil.CopyFile(src, dst, nil, 0777); err != nil {
-		t.Errorf("cannot copy %s to %s: %s", src, dst, err.Error())
+func checkRCUnchanged(t *testing.T, srcName, dstName string) {
+	t.Helper()
+	src := filepath.Join(testutil.TestdataDir(), "rc", srcName)
+	dst := filepath.Join(pathutil.VimDir(), dstName)
+	if !sameFile(t, src, dst) {
+		t.Errorf("expected %s was not changed but changed", dst)
+	}
+}
+
+func checkRCInstalled(t *testing.T, f, g, h, i int) {
+	t.Helper()
+	userVimrc := filepath.Join(pathutil.VimDir(), pathutil.Vimrc)
+	userGvimrc := filepath.Join(pathutil.VimDir(), pathutil.Gvimrc)
+
+	// (F, H)
+	for _, tt := range []struct {
+		value int
+		path  string
+	}{
+		{f, userVimrc},
+		{h, userGvimrc},
+	} {
+		if tt.value >= 0 {
+			if tt.value == 1 && !pathutil.Exists(tt.path) {
+				t.Errorf("expected %s was installed but not installed", tt.path)
+			}
+			if tt.value == 0 && pathutil.Exists(tt.path) {
+				t.Errorf("expected %s was not installed but installed", tt.path)
+			}
+		}
+	}
+
+	// (G, I)
+	for _, tt := range []struct {
+		value int
+		path  string
+	}{
+		{g, userVimrc},
+		{i, userGvimrc},
+	} {
+		if tt.value >= 0 {
+			if tt.value == 1 && !(&builder.BaseBuilder{}).HasMagicComment(tt.path) {
+				t.Errorf("expected %s has magic comment but has no magic comment", tt.path)
+			}
+			if tt.value == 0 && (&builder.BaseBuilder{}).HasMagicComment(tt.path) {
+				t.Errorf("expected %s was not installed but installed", tt.path)
+			}
+		}
+	}
+}
+
+func checkSyntax(t *testing.T, bundledPlugconf string) {
+	t.Helper()
+	r, err := os.Open(bundledPlugconf)
+	if err != nil {
+		t.Errorf("failed to open %s: %s", bundledPlugconf, err.Error())
+	}
+	_, err = vimlparser.ParseFile(r, bundledPlugconf, nil)
+	if err != nil {
+		t.Errorf("failed to parse %s: %s", bundledPlugconf, err.Error())
+	}
+}
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) The revision given by -set-version is installed
+// (b) lock.json is not changed
+// (c) The locked revision is installed again by next `volt build`
+//
+// * Run `volt build -strategy copy -set-version {repos}={abbrev hash}` (A, B, a, b)
+// * Run `volt build -strategy copy` (A, B, b, c)
+// * Run `volt build -strategy copy -set-version {repos}={unknown revision}` (!A, !B, b)
+// * Run `volt build -strategy symlink -set-version {repos}={abbrev hash}` (!A, !B, b)
+func TestVoltBuildSetVersion(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	testutil.InstallConfig(t, "strategy-copy.toml")
+	reposPath := pathutil.ReposPath("localhost/local/hello-git")
+	first := setUpLocalGitRepos(t, reposPath)
+	lockJSONPath := pathutil.LockJSON()
+	locked, err := ioutil.ReadFile(lockJSONPath)
+	if err != nil {
+		t.Fatal("failed to read lock.json: " + err.Error())
+	}
+	checkLockJSON := func() {
+		t.Helper()
+		content, err := ioutil.ReadFile(lockJSONPath)
+		if err != nil {
+			t.Fatal("failed to read lock.json: " + err.Error())
+		}
+		if !bytes.Equal(content, locked) {
+			t.Errorf("lock.json was changed:\n%s", string(content))
+		}
+	}
+	checkInstalled := func(expected string) {
+		t.Helper()
+		content, err := ioutil.ReadFile(filepath.Join(pathutil.EncodeReposPath(reposPath), "hello"))
+		if err != nil {
+			t.Fatal("failed to read installed file: " + err.Error())
+		}
+		if string(content) != expected {
+			t.Errorf("expected installed content %q but got %q", expected, string(content))
+		}
+	}
+
+	// =============== run =============== //
+
+	out, err := testutil.RunVolt("build", "-strategy", config.CopyBuilder, "-set-version", reposPath.String()+"="+first.String()[:7])
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	// (a)
+	checkInstalled("first")
+	// (b)
+	checkLockJSON()
+
+	out, err = testutil.RunVolt("build", "-strategy", config.CopyBuilder)
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	// (b)
+	checkLockJSON()
+	// (c)
+	checkInstalled("hello world!")
+
+	out, err = testutil.RunVolt("build", "-strategy", config.CopyBuilder, "-set-version", reposPath.String()+"=no-such-revision")
+	// (!A, !B)
+	testutil.FailExit(t, out, err)
+	// (b)
+	checkLockJSON()
+
+	out, err = testutil.RunVolt("build", "-strategy", config.SymlinkBuilder, "-set-version", reposPath.String()+"="+first.String()[:7])
+	// (!A, !B)
+	testutil.FailExit(t, out, err)
+	// (b)
+	checkLockJSON()
+}
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) The commit of the tag or branch in "version" of lock.json is installed
+// (b) `volt status` shows it is up to date after the build
+// (c) The error says which of ref or hash could not be resolved
+//
+// * Run `volt build` with a tag in "version" (A, B, a, b)
+// * Run `volt build` with a branch in "version" (A, B, a, b)
+// * Run `volt build` with an unknown tag in "version" (!A, !B, c)
+// * Run `volt build` with an unknown hash in "version" (!A, !B, c)
+func TestVoltBuildVersionRef(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	testutil.InstallConfig(t, "strategy-copy.toml")
+	reposPath := pathutil.ReposPath("localhost/local/hello-git")
+	first := setUpLocalGitRepos(t, reposPath)
+	r, err := git.PlainOpen(pathutil.FullReposPath(reposPath))
+	if err != nil {
+		t.Fatal("git.PlainOpen() failed: " + err.Error())
+	}
+	if err := r.Storer.SetReference(plumbing.NewHashReference("refs/tags/v1.0.0", first)); err != nil {
+		t.Fatal("failed to create tag: " + err.Error())
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		t.Fatal("r.Worktree() failed: " + err.Error())
+	}
+
+	// =============== run =============== //
+
+	for _, tt := range []struct {
+		version  string
+		checkout *git.CheckoutOptions
+		expected string
+		errMsg   string
+	}{
+		{"v1.0.0", &git.CheckoutOptions{Hash: first}, "first", ""},
+		{"master", &git.CheckoutOptions{Branch: "refs/heads/master"}, "hello world!", ""},
+		{"v9.9.9", nil, "", `could not resolve ref "v9.9.9"`},
+		{"0123456789012345678901234567890123456789", nil, "", `could not resolve hash "0123456789012345678901234567890123456789"`},
+	} {
+		if tt.checkout != nil {
+			// Check out the version not to warn that HEAD differs
+			if err := w.Checkout(tt.checkout); err != nil {
+				t.Fatal("w.Checkout() failed: " + err.Error())
+			}
+		}
+		lockJSON, err := lockjson.Read()
+		if err != nil {
+			t.Fatal("lockjson.Read() failed: " + err.Error())
+		}
+		repos, err := lockJSON.Repos.FindByPath(reposPath)
+		if err != nil {
+			t.Fatal("lockJSON.Repos.FindByPath() failed: " + err.Error())
+		}
+		repos.Version = tt.version
+		if err := lockJSON.Write(); err != nil {
+			t.Fatal("lockJSON.Write() failed: " + err.Error())
+		}
+
+		out, err := testutil.RunVolt("build")
+		if tt.errMsg != "" {
+			// (!A, !B)
+			testutil.FailExit(t, out, err)
+			// (c)
+			if !strings.Contains(string(out), tt.errMsg) {
+				t.Errorf("version %s: expected %q but got: %s", tt.version, tt.errMsg, string(out))
+			}
+			continue
+		}
+		// (A, B)
+		testutil.SuccessExit(t, out, err)
+		// (a)
+		content, err := ioutil.ReadFile(filepath.Join(pathutil.EncodeReposPath(reposPath), "hello"))
+		if err != nil {
+			t.Fatal("failed to read installed file: " + err.Error())
+		}
+		if string(content) != tt.expected {
+			t.Errorf("version %s: expected installed content %q but got %q", tt.version, tt.expected, string(content))
+		}
+		// (b)
+		out, err = testutil.RunVolt("status")
+		testutil.SuccessExit(t, out, err)
+	}
+}
+
+// Create git repository reposPath which has two commits, and add it to
+// lock.json and current profile. The locked revision is the second commit.
+// Returns the first commit hash.
+func setUpLocalGitRepos(t *testing.T, reposPath pathutil.ReposPath) plumbing.Hash {
+	t.Helper()
+	fullpath := pathutil.FullReposPath(reposPath)
+	r, err := git.PlainInit(fullpath, false)
+	if err != nil {
+		t.Fatal("git.PlainInit() failed: " + err.Error())
+	}
+	if err := ioutil.WriteFile(filepath.Join(fullpath, "hello"), []byte("first"), 0644); err != nil {
+		t.Fatal("ioutil.WriteFile() failed: " + err.Error())
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		t.Fatal("r.Worktree() failed: " + err.Error())
+	}
+	if _, err := w.Add("hello"); err != nil {
+		t.Fatal("w.Add() failed: " + err.Error())
+	}
+	first, err := w.Commit("first", &git.CommitOptions{
+		Author: &object.Signature{
+			Name:  "John Doe",
+			Email: "john@doe.org",
+			When:  time.Now(),
+		},
+	})
+	if err != nil {
+		t.Fatal("w.Commit() failed: " + err.Error())
+	}
+	_, second, err := gitCommitOne(reposPath)
+	if err != nil {
+		t.Fatal("gitCommitOne() failed: " + err.Error())
+	}
+
+	addGitReposToLockJSON(t, reposPath, second)
+	return first
+}
+
+// Add git repository reposPath locked at version to lock.json and
+// current profile
+func addGitReposToLockJSON(t *testing.T, reposPath pathutil.ReposPath, version plumbing.Hash) {
+	t.Helper()
+	lockJSON, err := lockjson.Read()
+	if err != nil {
+		t.Fatal("lockjson.Read() failed: " + err.Error())
+	}
+	lockJSON.Repos = append(lockJSON.Repos, lockjson.Repos{
+		Type:    lockjson.ReposGitType,
+		Path:    reposPath,
+		Version: version.String(),
+	})
+	profile, err := lockJSON.Profiles.FindByName(lockJSON.CurrentProfileName)
+	if err != nil {
+		t.Fatal("lockJSON.Profiles.FindByName() failed: " + err.Error())
+	}
+	profile.ReposPath = append(profile.ReposPath, reposPath)
+	if err := lockJSON.Write(); err != nil {
+		t.Fatal("lockJSON.Write() failed: " + err.Error())
+	}
+}
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) Each repository installs its locked revision from the shared bare repository
+// (b) The repositories are not copied again when nothing was changed (copy strategy)
+//
+// * Run `volt build` (A, B, a)
+// * Run `volt build` again (A, B, a, b)
+func TestVoltBuildSharedBareCache(t *testing.T) {
+	for _, strategy := range testutil.AvailableStrategies() {
+		t.Run("strategy="+strategy, func(t *testing.T) {
+			// =============== setup =============== //
+
+			testutil.SetUpEnv(t)
+			testutil.InstallConfig(t, "strategy-"+strategy+".toml")
+
+			// Make a bare repository which has two commits,
+			// and refer to it from two repositories locked at each commit
+			cacheDir := filepath.Join(os.Getenv("HOME"), "cache.git")
+			messages := []string{"first", "second"}
+			commits := setUpBareCache(t, cacheDir, messages)
+			reposPathList := []pathutil.ReposPath{"localhost/cache/first", "localhost/cache/second"}
+			for i, reposPath := range reposPathList {
+				fullpath := pathutil.FullReposPath(reposPath)
+				os.MkdirAll(filepath.Dir(fullpath), 0755)
+				if err := os.Symlink(cacheDir, fullpath); err != nil {
+					t.Fatal("os.Symlink() failed: " + err.Error())
+				}
+				addGitReposToLockJSON(t, reposPath, commits[i])
+			}
+
+			// =============== run =============== //
+
+			for i := 0; i < 2; i++ {
+				out, err := testutil.RunVolt("build")
+				// (A, B)
+				testutil.SuccessExit(t, out, err)
+				// (a)
+				for j, reposPath := range reposPathList {
+					path := filepath.Join(pathutil.EncodeReposPath(reposPath), "plugin", "cache.vim")
+					content, err := ioutil.ReadFile(path)
+					if err != nil {
+						t.Fatal("failed to read installed file: " + err.Error())
+					}
+					expected := "\" " + messages[j] + "\n"
+					if string(content) != expected {
+						t.Errorf("expected %q but got %q: %s", expected, string(content), path)
+					}
+				}
+				// (b)
+				if i == 1 && strategy == config.CopyBuilder && !strings.Contains(string(out), "(2 repositories are up to date)") {
+					t.Errorf("repositories were copied again: %s", string(out))
+				}
+			}
+		})
+	}
+}
+
+// Make a bare repository at dir which has one commit per message.
+// Each commit writes the message to plugin/cache.vim, and
+// the returned hashes are the commits in order.
+func setUpBareCache(t *testing.T, dir string, messages []string) []plumbing.Hash {
+	t.Helper()
+	workDir := dir + ".work"
+	r, err := git.PlainInit(workDir, false)
+	if err != nil {
+		t.Fatal("git.PlainInit() failed: " + err.Error())
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		t.Fatal("r.Worktree() failed: " + err.Error())
+	}
+	filename := filepath.Join(workDir, "plugin", "cache.vim")
+	os.MkdirAll(filepath.Dir(filename), 0755)
+	commits := make([]plumbing.Hash, 0, len(messages))
+	for _, msg := range messages {
+		if err := ioutil.WriteFile(filename, []byte("\" "+msg+"\n"), 0644); err != nil {
+			t.Fatal("ioutil.WriteFile() failed: " + err.Error())
+		}
+		if _, err := w.Add("plugin/cache.vim"); err != nil {
+			t.Fatal("w.Add() failed: " + err.Error())
+		}
+		hash, err := w.Commit(msg, &git.CommitOptions{
+			Author: &object.Signature{
+				Name:  "John Doe",
+				Email: "john@doe.org",
+				When:  time.Now(),
+			},
+		})
+		if err != nil {
+			t.Fatal("w.Commit() failed: " + err.Error())
+		}
+		commits = append(commits, hash)
+	}
+
+	// Move .git directory to dir, and make it bare repository
+	if err := os.Rename(filepath.Join(workDir, ".git"), dir); err != nil {
+		t.Fatal("os.Rename() failed: " + err.Error())
+	}
+	os.RemoveAll(workDir)
+	config := []byte("[core]\n\tbare = true\n")
+	if err := ioutil.WriteFile(filepath.Join(dir, "config"), config, 0644); err != nil {
+		t.Fatal("ioutil.WriteFile() failed: " + err.Error())
+	}
+	return commits
+}
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) Files under the subdir are installed at the top of the installed directory
+// (b) Files outside the subdir are not installed
+// (c) The repository is installed again when the subdir was changed
+//
+// * Run `volt build` (A, B, a, b)
+// * Run `volt build` after changing the subdir (A, B, a, b, c)
+// * Run `volt build` when the subdir does not exist (!B)
+func TestVoltBuildSubdir(t *testing.T) {
+	for _, strategy := range testutil.AvailableStrategies() {
+		t.Run("strategy="+strategy, func(t *testing.T) {
+			// =============== setup =============== //
+
+			testutil.SetUpEnv(t)
+			testutil.InstallConfig(t, "strategy-"+strategy+".toml")
+
+			gitRepos := pathutil.ReposPath("localhost/local/monorepo")
+			staticRepos := pathutil.ReposPath("localhost/local/static-monorepo")
+			files := []string{
+				"README.md",
+				"editors/vim/plugin/mono.vim",
+				"editors/vim/autoload/mono.vim",
+				"editors/vim2/plugin/mono2.vim",
+				"editors/emacs/mono.el",
+			}
+			version := setUpMonorepo(t, gitRepos, files)
+			addGitReposToLockJSON(t, gitRepos, version)
+			for _, file := range files {
+				path := filepath.Join(pathutil.FullReposPath(staticRepos), filepath.FromSlash(file))
+				os.MkdirAll(filepath.Dir(path), 0755)
+				if err := ioutil.WriteFile(path, []byte("\" "+file+"\n"), 0644); err != nil {
+					t.Fatal("failed to write " + path)
+				}
+			}
+			out, err := testutil.RunVolt("get", staticRepos.String())
+			testutil.SuccessExit(t, out, err)
+
+			for _, tt := range []struct {
+				subdir    string
+				installed []string
+			}{
+				{"editors/vim", []string{"plugin/mono.vim", "autoload/mono.vim"}},
+				{"editors/vim2", []string{"plugin/mono2.vim"}},
+			} {
+				setSubdir(t, tt.subdir, gitRepos, staticRepos)
+
+				// =============== run =============== //
+
+				out, err := testutil.RunVolt("build")
+				// (A, B)
+				testutil.SuccessExit(t, out, err)
+
+				for _, reposPath := range []pathutil.ReposPath{gitRepos, staticRepos} {
+					dst := pathutil.EncodeReposPath(reposPath)
+					// (a, c)
+					for _, file := range tt.installed {
+						path := filepath.Join(dst, filepath.FromSlash(file))
+						content, err := ioutil.ReadFile(path)
+						if err != nil {
+							t.Errorf("%s was not installed: %s", path, err.Error())
+						} else if expected := "\" " + tt.subdir + "/" + file + "\n"; string(content) != expected {
+							t.Errorf("%s: expected %q but got %q", path, expected, string(content))
+						}
+					}
+					// (b)
+					for _, file := range []string{"README.md", "editors", "mono.el", "autoload/mono2.vim"} {
+						if path := filepath.Join(dst, filepath.FromSlash(file)); pathutil.Exists(path) {
+							t.Errorf("%s was installed", path)
+						}
+					}
+				}
+			}
+
+			setSubdir(t, "editors/none", gitRepos, staticRepos)
+			out, err = testutil.RunVolt("build")
+			// (!B)
+			testutil.FailExit(t, out, err)
+		})
+	}
+}
+
+// Make a git repository which has files (the content of each file is
+// `" {file}`), and returns the commit hash
+func setUpMonorepo(t *testing.T, reposPath pathutil.ReposPath, files []string) plumbing.Hash {
+	t.Helper()
+	fullpath := pathutil.FullReposPath(reposPath)
+	r, err := git.PlainInit(fullpath, false)
+	if err != nil {
+		t.Fatal("git.PlainInit() failed: " + err.Error())
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		t.Fatal("r.Worktree() failed: " + err.Error())
+	}
+	for _, file := range files {
+		path := filepath.Join(fullpath, filepath.FromSlash(file))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte("\" "+file+"\n"), 0644); err != nil {
+			t.Fatal("ioutil.WriteFile() failed: " + err.Error())
+		}
+		if _, err := w.Add(file); err != nil {
+			t.Fatal("w.Add() failed: " + err.Error())
+		}
+	}
+	hash, err := w.Commit("monorepo", &git.CommitOptions{
+		Author: &object.Signature{
+			Name:  "John Doe",
+			Email: "john@doe.org",
+			When:  time.Now(),
+		},
+	})
+	if err != nil {
+		t.Fatal("w.Commit() failed: " + err.Error())
+	}
+	return hash
+}
+
+// Set subdir of repositories in lock.json
+func setSubdir(t *testing.T, subdir string, reposPathList ...pathutil.ReposPath) {
+	t.Helper()
+	lockJSON, err := lockjson.Read()
+	if err != nil {
+		t.Fatal("lockjson.Read() failed: " + err.Error())
+	}
+	for _, reposPath := range reposPathList {
+		repos, err := lockJSON.Repos.FindByPath(reposPath)
+		if err != nil {
+			t.Fatal("lockJSON.Repos.FindByPath() failed: " + err.Error())
+		}
+		repos.Subdir = subdir
+	}
+	if err := lockJSON.Write(); err != nil {
+		t.Fatal("lockJSON.Write() failed: " + err.Error())
+	}
+}
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) The repositories installed before the build failed are recorded to the checkpoint
+// (b) `volt build -resume` installs only the remaining repositories
+// (c) The checkpoint is removed after the build succeeded
+//
+// * Run `volt build` which fails for a repository (!B, a)
+// * Run `volt build -resume` after fixing the repository (A, B, b, c)
+// * Run `volt build -resume` with symlink strategy (!B)
+func TestVoltBuildResume(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	testutil.InstallConfig(t, "strategy-copy.toml")
+	names := []string{"alpha", "bravo", "charlie"}
+	args := []string{"get"}
+	for _, name := range names {
+		path := filepath.Join(pathutil.FullReposPath(pathutil.ReposPath("localhost/local/"+name)), "plugin", name+".vim")
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte("\" "+name+"\n"), 0644); err != nil {
+			t.Fatal("failed to write " + path)
+		}
+		args = append(args, "localhost/local/"+name)
+	}
+	out, err := testutil.RunVolt(args...)
+	testutil.SuccessExit(t, out, err)
+
+	// Make copying charlie fail (the subdir does not exist)
+	broken := pathutil.ReposPath("localhost/local/charlie")
+	setSubdir(t, "vim", broken)
+
+	// =============== run =============== //
+
+	out, err = testutil.RunVolt("build", "-full")
+	// (!B)
+	testutil.FailExit(t, out, err)
+	// (a)
+	checkpoint, err := buildinfo.ReadCheckpoint()
+	if err != nil {
+		t.Fatal("buildinfo.ReadCheckpoint() failed: " + err.Error())
+	}
+	if len(checkpoint) != 2 || checkpoint.FindByReposPath("localhost/local/alpha") == nil || checkpoint.FindByReposPath("localhost/local/bravo") == nil {
+		t.Errorf("expected alpha and bravo in the checkpoint but got: %+v", checkpoint)
+	}
+
+	path := filepath.Join(pathutil.FullReposPath(broken), "vim", "plugin", "charlie.vim")
+	os.MkdirAll(filepath.Dir(path), 0755)
+	if err := ioutil.WriteFile(path, []byte("\" charlie\n"), 0644); err != nil {
+		t.Fatal("failed to write " + path)
+	}
+	// Static repositories modified in the same second as the last build are
+	// installed again
+	past := time.Now().Add(-time.Hour)
+	for _, name := range names {
+		filepath.Walk(pathutil.FullReposPath(pathutil.ReposPath("localhost/local/"+name)), func(path string, _ os.FileInfo, err error) error {
+			if err == nil {
+				err = os.Chtimes(path, past, past)
+			}
+			return err
+		})
+	}
+	out, err = testutil.RunVolt("build", "-full", "-resume")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	// (b)
+	for _, name := range names {
+		installing := strings.Contains(string(out), "Installing static repository localhost/local/"+name+" ")
+		if installing != (name == "charlie") {
+			t.Errorf("expected only charlie is installed but got: %s", string(out))
+		}
+		path := filepath.Join(pathutil.EncodeReposPath(pathutil.ReposPath("localhost/local/"+name)), "plugin", name+".vim")
+		if !pathutil.Exists(path) {
+			t.Errorf("%s does not exist", path)
+		}
+	}
+	if expected := "Installed 1 repositories, removed 0 repositories (2 repositories are up to date)"; !strings.Contains(string(out), expected) {
+		t.Errorf("expected %q but got: %s", expected, string(out))
+	}
+	// (c)
+	if pathutil.Exists(pathutil.BuildCheckpointJSON()) {
+		t.Error("the checkpoint was not removed: " + pathutil.BuildCheckpointJSON())
+	}
+
+	out, err = testutil.RunVolt("build", "-resume", "-strategy", "symlink")
+	// (!B)
+	testutil.FailExit(t, out, err)
+}
+
+// Checks:
+// (A) Exit with non-zero status
+// (a) The previous ~/.vim/pack/volt is restored
+// (b) Neither the backup directory nor the checkpoint is left
+//
+// * Run `volt build -full` and send SIGINT while running ":helptags" (A, a, b)
+func TestErrVoltBuildInterrupted(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake vim executable is a shell script")
+	}
+	for _, strategy := range testutil.AvailableStrategies() {
+		t.Run("strategy="+strategy, func(t *testing.T) {
+			testErrVoltBuildInterrupted(t, strategy)
+		})
+	}
+}
+
+func testErrVoltBuildInterrupted(t *testing.T, strategy string) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	installConfigContent(t, fmt.Sprintf("[build]\nstrategy = %q\n", strategy))
+	args := []string{"get"}
+	for _, name := range []string{"alpha", "bravo"} {
+		src := pathutil.FullReposPath(pathutil.ReposPath("localhost/local/" + name))
+		// ":helptags" is executed only when doc directory exists
+		for _, file := range []string{"plugin/" + name + ".vim", "doc/" + name + ".txt"} {
+			path := filepath.Join(src, filepath.FromSlash(file))
+			os.MkdirAll(filepath.Dir(path), 0755)
+			if err := ioutil.WriteFile(path, []byte("*"+name+"*\n"), 0644); err != nil {
+				t.Fatal("failed to write " + path)
+			}
+		}
+		args = append(args, "localhost/local/"+name)
+	}
+	out, err := testutil.RunVolt(args...)
+	testutil.SuccessExit(t, out, err)
+
+	// The file which exists only in the previous ~/.vim/pack/volt
+	marker := filepath.Join(pathutil.VimVoltDir(), "marker")
+	if err := ioutil.WriteFile(marker, []byte(""), 0644); err != nil {
+		t.Fatal("failed to write " + marker)
+	}
+
+	// Fake vim executable which blocks ":helptags" after creating started
+	// file
+	home := os.Getenv("HOME")
+	started := filepath.Join(home, "started")
+	fakeVim := filepath.Join(home, "fake-vim")
+	script := "#!/bin/sh\n" +
+		"if [ \"$1\" = --version ]; then\n  echo 'VIM - Vi IMproved 8.0'\n  exit\nfi\n" +
+		"touch " + started + "\n" +
+		"exec sleep 10\n"
+	if err := ioutil.WriteFile(fakeVim, []byte(script), 0755); err != nil {
+		t.Fatal("failed to write " + fakeVim)
+	}
+	os.Setenv("VOLT_VIM", fakeVim)
+	defer os.Unsetenv("VOLT_VIM")
+
+	// =============== run =============== //
+
+	var buf bytes.Buffer
+	cmd := testutil.VoltCommand("build", "-full")
+	cmd.Stdout = &buf
+	cmd.Stderr = &buf
+	if err := cmd.Start(); err != nil {
+		t.Fatal("failed to start volt: " + err.Error())
+	}
+	for i := 0; i < 100 && !pathutil.Exists(started); i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if err := cmd.Process.Signal(os.Interrupt); err != nil {
+		t.Fatal("failed to send SIGINT: " + err.Error())
+	}
+	err = cmd.Wait()
+	// (A)
+	if err == nil {
+		t.Error("expected failure exit but exited with success: " + buf.String())
+	}
+	if !strings.Contains(buf.String(), "interrupted") {
+		t.Errorf("expected the build was interrupted but got: %s", buf.String())
+	}
+	// (a)
+	if !pathutil.Exists(marker) {
+		t.Error("the previous directory was not restored: " + buf.String())
+	}
+	for _, name := range []string{"alpha", "bravo"} {
+		path := filepath.Join(pathutil.EncodeReposPath(pathutil.ReposPath("localhost/local/"+name)), "plugin", name+".vim")
+		if !pathutil.Exists(path) {
+			t.Errorf("%s does not exist", path)
+		}
+	}
+	// (b)
+	if backup := filepath.Join(filepath.Dir(pathutil.VimVoltDir()), ".volt_backup"); pathutil.Exists(backup) {
+		t.Error("the backup directory was left: " + backup)
+	}
+	if pathutil.Exists(pathutil.BuildCheckpointJSON()) {
+		t.Error("the checkpoint was left: " + pathutil.BuildCheckpointJSON())
+	}
+}
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) Unchanged repositories are skipped as up to date
+// (b) The repository whose installed directory was removed is installed again
+// (c) -f option installs all repositories
+//
+// * Run `volt build` (A, B, a)
+// * Remove the installed directory of a repository and run `volt build` (A, B, a, b)
+// * Run `volt build -f` (A, B, c)
+func TestVoltBuildSkipUpToDate(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	testutil.InstallConfig(t, "strategy-copy.toml")
+	names := []string{"alpha", "bravo"}
+	args := []string{"get"}
+	for _, name := range names {
+		path := filepath.Join(pathutil.FullReposPath(pathutil.ReposPath("localhost/local/"+name)), "plugin", name+".vim")
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte("\" "+name+"\n"), 0644); err != nil {
+			t.Fatal("failed to write " + path)
+		}
+		args = append(args, "localhost/local/"+name)
+	}
+	out, err := testutil.RunVolt(args...)
+	testutil.SuccessExit(t, out, err)
+	// Static repositories modified in the same second as the last build are
+	// installed again
+	past := time.Now().Add(-time.Hour)
+	for _, name := range names {
+		filepath.Walk(pathutil.FullReposPath(pathutil.ReposPath("localhost/local/"+name)), func(path string, _ os.FileInfo, err error) error {
+			if err == nil {
+				err = os.Chtimes(path, past, past)
+			}
+			return err
+		})
+	}
+	skipped := func(name string) string {
+		return "Skipping static repository localhost/local/" + name + " ... Already up to date."
+	}
+	installed := func(name string) string {
+		return "Installing static repository localhost/local/" + name + " "
+	}
+
+	// =============== run =============== //
+
+	for _, tt := range []struct {
+		args     []string
+		remove   string
+		expected map[string]bool
+	}{
+		{[]string{"build"}, "", map[string]bool{skipped("alpha"): true, skipped("bravo"): true, installed("alpha"): false, installed("bravo"): false}},
+		{[]string{"build"}, "bravo", map[string]bool{skipped("alpha"): true, skipped("bravo"): false, installed("alpha"): false, installed("bravo"): true}},
+		{[]string{"build", "-f"}, "", map[string]bool{skipped("alpha"): false, skipped("bravo"): false, installed("alpha"): true, installed("bravo"): true}},
+	} {
+		if tt.remove != "" {
+			os.RemoveAll(pathutil.EncodeReposPath(pathutil.ReposPath("localhost/local/" + tt.remove)))
+		}
+		out, err := testutil.RunVolt(tt.args...)
+		// (A, B)
+		testutil.SuccessExit(t, out, err)
+		// (a, b, c)
+		for msg, expected := range tt.expected {
+			if strings.Contains(string(out), msg) != expected {
+				t.Errorf("volt %s: expected %q is shown = %v but got: %s", strings.Join(tt.args, " "), msg, expected, string(out))
+			}
+		}
+		for _, name := range names {
+			path := filepath.Join(pathutil.EncodeReposPath(pathutil.ReposPath("localhost/local/"+name)), "plugin", name+".vim")
+			if !pathutil.Exists(path) {
+				t.Errorf("volt %s: %s does not exist", strings.Join(tt.args, " "), path)
+			}
+		}
+	}
+}
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) The actions of the build are shown
+// (b) The actions of unchanged repositories are not shown by smart build
+// (c) ~/.vim/pack/volt and ~/.vim/vimrc are not changed
+//
+// * Run `volt build -dry-run` (A, B, a, b, c)
+// * Run `volt build -dry-run -full` (A, B, a, c)
+// * Run `volt build -dry-run -strategy symlink` (A, B, a, c)
+func TestVoltBuildDryRun(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	testutil.InstallConfig(t, "strategy-copy.toml")
+	installProfileRC(t, "default", "vimrc-nomagic.vim", pathutil.ProfileVimrc)
+	args := []string{"get"}
+	for _, name := range []string{"alpha", "bravo"} {
+		path := filepath.Join(pathutil.FullReposPath(pathutil.ReposPath("localhost/local/"+name)), "vim", "plugin", name+".vim")
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte("\" "+name+"\n"), 0644); err != nil {
+			t.Fatal("failed to write " + path)
+		}
+		args = append(args, "localhost/local/"+name)
+	}
+	out, err := testutil.RunVolt(args...)
+	testutil.SuccessExit(t, out, err)
+
+	// Change vimrc and the subdir of bravo
+	profileVimrc := filepath.Join(pathutil.RCDir("default"), pathutil.ProfileVimrc)
+	if err := ioutil.WriteFile(profileVimrc, []byte("\" changed\n"), 0644); err != nil {
+		t.Fatal("failed to write " + profileVimrc)
+	}
+	setSubdir(t, "vim", pathutil.ReposPath("localhost/local/bravo"))
+	vimrc := filepath.Join(pathutil.VimDir(), pathutil.Vimrc)
+	oldVimrc, err := ioutil.ReadFile(vimrc)
+	if err != nil {
+		t.Fatal("failed to read " + vimrc + ": " + err.Error())
+	}
+	oldFiles := readVimVoltDirFiles(t)
+
+	alpha := pathutil.EncodeReposPath("localhost/local/alpha")
+	bravo := pathutil.EncodeReposPath("localhost/local/bravo")
+	installVimrc := "Would install " + profileVimrc + " to " + vimrc
+	fullBuild := "Would remove " + pathutil.VimVoltDir() + " and re-create it (full build)"
+
+	// =============== run =============== //
+
+	for _, tt := range []struct {
+		args       []string
+		expected   []string
+		unexpected []string
+	}{
+		{
+			[]string{"build", "-dry-run"},
+			[]string{installVimrc, "Would copy static repository localhost/local/bravo to " + bravo},
+			[]string{fullBuild, "localhost/local/alpha"},
+		},
+		{
+			[]string{"build", "-dry-run", "-full"},
+			[]string{installVimrc, fullBuild, "Would copy static repository localhost/local/alpha to " + alpha, "Would copy static repository localhost/local/bravo to " + bravo},
+			nil,
+		},
+		{
+			[]string{"build", "-dry-run", "-strategy", "symlink"},
+			[]string{installVimrc, fullBuild, "Would link " + alpha + " to ", "Would link " + bravo + " to "},
+			[]string{"Would copy"},
+		},
+	} {
+		out, err := testutil.RunVolt(tt.args...)
+		// (A, B)
+		testutil.SuccessExit(t, out, err)
+		// (a)
+		for _, expected := range tt.expected {
+			if !strings.Contains(string(out), expected) {
+				t.Errorf("volt %s: expected %q but got: %s", strings.Join(tt.args, " "), expected, string(out))
+			}
+		}
+		// (b)
+		for _, unexpected := range tt.unexpected {
+			if strings.Contains(string(out), unexpected) {
+				t.Errorf("volt %s: expected no %q but got: %s", strings.Join(tt.args, " "), unexpected, string(out))
+			}
+		}
+		// (c)
+		if files := readVimVoltDirFiles(t); !reflect.DeepEqual(files, oldFiles) {
+			t.Errorf("volt %s: expected %s is not changed but got %v", strings.Join(tt.args, " "), pathutil.VimVoltDir(), files)
+		}
+		if content, err := ioutil.ReadFile(vimrc); err != nil || !bytes.Equal(content, oldVimrc) {
+			t.Errorf("volt %s: expected %s is not changed but got %q (%v)", strings.Join(tt.args, " "), vimrc, string(content), err)
+		}
+	}
+}
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) `volt build -dry-run` does not write encoded-names.json
+// (b) `volt build` records the hashed directory name of the long repository
+//     path to encoded-names.json
+//
+// * Run `volt build -dry-run` (A, B, a)
+// * Run `volt build` (A, B, b)
+func TestVoltBuildLongReposPath(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	testutil.InstallConfig(t, "strategy-copy.toml")
+	reposPath := pathutil.ReposPath("localhost/" + strings.Repeat("long-", 10) + "user/" + strings.Repeat("long-", 10) + "plugin.vim")
+	path := filepath.Join(pathutil.FullReposPath(reposPath), "plugin", "hello.vim")
+	os.MkdirAll(filepath.Dir(path), 0755)
+	if err := ioutil.WriteFile(path, []byte("\" hello\n"), 0644); err != nil {
+		t.Fatal("failed to write " + path)
+	}
+	out, err := testutil.RunVolt("get", reposPath.String())
+	testutil.SuccessExit(t, out, err)
+	os.RemoveAll(pathutil.VimVoltDir())
+
+	// =============== run =============== //
+
+	out, err = testutil.RunVolt("build", "-dry-run")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	// (a)
+	if pathutil.Exists(pathutil.EncodedNamesJSON()) {
+		t.Errorf("%s was written by -dry-run", pathutil.EncodedNamesJSON())
+	}
+
+	out, err = testutil.RunVolt("build")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	// (b)
+	encoded := pathutil.EncodeReposPath(reposPath)
+	if !pathutil.Exists(encoded) {
+		t.Errorf("%s was not installed", encoded)
+	}
+	if decoded := pathutil.DecodeReposPath(encoded); decoded != reposPath {
+		t.Errorf("expected %s is decoded to %s but got %s", encoded, reposPath, decoded)
+	}
+}
+
+// Returns the relative paths of files under ~/.vim/pack and their sizes
+func readVimVoltDirFiles(t *testing.T) map[string]int64 {
+	t.Helper()
+	packDir := filepath.Dir(pathutil.VimVoltDir())
+	files := make(map[string]int64, 32)
+	err := filepath.Walk(packDir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(packDir, path)
+		if err != nil {
+			return err
+		}
+		files[rel] = fi.Size()
+		return nil
+	})
+	if err != nil {
+		t.Fatal("failed to walk " + packDir + ": " + err.Error())
+	}
+	return files
+}
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) The opt dir is restored to the contents before the build
+// (b) `~/.vim/vimrc` is restored
+// (c) build-info.json is not changed
+//
+// * Run `volt build` with symlink strategy (A, B)
+// * Run `volt build` with symlink strategy which fails for the 3rd repository (!B, a, b, c)
+func TestVoltBuildSymlinkRollback(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	testutil.InstallConfig(t, "strategy-symlink.toml")
+	installProfileRC(t, "default", "vimrc-nomagic.vim", pathutil.ProfileVimrc)
+	names := []string{"alpha", "bravo", "charlie", "delta"}
+	args := []string{"get"}
+	for _, name := range names {
+		path := filepath.Join(pathutil.FullReposPath(pathutil.ReposPath("localhost/local/"+name)), "plugin", name+".vim")
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte("\" "+name+"\n"), 0644); err != nil {
+			t.Fatal("failed to write " + path)
+		}
+		args = append(args, "localhost/local/"+name)
+	}
+	out, err := testutil.RunVolt(args...)
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+
+	vimrc := filepath.Join(pathutil.VimDir(), pathutil.Vimrc)
+	oldVimrc, err := ioutil.ReadFile(vimrc)
+	if err != nil {
+		t.Fatal("failed to read " + vimrc + ": " + err.Error())
+	}
+	oldBuildInfo, err := ioutil.ReadFile(pathutil.BuildInfoJSON())
+	if err != nil {
+		t.Fatal("failed to read build-info.json: " + err.Error())
+	}
+	oldOptDir := readOptDirLinks(t)
+
+	// Change vimrc, and make installing charlie fail (the subdir does not exist)
+	profileVimrc := filepath.Join(pathutil.RCDir("default"), pathutil.ProfileVimrc)
+	if err := ioutil.WriteFile(profileVimrc, []byte("\" changed\n"), 0644); err != nil {
+		t.Fatal("failed to write " + profileVimrc)
+	}
+	setSubdir(t, "vim", pathutil.ReposPath("localhost/local/charlie"))
+
+	// =============== run =============== //
+
+	out, err = testutil.RunVolt("build", "-j", "1")
+	// (!B)
+	testutil.FailExit(t, out, err)
+	// (a)
+	if optDir := readOptDirLinks(t); !reflect.DeepEqual(optDir, oldOptDir) {
+		t.Errorf("expected opt dir is %v but got %v", oldOptDir, optDir)
+	}
+	if backup := filepath.Join(filepath.Dir(pathutil.VimVoltDir()), ".volt_backup"); pathutil.Exists(backup) {
+		t.Error("the backup was left: " + backup)
+	}
+	// (b)
+	if content, err := ioutil.ReadFile(vimrc); err != nil || !bytes.Equal(content, oldVimrc) {
+		t.Errorf("expected %s is restored but got %q (%v)", vimrc, string(content), err)
+	}
+	// (c)
+	if content, err := ioutil.ReadFile(pathutil.BuildInfoJSON()); err != nil || !bytes.Equal(content, oldBuildInfo) {
+		t.Errorf("expected build-info.json is not changed but got %q (%v)", string(content), err)
+	}
+}
+
+// Returns the entries of the opt dir and their link targets
+func readOptDirLinks(t *testing.T) map[string]string {
+	t.Helper()
+	entries, err := ioutil.ReadDir(pathutil.VimVoltOptDir())
+	if err != nil {
+		t.Fatal("failed to read opt dir: " + err.Error())
+	}
+	links := make(map[string]string, len(entries))
+	for _, fi := range entries {
+		links[fi.Name()], _ = os.Readlink(filepath.Join(pathutil.VimVoltOptDir(), fi.Name()))
+	}
+	return links
+}
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) The files larger than the threshold are not installed with warnings
+// (b) The files smaller than the threshold are installed
+// (c) The repositories are not installed again by smart build
+//
+// * Run `volt build -full -max-file-size 30` (!A, B, a, b)
+// * Run `volt build -max-file-size 30` (A, B, c)
+// * Run `volt build -full -max-file-size 100` (A, B, b)
+// * Run `volt build -max-file-size 30` with symlink strategy (!B)
+func TestVoltBuildMaxFileSize(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	testutil.InstallConfig(t, "strategy-copy.toml")
+
+	gitRepos := pathutil.ReposPath("localhost/local/git-assets")
+	staticRepos := pathutil.ReposPath("localhost/local/static-assets")
+	// The content of each file is `" {file}` (19 and 42 bytes)
+	small := "plugin/small.vim"
+	large := "assets/this-is-a-large-binary-asset.bin"
+	version := setUpMonorepo(t, gitRepos, []string{small, large})
+	addGitReposToLockJSON(t, gitRepos, version)
+	for _, file := range []string{small, large} {
+		path := filepath.Join(pathutil.FullReposPath(staticRepos), filepath.FromSlash(file))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte("\" "+file+"\n"), 0644); err != nil {
+			t.Fatal("failed to write " + path)
+		}
+	}
+	out, err := testutil.RunVolt("get", staticRepos.String())
+	testutil.SuccessExit(t, out, err)
+	// Static repositories modified in the same second as the last build are
+	// installed again
+	past := time.Now().Add(-time.Hour)
+	filepath.Walk(pathutil.FullReposPath(staticRepos), func(path string, _ os.FileInfo, err error) error {
+		if err == nil {
+			err = os.Chtimes(path, past, past)
+		}
+		return err
+	})
+
+	// =============== run =============== //
+
+	out, err = testutil.RunVolt("build", "-full", "-max-file-size", "30")
+	// (B)
+	if err != nil {
+		t.Error("expected success exit but exited with failure: " + err.Error())
+	}
+	for _, reposPath := range []pathutil.ReposPath{gitRepos, staticRepos} {
+		// (!A, a)
+		expected := "[WARN] " + reposPath.String() + ": skipped " + large + " (42 bytes) because it is larger than 30 bytes"
+		if !strings.Contains(string(out), expected) {
+			t.Errorf("expected %q but got: %s", expected, string(out))
+		}
+		dst := pathutil.EncodeReposPath(reposPath)
+		if path := filepath.Join(dst, filepath.FromSlash(large)); pathutil.Exists(path) {
+			t.Errorf("%s was installed", path)
+		}
+		// (b)
+		if path := filepath.Join(dst, filepath.FromSlash(small)); !pathutil.Exists(path) {
+			t.Errorf("%s was not installed", path)
+		}
+	}
+
+	out, err = testutil.RunVolt("build", "-max-file-size", "30")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	// (c)
+	if expected := "Installed 0 repositories, removed 0 repositories (2 repositories are up to date)"; !strings.Contains(string(out), expected) {
+		t.Errorf("expected %q but got: %s", expected, string(out))
+	}
+
+	out, err = testutil.RunVolt("build", "-full", "-max-file-size", "100")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	// (b)
+	for _, reposPath := range []pathutil.ReposPath{gitRepos, staticRepos} {
+		for _, file := range []string{small, large} {
+			if path := filepath.Join(pathutil.EncodeReposPath(reposPath), filepath.FromSlash(file)); !pathutil.Exists(path) {
+				t.Errorf("%s was not installed", path)
+			}
+		}
+	}
+
+	out, err = testutil.RunVolt("build", "-max-file-size", "30", "-strategy", "symlink")
+	// (!B)
+	testutil.FailExit(t, out, err)
+}
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) The bits of the mask are cleared from installed files
+// (b) The modes of source files are not changed
+// (c) The modes of source files are preserved without the mask
+//
+// * Run `volt build -full -file-mode-mask 0111` (A, B, a, b)
+// * Run `volt build -full` (A, B, c)
+// * Run `volt build -file-mode-mask 0111` with symlink strategy (!A, !B)
+func TestVoltBuildFileModeMask(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	testutil.InstallConfig(t, "strategy-copy.toml")
+
+	gitRepos := pathutil.ReposPath("localhost/local/git-exec")
+	staticRepos := pathutil.ReposPath("localhost/local/static-exec")
+	script := "bin/run.sh"
+	plugin := "plugin/exec.vim"
+
+	// Commit the executable script
+	setUpMonorepo(t, gitRepos, []string{script, plugin})
+	if err := os.Chmod(filepath.Join(pathutil.FullReposPath(gitRepos), filepath.FromSlash(script)), 0755); err != nil {
+		t.Fatal("os.Chmod() failed: " + err.Error())
+	}
+	r, err := git.PlainOpen(pathutil.FullReposPath(gitRepos))
+	if err != nil {
+		t.Fatal("git.PlainOpen() failed: " + err.Error())
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		t.Fatal("r.Worktree() failed: " + err.Error())
+	}
+	if _, err := w.Add(script); err != nil {
+		t.Fatal("w.Add() failed: " + err.Error())
+	}
+	version, err := w.Commit("make executable", &git.CommitOptions{
+		Author: &object.Signature{
+			Name:  "John Doe",
+			Email: "john@doe.org",
+			When:  time.Now(),
+		},
+	})
+	if err != nil {
+		t.Fatal("w.Commit() failed: " + err.Error())
+	}
+	addGitReposToLockJSON(t, gitRepos, version)
+
+	for _, file := range []string{script, plugin} {
+		path := filepath.Join(pathutil.FullReposPath(staticRepos), filepath.FromSlash(file))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte("\" "+file+"\n"), 0644); err != nil {
+			t.Fatal("failed to write " + path)
+		}
+	}
+	staticScript := filepath.Join(pathutil.FullReposPath(staticRepos), filepath.FromSlash(script))
+	if err := os.Chmod(staticScript, 0755); err != nil {
+		t.Fatal("os.Chmod() failed: " + err.Error())
+	}
+	out, err := testutil.RunVolt("get", staticRepos.String())
+	testutil.SuccessExit(t, out, err)
+
+	modeOf := func(path string) os.FileMode {
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal("os.Stat() failed: " + err.Error())
+		}
+		return fi.Mode().Perm()
+	}
+
+	// =============== run =============== //
+
+	out, err = testutil.RunVolt("build", "-full", "-file-mode-mask", "0111")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	for _, reposPath := range []pathutil.ReposPath{gitRepos, staticRepos} {
+		// (a)
+		path := filepath.Join(pathutil.EncodeReposPath(reposPath), filepath.FromSlash(script))
+		if mode := modeOf(path); mode&0111 != 0 {
+			t.Errorf("expected %s is not executable but the mode is %o", path, mode)
+		}
+	}
+	// (b)
+	if mode := modeOf(staticScript); mode&0111 == 0 {
+		t.Errorf("expected %s is executable but the mode is %o", staticScript, mode)
+	}
+
+	out, err = testutil.RunVolt("build", "-full")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	for _, reposPath := range []pathutil.ReposPath{gitRepos, staticRepos} {
+		// (c)
+		path := filepath.Join(pathutil.EncodeReposPath(reposPath), filepath.FromSlash(script))
+		if mode := modeOf(path); mode&0100 == 0 {
+			t.Errorf("expected %s is executable but the mode is %o", path, mode)
+		}
+	}
+
+	out, err = testutil.RunVolt("build", "-file-mode-mask", "0111", "-strategy", "symlink")
+	// (!A, !B)
+	testutil.FailExit(t, out, err)
+}
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) The files of git repository are installed
+//
+// * Run `volt build -full -verify-copy size` (A, B, a)
+// * Run `volt build -full -verify-copy checksum` (A, B, a)
+// * Run `volt build -verify-copy sha256` (!A, !B)
+func TestVoltBuildVerifyCopy(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	testutil.InstallConfig(t, "strategy-copy.toml")
+
+	reposPath := pathutil.ReposPath("localhost/local/verified")
+	files := []string{"plugin/verified.vim", "autoload/verified.vim"}
+	version := setUpMonorepo(t, reposPath, files)
+	addGitReposToLockJSON(t, reposPath, version)
+
+	// =============== run =============== //
+
+	for _, mode := range []string{"size", "checksum"} {
+		out, err := testutil.RunVolt("build", "-full", "-verify-copy", mode)
+		// (A, B)
+		testutil.SuccessExit(t, out, err)
+		// (a)
+		for _, file := range files {
+			path := filepath.Join(pathutil.EncodeReposPath(reposPath), filepath.FromSlash(file))
+			if content, err := ioutil.ReadFile(path); err != nil || string(content) != "\" "+file+"\n" {
+				t.Errorf("[%s] expected %s is installed but got %q (%v)", mode, path, content, err)
+			}
+		}
+	}
+
+	out, err := testutil.RunVolt("build", "-verify-copy", "sha256")
+	// (!A, !B)
+	testutil.FailExit(t, out, err)
+}
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) The mode of the executable file of static repository is preserved
+// (b) The symlink of static repository is installed as symlink
+//
+// * Run `volt build -full` (A, B, a, b)
+// * Run `volt build -full` (.voltignore: exists) (A, B, a, b)
+func TestVoltBuildStaticModeAndSymlink(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	testutil.InstallConfig(t, "strategy-copy.toml")
+
+	reposPath := pathutil.ReposPath("localhost/local/static-link")
+	src := pathutil.FullReposPath(reposPath)
+	for _, file := range []string{"bin/run.sh", "plugin/link.vim"} {
+		path := filepath.Join(src, filepath.FromSlash(file))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte("\" "+file+"\n"), 0644); err != nil {
+			t.Fatal("failed to write " + path)
+		}
+	}
+	if err := os.Chmod(filepath.Join(src, "bin", "run.sh"), 0755); err != nil {
+		t.Fatal("os.Chmod() failed: " + err.Error())
+	}
+	link := filepath.Join("..", "bin", "run.sh")
+	if err := os.Symlink(link, filepath.Join(src, "plugin", "run.sh")); err != nil {
+		t.Skip("cannot create symlink: " + err.Error())
+	}
+	out, err := testutil.RunVolt("get", reposPath.String())
+	testutil.SuccessExit(t, out, err)
+
+	dst := pathutil.EncodeReposPath(reposPath)
+	check := func() {
+		t.Helper()
+		// (a)
+		fi, err := os.Stat(filepath.Join(dst, "bin", "run.sh"))
+		if err != nil {
+			t.Fatal("bin/run.sh was not installed: " + err.Error())
+		}
+		if fi.Mode().Perm() != 0755 {
+			t.Errorf("expected mode of bin/run.sh is 0755 but got %o", fi.Mode().Perm())
+		}
+		// (b)
+		fi, err = os.Lstat(filepath.Join(dst, "plugin", "run.sh"))
+		if err != nil {
+			t.Fatal("plugin/run.sh was not installed: " + err.Error())
+		}
+		if fi.Mode()&os.ModeSymlink == 0 {
+			t.Errorf("expected plugin/run.sh is a symlink but the mode is %v", fi.Mode())
+		} else if l, err := os.Readlink(filepath.Join(dst, "plugin", "run.sh")); err != nil || l != link {
+			t.Errorf("expected plugin/run.sh links to %q but got %q (%v)", link, l, err)
+		}
+	}
+
+	// =============== run =============== //
+
+	out, err = testutil.RunVolt("build", "-full")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	check()
+
+	if err := ioutil.WriteFile(filepath.Join(src, ".voltignore"), []byte("*.md\n"), 0644); err != nil {
+		t.Fatal("failed to write .voltignore: " + err.Error())
 	}
+	out, err = testutil.RunVolt("build", "-full")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	check()
 }
 
-func checkRCInstalled(t *testing.T, f, g, h, i int) {
-	t.Helper()
-	userVimrc := filepath.Join(pathutil.VimDir(), pathutil.Vimrc)
-	userGvimrc := filepath.Join(pathutil.VimDir(), pathutil.Gvimrc)
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) The symlink of "post_install" links to the installed file
+// (b) The directory of "post_install" is created
+// (c) The removed symlink is created again by next build
+// (d) "post_install" path outside the home directory is rejected
+//
+// * Run `volt build` (A, B, a, b)
+// * Remove the symlink and run `volt build` (A, B, c)
+// * Run `volt build` with "post_install" path "/etc/plugin" (!A, !B, d)
+func TestVoltBuildPostInstall(t *testing.T) {
+	for _, strategy := range testutil.AvailableStrategies() {
+		t.Run("strategy="+strategy, func(t *testing.T) {
+			// =============== setup =============== //
+
+			testutil.SetUpEnv(t)
+			testutil.InstallConfig(t, "strategy-"+strategy+".toml")
+			reposPath := pathutil.ReposPath("localhost/local/post-install")
+			conf := filepath.Join(pathutil.FullReposPath(reposPath), "conf", "plugin.conf")
+			os.MkdirAll(filepath.Dir(conf), 0755)
+			if err := ioutil.WriteFile(conf, []byte("config"), 0644); err != nil {
+				t.Fatal("failed to write " + conf)
+			}
+			out, err := testutil.RunVolt("get", reposPath.String())
+			testutil.SuccessExit(t, out, err)
+			setPostInstall := func(postInstall []lockjson.PostInstall) {
+				lockJSON, err := lockjson.Read()
+				if err != nil {
+					t.Fatal("lockjson.Read() failed: " + err.Error())
+				}
+				repos, err := lockJSON.Repos.FindByPath(reposPath)
+				if err != nil {
+					t.Fatal("lockJSON.Repos.FindByPath() failed: " + err.Error())
+				}
+				repos.PostInstall = postInstall
+				if err := lockJSON.Write(); err != nil {
+					t.Fatal("lockJSON.Write() failed: " + err.Error())
+				}
+			}
+			setPostInstall([]lockjson.PostInstall{
+				{Path: "~/.config/plugin/plugin.conf", Target: "conf/plugin.conf"},
+				{Path: "~/.cache/plugin"},
+			})
+			link := filepath.Join(os.Getenv("HOME"), ".config", "plugin", "plugin.conf")
+			dir := filepath.Join(os.Getenv("HOME"), ".cache", "plugin")
+			checkLink := func() {
+				t.Helper()
+				if content, err := ioutil.ReadFile(link); err != nil {
+					t.Errorf("failed to read %s: %s", link, err.Error())
+				} else if string(content) != "config" {
+					t.Errorf("expected %s has %q but got %q", link, "config", string(content))
+				}
+			}
 
-	// (F, H)
-	for _, tt := range []struct {
-		value int
-		path  string
-	}{
-		{f, userVimrc},
-		{h, userGvimrc},
-	} {
-		if tt.value >= 0 {
-			if tt.value == 1 && !pathutil.Exists(tt.path) {
-				t.Errorf("expected %s was installed but not installed", tt.path)
+			// =============== run =============== //
+
+			out, err = testutil.RunVolt("build")
+			// (A, B)
+			testutil.SuccessExit(t, out, err)
+			// (a)
+			checkLink()
+			// (b)
+			if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+				t.Errorf("expected %s is created as a directory", dir)
 			}
-			if tt.value == 0 && pathutil.Exists(tt.path) {
-				t.Errorf("expected %s was not installed but installed", tt.path)
+
+			os.Remove(link)
+			out, err = testutil.RunVolt("build")
+			// (A, B)
+			testutil.SuccessExit(t, out, err)
+			// (c)
+			checkLink()
+
+			// lockjson.Write() rejects it, so rewrite lock.json directly
+			content, err := ioutil.ReadFile(pathutil.LockJSON())
+			if err != nil {
+				t.Fatal("failed to read lock.json: " + err.Error())
+			}
+			content = []byte(strings.Replace(string(content), "~/.cache/plugin", "/etc/plugin", 1))
+			if err := ioutil.WriteFile(pathutil.LockJSON(), content, 0644); err != nil {
+				t.Fatal("failed to write lock.json: " + err.Error())
+			}
+			out, err = testutil.RunVolt("build")
+			// (!A, !B)
+			testutil.FailExit(t, out, err)
+			// (d)
+			if !strings.Contains(string(out), "post_install path") {
+				t.Errorf("expected the error of post_install path but got: %s", string(out))
 			}
+		})
+	}
+}
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) The time and disk usage of each strategy are shown
+// (b) ~/.vim/pack/volt is not created
+//
+// * Run `volt build -benchmark` (A, B, a, b)
+func TestVoltBuildBenchmark(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	reposPath := pathutil.ReposPath("localhost/local/benchmark")
+	plugin := filepath.Join(pathutil.FullReposPath(reposPath), "plugin", "benchmark.vim")
+	os.MkdirAll(filepath.Dir(plugin), 0755)
+	if err := ioutil.WriteFile(plugin, []byte("\" benchmark\n"), 0644); err != nil {
+		t.Fatal("failed to write " + plugin)
+	}
+	out, err := testutil.RunVolt("get", reposPath.String())
+	testutil.SuccessExit(t, out, err)
+	// 'volt get' builds it
+	if err := os.RemoveAll(pathutil.VimVoltDir()); err != nil {
+		t.Fatal("failed to remove " + pathutil.VimVoltDir())
+	}
+
+	// =============== run =============== //
+
+	out, err = testutil.RunVolt("build", "-benchmark")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	// (a)
+	for _, strategy := range testutil.AvailableStrategies() {
+		rx := regexp.MustCompile(`(?m)^` + strategy + `\t\d+ms\t\d+ bytes$`)
+		if !rx.Match(out) {
+			t.Errorf("expected the result of %s strategy but got: %s", strategy, string(out))
 		}
 	}
+	// (b)
+	if pathutil.Exists(pathutil.VimVoltDir()) {
+		t.Errorf("expected %s is not created", pathutil.VimVoltDir())
+	}
+}
 
-	// (G, I)
-	for _, tt := range []struct {
-		value int
-		path  string
-	}{
-		{g, userVimrc},
-		{i, userGvimrc},
-	} {
-		if tt.value >= 0 {
-			if tt.value == 1 && !(&builder.BaseBuilder{}).HasMagicComment(tt.path) {
-				t.Errorf("expected %s has magic comment but has no magic comment", tt.path)
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) doc/tags is not generated if "generate_helptags" of current profile is false
+// (b) doc/tags is generated if "generate_helptags" of current profile is true
+//
+// * Run `volt build -full` with "generate_helptags": false (A, B, a)
+// * Run `volt build -full` with "generate_helptags": true (A, B, b)
+func TestVoltBuildProfileGenerateHelptags(t *testing.T) {
+	for _, strategy := range testutil.AvailableStrategies() {
+		t.Run("strategy="+strategy, func(t *testing.T) {
+			// =============== setup =============== //
+
+			testutil.SetUpEnv(t)
+			testutil.InstallConfig(t, "strategy-"+strategy+".toml")
+			reposPath := pathutil.ReposPath("localhost/local/helptags")
+			doc := filepath.Join(pathutil.FullReposPath(reposPath), "doc", "helptags.txt")
+			os.MkdirAll(filepath.Dir(doc), 0755)
+			if err := ioutil.WriteFile(doc, []byte("*helptags.txt*\n"), 0644); err != nil {
+				t.Fatal("failed to write " + doc)
 			}
-			if tt.value == 0 && (&builder.BaseBuilder{}).HasMagicComment(tt.path) {
-				t.Errorf("expected %s was not installed but installed", tt.path)
+			out, err := testutil.RunVolt("get", reposPath.String())
+			testutil.SuccessExit(t, out, err)
+			tags := filepath.Join(pathutil.EncodeReposPath(reposPath), "doc", "tags")
+			// The symlink strategy generates tags in the source directory
+			os.Remove(filepath.Join(pathutil.FullReposPath(reposPath), "doc", "tags"))
+			setGenerateHelptags := func(generate bool) {
+				lockJSON, err := lockjson.Read()
+				if err != nil {
+					t.Fatal("lockjson.Read() failed: " + err.Error())
+				}
+				profile, err := lockJSON.Profiles.FindByName(lockJSON.CurrentProfileName)
+				if err != nil {
+					t.Fatal("lockJSON.Profiles.FindByName() failed: " + err.Error())
+				}
+				profile.GenerateHelptags = &generate
+				if err := lockJSON.Write(); err != nil {
+					t.Fatal("lockJSON.Write() failed: " + err.Error())
+				}
+			}
+
+			// =============== run =============== //
+
+			setGenerateHelptags(false)
+			out, err = testutil.RunVolt("build", "-full")
+			// (A, B)
+			testutil.SuccessExit(t, out, err)
+			// (a)
+			if pathutil.Exists(tags) {
+				t.Errorf("expected %s is not generated", tags)
+			}
+
+			setGenerateHelptags(true)
+			out, err = testutil.RunVolt("build", "-full")
+			// (A, B)
+			testutil.SuccessExit(t, out, err)
+			// (b)
+			if !pathutil.Exists(tags) {
+				t.Errorf("expected %s is generated", tags)
 			}
+		})
+	}
+}
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) `volt status` shows that build-info.json's profile differs from current profile
+// (b) `volt build` warns the mismatch and does full build
+// (c) `volt build` does smart build after that
+// (d) `volt profile set` does not warn the mismatch
+//
+// * Run `volt status` after changing "current_profile_name" of lock.json (A, !B, a)
+// * Run `volt build` (!A, B, b)
+// * Run `volt build` (A, B, c)
+// * Run `volt profile set default` (A, B, d)
+func TestVoltBuildProfileMismatch(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	testutil.InstallConfig(t, "strategy-copy.toml")
+	reposPath := pathutil.ReposPath("localhost/local/hello")
+	path := filepath.Join(pathutil.FullReposPath(reposPath), "plugin", "hello.vim")
+	os.MkdirAll(filepath.Dir(path), 0755)
+	if err := ioutil.WriteFile(path, []byte("\" hello\n"), 0644); err != nil {
+		t.Fatal("failed to write " + path)
+	}
+	out, err := testutil.RunVolt("get", reposPath.String())
+	testutil.SuccessExit(t, out, err)
+	out, err = testutil.RunVolt("profile", "new", "another")
+	testutil.SuccessExit(t, out, err)
+	lockJSON, err := lockjson.Read()
+	if err != nil {
+		t.Fatal("lockjson.Read() failed: " + err.Error())
+	}
+	lockJSON.CurrentProfileName = "another"
+	if err := lockJSON.Write(); err != nil {
+		t.Fatal("lockJSON.Write() failed: " + err.Error())
+	}
+	reportFile := filepath.Join(pathutil.VoltPath(), "report.json")
+
+	// =============== run =============== //
+
+	out, err = testutil.RunVolt("status")
+	// (!B)
+	if err == nil {
+		t.Error("expected failure exit but exited with success")
+	}
+	// (A, a)
+	if expected := "profile: default -> another\n"; !strings.Contains(string(out), expected) ||
+		strings.Contains(string(out), "[WARN]") || strings.Contains(string(out), "[ERROR]") {
+		t.Errorf("expected %q but got %q", expected, string(out))
+	}
+
+	out, err = testutil.RunVolt("build", "-report", reportFile)
+	// (B)
+	if err != nil {
+		t.Errorf("expected success exit but exited with failure: %s\n%s", err, string(out))
+	}
+	// (b)
+	if !strings.Contains(string(out), "[WARN]") || !strings.Contains(string(out), "built for profile 'default'") {
+		t.Errorf("expected the profile mismatch is warned but got: %s", string(out))
+	}
+	if report := readBuildReport(t, reportFile); !report.Success || !report.Full || report.Profile != "another" {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if pathutil.Exists(pathutil.EncodeReposPath(reposPath)) {
+		t.Errorf("expected %s is removed by full build", pathutil.EncodeReposPath(reposPath))
+	}
+
+	out, err = testutil.RunVolt("build", "-report", reportFile)
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	// (c)
+	if report := readBuildReport(t, reportFile); !report.Success || report.Full {
+		t.Errorf("unexpected report: %+v", report)
+	}
+
+	out, err = testutil.RunVolt("profile", "set", "default")
+	// (A, B, d)
+	testutil.SuccessExit(t, out, err)
+	if !pathutil.Exists(pathutil.EncodeReposPath(reposPath)) {
+		t.Errorf("expected %s is installed", pathutil.EncodeReposPath(reposPath))
+	}
+}
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) The repository is installed if "tree_hash" matches the locked revision
+// (b) The repository is not installed if "tree_hash" differs
+//
+// * Run `volt build -full` with "tree_hash" of the locked revision (A, B, a)
+// * Run `volt build -full` with "tree_hash" of other revision (!A, !B, b)
+func TestVoltBuildTreeHash(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	testutil.InstallConfig(t, "strategy-copy.toml")
+	reposPath := pathutil.ReposPath("localhost/local/treehash")
+	first := setUpLocalGitRepos(t, reposPath)
+	r, err := git.PlainOpen(pathutil.FullReposPath(reposPath))
+	if err != nil {
+		t.Fatal("git.PlainOpen() failed: " + err.Error())
+	}
+	head, err := gitutil.GetHEADRepository(r)
+	if err != nil {
+		t.Fatal("gitutil.GetHEADRepository() failed: " + err.Error())
+	}
+	setTreeHash := func(version string) string {
+		treeHash, err := gitutil.GetTreeHash(r, version)
+		if err != nil {
+			t.Fatal("gitutil.GetTreeHash() failed: " + err.Error())
+		}
+		lockJSON, err := lockjson.Read()
+		if err != nil {
+			t.Fatal("lockjson.Read() failed: " + err.Error())
+		}
+		repos, err := lockJSON.Repos.FindByPath(reposPath)
+		if err != nil {
+			t.Fatal("lockJSON.Repos.FindByPath() failed: " + err.Error())
 		}
+		repos.TreeHash = treeHash
+		if err := lockJSON.Write(); err != nil {
+			t.Fatal("lockJSON.Write() failed: " + err.Error())
+		}
+		return treeHash
+	}
+	installed := filepath.Join(pathutil.EncodeReposPath(reposPath), "hello")
+
+	// =============== run =============== //
+
+	setTreeHash(head)
+	out, err := testutil.RunVolt("build", "-full")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	// (a)
+	if !pathutil.Exists(installed) {
+		t.Errorf("expected %s is installed", installed)
+	}
+
+	tampered := setTreeHash(first.String())
+	out, err = testutil.RunVolt("build", "-full")
+	// (!A, !B)
+	testutil.FailExit(t, out, err)
+	// (b)
+	if !strings.Contains(string(out), "tree_hash of lock.json is "+tampered) {
+		t.Errorf("expected the tree hash mismatch is reported but got: %s", string(out))
+	}
+	if pathutil.Exists(installed) {
+		t.Errorf("expected %s is not installed", installed)
 	}
 }
 
-func checkSyntax(t *testing.T, bundledPlugconf string) {
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) The report is written even if the build failed
+// (b) The report has the outcome of each repository
+//
+// * Run `volt build -report {file}` which fails for a repository (!B, a, b)
+// * Run `volt build -report {file}` after fixing the repository (A, B, a, b)
+func TestVoltBuildReport(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	testutil.InstallConfig(t, "strategy-copy.toml")
+	names := []string{"alpha", "bravo", "charlie"}
+	args := []string{"get"}
+	for _, name := range names {
+		path := filepath.Join(pathutil.FullReposPath(pathutil.ReposPath("localhost/local/"+name)), "plugin", name+".vim")
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte("\" "+name+"\n"), 0644); err != nil {
+			t.Fatal("failed to write " + path)
+		}
+		args = append(args, "localhost/local/"+name)
+	}
+	out, err := testutil.RunVolt(args...)
+	testutil.SuccessExit(t, out, err)
+
+	// bravo is up to date, alpha is modified in the same second as the last
+	// build, and copying charlie fails (the subdir does not exist)
+	past := time.Now().Add(-time.Hour)
+	filepath.Walk(pathutil.FullReposPath("localhost/local/bravo"), func(path string, _ os.FileInfo, err error) error {
+		if err == nil {
+			err = os.Chtimes(path, past, past)
+		}
+		return err
+	})
+	setSubdir(t, "vim", "localhost/local/charlie")
+	reportFile := filepath.Join(pathutil.VoltPath(), "report.json")
+
+	// =============== run =============== //
+
+	out, err = testutil.RunVolt("build", "-report", reportFile)
+	// (!B)
+	testutil.FailExit(t, out, err)
+	// (a)
+	report := readBuildReport(t, reportFile)
+	if report.Success || report.Error == "" || report.Profile != "default" || report.Strategy != config.CopyBuilder || report.Full {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	// (b)
+	expected := map[pathutil.ReposPath]string{
+		"localhost/local/alpha":   builder.ReportInstalled,
+		"localhost/local/bravo":   builder.ReportSkipped,
+		"localhost/local/charlie": builder.ReportFailed,
+	}
+	if len(report.Repos) != len(expected) {
+		t.Errorf("expected %d repositories but got: %+v", len(expected), report.Repos)
+	}
+	for _, r := range report.Repos {
+		if r.Status != expected[r.Path] {
+			t.Errorf("%s: expected %q but got %q", r.Path, expected[r.Path], r.Status)
+		}
+		if r.Status == builder.ReportInstalled && r.Size != int64(len("\" alpha\n")) {
+			t.Errorf("%s: unexpected size %d", r.Path, r.Size)
+		}
+		if (r.Status == builder.ReportFailed) != (r.Error != "") {
+			t.Errorf("%s: unexpected error %q", r.Path, r.Error)
+		}
+	}
+
+	setSubdir(t, "", "localhost/local/charlie")
+	out, err = testutil.RunVolt("build", "-full", "-report", reportFile)
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	// (a)
+	report = readBuildReport(t, reportFile)
+	if !report.Success || report.Error != "" || !report.Full {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	// (b)
+	if len(report.Repos) != len(expected) {
+		t.Errorf("expected %d repositories but got: %+v", len(expected), report.Repos)
+	}
+	for _, r := range report.Repos {
+		if r.Status != builder.ReportInstalled || r.Size == 0 {
+			t.Errorf("%s: expected installed files but got: %+v", r.Path, r)
+		}
+	}
+}
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) Only the report is shown to stdout as JSON
+// (b) The report has the type and outcome of each repository,
+//     and the error of the failed repository
+//
+// * Run `volt build -format json` which fails for a repository (!B, a, b)
+// * Run `volt build -format json` after fixing the repository (A, B, a, b)
+// * Run `volt build -format xml` (!A, !B)
+func TestVoltBuildFormatJSON(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	testutil.InstallConfig(t, "strategy-copy.toml")
+	args := []string{"get"}
+	for _, name := range []string{"alpha", "charlie"} {
+		path := filepath.Join(pathutil.FullReposPath(pathutil.ReposPath("localhost/local/"+name)), "plugin", name+".vim")
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte("\" "+name+"\n"), 0644); err != nil {
+			t.Fatal("failed to write " + path)
+		}
+		args = append(args, "localhost/local/"+name)
+	}
+	out, err := testutil.RunVolt(args...)
+	testutil.SuccessExit(t, out, err)
+
+	// Copying charlie fails (the subdir does not exist)
+	setSubdir(t, "vim", "localhost/local/charlie")
+
+	runBuild := func() (*builder.Report, string, error) {
+		t.Helper()
+		cmd := testutil.VoltCommand("build", "-format", "json")
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		err := cmd.Run()
+		var report builder.Report
+		if e := json.Unmarshal(stdout.Bytes(), &report); e != nil {
+			t.Fatalf("stdout is not JSON: %s: %s", e.Error(), stdout.String())
+		}
+		return &report, stderr.String(), err
+	}
+
+	// =============== run =============== //
+
+	report, stderr, err := runBuild()
+	// (!B)
+	if err == nil {
+		t.Error("expected failure exit but exited with success")
+	}
+	// (a)
+	if !strings.Contains(stderr, "[ERROR]") {
+		t.Errorf("expected the error is shown to stderr but got: %s", stderr)
+	}
+	if report.Success || report.Error == "" || report.Profile != "default" {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	// (b)
+	expected := map[pathutil.ReposPath]string{
+		"localhost/local/alpha":   builder.ReportInstalled,
+		"localhost/local/charlie": builder.ReportFailed,
+	}
+	if len(report.Repos) != len(expected) {
+		t.Errorf("expected %d repositories but got: %+v", len(expected), report.Repos)
+	}
+	for _, r := range report.Repos {
+		if r.Status != expected[r.Path] || r.Type != lockjson.ReposStaticType {
+			t.Errorf("%s: unexpected result: %+v", r.Path, r)
+		}
+		if (r.Status == builder.ReportFailed) != (r.Error != "") {
+			t.Errorf("%s: unexpected error %q", r.Path, r.Error)
+		}
+	}
+
+	setSubdir(t, "", "localhost/local/charlie")
+	report, stderr, err = runBuild()
+	// (A, B)
+	testutil.SuccessExit(t, []byte(stderr), err)
+	if stderr != "" {
+		t.Errorf("expected no messages but got: %s", stderr)
+	}
+	// (a)
+	if !report.Success || report.Error != "" {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	// (b)
+	for _, r := range report.Repos {
+		if r.Status != builder.ReportInstalled && r.Status != builder.ReportSkipped {
+			t.Errorf("%s: unexpected result: %+v", r.Path, r)
+		}
+	}
+
+	out, err = testutil.RunVolt("build", "-format", "xml")
+	// (!A, !B)
+	testutil.FailExit(t, out, err)
+}
+
+func readBuildReport(t *testing.T, path string) *builder.Report {
 	t.Helper()
-	r, err := os.Open(bundledPlugconf)
+	content, err := ioutil.ReadFile(path)
 	if err != nil {
-		t.Errorf("failed to open %s: %s", bundledPlugconf, err.Error())
+		t.Fatal("failed to read report: " + err.Error())
 	}
-	_, err = vimlparser.ParseFile(r, bundledPlugconf, nil)
-	if err != nil {
-		t.Errorf("failed to parse %s: %s", bundledPlugconf, err.Error())
+	var report builder.Report
+	if err := json.Unmarshal(content, &report); err != nil {
+		t.Fatal("json.Unmarshal() failed: " + err.Error())
 	}
+	return &report
 }
@@ -1,25 +1,55 @@
 package builder
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/vim-volt/volt/cmd/buildinfo"
 	"github.com/vim-volt/volt/fileutil"
+	"github.com/vim-volt/volt/gitutil"
 	"github.com/vim-volt/volt/lockjson"
 	"github.com/vim-volt/volt/logger"
 	"github.com/vim-volt/volt/pathutil"
+	"github.com/vim-volt/volt/plugconf"
+	"github.com/vim-volt/volt/vimutil"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/gitignore"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
 )
 
-type BaseBuilder struct{}
+type BaseBuilder struct {
+	opts Options
+	// Limits the number of repositories which goReposAction() processes
+	// at the same time. nil means no limit
+	reposSem chan struct{}
+	// Limits the number of Vim processes which run ":helptags" at the same
+	// time. nil means no limit
+	helptagsSem chan struct{}
+}
 
 func (builder *BaseBuilder) installVimrcAndGvimrc(profileName, vimrcPath, gvimrcPath string) error {
+	if builder.opts.NoVimrc {
+		logger.Info("Skipping installation of vimrc and gvimrc ...")
+		return nil
+	}
+
+	logger.Info("Installing vimrc and gvimrc ...")
+
 	// Save old vimrc file as {vimrc}.bak
 	vimrcInfo, err := os.Stat(vimrcPath)
 	if err != nil && !os.IsNotExist(err) {
@@ -78,7 +108,17 @@ func (builder *BaseBuilder) installRCFile(profileName, srcRCFileName, dst string
 			if !pathutil.Exists(src) {
 				return nil
 			}
-			return errors.New("'" + dst + "' does not have magic comment")
+			if !builder.opts.BackupRC {
+				return errors.New("'" + dst + "' does not have magic comment")
+			}
+			return builder.backupAndInstallRCFile(profileName, srcRCFileName, dst)
+		}
+	}
+
+	// Show why the installed file is updated
+	if pathutil.Exists(dst) {
+		if err := builder.VerifyRCFile(profileName, srcRCFileName, dst); err != nil {
+			logger.Info("Updating " + dst + " (" + err.Error() + ")")
 		}
 	}
 
@@ -93,12 +133,169 @@ func (builder *BaseBuilder) installRCFile(profileName, srcRCFileName, dst string
 		return nil
 	}
 
-	return builder.copyFileWithMagicComment(src, dst)
+	if err := builder.copyFileWithMagicComment(src, dst); err != nil {
+		return err
+	}
+	if err := builder.VerifyRCFile(profileName, srcRCFileName, dst); err != nil {
+		return errors.New("failed to install " + dst + ": " + err.Error())
+	}
+	return nil
+}
+
+// Renames user's rc file dst (which does not have magic comment) to
+// {dst}.pre-volt, and installs the rc file of the profile to dst.
+// An existing backup is not overwritten unless it has the same content as
+// dst (e.g. the previous build was rolled back after the backup).
+func (builder *BaseBuilder) backupAndInstallRCFile(profileName, srcRCFileName, dst string) error {
+	backup := dst + preVoltSuffix
+	if pathutil.Exists(backup) {
+		content, err := ioutil.ReadFile(dst)
+		if err != nil {
+			return err
+		}
+		old, err := ioutil.ReadFile(backup)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(content, old) {
+			return errors.New("could not back up '" + dst + "': '" + backup + "' already exists")
+		}
+	}
+	if err := os.Rename(dst, backup); err != nil {
+		return errors.New("could not back up '" + dst + "': " + err.Error())
+	}
+	logger.Info("Backed up " + dst + " to " + backup + " because it does not have magic comment")
+	return builder.installRCFile(profileName, srcRCFileName, dst)
+}
+
+// The suffix of the backup of user's rc file (see Options.BackupRC)
+const preVoltSuffix = ".pre-volt"
+
+// Returns true if installRCFile() changes dst (~/.vim/vimrc or ~/.vim/gvimrc).
+// The user's rc file which does not have magic comment is never changed.
+func (builder *BaseBuilder) RCFileChanged(profileName, srcRCFileName, dst string) (bool, error) {
+	src := filepath.Join(pathutil.RCDir(profileName), srcRCFileName)
+	if pathutil.Exists(dst) && !builder.HasMagicComment(dst) {
+		return false, nil
+	}
+	if !pathutil.Exists(src) {
+		return pathutil.Exists(dst), nil
+	}
+	if !pathutil.Exists(dst) {
+		return true, nil
+	}
+	srcContent, err := ioutil.ReadFile(src)
+	if err != nil {
+		return false, err
+	}
+	dstContent, err := ioutil.ReadFile(dst)
+	if err != nil {
+		return false, err
+	}
+	expected := magicCommentLine() + fmt.Sprintf(magicCommentNext, src) + string(srcContent)
+	return string(dstContent) != expected, nil
+}
+
+// VerifyRCFile returns error if the content of installed rc file dst
+// (~/.vim/vimrc or ~/.vim/gvimrc) without the magic comment differs from
+// the source rc file of the profile.
+// The user's rc file which does not have magic comment is not verified.
+func (builder *BaseBuilder) VerifyRCFile(profileName, srcRCFileName, dst string) error {
+	src := filepath.Join(pathutil.RCDir(profileName), srcRCFileName)
+	dstExists := pathutil.Exists(dst)
+	if dstExists && !builder.HasMagicComment(dst) {
+		return nil
+	}
+	if !pathutil.Exists(src) {
+		if dstExists {
+			return errors.New(dst + " is installed but " + src + " does not exist")
+		}
+		return nil
+	}
+	if !dstExists {
+		return errors.New(dst + " is not installed from " + src)
+	}
+	srcContent, err := ioutil.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	dstContent, err := ioutil.ReadFile(dst)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(stripMagicComment(dstContent), srcContent) {
+		return errors.New(dst + " differs from " + src)
+	}
+	return nil
+}
+
+// Returns content without the magic comment and "Original file" line
+// which copyFileWithMagicComment() writes
+func stripMagicComment(content []byte) []byte {
+	if n := matchMagicComment(content); n > 0 {
+		content = content[n:]
+	}
+	if !bytes.HasPrefix(content, []byte("\" Original file: ")) {
+		return content
+	}
+	if i := bytes.Index(content, []byte("\n\n")); i >= 0 {
+		return content[i+2:]
+	}
+	return content
 }
 
-const magicComment = "\" NOTE: this file was generated by volt. please modify original file.\n"
+// DefaultMagicComment is the first line of ~/.vim/vimrc and ~/.vim/gvimrc
+// which volt installs. volt overwrites (or removes) only the files which
+// start with the magic comment.
+const DefaultMagicComment = "\" NOTE: this file was generated by volt. please modify original file."
+
+// MagicCommentVersion in the magic comment is replaced with the volt version
+const MagicCommentVersion = "{version}"
+
 const magicCommentNext = "\" Original file: %s\n\n"
 
+var (
+	magicComment        = DefaultMagicComment
+	magicCommentVersion string
+)
+
+// SetMagicComment changes the magic comment (DefaultMagicComment by default)
+// which is written to installed vimrc and gvimrc ("build.magic_comment" of
+// config.toml). MagicCommentVersion in comment is replaced with version.
+// comment must be one line Vim comment (see config.ValidateMagicComment()).
+// The files which start with DefaultMagicComment, or comment with any
+// version, are still regarded as installed by volt.
+func SetMagicComment(comment, version string) {
+	magicComment = comment
+	magicCommentVersion = version
+}
+
+// Returns the magic comment line which is written to installed rc files
+func magicCommentLine() string {
+	return strings.Replace(magicComment, MagicCommentVersion, magicCommentVersion, -1) + "\n"
+}
+
+// Returns the length of the magic comment line (including newline) at the
+// beginning of content, or 0 if content does not start with the magic
+// comment or DefaultMagicComment. MagicCommentVersion matches any version.
+func matchMagicComment(content []byte) int {
+	for _, comment := range []string{magicComment, DefaultMagicComment} {
+		parts := strings.Split(comment, MagicCommentVersion)
+		for i := range parts {
+			parts[i] = regexp.QuoteMeta(parts[i])
+		}
+		rx := regexp.MustCompile(`^` + strings.Join(parts, `[^\n]*`) + `\r?\n`)
+		if loc := rx.FindIndex(content); loc != nil {
+			return loc[1]
+		}
+	}
+	return 0
+}
+
+// The maximum number of bytes read from the beginning of a file to find the
+// magic comment line
+const maxMagicCommentLen = 4096
+
 // Return error if the magic comment does not exist
 func (*BaseBuilder) HasMagicComment(dst string) bool {
 	r, err := os.Open(dst)
@@ -107,19 +304,15 @@ func (*BaseBuilder) HasMagicComment(dst string) bool {
 	}
 	defer r.Close()
 
-	magic := []byte(magicComment)
-	read := make([]byte, len(magic))
-	n, err := r.Read(read)
-	if err != nil || n < len(magicComment) {
+	// Read() may return fewer bytes than requested even if the file has more,
+	// and the file may be shorter than the buffer (then there is no magic
+	// comment if it does not fit)
+	read := make([]byte, maxMagicCommentLen)
+	n, err := io.ReadFull(r, read)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
 		return false
 	}
-
-	for i := range magic {
-		if magic[i] != read[i] {
-			return false
-		}
-	}
-	return true
+	return matchMagicComment(read[:n]) > 0
 }
 
 func (builder *BaseBuilder) copyFileWithMagicComment(src, dst string) (err error) {
@@ -144,7 +337,7 @@ func (builder *BaseBuilder) copyFileWithMagicComment(src, dst string) (err error
 		}
 	}()
 
-	_, err = w.Write([]byte(magicComment))
+	_, err = w.Write([]byte(magicCommentLine()))
 	if err != nil {
 		return
 	}
@@ -157,13 +350,255 @@ func (builder *BaseBuilder) copyFileWithMagicComment(src, dst string) (err error
 	return
 }
 
+// Write bundled plugconf to a temporary file and rename it to
+// ~/.vim/pack/volt/start/system/plugin/bundled_plugconf.vim.
+// This must be called after all repositories were installed successfully
+// so that the previous bundled plugconf remains when the build failed.
+func (*BaseBuilder) writeBundledPlugconf(content []byte) error {
+	bundled := pathutil.BundledPlugConf()
+	os.MkdirAll(filepath.Dir(bundled), 0755)
+	tmp, err := ioutil.TempFile(filepath.Dir(bundled), ".bundled_plugconf")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(content)
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), bundled)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return errors.New("failed to write bundled plugconf: " + err.Error())
+	}
+	return nil
+}
+
 type actionReposResult struct {
 	err   error
 	repos *lockjson.Repos
 	files buildinfo.FileMap
+	sizes map[string]int64
+	// True if the repository was copied instead of linked (symlink builder)
+	copied bool
+	// Set by goReposAction()
+	duration time.Duration
+	size     int64
+	digest   string
+}
+
+// reposTimeoutError is returned when copying (or linking) a repository
+// did not finish within Options.ReposTimeout
+type reposTimeoutError struct {
+	reposPath pathutil.ReposPath
+	timeout   time.Duration
+}
+
+func (e *reposTimeoutError) Error() string {
+	return "timed out copying repository '" + e.reposPath.String() + "' after " + e.timeout.String()
+}
+
+// goReposAction calls withReposTimeout() in a new goroutine.
+// At most Options.Jobs goroutines call it at the same time.
+// If Options.NoParallel is true, it is called in the current goroutine,
+// so done must have enough buffer for the result.
+// The result has the duration, the digest of the installed files (see
+// installedDigest()), and the installed size if Options.Report is not nil.
+// f is not called if ctx was already cancelled (e.g. the build was
+// interrupted), and the error of ctx is sent instead.
+func (builder *BaseBuilder) goReposAction(ctx context.Context, repos *lockjson.Repos, done chan actionReposResult, f func(context.Context, chan actionReposResult)) {
+	action := func() {
+		if err := ctx.Err(); err != nil {
+			done <- actionReposResult{
+				err:   err,
+				repos: repos,
+			}
+			return
+		}
+		start := time.Now()
+		result := make(chan actionReposResult, 1)
+		builder.withReposTimeout(ctx, repos, result, f)
+		r := <-result
+		if r.repos == nil {
+			r.repos = repos
+		}
+		r.duration = time.Since(start)
+		if r.err == nil {
+			r.digest = installedDigest(repos, r.files)
+			// The hashed directory name can't be decoded without the mapping
+			if err := pathutil.RecordEncodedName(repos.Path); err != nil {
+				logger.Warnf("%s: could not write %s: %s", repos.Path, pathutil.EncodedNamesJSON(), err.Error())
+			}
+		}
+		if builder.opts.Report != nil && r.err == nil {
+			r.size = installedSize(repos)
+		}
+		done <- r
+	}
+	if builder.opts.NoParallel {
+		action()
+		return
+	}
+	go func() {
+		if builder.reposSem != nil {
+			builder.reposSem <- struct{}{}
+			defer func() { <-builder.reposSem }()
+		}
+		action()
+	}()
+}
+
+// Returns the digest of the files installed to the directory of repos
+// (see buildinfo.FileMap.DigestV1()). files are the blob hashes of the
+// installed files if they are known, otherwise the installed files are read.
+// doc/tags files are not included because ":helptags" generates them.
+// Returns empty string if the directory is a symlink (symlink strategy),
+// or if it could not be read.
+func installedDigest(repos *lockjson.Repos, files buildinfo.FileMap) string {
+	dst := repos.EncodedPath()
+	if fi, err := os.Lstat(dst); err != nil || !fi.IsDir() {
+		return ""
+	}
+	if files == nil {
+		hashes, err := hashDir(dst, nil)
+		if err != nil {
+			logger.Debugf("%s: could not compute digest: %s", repos.Path, err.Error())
+			return ""
+		}
+		return buildinfo.FileMap(hashes).DigestV1()
+	}
+	installed := make(buildinfo.FileMap, len(files))
+	for name, hash := range files {
+		if !isHelptagsFile(name) {
+			installed[name] = hash
+		}
+	}
+	return installed.DigestV1()
+}
+
+// Show the result of a repository with the number of received results
+// (n) and all results (total) like "[3/10] Installing ... Done."
+func (*BaseBuilder) progressRepos(result *actionReposResult, n, total int) {
+	if result.repos == nil {
+		return
+	}
+	status := "Done."
+	if result.err != nil {
+		status = "Failed."
+	}
+	logger.Progressf("[%d/%d] Installing %s repository %s ... %s", n, total, result.repos.Type, result.repos.Path, status)
+}
+
+// Returns the indexes of reposList in the order to be processed.
+// If Options.NoParallel is true, they are sorted by the installed path
+// (encoded repository path) to make the order deterministic.
+func (builder *BaseBuilder) reposOrder(reposList lockjson.ReposList) []int {
+	order := make([]int, len(reposList))
+	for i := range order {
+		order[i] = i
+	}
+	if builder.opts.NoParallel {
+		sort.SliceStable(order, func(i, j int) bool {
+			return reposList[order[i]].EncodedPath() < reposList[order[j]].EncodedPath()
+		})
+	}
+	return order
+}
+
+// withReposTimeout calls f which must send one result to the given channel.
+// If f does not finish within Options.ReposTimeout, the timeout error is sent
+// to done instead, and the context given to f is cancelled.
+func (builder *BaseBuilder) withReposTimeout(ctx context.Context, repos *lockjson.Repos, done chan actionReposResult, f func(context.Context, chan actionReposResult)) {
+	if builder.opts.ReposTimeout <= 0 {
+		f(ctx, done)
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, builder.opts.ReposTimeout)
+	defer cancel()
+
+	result := make(chan actionReposResult, 1)
+	go f(ctx, result)
+	select {
+	case r := <-result:
+		done <- r
+	case <-ctx.Done():
+		err := ctx.Err()
+		if err == context.DeadlineExceeded {
+			err = &reposTimeoutError{repos.Path, builder.opts.ReposTimeout}
+		}
+		done <- actionReposResult{
+			err:   err,
+			repos: repos,
+		}
+	}
+}
+
+// Returns error if the vim is too old for volt's pack-based layout.
+// Only shows warning if the vim version could not be detected.
+func (*BaseBuilder) checkVimVersion(vimExePath string) error {
+	info, err := vimutil.CheckVersion(vimExePath)
+	if err != nil && info == nil {
+		logger.Warn("Could not check vim version: " + err.Error())
+		return nil
+	}
+	return err
+}
+
+// Show warnings about the repositories whose requirements (s:requires() in
+// plugconf) are not satisfied by the vim.
+// If Options.Strict is true, returns error instead.
+func (builder *BaseBuilder) checkRequirements(vimExePath, profileName string, reposList lockjson.ReposList) error {
+	requires, merr := plugconf.RequirementsOf(profileName, reposList)
+	if merr.ErrorOrNil() != nil {
+		return merr
+	}
+	if len(requires) == 0 {
+		return nil
+	}
+	info, _ := vimutil.CheckVersion(vimExePath)
+	if info == nil {
+		// checkVimVersion() already showed the warning
+		return nil
+	}
+	var unsatisfied *multierror.Error
+	for i := range reposList {
+		for _, requirement := range requires[reposList[i].Path] {
+			if err := info.Satisfies(requirement); err != nil {
+				unsatisfied = multierror.Append(unsatisfied,
+					errors.New(reposList[i].Path.String()+" requires "+requirement+": "+err.Error()))
+			}
+		}
+	}
+	if unsatisfied.ErrorOrNil() == nil {
+		return nil
+	}
+	if builder.opts.Strict {
+		return unsatisfied
+	}
+	for _, err := range unsatisfied.Errors {
+		logger.Warn(err.Error())
+	}
+	return nil
 }
 
 func (builder *BaseBuilder) getCurrentReposList(lockJSON *lockjson.LockJSON) (lockjson.ReposList, error) {
+	reposList, err := builder.getUnresolvedReposList(lockJSON)
+	if err != nil {
+		return nil, err
+	}
+	if err := ResolveVersions(reposList); err != nil {
+		return nil, err
+	}
+	return reposList, nil
+}
+
+// Same as getCurrentReposList() but the versions are not resolved to commit
+// hashes, so that Preflight() can report all unresolvable versions at once
+func (builder *BaseBuilder) getUnresolvedReposList(lockJSON *lockjson.LockJSON) (lockjson.ReposList, error) {
 	// Find current profile
 	profile, err := lockJSON.Profiles.FindByName(lockJSON.CurrentProfileName)
 	if err != nil {
@@ -173,27 +608,637 @@ func (builder *BaseBuilder) getCurrentReposList(lockJSON *lockjson.LockJSON) (lo
 	}
 
 	reposList, err := lockJSON.GetReposListByProfile(profile)
-	return reposList, err
+	if err != nil {
+		return nil, err
+	}
+	reposList = uniqReposList(reposList)
+	if len(builder.opts.SkipRepos) > 0 {
+		filtered := make(lockjson.ReposList, 0, len(reposList))
+		for i := range reposList {
+			if !builder.opts.SkipRepos[reposList[i].Path] {
+				filtered = append(filtered, reposList[i])
+			}
+		}
+		reposList = filtered
+	}
+	for i := range reposList {
+		if version, exists := builder.opts.VersionOverrides[reposList[i].Path]; exists {
+			reposList[i].Version = version
+		}
+	}
+	return reposList, nil
+}
+
+// Drops the repositories whose path appears earlier in reposList.
+// lockjson.Read() rejects such a profile, but the repositories installed
+// twice to the same directory would race each other.
+func uniqReposList(reposList lockjson.ReposList) lockjson.ReposList {
+	seen := make(map[pathutil.ReposPath]bool, len(reposList))
+	uniq := make(lockjson.ReposList, 0, len(reposList))
+	for i := range reposList {
+		if seen[reposList[i].Path] {
+			logger.Warnf("%s: duplicate repos in the profile, ignored", reposList[i].Path)
+			continue
+		}
+		seen[reposList[i].Path] = true
+		uniq = append(uniq, reposList[i])
+	}
+	return uniq
 }
 
-func (builder *BaseBuilder) helptags(reposPath pathutil.ReposPath, vimExePath string) error {
-	// Do nothing if <reposPath>/doc directory doesn't exist
-	docdir := filepath.Join(pathutil.EncodeReposPath(reposPath), "doc")
+// ResolveVersions replaces tag and branch names in "version" of git
+// repositories with the commit hashes which they point to, so that the
+// builders and build-info.json always handle commit hashes.
+// Full commit hashes are kept as is without opening the repositories.
+func ResolveVersions(reposList lockjson.ReposList) error {
+	for i := range reposList {
+		repos := &reposList[i]
+		if repos.Type != lockjson.ReposGitType || gitutil.IsFullHash(repos.Version) {
+			continue
+		}
+		src := pathutil.FullReposPath(repos.Path)
+		if !pathutil.Exists(src) {
+			// Preflight reports it
+			continue
+		}
+		r, err := git.PlainOpen(src)
+		if err != nil {
+			return errors.New(repos.Path.String() + ": failed to open repository: " + err.Error())
+		}
+		hash, err := gitutil.ResolveVersion(r, repos.Version)
+		if err != nil {
+			return errors.New(repos.Path.String() + ": " + err.Error())
+		}
+		logger.Debugf("%s: resolved version %s to %s", repos.Path, repos.Version, hash)
+		repos.Version = hash
+	}
+	return nil
+}
+
+// Write files of the locked revision's tree object to dst, and run
+// ":helptags" to generate tags file.
+// This works for bare repositories (e.g. a cache of repositories shared by
+// several repos path), and is used by both copy and symlink strategies.
+// Returns the blob hashes and sizes of the written files.
+func (builder *BaseBuilder) installGitTree(ctx context.Context, r *git.Repository, dst string, repos *lockjson.Repos, vimExePath string) (buildinfo.FileMap, map[string]int64, error) {
+	files, sizes, err := builder.extractGitTree(ctx, r, dst, repos)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Run ":helptags" to generate tags file
+	if err := builder.helptags(ctx, repos, vimExePath); err != nil {
+		return nil, nil, err
+	}
+	return files, sizes, nil
+}
+
+// Write files of the locked revision's tree object to dst (see also
+// ExtractGitTree()). Returns the blob hashes and sizes of the written files
+// except doc/tags.
+func (builder *BaseBuilder) extractGitTree(ctx context.Context, r *git.Repository, dst string, repos *lockjson.Repos) (buildinfo.FileMap, map[string]int64, error) {
+	commitObj, err := builder.lockedCommit(r, repos)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The files are written in the order of the tree, and their modification
+	// times are set to the commit time like packReposGit(), so the extracted
+	// files are the same every time
+	modTime := commitObj.Committer.When
+	dirs := map[string]bool{dst: true}
+
+	// Copy files
+	files := make(buildinfo.FileMap, 512)
+	sizes := make(map[string]int64, 512)
+	err = builder.walkInstalledGitFiles(ctx, r, commitObj, repos, func(file *object.File, osMode os.FileMode) error {
+		filename := filepath.Join(dst, file.Name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			return errors.New("failed to create directory: " + err.Error())
+		}
+		for dir := filepath.Dir(filename); !dirs[dir]; dir = filepath.Dir(dir) {
+			dirs[dir] = true
+		}
+		if err := writeGitFile(file, filename, osMode); err != nil {
+			return err
+		}
+		if err := os.Chtimes(filename, modTime, modTime); err != nil {
+			return errors.New("failed to set modification time: " + err.Error())
+		}
+		if builder.opts.VerifyCopy != "" {
+			if err := verifyGitFile(file, filename, builder.opts.VerifyCopy == VerifyCopyChecksum); err != nil {
+				return err
+			}
+		}
+
+		// doc/tags is re-generated by ":helptags" after it was written
+		if !isHelptagsFile(file.Name) {
+			files[file.Name] = file.Hash.String() // blob hash
+			sizes[file.Name] = file.Size
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	// Set the times of directories after all files were created in them
+	for dir := range dirs {
+		if err := os.Chtimes(dir, modTime, modTime); err != nil && !os.IsNotExist(err) {
+			return nil, nil, errors.New("failed to set modification time: " + err.Error())
+		}
+	}
+	return files, sizes, nil
+}
+
+// Call fn with each file of the tree object of commitObj which copy strategy
+// installs (see walkGitTree()), and its mode to be installed.
+// The files larger than Options.MaxFileSize are skipped, and the bits of
+// Options.FileModeMask are cleared from the mode.
+func (builder *BaseBuilder) walkInstalledGitFiles(ctx context.Context, r *git.Repository, commitObj *object.Commit, repos *lockjson.Repos, fn func(file *object.File, mode os.FileMode) error) error {
+	return builder.walkGitTree(ctx, r, commitObj, repos, func(file *object.File) error {
+		// The size is known from the blob before reading its contents
+		if builder.isTooLarge(repos, file.Name, file.Size) {
+			return nil
+		}
+		osMode, err := file.Mode.ToOSFileMode()
+		if err != nil {
+			return errors.New("failed to convert file mode: " + err.Error())
+		}
+		return fn(file, osMode&^builder.opts.FileModeMask)
+	})
+}
+
+// Returns the commit object of the locked revision of repos
+func (builder *BaseBuilder) lockedCommit(r *git.Repository, repos *lockjson.Repos) (*object.Commit, error) {
+	var commitObj *object.Commit
+	err := builder.retryGit(repos, "reading commit", func() (err error) {
+		commitObj, err = r.CommitObject(plumbing.NewHash(repos.Version))
+		return err
+	})
+	if err != nil {
+		return nil, errors.New("failed to get HEAD commit object: " + err.Error())
+	}
+	return commitObj, nil
+}
+
+// Call fn with each file of the tree object of commitObj which is
+// installed: the files under subdir of repos, except the files matched by
+// .voltignore. The names of the files are relative to subdir.
+// The files of submodules are included (see walkSubmodules()).
+func (builder *BaseBuilder) walkGitTree(ctx context.Context, r *git.Repository, commitObj *object.Commit, repos *lockjson.Repos, fn func(file *object.File) error) error {
+	// Get tree hash of commit hash
+	tree, err := builder.sourceTree(r, commitObj, repos)
+	if err != nil {
+		return err
+	}
+
+	// Read .voltignore
+	var ignore gitignore.Matcher
+	if file, err := tree.File(voltignoreName); err == nil {
+		content, err := file.Contents()
+		if err != nil {
+			return errors.New("failed to read " + voltignoreName + ": " + err.Error())
+		}
+		ignore = parseVoltignore(content)
+	}
+
+	err = tree.Files().ForEach(func(file *object.File) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if isVoltignored(ignore, file.Name) {
+			return nil
+		}
+		return fn(file)
+	})
+	if err != nil {
+		return err
+	}
+	return builder.walkSubmodules(ctx, r, commitObj, tree, repos, ignore, fn)
+}
+
+// Write the contents of file to filename.
+// The blob is streamed instead of being read into memory at once, so large
+// files do not consume memory as much as their size.
+func writeGitFile(file *object.File, filename string, mode os.FileMode) (err error) {
+	r, err := file.Reader()
+	if err != nil {
+		return errors.New("failed to get file contents: " + err.Error())
+	}
+	defer func() {
+		if e := r.Close(); err == nil && e != nil {
+			err = errors.New("failed to get file contents: " + e.Error())
+		}
+	}()
+	w, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if e := w.Close(); err == nil {
+			err = e
+		}
+	}()
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// Re-reads filename which was written by writeGitFile(), and compares its
+// size (and SHA-1 as blob hash if checksum is true) with file. This detects
+// the files which were not written correctly without errors (e.g. truncated
+// when the disk was full).
+func verifyGitFile(file *object.File, filename string, checksum bool) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return errors.New("failed to verify installed file: " + err.Error())
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return errors.New("failed to verify installed file: " + err.Error())
+	}
+	if info.Size() != file.Size {
+		return fmt.Errorf("installed file %s has %d bytes but %s has %d bytes", filename, info.Size(), file.Name, file.Size)
+	}
+	if !checksum {
+		return nil
+	}
+	h := plumbing.NewHasher(plumbing.BlobObject, info.Size())
+	if _, err := io.Copy(h, f); err != nil {
+		return errors.New("failed to verify installed file: " + err.Error())
+	}
+	if hash := h.Sum(); hash != file.Hash {
+		return fmt.Errorf("installed file %s has SHA-1 %s but %s has %s", filename, hash, file.Name, file.Hash)
+	}
+	return nil
+}
+
+// Returns the first line of the commit message of the locked revision of
+// git repository. Returns empty string for static repository, or if the
+// commit cannot be read.
+func commitSubject(repos *lockjson.Repos) string {
+	if repos.Type != lockjson.ReposGitType {
+		return ""
+	}
+	r, err := git.PlainOpen(pathutil.FullReposPath(repos.Path))
+	if err != nil {
+		return ""
+	}
+	commitObj, err := r.CommitObject(plumbing.NewHash(repos.Version))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.SplitN(commitObj.Message, "\n", 2)[0])
+}
+
+// Returns true if the file (name is relative to the repository) is larger
+// than Options.MaxFileSize, and shows the warning that it is not installed
+func (builder *BaseBuilder) isTooLarge(repos *lockjson.Repos, name string, size int64) bool {
+	if builder.opts.MaxFileSize <= 0 || size <= builder.opts.MaxFileSize {
+		return false
+	}
+	logger.Warnf("%s: skipped %s (%d bytes) because it is larger than %d bytes",
+		repos.Path, filepath.ToSlash(name), size, builder.opts.MaxFileSize)
+	return true
+}
+
+// The wait before the first retry of a git operation. It is doubled on each
+// retry
+var gitRetryInterval = 100 * time.Millisecond
+
+// Calls f, and calls it again at most Options.GitRetries times with
+// exponential backoff while it fails with transient errors. what is the
+// operation shown in the warnings (e.g. "opening repository").
+func (builder *BaseBuilder) retryGit(repos *lockjson.Repos, what string, f func() error) error {
+	wait := gitRetryInterval
+	for i := 0; ; i++ {
+		err := f()
+		if err == nil || i >= builder.opts.GitRetries || !isTransientGitError(err) {
+			return err
+		}
+		logger.Warnf("%s: %s failed: %s", repos.Path, what, err.Error())
+		logger.Warnf("  Retrying in %s ... (%d/%d)", wait, i+1, builder.opts.GitRetries)
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+// Returns true if err may not occur when retried: opening or reading a file
+// of the repository failed (e.g. on network filesystems, or while antivirus
+// software scans it). Missing files, missing objects and invalid
+// repositories are not transient.
+func isTransientGitError(err error) bool {
+	if os.IsNotExist(err) {
+		return false
+	}
+	switch err.(type) {
+	case *os.PathError, *os.SyscallError:
+		return true
+	}
+	return err == io.ErrUnexpectedEOF
+}
+
+// Returns the tree object of the commit which is installed as the plugin
+// root (the subdirectory if repos.Subdir is not empty)
+func (builder *BaseBuilder) sourceTree(r *git.Repository, commitObj *object.Commit, repos *lockjson.Repos) (*object.Tree, error) {
+	var tree *object.Tree
+	err := builder.retryGit(repos, "reading tree", func() (err error) {
+		tree, err = r.TreeObject(commitObj.TreeHash)
+		return err
+	})
+	if err != nil {
+		return nil, errors.New("failed to get tree " + commitObj.Hash.String() + ": " + err.Error())
+	}
+	if repos.Subdir == "" {
+		return tree, nil
+	}
+	subtree, err := tree.Tree(repos.Subdir)
+	if err != nil {
+		return nil, errors.New("failed to get subdir '" + repos.Subdir + "' of tree " + commitObj.Hash.String() + ": " + err.Error())
+	}
+	return subtree, nil
+}
+
+// Run ":helptags" to generate tags file of the installed directory of repos
+func (builder *BaseBuilder) helptags(ctx context.Context, repos *lockjson.Repos, vimExePath string) error {
+	return builder.helptagsDir(ctx, repos, repos.EncodedPath(), vimExePath)
+}
+
+// Same as helptags() but generates tags file of path/doc instead of the
+// installed directory of repos
+func (builder *BaseBuilder) helptagsDir(ctx context.Context, repos *lockjson.Repos, path, vimExePath string) error {
+	if builder.opts.NoHelptags {
+		return nil
+	}
+	// Do nothing if <path>/doc directory doesn't exist
+	docdir := filepath.Join(path, "doc")
 	if !pathutil.Exists(docdir) {
 		return nil
 	}
-	// Execute ":helptags doc" in reposPath
-	vimArgs := builder.makeVimArgs(reposPath)
+	// Wait until the number of running Vim processes gets less than
+	// Options.HelptagsWorkers
+	if builder.helptagsSem != nil {
+		select {
+		case builder.helptagsSem <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		defer func() { <-builder.helptagsSem }()
+	}
+	// Execute ":helptags doc" in path
+	vimArgs := builder.makeVimArgs(path)
 	logger.Debugf("Executing '%s %s' ...", vimExePath, strings.Join(vimArgs, " "))
-	err := exec.Command(vimExePath, vimArgs...).Run()
+	err := exec.CommandContext(ctx, vimExePath, vimArgs...).Run()
 	if err != nil {
 		return errors.New("failed to make tags file: " + err.Error())
 	}
+	return builder.fixTags(repos, docdir)
+}
+
+// helptagsAll is the same as helptags() for each repository of reposList, but
+// runs ":helptags" for all of them in one Vim process.
+// The errors of ":helptags" (e.g. duplicate tags) are returned together with
+// the repository paths after the tags files of the other repositories were
+// made. Each repository is given Options.ReposTimeout (see
+// watchHelptagsProgress()).
+func (builder *BaseBuilder) helptagsAll(ctx context.Context, reposList []*lockjson.Repos, vimExePath string) error {
+	if builder.opts.NoHelptags {
+		return nil
+	}
+	// Skip the repositories which don't have <reposPath>/doc directory
+	targets := make([]*lockjson.Repos, 0, len(reposList))
+	docdirs := make([]string, 0, len(reposList))
+	for _, repos := range reposList {
+		docdir := filepath.Join(repos.EncodedPath(), "doc")
+		if pathutil.Exists(docdir) {
+			targets = append(targets, repos)
+			docdirs = append(docdirs, docdir)
+		}
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+
+	tempDir, err := ioutil.TempDir("", "volt-helptags-")
+	if err != nil {
+		return errors.New("failed to make tags files: " + err.Error())
+	}
+	defer os.RemoveAll(tempDir)
+	script := filepath.Join(tempDir, "helptags.vim")
+	errFile := filepath.Join(tempDir, "errors")
+	progressFile := filepath.Join(tempDir, "progress")
+	err = ioutil.WriteFile(script, []byte(makeHelptagsScript(docdirs, errFile, progressFile)), 0644)
+	if err != nil {
+		return errors.New("failed to make tags files: " + err.Error())
+	}
+
+	// Execute ":helptags {docdir}" for all docdirs
+	vimCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	timedOut := make(chan int, 1)
+	if builder.opts.ReposTimeout > 0 {
+		go builder.watchHelptagsProgress(vimCtx, cancel, progressFile, timedOut)
+	}
+	vimArgs := []string{"-u", "NONE", "-i", "NONE", "-N", "-e", "-s", "-S", script}
+	logger.Debugf("Executing '%s %s' ...", vimExePath, strings.Join(vimArgs, " "))
+	out, err := exec.CommandContext(vimCtx, vimExePath, vimArgs...).CombinedOutput()
+	select {
+	case i := <-timedOut:
+		if i < 0 || i >= len(targets) {
+			i = 0
+		}
+		return errors.New("timed out making tags file of '" + targets[i].Path.String() + "' after " + builder.opts.ReposTimeout.String())
+	default:
+	}
+	if err != nil {
+		msg := "failed to make tags files of " + strconv.Itoa(len(targets)) + " repositories: " + err.Error()
+		if s := strings.TrimSpace(string(out)); s != "" {
+			msg += ": " + s
+		}
+		return errors.New(msg)
+	}
+	failed := make(map[int]bool)
+	var merr *multierror.Error
+	if content, err := ioutil.ReadFile(errFile); err == nil {
+		for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+			// {index}<Tab>{exception}
+			fields := strings.SplitN(line, "\t", 2)
+			i, err := strconv.Atoi(fields[0])
+			if len(fields) != 2 || err != nil || i < 0 || i >= len(targets) {
+				continue
+			}
+			failed[i] = true
+			merr = multierror.Append(merr, errors.New(targets[i].Path.String()+": failed to make tags file: "+fields[1]))
+		}
+	}
+
+	for i := range targets {
+		if failed[i] {
+			continue
+		}
+		if err := builder.fixTags(targets[i], docdirs[i]); err != nil {
+			merr = multierror.Append(merr, err)
+		}
+	}
+	return merr.ErrorOrNil()
+}
+
+// The interval to check the progress of ":helptags" of helptagsAll()
+var helptagsProgressInterval = 100 * time.Millisecond
+
+// Cancels ":helptags" of helptagsAll() by cancel, and sends the index of the
+// repository to timedOut when ":helptags" of one repository did not finish
+// within Options.ReposTimeout. The index is read from progressFile, which
+// the script of makeHelptagsScript() writes before each ":helptags".
+// It returns when ctx is done.
+func (builder *BaseBuilder) watchHelptagsProgress(ctx context.Context, cancel context.CancelFunc, progressFile string, timedOut chan<- int) {
+	ticker := time.NewTicker(helptagsProgressInterval)
+	defer ticker.Stop()
+	current := -1
+	deadline := time.Now().Add(builder.opts.ReposTimeout)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if content, err := ioutil.ReadFile(progressFile); err == nil {
+			if i, err := strconv.Atoi(strings.TrimSpace(string(content))); err == nil && i != current {
+				current = i
+				deadline = time.Now().Add(builder.opts.ReposTimeout)
+			}
+		}
+		if time.Now().After(deadline) {
+			timedOut <- current
+			cancel()
+			return
+		}
+	}
+}
+
+// Returns Vim script which runs ":helptags" for each docdirs and writes the
+// errors to errFile.
+// The index of docdirs is written to progressFile before each ":helptags".
+// The script quits Vim at the end.
+func makeHelptagsScript(docdirs []string, errFile, progressFile string) string {
+	quote := func(s string) string {
+		return "'" + strings.Replace(s, "'", "''", -1) + "'"
+	}
+	var buf bytes.Buffer
+	buf.WriteString("let s:errors = []\n")
+	for i, docdir := range docdirs {
+		buf.WriteString("call writefile(['" + strconv.Itoa(i) + "'], " + quote(progressFile) + ")\n")
+		buf.WriteString("try\n")
+		buf.WriteString("  execute 'helptags' fnameescape(" + quote(docdir) + ")\n")
+		buf.WriteString("catch\n")
+		buf.WriteString("  call add(s:errors, '" + strconv.Itoa(i) + "' . \"\\t\" . v:exception)\n")
+		buf.WriteString("endtry\n")
+	}
+	buf.WriteString("if !empty(s:errors)\n")
+	buf.WriteString("  call writefile(s:errors, " + quote(errFile) + ")\n")
+	buf.WriteString("endif\n")
+	buf.WriteString("qall!\n")
+	return buf.String()
+}
+
+// Post-processes the tags files generated by ":helptags" in docdir
+// according to the options
+func (builder *BaseBuilder) fixTags(repos *lockjson.Repos, docdir string) error {
+	if builder.opts.HelpLanguages != nil {
+		if err := builder.removeOtherLangTags(docdir, builder.opts.HelpLanguages); err != nil {
+			return err
+		}
+	}
+	if patterns := builder.opts.ExcludeDocsFromTags[repos.Path]; len(patterns) > 0 {
+		return builder.excludeDocsFromTags(docdir, patterns)
+	}
+	return nil
+}
+
+// Remove doc/tags-{lang} files whose language is not in langs
+func (*BaseBuilder) removeOtherLangTags(docdir string, langs []string) error {
+	tagsFiles, err := filepath.Glob(filepath.Join(docdir, "tags-*"))
+	if err != nil {
+		return err
+	}
+	for _, tagsFile := range tagsFiles {
+		lang := strings.TrimPrefix(filepath.Base(tagsFile), "tags-")
+		kept := false
+		for i := range langs {
+			if langs[i] == lang {
+				kept = true
+				break
+			}
+		}
+		if kept {
+			continue
+		}
+		if err := os.Remove(tagsFile); err != nil {
+			return errors.New("failed to remove tags file: " + err.Error())
+		}
+	}
 	return nil
 }
 
-func (*BaseBuilder) makeVimArgs(reposPath pathutil.ReposPath) []string {
-	path := pathutil.EncodeReposPath(reposPath)
+// Remove the lines of doc/tags (and doc/tags-{lang}) which refer to the doc
+// files matching patterns. The doc files themselves are still installed.
+func (*BaseBuilder) excludeDocsFromTags(docdir string, patterns []string) error {
+	tagsFiles, err := filepath.Glob(filepath.Join(docdir, "tags*"))
+	if err != nil {
+		return err
+	}
+	for _, tagsFile := range tagsFiles {
+		base := filepath.Base(tagsFile)
+		if base != "tags" && !strings.HasPrefix(base, "tags-") {
+			continue
+		}
+		content, err := ioutil.ReadFile(tagsFile)
+		if err != nil {
+			return errors.New("failed to read tags file: " + err.Error())
+		}
+		lines := strings.SplitAfter(string(content), "\n")
+		kept := make([]string, 0, len(lines))
+		for _, line := range lines {
+			// {tag}<Tab>{file}<Tab>{pattern}
+			fields := strings.SplitN(line, "\t", 3)
+			if len(fields) == 3 && isExcludedDoc(fields[1], patterns) {
+				continue
+			}
+			kept = append(kept, line)
+		}
+		if len(kept) == len(lines) {
+			continue
+		}
+		// Do not overwrite the file in place because it may be hard-linked
+		// to the file of $VOLTPATH/repos
+		tmp := tagsFile + ".tmp"
+		err = ioutil.WriteFile(tmp, []byte(strings.Join(kept, "")), 0644)
+		if err == nil {
+			err = os.Rename(tmp, tagsFile)
+		}
+		if err != nil {
+			os.Remove(tmp)
+			return errors.New("failed to write tags file: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// Returns true if file (relative to doc directory) or its parent directory
+// matches one of patterns
+func isExcludedDoc(file string, patterns []string) bool {
+	file = filepath.ToSlash(file)
+	for ; file != "." && file != "/"; file = path.Dir(file) {
+		for _, pattern := range patterns {
+			if matched, _ := path.Match(pattern, file); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (*BaseBuilder) makeVimArgs(path string) []string {
 	return []string{
 		"-u", "NONE", "-i", "NONE", "-N",
 		"--cmd", "cd " + path,
@@ -1,7 +1,12 @@
 package builder
 
 import (
+	"context"
 	"errors"
+	"os"
+	"runtime"
+	"sort"
+	"time"
 
 	"github.com/vim-volt/volt/cmd/buildinfo"
 	"github.com/vim-volt/volt/config"
@@ -9,16 +14,119 @@ import (
 )
 
 type Builder interface {
-	Build(buildInfo *buildinfo.BuildInfo, buildReposMap map[pathutil.ReposPath]*buildinfo.Repos) error
+	// Preflight validates the current profile without modifying anything,
+	// and returns all found problems at once
+	Preflight() error
+	Build(ctx context.Context, buildInfo *buildinfo.BuildInfo, buildReposMap map[pathutil.ReposPath]*buildinfo.Repos) error
 }
 
-func Get(strategy string) (Builder, error) {
-	switch strategy {
-	case config.SymlinkBuilder:
-		return &symlinkBuilder{}, nil
-	case config.CopyBuilder:
-		return &copyBuilder{}, nil
-	default:
+// Options changes the behavior of Builder.Build()
+type Options struct {
+	// Do not install (or remove) ~/.vim/vimrc and ~/.vim/gvimrc
+	NoVimrc bool
+	// Rename ~/.vim/vimrc and ~/.vim/gvimrc which do not have magic comment
+	// to {name}.pre-volt and install the profile's ones, instead of failing
+	BackupRC bool
+	// Give up copying (or linking) a repository which takes longer than this.
+	// Zero means no timeout
+	ReposTimeout time.Duration
+	// The number of times to retry opening or reading a git repository which
+	// failed transiently. Zero does not retry
+	GitRetries int
+	// Glob patterns of doc files (relative to doc directory)
+	// which are excluded from doc/tags of the repository
+	ExcludeDocsFromTags map[pathutil.ReposPath][]string
+	// Do not run ":helptags" for any repositories
+	// ("generate_helptags" of current profile is false)
+	NoHelptags bool
+	// Languages of translated help whose doc/tags-{lang} files are kept
+	// after ":helptags". doc/tags (English) is always kept.
+	// nil keeps all languages
+	HelpLanguages []string
+	// The maximum number of Vim processes which run ":helptags" at the same
+	// time, regardless of how many repositories are copied concurrently.
+	// Zero means the number of CPUs
+	HelptagsWorkers int
+	// Fail when the vim does not satisfy s:requires() of plugconf.
+	// Otherwise only warnings are shown
+	Strict bool
+	// Commit hashes used instead of the locked revisions in lock.json.
+	// lock.json is not changed
+	VersionOverrides map[pathutil.ReposPath]string
+	// Do not install hidden files (dot-prefixed files and directories)
+	// of static repositories by copy strategy
+	NoHidden bool
+	// Static repositories whose hidden files are installed even if NoHidden
+	KeepHidden map[pathutil.ReposPath]bool
+	// Process repositories one by one in the order of installed path,
+	// instead of concurrently. This makes logs reproducible for debugging
+	NoParallel bool
+	// The maximum number of repositories which are copied (or linked) at the
+	// same time. Zero means the number of CPUs
+	Jobs int
+	// Repositories which are not installed though they are in the current
+	// profile (e.g. their source directories do not exist)
+	SkipRepos map[pathutil.ReposPath]bool
+	// Do not install the files larger than this (bytes) by copy strategy.
+	// Zero means no limit
+	MaxFileSize int64
+	// The permission bits which are cleared from the modes of installed
+	// files by copy strategy (e.g. 0111 to make all files non-executable).
+	// Zero preserves the modes of source files
+	FileModeMask os.FileMode
+	// Re-read the files extracted from git repositories after writing them,
+	// and fail if they differ from the blobs. VerifyCopySize compares only
+	// the sizes, and VerifyCopyChecksum compares the SHA-1 too.
+	// Empty does not verify
+	VerifyCopy string
+	// The results of repositories are recorded to this if not nil
+	Report *Report
+}
+
+// The values of Options.VerifyCopy
+const (
+	VerifyCopySize     = "size"
+	VerifyCopyChecksum = "checksum"
+)
+
+// Constructors of builders.
+// key: strategy name ("build.strategy" in config.toml)
+var builders = map[string]func(BaseBuilder) Builder{
+	config.SymlinkBuilder: func(base BaseBuilder) Builder { return &symlinkBuilder{base} },
+	config.CopyBuilder:    func(base BaseBuilder) Builder { return &copyBuilder{base} },
+}
+
+// NewBuilder returns the builder of strategy ("build.strategy" in config.toml).
+// opts may be nil.
+func NewBuilder(strategy string, opts *Options) (Builder, error) {
+	newBuilder, exists := builders[strategy]
+	if !exists {
 		return nil, errors.New("unknown builder type: " + strategy)
 	}
+	if opts == nil {
+		opts = &Options{}
+	}
+	jobs := opts.Jobs
+	if jobs <= 0 {
+		jobs = runtime.NumCPU()
+	}
+	workers := opts.HelptagsWorkers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	return newBuilder(BaseBuilder{
+		opts:        *opts,
+		reposSem:    make(chan struct{}, jobs),
+		helptagsSem: make(chan struct{}, workers),
+	}), nil
+}
+
+// Strategies returns all strategy names which NewBuilder() accepts
+func Strategies() []string {
+	strategies := make([]string, 0, len(builders))
+	for strategy := range builders {
+		strategies = append(strategies, strategy)
+	}
+	sort.Strings(strategies)
+	return strategies
 }
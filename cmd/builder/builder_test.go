@@ -0,0 +1,759 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/vim-volt/volt/cmd/buildinfo"
+	"github.com/vim-volt/volt/config"
+	"github.com/vim-volt/volt/lockjson"
+	"github.com/vim-volt/volt/pathutil"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/index"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+func TestNewBuilder(t *testing.T) {
+	var tests = []struct {
+		strategy string
+		expected Builder
+	}{
+		{config.SymlinkBuilder, &symlinkBuilder{}},
+		{config.CopyBuilder, &copyBuilder{}},
+	}
+	for _, tt := range tests {
+		b, err := NewBuilder(tt.strategy, nil)
+		if err != nil {
+			t.Errorf("strategy:%s, err:%s", tt.strategy, err.Error())
+			continue
+		}
+		if reflect.TypeOf(b) != reflect.TypeOf(tt.expected) {
+			t.Errorf("strategy:%s, got:%T, expected:%T", tt.strategy, b, tt.expected)
+		}
+	}
+}
+
+func TestNewBuilderOptions(t *testing.T) {
+	opts := &Options{NoVimrc: true}
+	for _, strategy := range Strategies() {
+		b, err := NewBuilder(strategy, opts)
+		if err != nil {
+			t.Errorf("strategy:%s, err:%s", strategy, err.Error())
+			continue
+		}
+		var base BaseBuilder
+		switch b := b.(type) {
+		case *symlinkBuilder:
+			base = b.BaseBuilder
+		case *copyBuilder:
+			base = b.BaseBuilder
+		default:
+			t.Errorf("strategy:%s, unknown builder type %T", strategy, b)
+			continue
+		}
+		if !reflect.DeepEqual(base.opts, *opts) {
+			t.Errorf("strategy:%s, got:%+v, expected:%+v", strategy, base.opts, *opts)
+		}
+	}
+}
+
+func TestNewBuilderError(t *testing.T) {
+	for _, strategy := range []string{"", "hardlink", "Symlink"} {
+		if b, err := NewBuilder(strategy, nil); err == nil {
+			t.Errorf("strategy:%q, expected error but got:%T", strategy, b)
+		}
+	}
+}
+
+func TestStrategies(t *testing.T) {
+	expected := []string{config.CopyBuilder, config.SymlinkBuilder}
+	if got := Strategies(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("got:%v, expected:%v", got, expected)
+	}
+}
+
+func TestIsExcludedDoc(t *testing.T) {
+	var tests = []struct {
+		file     string
+		patterns []string
+		expected bool
+	}{
+		{"foo.txt", []string{"foo.txt"}, true},
+		{"foo.txt", []string{"*.txt"}, true},
+		{"foo.txt", []string{"bar.txt", "foo*"}, true},
+		{"foo.txt", []string{"bar.txt"}, false},
+		{"api/foo.txt", []string{"api"}, true},
+		{"api/foo.txt", []string{"api/*.txt"}, true},
+		{"api/foo.txt", []string{"foo.txt"}, false},
+		{"foo.txt", nil, false},
+	}
+	for _, tt := range tests {
+		if got := isExcludedDoc(tt.file, tt.patterns); got != tt.expected {
+			t.Errorf("file:%q, patterns:%v, got:%v, expected:%v", tt.file, tt.patterns, got, tt.expected)
+		}
+	}
+}
+
+func TestCheckInstalledFileHashes(t *testing.T) {
+	dst, err := ioutil.TempDir("", "volt-test-")
+	if err != nil {
+		t.Fatal("failed to create temp dir")
+	}
+	defer os.RemoveAll(dst)
+	os.MkdirAll(filepath.Join(dst, "plugin"), 0755)
+	content := []byte("echo 'hello'\n")
+	files := buildinfo.FileMap{
+		"plugin/hello.vim": plumbing.ComputeHash(plumbing.BlobObject, content).String(),
+	}
+	path := filepath.Join(dst, "plugin", "hello.vim")
+	builder := &copyBuilder{}
+
+	// build-info.json written by older volt does not have the sizes
+	for _, sizes := range []map[string]int64{nil, {"plugin/hello.vim": int64(len(content))}} {
+		for _, tt := range []struct {
+			content  []byte
+			expected bool
+		}{
+			{content, false},
+			{content[:5], true},
+			{[]byte("echo 'world'\n"), true},
+			{nil, true},
+		} {
+			os.Remove(path)
+			if tt.content != nil {
+				if err := ioutil.WriteFile(path, tt.content, 0644); err != nil {
+					t.Fatal("failed to write " + path)
+				}
+			}
+			err := builder.checkInstalledFileHashes(dst, files, sizes)
+			if (err != nil) != tt.expected {
+				t.Errorf("content:%q, sizes:%v, expected damaged=%v but got err:%v", tt.content, sizes, tt.expected, err)
+			}
+		}
+	}
+}
+
+func TestVerifyRCFile(t *testing.T) {
+	voltpath, cleanup := setUpVoltpath(t)
+	defer cleanup()
+
+	src := filepath.Join(pathutil.RCDir("default"), pathutil.ProfileVimrc)
+	dst := filepath.Join(voltpath, "vimrc")
+	content := "set nocompatible\n"
+	builder := &BaseBuilder{}
+
+	for _, tt := range []struct {
+		name     string
+		src      string // source is removed if empty
+		dst      string // installed from src if empty, removed if "-"
+		expected bool
+	}{
+		{"matching", content, "", false},
+		{"drifted", content, magicCommentLine() + fmt.Sprintf(magicCommentNext, src) + "set compatible\n", true},
+		{"header of renamed profile", content, magicCommentLine() + fmt.Sprintf(magicCommentNext, "old/vimrc.vim") + content, false},
+		{"user's vimrc", content, "set compatible\n", false},
+		{"not installed", content, "-", true},
+		{"source was removed", "", magicCommentLine() + content, true},
+		{"both do not exist", "", "-", false},
+	} {
+		os.Remove(src)
+		os.Remove(dst)
+		if tt.src != "" {
+			os.MkdirAll(filepath.Dir(src), 0755)
+			if err := ioutil.WriteFile(src, []byte(tt.src), 0644); err != nil {
+				t.Fatal("failed to write " + src)
+			}
+		}
+		if tt.dst == "" {
+			if err := builder.copyFileWithMagicComment(src, dst); err != nil {
+				t.Fatal("failed to install " + dst)
+			}
+		} else if tt.dst != "-" {
+			if err := ioutil.WriteFile(dst, []byte(tt.dst), 0644); err != nil {
+				t.Fatal("failed to write " + dst)
+			}
+		}
+		err := builder.VerifyRCFile("default", pathutil.ProfileVimrc, dst)
+		if (err != nil) != tt.expected {
+			t.Errorf("%s: expected drifted=%v but got err:%v", tt.name, tt.expected, err)
+		}
+	}
+}
+
+func TestMagicComment(t *testing.T) {
+	SetMagicComment("\" Generated by volt {version}", "v1.0.0")
+	defer SetMagicComment(DefaultMagicComment, "")
+
+	if line := magicCommentLine(); line != "\" Generated by volt v1.0.0\n" {
+		t.Errorf("expected the magic comment line %q but got %q", "\" Generated by volt v1.0.0\n", line)
+	}
+	for _, tt := range []struct {
+		content  string
+		expected int
+	}{
+		{"\" Generated by volt v1.0.0\nset nocompatible\n", len("\" Generated by volt v1.0.0\n")},
+		{"\" Generated by volt v0.3.3-beta\r\nset nocompatible\n", len("\" Generated by volt v0.3.3-beta\r\n")},
+		{DefaultMagicComment + "\nset nocompatible\n", len(DefaultMagicComment) + 1},
+		{"\" Generated by volt v1.0.0", 0},
+		{"\" Generated by\n", 0},
+		{"set nocompatible\n" + DefaultMagicComment + "\n", 0},
+		{"", 0},
+	} {
+		if n := matchMagicComment([]byte(tt.content)); n != tt.expected {
+			t.Errorf("content:%q, expected %d but got %d", tt.content, tt.expected, n)
+		}
+	}
+}
+
+func TestHasMagicComment(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "volt-test-")
+	if err != nil {
+		t.Fatal("failed to create temp dir")
+	}
+	defer os.RemoveAll(tmpdir)
+
+	line := magicCommentLine()
+	for _, tt := range []struct {
+		name     string
+		content  string
+		expected bool
+	}{
+		{"empty", "", false},
+		{"exactly the magic comment", line, true},
+		{"followed by vimrc", line + "set nocompatible\n", true},
+		{"shorter than the magic comment", line[:len(line)-2], false},
+		{"magic comment without newline", line[:len(line)-1], false},
+		{"longer than the read buffer", line + strings.Repeat("\" comment\n", maxMagicCommentLen), true},
+		{"user's vimrc", "set nocompatible\n", false},
+	} {
+		path := filepath.Join(tmpdir, "vimrc")
+		if err := ioutil.WriteFile(path, []byte(tt.content), 0644); err != nil {
+			t.Fatal("failed to write " + path)
+		}
+		if has := (&BaseBuilder{}).HasMagicComment(path); has != tt.expected {
+			t.Errorf("%s: expected %v but got %v", tt.name, tt.expected, has)
+		}
+	}
+	if (&BaseBuilder{}).HasMagicComment(filepath.Join(tmpdir, "not-exist")) {
+		t.Error("not-exist: expected false but got true")
+	}
+}
+
+func TestReposOrder(t *testing.T) {
+	reposList := lockjson.ReposList{
+		{Path: "github.com/tyru/caw.vim"},
+		{Path: "github.com/tyru/capture.vim"},
+		{Path: "github.com/tyru/bookmarks.vim"},
+	}
+	for _, tt := range []struct {
+		noParallel bool
+		expected   []int
+	}{
+		{false, []int{0, 1, 2}},
+		{true, []int{2, 1, 0}},
+	} {
+		builder := &BaseBuilder{opts: Options{NoParallel: tt.noParallel}}
+		if got := builder.reposOrder(reposList); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("noParallel:%v, got:%v, expected:%v", tt.noParallel, got, tt.expected)
+		}
+	}
+}
+
+func TestGetCurrentReposListDuplicate(t *testing.T) {
+	lockJSON := &lockjson.LockJSON{
+		CurrentProfileName: "default",
+		Repos: lockjson.ReposList{
+			{Type: lockjson.ReposStaticType, Path: "localhost/local/hello"},
+			{Type: lockjson.ReposStaticType, Path: "localhost/local/world"},
+		},
+		Profiles: lockjson.ProfileList{
+			{
+				Name: "default",
+				ReposPath: []pathutil.ReposPath{
+					"localhost/local/hello",
+					"localhost/local/world",
+					"localhost/local/hello",
+				},
+			},
+		},
+	}
+	reposList, err := (&BaseBuilder{}).getCurrentReposList(lockJSON)
+	if err != nil {
+		t.Fatal("getCurrentReposList() returned non-nil error: " + err.Error())
+	}
+	var paths []pathutil.ReposPath
+	for i := range reposList {
+		paths = append(paths, reposList[i].Path)
+	}
+	expected := []pathutil.ReposPath{"localhost/local/hello", "localhost/local/world"}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected %v but got %v", expected, paths)
+	}
+}
+
+func TestPreflightEncodedPaths(t *testing.T) {
+	for _, tt := range []struct {
+		reposList lockjson.ReposList
+		errs      int
+	}{
+		{lockjson.ReposList{
+			{Path: "github.com/foo_bar/baz"},
+			{Path: "github.com/foo/bar_baz"},
+			{Path: "github.com/foo/bar/baz"},
+		}, 0},
+		{lockjson.ReposList{
+			{Path: "github.com/tyru/caw.vim"},
+			{Path: "github.com/tyru/open-browser.vim"},
+			{Path: "github.com/Tyru/caw.vim"},
+		}, 1},
+	} {
+		errs := (&BaseBuilder{}).preflightEncodedPaths(tt.reposList)
+		if len(errs) != tt.errs {
+			t.Errorf("%v: expected %d errors but got %v", tt.reposList, tt.errs, errs)
+			continue
+		}
+		for _, err := range errs {
+			for _, reposPath := range []string{"github.com/tyru/caw.vim", "github.com/Tyru/caw.vim"} {
+				if !strings.Contains(err.Error(), reposPath) {
+					t.Errorf("expected %q is named but got %q", reposPath, err.Error())
+				}
+			}
+		}
+	}
+}
+
+func TestSymlinkBuilderJunctionFallback(t *testing.T) {
+	tmpdir, cleanup := setUpVoltpath(t)
+	defer cleanup()
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", filepath.Join(tmpdir, "HOME"))
+	defer func(f func(src, dst string) error) { makeSymlink = f }(makeSymlink)
+	makeSymlink = func(src, dst string) error {
+		return &junctionError{src: src, dst: dst, output: "Access is denied.", err: errors.New("exit status 1")}
+	}
+
+	repos := &lockjson.Repos{Type: lockjson.ReposStaticType, Path: pathutil.ReposPath("localhost/local/hello")}
+	file := filepath.Join(pathutil.FullReposPath(repos.Path), "plugin", "hello.vim")
+	os.MkdirAll(filepath.Dir(file), 0755)
+	if err := ioutil.WriteFile(file, []byte("\" hello\n"), 0644); err != nil {
+		t.Fatal("failed to write " + file)
+	}
+
+	builder := &symlinkBuilder{}
+	rollback := &symlinkRollback{}
+	done := make(chan actionReposResult, 1)
+	builder.installRepos(context.Background(), repos, "", rollback, done)
+	result := <-done
+	if result.err != nil {
+		t.Fatal("installRepos() returned error: " + result.err.Error())
+	}
+	if !result.copied {
+		t.Error("expected the repository is copied")
+	}
+	installed := filepath.Join(repos.EncodedPath(), "plugin", "hello.vim")
+	if fi, err := os.Lstat(installed); err != nil || !fi.Mode().IsRegular() {
+		t.Errorf("expected %s is copied but got %v", installed, err)
+	}
+	if fi, err := os.Lstat(repos.EncodedPath()); err != nil || fi.Mode()&os.ModeSymlink != 0 {
+		t.Errorf("expected %s is a directory but got %v", repos.EncodedPath(), err)
+	}
+
+	// The copied directory is removed on rollback
+	if err := rollback.run(); err != nil {
+		t.Fatal("rollback.run() returned error: " + err.Error())
+	}
+	if pathutil.Exists(repos.EncodedPath()) {
+		t.Errorf("expected %s is removed on rollback", repos.EncodedPath())
+	}
+}
+
+func TestVerifyGitFile(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "volt-test-")
+	if err != nil {
+		t.Fatal("failed to create temp dir")
+	}
+	defer os.RemoveAll(tmpdir)
+
+	content := "\" hello\n"
+	obj := &plumbing.MemoryObject{}
+	obj.SetType(plumbing.BlobObject)
+	obj.Write([]byte(content))
+	blob, err := object.DecodeBlob(obj)
+	if err != nil {
+		t.Fatal("object.DecodeBlob() failed: " + err.Error())
+	}
+	file := object.NewFile("plugin/hello.vim", filemode.Regular, blob)
+	filename := filepath.Join(tmpdir, "hello.vim")
+
+	for _, tt := range []struct {
+		name     string
+		content  string
+		checksum bool
+		expected string // error message contains this, or no error if empty
+	}{
+		{"same", content, true, ""},
+		{"truncated", content[:3], false, "has 3 bytes"},
+		{"same size", "\" HELLO\n", false, ""},
+		{"same size with checksum", "\" HELLO\n", true, "SHA-1"},
+	} {
+		if err := ioutil.WriteFile(filename, []byte(tt.content), 0644); err != nil {
+			t.Fatal("failed to write " + filename)
+		}
+		err := verifyGitFile(file, filename, tt.checksum)
+		if tt.expected == "" && err != nil {
+			t.Errorf("%s: expected no error but got %v", tt.name, err)
+		} else if tt.expected != "" && (err == nil || !strings.Contains(err.Error(), tt.expected)) {
+			t.Errorf("%s: expected error %q but got %v", tt.name, tt.expected, err)
+		}
+	}
+	os.Remove(filename)
+	if err := verifyGitFile(file, filename, false); err == nil {
+		t.Error("expected error for nonexistent file")
+	}
+}
+
+func TestRetryGit(t *testing.T) {
+	defer func(d time.Duration) { gitRetryInterval = d }(gitRetryInterval)
+	gitRetryInterval = time.Millisecond
+
+	transient := &os.PathError{Op: "read", Path: "objects/pack", Err: syscall.EIO}
+	missing := &os.PathError{Op: "open", Path: "HEAD", Err: syscall.ENOENT}
+	repos := &lockjson.Repos{Path: pathutil.ReposPath("localhost/local/hello")}
+	for _, tt := range []struct {
+		name          string
+		retries       int
+		errs          []error // f() returns these in order, and nil after them
+		expectedCalls int
+		expectedErr   error
+	}{
+		{"success", 3, nil, 1, nil},
+		{"transient errors", 3, []error{transient, transient}, 3, nil},
+		{"too many transient errors", 3, []error{transient, transient, transient, transient}, 4, transient},
+		{"no retries", 0, []error{transient}, 1, transient},
+		{"invalid repository", 3, []error{git.ErrRepositoryNotExists}, 1, git.ErrRepositoryNotExists},
+		{"missing file", 3, []error{missing}, 1, missing},
+	} {
+		builder := &BaseBuilder{opts: Options{GitRetries: tt.retries}}
+		calls := 0
+		err := builder.retryGit(repos, "reading", func() error {
+			calls++
+			if calls <= len(tt.errs) {
+				return tt.errs[calls-1]
+			}
+			return nil
+		})
+		if calls != tt.expectedCalls {
+			t.Errorf("%s: expected %d calls but got %d", tt.name, tt.expectedCalls, calls)
+		}
+		if err != tt.expectedErr {
+			t.Errorf("%s: expected error %v but got %v", tt.name, tt.expectedErr, err)
+		}
+	}
+}
+
+func TestExtractGitTree(t *testing.T) {
+	voltpath, cleanup := setUpVoltpath(t)
+	defer cleanup()
+
+	// Commit plugin/hello.vim and ignored file, and tag it as v1.0.0.
+	// Then change plugin/hello.vim after it.
+	reposPath := pathutil.ReposPath("localhost/local/hello")
+	src := pathutil.FullReposPath(reposPath)
+	r, err := git.PlainInit(src, false)
+	if err != nil {
+		t.Fatal("git.PlainInit() failed: " + err.Error())
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		t.Fatal("r.Worktree() failed: " + err.Error())
+	}
+	commit := func(files map[string]string) plumbing.Hash {
+		for file, content := range files {
+			path := filepath.Join(src, filepath.FromSlash(file))
+			os.MkdirAll(filepath.Dir(path), 0755)
+			if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal("failed to write " + path)
+			}
+			if _, err := w.Add(file); err != nil {
+				t.Fatal("w.Add() failed: " + err.Error())
+			}
+		}
+		hash, err := w.Commit("commit", &git.CommitOptions{
+			Author: &object.Signature{Name: "John Doe", Email: "john@doe.org", When: time.Now()},
+		})
+		if err != nil {
+			t.Fatal("w.Commit() failed: " + err.Error())
+		}
+		return hash
+	}
+	first := commit(map[string]string{
+		"plugin/hello.vim": "\" v1\n",
+		"test/hello.vim":   "\" test\n",
+		".voltignore":      "test/\n",
+	})
+	if err := r.Storer.SetReference(plumbing.NewHashReference("refs/tags/v1.0.0", first)); err != nil {
+		t.Fatal("failed to create tag: " + err.Error())
+	}
+	second := commit(map[string]string{"plugin/hello.vim": "\" v2\n"})
+
+	for _, tt := range []struct {
+		version  string
+		hash     plumbing.Hash
+		expected string
+	}{
+		{"v1.0.0", first, "\" v1\n"},
+		{first.String(), first, "\" v1\n"},
+		{second.String(), second, "\" v2\n"},
+	} {
+		dst := filepath.Join(voltpath, "extracted", tt.version)
+		if err := ExtractGitTree(context.Background(), reposPath, tt.version, dst, nil); err != nil {
+			t.Errorf("%s: ExtractGitTree() failed: %s", tt.version, err.Error())
+			continue
+		}
+		content, err := ioutil.ReadFile(filepath.Join(dst, "plugin", "hello.vim"))
+		if err != nil || string(content) != tt.expected {
+			t.Errorf("%s: expected %q but got %q (%v)", tt.version, tt.expected, content, err)
+		}
+		if pathutil.Exists(filepath.Join(dst, "test")) {
+			t.Errorf("%s: ignored directory was extracted", tt.version)
+		}
+		// The modification times are the commit time
+		commitObj, err := r.CommitObject(tt.hash)
+		if err != nil {
+			t.Fatal("r.CommitObject() failed: " + err.Error())
+		}
+		for _, path := range []string{dst, filepath.Join(dst, "plugin"), filepath.Join(dst, "plugin", "hello.vim")} {
+			fi, err := os.Stat(path)
+			if err != nil {
+				t.Errorf("%s: failed to stat %s: %s", tt.version, path, err.Error())
+			} else if !fi.ModTime().Equal(commitObj.Committer.When) {
+				t.Errorf("%s: expected the modification time of %s is %s but got %s", tt.version, path, commitObj.Committer.When, fi.ModTime())
+			}
+		}
+	}
+
+	dst := filepath.Join(voltpath, "extracted", "missing")
+	if err := ExtractGitTree(context.Background(), reposPath, "v9.9.9", dst, nil); err == nil {
+		t.Error("expected error for nonexistent version")
+	}
+	if err := ExtractGitTree(context.Background(), "localhost/local/missing", "v1.0.0", dst, nil); err == nil {
+		t.Error("expected error for nonexistent repository")
+	}
+}
+
+func TestPreflightRepos(t *testing.T) {
+	_, cleanup := setUpVoltpath(t)
+	defer cleanup()
+
+	gitPath := pathutil.ReposPath("localhost/local/hello")
+	src := pathutil.FullReposPath(gitPath)
+	r, err := git.PlainInit(src, false)
+	if err != nil {
+		t.Fatal("git.PlainInit() failed: " + err.Error())
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		t.Fatal("r.Worktree() failed: " + err.Error())
+	}
+	os.MkdirAll(filepath.Join(src, "plugin"), 0755)
+	if err := ioutil.WriteFile(filepath.Join(src, "plugin", "hello.vim"), []byte("\" hello\n"), 0644); err != nil {
+		t.Fatal("failed to write plugin/hello.vim")
+	}
+	if _, err := w.Add("plugin/hello.vim"); err != nil {
+		t.Fatal("w.Add() failed: " + err.Error())
+	}
+	hash, err := w.Commit("commit", &git.CommitOptions{
+		Author: &object.Signature{Name: "John Doe", Email: "john@doe.org", When: time.Now()},
+	})
+	if err != nil {
+		t.Fatal("w.Commit() failed: " + err.Error())
+	}
+
+	staticPath := pathutil.ReposPath("localhost/local/world")
+	os.MkdirAll(pathutil.FullReposPath(staticPath), 0755)
+
+	for _, tt := range []struct {
+		repos    lockjson.Repos
+		expected string
+	}{
+		{lockjson.Repos{Type: lockjson.ReposGitType, Path: gitPath, Version: hash.String()}, ""},
+		{lockjson.Repos{Type: lockjson.ReposGitType, Path: gitPath, Version: strings.Repeat("0", 40)}, "locked revision does not exist"},
+		{lockjson.Repos{Type: lockjson.ReposGitType, Path: gitPath, Version: "v9.9.9"}, "locked revision does not exist"},
+		{lockjson.Repos{Type: lockjson.ReposStaticType, Path: staticPath}, ""},
+		{lockjson.Repos{Type: lockjson.ReposStaticType, Path: "localhost/local/missing"}, "repository does not exist"},
+	} {
+		errs := (&BaseBuilder{}).preflightRepos("default", &tt.repos)
+		if tt.expected == "" {
+			if len(errs) != 0 {
+				t.Errorf("%s@%s: expected no errors but got %v", tt.repos.Path, tt.repos.Version, errs)
+			}
+			continue
+		}
+		if len(errs) != 1 || !strings.Contains(errs[0].Error(), tt.expected) || !strings.Contains(errs[0].Error(), tt.repos.Path.String()) {
+			t.Errorf("%s@%s: expected an error %q but got %v", tt.repos.Path, tt.repos.Version, tt.expected, errs)
+		}
+	}
+}
+
+func TestExtractGitTreeSubmodule(t *testing.T) {
+	voltpath, cleanup := setUpVoltpath(t)
+	defer cleanup()
+
+	reposPath := pathutil.ReposPath("localhost/local/hello")
+	src := pathutil.FullReposPath(reposPath)
+	author := &object.Signature{Name: "John Doe", Email: "john@doe.org", When: time.Now()}
+
+	r, err := git.PlainInit(src, false)
+	if err != nil {
+		t.Fatal("git.PlainInit() failed: " + err.Error())
+	}
+
+	// Commit autoload/lib.vim to the submodule "lib" in $GIT_DIR/modules/lib
+	subSrc := filepath.Join(voltpath, "lib")
+	sub, err := git.PlainInit(subSrc, false)
+	if err != nil {
+		t.Fatal("git.PlainInit() failed: " + err.Error())
+	}
+	subWorktree, err := sub.Worktree()
+	if err != nil {
+		t.Fatal("sub.Worktree() failed: " + err.Error())
+	}
+	os.MkdirAll(filepath.Join(subSrc, "autoload"), 0755)
+	if err := ioutil.WriteFile(filepath.Join(subSrc, "autoload", "lib.vim"), []byte("\" lib\n"), 0644); err != nil {
+		t.Fatal("failed to write autoload/lib.vim")
+	}
+	if _, err := subWorktree.Add("autoload/lib.vim"); err != nil {
+		t.Fatal("subWorktree.Add() failed: " + err.Error())
+	}
+	subHash, err := subWorktree.Commit("commit", &git.CommitOptions{Author: author})
+	if err != nil {
+		t.Fatal("subWorktree.Commit() failed: " + err.Error())
+	}
+	os.MkdirAll(filepath.Join(src, ".git", "modules"), 0755)
+	if err := os.Rename(filepath.Join(subSrc, ".git"), filepath.Join(src, ".git", "modules", "lib")); err != nil {
+		t.Fatal("failed to move submodule: " + err.Error())
+	}
+
+	// Commit .gitmodules and the gitlinks of "lib" and "missing" (which is
+	// not initialized)
+	w, err := r.Worktree()
+	if err != nil {
+		t.Fatal("r.Worktree() failed: " + err.Error())
+	}
+	gitmodules := "[submodule \"lib\"]\n\tpath = vendor/lib\n\turl = https://example.com/lib\n" +
+		"[submodule \"missing\"]\n\tpath = vendor/missing\n\turl = https://example.com/missing\n"
+	if err := ioutil.WriteFile(filepath.Join(src, ".gitmodules"), []byte(gitmodules), 0644); err != nil {
+		t.Fatal("failed to write .gitmodules")
+	}
+	if _, err := w.Add(".gitmodules"); err != nil {
+		t.Fatal("w.Add() failed: " + err.Error())
+	}
+	idx, err := r.Storer.Index()
+	if err != nil {
+		t.Fatal("r.Storer.Index() failed: " + err.Error())
+	}
+	for _, name := range []string{"vendor/lib", "vendor/missing"} {
+		idx.Entries = append(idx.Entries, &index.Entry{Name: name, Mode: filemode.Submodule, Hash: subHash})
+	}
+	if err := r.Storer.SetIndex(idx); err != nil {
+		t.Fatal("r.Storer.SetIndex() failed: " + err.Error())
+	}
+	hash, err := w.Commit("commit", &git.CommitOptions{Author: author})
+	if err != nil {
+		t.Fatal("w.Commit() failed: " + err.Error())
+	}
+
+	dst := filepath.Join(voltpath, "extracted")
+	if err := ExtractGitTree(context.Background(), reposPath, hash.String(), dst, nil); err != nil {
+		t.Fatal("ExtractGitTree() failed: " + err.Error())
+	}
+	content, err := ioutil.ReadFile(filepath.Join(dst, "vendor", "lib", "autoload", "lib.vim"))
+	if err != nil || string(content) != "\" lib\n" {
+		t.Errorf("expected the file of submodule is extracted but got %q (%v)", content, err)
+	}
+	if pathutil.Exists(filepath.Join(dst, "vendor", "missing")) {
+		t.Error("uninitialized submodule was extracted")
+	}
+}
+
+func TestInstalledDigest(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "volt-test-")
+	if err != nil {
+		t.Fatal("failed to create temp dir")
+	}
+	defer os.RemoveAll(tmpdir)
+	defer os.Setenv("VOLT_HOME", os.Getenv("VOLT_HOME"))
+	os.Setenv("VOLT_HOME", tmpdir)
+
+	repos := &lockjson.Repos{Type: lockjson.ReposStaticType, Path: "localhost/local/hello"}
+	dst := repos.EncodedPath()
+	files := map[string]string{
+		"plugin/hello.vim": "\" hello\n",
+		"doc/hello.txt":    "*hello.txt*\n",
+	}
+	expected := make(buildinfo.FileMap, len(files))
+	for name, content := range files {
+		path := filepath.Join(dst, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal("failed to write " + path)
+		}
+		expected[name] = plumbing.ComputeHash(plumbing.BlobObject, []byte(content)).String()
+	}
+	// doc/tags is not included
+	if err := ioutil.WriteFile(filepath.Join(dst, "doc", "tags"), []byte("hello.txt\thello.txt\t/*hello.txt*\n"), 0644); err != nil {
+		t.Fatal("failed to write doc/tags")
+	}
+
+	if digest := installedDigest(repos, nil); digest != expected.DigestV1() {
+		t.Errorf("expected %q but got %q", expected.DigestV1(), digest)
+	}
+	// The known blob hashes are used instead of reading the files
+	known := buildinfo.FileMap{"plugin/hello.vim": expected["plugin/hello.vim"]}
+	if digest := installedDigest(repos, known); digest != known.DigestV1() {
+		t.Errorf("expected %q but got %q", known.DigestV1(), digest)
+	}
+	// doc/tags in the known blob hashes is not included either
+	withTags := buildinfo.FileMap{"plugin/hello.vim": expected["plugin/hello.vim"], "doc/tags": strings.Repeat("0", 40)}
+	if digest := installedDigest(repos, withTags); digest != known.DigestV1() {
+		t.Errorf("expected %q but got %q", known.DigestV1(), digest)
+	}
+
+	// Symlink strategy does not have a digest
+	if err := os.RemoveAll(dst); err != nil {
+		t.Fatal("failed to remove " + dst)
+	}
+	if err := os.Symlink(tmpdir, dst); err != nil {
+		t.Skip("could not create a symlink: " + err.Error())
+	}
+	if digest := installedDigest(repos, nil); digest != "" {
+		t.Errorf("expected empty digest for symlink but got %q", digest)
+	}
+}
+
+// Sets VOLTPATH to a new temporary directory, and returns it and the function
+// which restores VOLTPATH and removes the directory
+func setUpVoltpath(t *testing.T) (string, func()) {
+	t.Helper()
+	voltpath, err := ioutil.TempDir("", "volt-test-")
+	if err != nil {
+		t.Fatal("failed to create temp dir")
+	}
+	orig := os.Getenv("VOLTPATH")
+	os.Setenv("VOLTPATH", voltpath)
+	return voltpath, func() {
+		os.Setenv("VOLTPATH", orig)
+		os.RemoveAll(voltpath)
+	}
+}
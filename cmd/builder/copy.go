@@ -1,11 +1,13 @@
 package builder
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
 	"time"
 
 	"github.com/hashicorp/go-multierror"
@@ -17,20 +19,22 @@ import (
 	"github.com/vim-volt/volt/pathutil"
 	"github.com/vim-volt/volt/plugconf"
 	"gopkg.in/src-d/go-git.v4"
-	"gopkg.in/src-d/go-git.v4/plumbing"
-	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	gitconfig "gopkg.in/src-d/go-git.v4/config"
 )
 
 type copyBuilder struct {
 	BaseBuilder
 }
 
-func (builder *copyBuilder) Build(buildInfo *buildinfo.BuildInfo, buildReposMap map[pathutil.ReposPath]*buildinfo.Repos) error {
+func (builder *copyBuilder) Build(ctx context.Context, buildInfo *buildinfo.BuildInfo, buildReposMap map[pathutil.ReposPath]*buildinfo.Repos) error {
 	// Exit if vim executable was not found in PATH
 	vimExePath, err := pathutil.VimExecutable()
 	if err != nil {
 		return err
 	}
+	if err := builder.checkVimVersion(vimExePath); err != nil {
+		return err
+	}
 
 	// Read lock.json
 	lockJSON, err := lockjson.Read()
@@ -43,8 +47,9 @@ func (builder *copyBuilder) Build(buildInfo *buildinfo.BuildInfo, buildReposMap
 	if err != nil {
 		return err
 	}
-
-	logger.Info("Installing vimrc and gvimrc ...")
+	if err := builder.checkRequirements(vimExePath, lockJSON.CurrentProfileName, reposList); err != nil {
+		return err
+	}
 
 	vimDir := pathutil.VimDir()
 	vimrcPath := filepath.Join(vimDir, pathutil.Vimrc)
@@ -63,32 +68,37 @@ func (builder *copyBuilder) Build(buildInfo *buildinfo.BuildInfo, buildReposMap
 		return errors.New("could not create " + optDir)
 	}
 
-	reposDirList, err := ioutil.ReadDir(pathutil.VimVoltOptDir())
+	installedDirList, err := builder.readInstalledDirList()
 	if err != nil {
 		return err
 	}
 
 	// Copy volt repos files to optDir
-	copyDone, copyCount := builder.copyReposList(buildReposMap, reposList, optDir, vimExePath)
+	copyDone, copyCount := builder.copyReposList(ctx, buildReposMap, reposList, optDir, vimExePath)
 
 	// Remove vim repos not found in lock.json current repos list
-	removeDone, removeCount := builder.removeReposList(reposList, reposDirList)
+	removeDone, removeCount := builder.removeReposList(reposList, installedDirList)
 
 	// Wait copy
 	var copyModified bool
 	copyErr := builder.waitCopyRepos(copyDone, copyCount, func(result *actionReposResult) error {
-		logger.Info("Installing " + string(result.repos.Type) + " repository " + result.repos.Path.String() + " ... Done.")
 		// Construct buildInfo from the result
 		builder.constructBuildInfo(buildInfo, result)
 		copyModified = true
-		return nil
+		// Record the installed repository to resume the build
+		// if it was interrupted
+		return buildinfo.AppendCheckpoint(buildInfo.Repos.FindByReposPath(result.repos.Path))
 	})
 
 	// Wait remove
 	var removeModified bool
 	removeErr := builder.waitRemoveRepos(removeDone, removeCount, func(result *actionReposResult) {
-		// Remove the repository from buildInfo
-		buildInfo.Repos.RemoveByReposPath(result.repos.Path)
+		// Remove the repository from buildInfo.
+		// If the repository was moved between start and opt,
+		// buildInfo was already updated by the copy.
+		if !reposList.Contains(result.repos.Path) {
+			buildInfo.Repos.RemoveByReposPath(result.repos.Path)
+		}
 		removeModified = true
 	})
 
@@ -96,21 +106,27 @@ func (builder *copyBuilder) Build(buildInfo *buildinfo.BuildInfo, buildReposMap
 	if copyErr != nil || removeErr != nil {
 		return multierror.Append(copyErr, removeErr).ErrorOrNil()
 	}
+	logger.Infof("Installed %d repositories, removed %d repositories (%d repositories are up to date)", copyCount, removeCount, len(reposList)-copyCount)
 
 	// Write bundled plugconf file
-	content, merr := plugconf.GenerateBundlePlugconf(reposList)
+	content, merr := plugconf.GenerateBundlePlugconf(lockJSON.CurrentProfileName, reposList)
 	if merr.ErrorOrNil() != nil {
 		// Return vim script parse errors
 		return merr
 	}
-	os.MkdirAll(filepath.Dir(pathutil.BundledPlugConf()), 0755)
-	err = ioutil.WriteFile(pathutil.BundledPlugConf(), content, 0644)
+	err = builder.writeBundledPlugconf(content)
 	if err != nil {
 		return err
 	}
 
-	// Write to build-info.json if buildInfo was modified
-	if copyModified || removeModified {
+	// Create symlinks and directories of "post_install"
+	if err := builder.installPostInstall(reposList); err != nil {
+		return err
+	}
+
+	// Write to build-info.json if buildInfo was modified or it does not exist
+	// (full build of the profile which has no repositories)
+	if copyModified || removeModified || !pathutil.Exists(pathutil.BuildInfoJSON()) {
 		err = buildInfo.Write()
 		if err != nil {
 			return err
@@ -120,111 +136,202 @@ func (builder *copyBuilder) Build(buildInfo *buildinfo.BuildInfo, buildReposMap
 	return nil
 }
 
-func (builder *copyBuilder) copyReposList(buildReposMap map[pathutil.ReposPath]*buildinfo.Repos, reposList []lockjson.Repos, optDir, vimExePath string) (chan actionReposResult, int) {
+func (builder *copyBuilder) copyReposList(ctx context.Context, buildReposMap map[pathutil.ReposPath]*buildinfo.Repos, reposList []lockjson.Repos, optDir, vimExePath string) (chan actionReposResult, int) {
 	copyDone := make(chan actionReposResult, len(reposList))
 	copyCount := 0
-	for i := range reposList {
+	for _, i := range builder.reposOrder(reposList) {
 		if reposList[i].Type == lockjson.ReposGitType {
-			n, err := builder.copyReposGit(&reposList[i], buildReposMap[reposList[i].Path], vimExePath, copyDone)
+			n, err := builder.copyReposGit(ctx, &reposList[i], buildReposMap[reposList[i].Path], vimExePath, copyDone)
 			if err != nil {
 				copyDone <- actionReposResult{
 					err:   errors.New("failed to copy " + string(reposList[i].Type) + " repos: " + err.Error()),
 					repos: &reposList[i],
 				}
+				// Wait the error in waitCopyRepos()
+				n = 1
 			}
 			copyCount += n
-		} else if reposList[i].Type == lockjson.ReposStaticType {
-			copyCount += builder.copyReposStatic(&reposList[i], buildReposMap[reposList[i].Path], optDir, vimExePath, copyDone)
+		} else if reposList[i].Type == lockjson.ReposStaticType || reposList[i].Type == lockjson.ReposLocalType {
+			copyCount += builder.copyReposStatic(ctx, &reposList[i], buildReposMap[reposList[i].Path], optDir, vimExePath, copyDone)
 		} else {
 			copyDone <- actionReposResult{
 				err:   errors.New("invalid repository type: " + string(reposList[i].Type)),
 				repos: &reposList[i],
 			}
+			copyCount++
 		}
 	}
 	return copyDone, copyCount
 }
 
-func (builder *copyBuilder) copyReposGit(repos *lockjson.Repos, buildRepos *buildinfo.Repos, vimExePath string, done chan actionReposResult) (int, error) {
+func (builder *copyBuilder) copyReposGit(ctx context.Context, repos *lockjson.Repos, buildRepos *buildinfo.Repos, vimExePath string, done chan actionReposResult) (int, error) {
 	src := pathutil.FullReposPath(repos.Path)
-
-	// Open ~/volt/repos/{repos}
-	r, err := git.PlainOpen(src)
+	r, cfg, err := builder.openReposGit(repos)
 	if err != nil {
-		return 0, errors.New("failed to open repository: " + err.Error())
+		return 0, err
 	}
 
-	// Show warning when HEAD and locked revision are different
-	head, err := gitutil.GetHEADRepository(r)
-	if err != nil {
-		return 0, fmt.Errorf("failed to get HEAD revision of %q: %s", src, err.Error())
+	// Show warning when HEAD and locked revision are different.
+	// HEAD of bare repository is not installed, so it is not checked.
+	_, overridden := builder.opts.VersionOverrides[repos.Path]
+	if !cfg.Core.IsBare && !overridden {
+		head, err := gitutil.GetHEADRepository(r)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get HEAD revision of %q: %s", src, err.Error())
+		}
+		if head != repos.Version {
+			logger.Warnf("%s: HEAD and locked revision are different", repos.Path)
+			logger.Warn("  HEAD: " + head)
+			logger.Warn("  locked revision: " + repos.Version)
+			logger.Warn("  Please run 'volt get -l' to update locked revision.")
+		}
 	}
-	if head != repos.Version {
-		logger.Warnf("%s: HEAD and locked revision are different", repos.Path)
-		logger.Warn("  HEAD: " + head)
-		logger.Warn("  locked revision: " + repos.Version)
-		logger.Warn("  Please run 'volt get -l' to update locked revision.")
+
+	// Refuse to install the locked revision whose contents differ from
+	// tree_hash of lock.json (e.g. the history was rewritten)
+	if repos.TreeHash != "" && !overridden {
+		treeHash, err := gitutil.GetTreeHash(r, repos.Version)
+		if err != nil {
+			return 0, err
+		}
+		if treeHash != repos.TreeHash {
+			return 0, fmt.Errorf("tree hash of locked revision %s is %s, but tree_hash of lock.json is %s", repos.Version, treeHash, repos.TreeHash)
+		}
 	}
 
-	cfg, err := r.Config()
+	isClean := builder.isCleanWorktree(r, cfg)
+	if builder.hasChangedGitRepos(repos, buildRepos, !isClean) {
+		copyFromGitObjects := builder.copiesFromGitObjects(repos, isClean)
+		builder.goReposAction(ctx, repos, done, func(ctx context.Context, done chan actionReposResult) {
+			builder.updateGitRepos(ctx, repos, r, copyFromGitObjects, vimExePath, done)
+		})
+		return 1, nil
+	}
+	logger.Progress("Skipping " + string(repos.Type) + " repository " + repos.Path.String() + " ... Already up to date.")
+	return 0, nil
+}
+
+// Open ~/volt/repos/{repos} and read its config
+func (builder *copyBuilder) openReposGit(repos *lockjson.Repos) (*git.Repository, *gitconfig.Config, error) {
+	var r *git.Repository
+	err := builder.retryGit(repos, "opening repository", func() (err error) {
+		r, err = git.PlainOpen(pathutil.FullReposPath(repos.Path))
+		return err
+	})
+	if err != nil {
+		return nil, nil, errors.New("failed to open repository: " + err.Error())
+	}
+
+	var cfg *gitconfig.Config
+	err = builder.retryGit(repos, "reading repository config", func() (err error) {
+		cfg, err = r.Config()
+		return err
+	})
 	if err != nil {
-		return 0, errors.New("failed to get repository config: " + err.Error())
+		return nil, nil, errors.New("failed to get repository config: " + err.Error())
 	}
+	return r, cfg, nil
+}
 
-	isClean := false
+// Returns true if the worktree of r is clean.
+// Bare repository has no worktree to be dirty.
+func (*copyBuilder) isCleanWorktree(r *git.Repository, cfg *gitconfig.Config) bool {
+	if cfg.Core.IsBare {
+		return true
+	}
 	if wt, err := r.Worktree(); err == nil {
 		if st, err := wt.Status(); err == nil && st.IsClean() {
-			isClean = true
+			return true
 		}
 	}
+	return false
+}
 
-	if builder.hasChangedGitRepos(repos, buildRepos, !isClean) {
-		// Copy files from .git/objects/... when:
-		// * bare repository
-		// * or worktree is clean
-		copyFromGitObjects := cfg.Core.IsBare || isClean
-		go builder.updateGitRepos(repos, r, copyFromGitObjects, vimExePath, done)
-		return 1, nil
-	}
-	return 0, nil
+// Returns true if the files of git repository are copied from
+// .git/objects/... instead of the worktree, when:
+// * bare repository
+// * or worktree is clean
+// * or the version is overridden
+func (builder *copyBuilder) copiesFromGitObjects(repos *lockjson.Repos, isClean bool) bool {
+	_, overridden := builder.opts.VersionOverrides[repos.Path]
+	return isClean || overridden
 }
 
-func (builder *copyBuilder) copyReposStatic(repos *lockjson.Repos, buildRepos *buildinfo.Repos, optDir, vimExePath string, done chan actionReposResult) int {
+func (builder *copyBuilder) copyReposStatic(ctx context.Context, repos *lockjson.Repos, buildRepos *buildinfo.Repos, optDir, vimExePath string, done chan actionReposResult) int {
 	if builder.hasChangedStaticRepos(repos, buildRepos, optDir) {
-		go builder.updateStaticRepos(repos, vimExePath, done)
+		builder.goReposAction(ctx, repos, done, func(ctx context.Context, done chan actionReposResult) {
+			builder.updateStaticRepos(ctx, repos, vimExePath, done)
+		})
 		return 1
 	}
+	logger.Progress("Skipping " + string(repos.Type) + " repository " + repos.Path.String() + " ... Already up to date.")
 	return 0
 }
 
-// Remove vim repos not found in lock.json current repos list
-func (builder *copyBuilder) removeReposList(reposList lockjson.ReposList, reposDirList []os.FileInfo) (chan actionReposResult, int) {
-	removeList := make([]pathutil.ReposPath, 0, len(reposList))
-	for i := range reposDirList {
-		reposPath := pathutil.DecodeReposPath(reposDirList[i].Name())
-		if !reposList.Contains(reposPath) {
-			removeList = append(removeList, reposPath)
+// Returns installed repository directories
+// under ~/.vim/pack/volt/opt and ~/.vim/pack/volt/start
+func (*copyBuilder) readInstalledDirList() ([]string, error) {
+	dirList := make([]string, 0, 32)
+	for _, dir := range []string{pathutil.VimVoltOptDir(), pathutil.VimVoltStartDir()} {
+		fileList, err := ioutil.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		for i := range fileList {
+			// Skip ~/.vim/pack/volt/start/system
+			if dir == pathutil.VimVoltStartDir() && fileList[i].Name() == "system" {
+				continue
+			}
+			dirList = append(dirList, filepath.Join(dir, fileList[i].Name()))
+		}
+	}
+	return dirList, nil
+}
+
+// Remove vim repos not found in lock.json current repos list,
+// or installed to the other placement than current profile's one
+func (builder *copyBuilder) removeReposList(reposList lockjson.ReposList, installedDirList []string) (chan actionReposResult, int) {
+	wantDir := make(map[string]bool, len(reposList))
+	for i := range reposList {
+		wantDir[reposList[i].EncodedPath()] = true
+	}
+	removeList := make([]string, 0, len(installedDirList))
+	for i := range installedDirList {
+		if !wantDir[installedDirList[i]] {
+			removeList = append(removeList, installedDirList[i])
 		}
 	}
 	removeDone := make(chan actionReposResult, len(removeList))
+	remove := func(dir string) {
+		reposPath := pathutil.DecodeReposPath(dir)
+		err := os.RemoveAll(dir)
+		logger.Progress("Removing " + dir + " ... Done.")
+		removeDone <- actionReposResult{
+			err:   err,
+			repos: &lockjson.Repos{Path: reposPath},
+		}
+	}
 	for i := range removeList {
-		go func(reposPath pathutil.ReposPath) {
-			err := os.RemoveAll(pathutil.EncodeReposPath(reposPath))
-			logger.Info("Removing " + reposPath + " ... Done.")
-			removeDone <- actionReposResult{
-				err:   err,
-				repos: &lockjson.Repos{Path: reposPath},
-			}
-		}(removeList[i])
+		if builder.opts.NoParallel {
+			remove(removeList[i])
+		} else {
+			go remove(removeList[i])
+		}
 	}
 	return removeDone, len(removeList)
 }
 
-func (*copyBuilder) waitCopyRepos(copyDone chan actionReposResult, copyCount int, callback func(*actionReposResult) error) *multierror.Error {
+func (builder *copyBuilder) waitCopyRepos(copyDone chan actionReposResult, copyCount int, callback func(*actionReposResult) error) *multierror.Error {
 	var merr *multierror.Error
 	for i := 0; i < copyCount; i++ {
 		result := <-copyDone
-		if result.err != nil {
+		builder.reportRepos(&result)
+		builder.progressRepos(&result, i+1, copyCount)
+		if _, ok := result.err.(*reposTimeoutError); ok {
+			merr = multierror.Append(merr, result.err)
+		} else if result.err != nil {
 			merr = multierror.Append(
 				merr,
 				errors.New(
@@ -243,33 +350,52 @@ func (*copyBuilder) waitCopyRepos(copyDone chan actionReposResult, copyCount int
 func (*copyBuilder) constructBuildInfo(buildInfo *buildinfo.BuildInfo, result *actionReposResult) {
 	if result.repos.Type == lockjson.ReposGitType {
 		r := buildInfo.Repos.FindByReposPath(result.repos.Path)
+		subject := commitSubject(result.repos)
 		if r != nil {
 			r.Version = result.repos.Version
 			r.Files = result.files
+			r.FileSizes = result.sizes
+			r.Placement = result.repos.Placement
+			r.Subdir = result.repos.Subdir
+			r.CommitSubject = subject
+			r.DigestV1 = result.digest
 		} else {
 			buildInfo.Repos = append(
 				buildInfo.Repos,
 				buildinfo.Repos{
-					Type:    lockjson.ReposGitType,
-					Path:    result.repos.Path,
-					Version: result.repos.Version,
-					Files:   result.files,
+					Type:          lockjson.ReposGitType,
+					Path:          result.repos.Path,
+					Version:       result.repos.Version,
+					Files:         result.files,
+					FileSizes:     result.sizes,
+					Placement:     result.repos.Placement,
+					Subdir:        result.repos.Subdir,
+					CommitSubject: subject,
+					DigestV1:      result.digest,
 				},
 			)
 		}
-	} else if result.repos.Type == lockjson.ReposStaticType {
+	} else if result.repos.Type == lockjson.ReposStaticType || result.repos.Type == lockjson.ReposLocalType {
 		r := buildInfo.Repos.FindByReposPath(result.repos.Path)
 		if r != nil {
 			r.Version = time.Now().Format(time.RFC3339)
 			r.Files = result.files
+			r.FileSizes = result.sizes
+			r.Placement = result.repos.Placement
+			r.Subdir = result.repos.Subdir
+			r.DigestV1 = result.digest
 		} else {
 			buildInfo.Repos = append(
 				buildInfo.Repos,
 				buildinfo.Repos{
-					Type:    lockjson.ReposStaticType,
-					Path:    result.repos.Path,
-					Version: time.Now().Format(time.RFC3339),
-					Files:   result.files,
+					Type:      result.repos.Type,
+					Path:      result.repos.Path,
+					Version:   time.Now().Format(time.RFC3339),
+					Files:     result.files,
+					FileSizes: result.sizes,
+					Placement: result.repos.Placement,
+					Subdir:    result.repos.Subdir,
+					DigestV1:  result.digest,
 				},
 			)
 		}
@@ -316,23 +442,149 @@ func (*copyBuilder) getLatestModTime(path string) (time.Time, error) {
 	return mtime, nil
 }
 
-func (*copyBuilder) hasChangedGitRepos(repos *lockjson.Repos, buildRepos *buildinfo.Repos, isDirty bool) bool {
+func (builder *copyBuilder) hasChangedGitRepos(repos *lockjson.Repos, buildRepos *buildinfo.Repos, isDirty bool) bool {
 	if buildRepos == nil { // Full build
 		return true
 	}
+	if builder.hasChangedPlacement(repos, buildRepos) || repos.Subdir != buildRepos.Subdir {
+		return true
+	}
 	if repos.Version != buildRepos.Version {
 		return true
 	}
 	if buildRepos.DirtyWorktree || isDirty {
 		return true
 	}
+	return builder.isInstalledReposDamaged(repos, buildRepos)
+}
+
+// Returns true if the repository was installed to the other placement
+// (start or opt) than the current profile's one
+func (*copyBuilder) hasChangedPlacement(repos *lockjson.Repos, buildRepos *buildinfo.Repos) bool {
+	placement := buildRepos.Placement
+	if placement == "" {
+		placement = lockjson.ReposOptPlacement
+	}
+	return placement != repos.Placement
+}
+
+// Returns true if the installed files of the repository look damaged
+// (e.g. previous build crashed while writing them) though the repository
+// itself was not changed.
+// If build-info.json has the installed files, compares their blob hashes.
+// If it has only the digest of the installed files (e.g. static
+// repository), compares the digest. Otherwise checks that files in
+// ~/volt/repos/{repos} are installed with the same size.
+func (builder *copyBuilder) isInstalledReposDamaged(repos *lockjson.Repos, buildRepos *buildinfo.Repos) bool {
+	dst := repos.EncodedPath()
+	// The removed directory is installed again without warnings
+	if !pathutil.Exists(dst) {
+		logger.Debug(repos.Path.String() + ": " + dst + " does not exist, copying again")
+		return true
+	}
+	var err error
+	if len(buildRepos.Files) > 0 {
+		err = builder.checkInstalledFileHashes(dst, buildRepos.Files, buildRepos.FileSizes)
+	} else if buildRepos.DigestV1 != "" {
+		err = builder.checkInstalledDigest(dst, buildRepos.DigestV1)
+	} else {
+		err = builder.checkInstalledFileSizes(repos, dst)
+	}
+	if err != nil {
+		logger.Warnf("%s: installed files look damaged, copying again: %s", repos.Path, err.Error())
+		return true
+	}
 	return false
 }
 
+// sizes may not have the sizes of files (built by older volt)
+func (*copyBuilder) checkInstalledFileHashes(dst string, files buildinfo.FileMap, sizes map[string]int64) error {
+	for name, hash := range files {
+		// build-info.json written by older volt may have doc/tags which is
+		// re-generated by ":helptags"
+		if isHelptagsFile(name) {
+			continue
+		}
+		size, ok := sizes[name]
+		if !ok {
+			size = -1
+		}
+		got, err := hashFile(filepath.Join(dst, filepath.FromSlash(name)), size)
+		if err != nil {
+			return errors.New(name + ": " + err.Error())
+		}
+		if got != hash {
+			return errors.New(name + " was modified")
+		}
+	}
+	return nil
+}
+
+func (*copyBuilder) checkInstalledDigest(dst string, digest string) error {
+	hashes, err := hashDir(dst, nil)
+	if err != nil {
+		return err
+	}
+	if buildinfo.FileMap(hashes).DigestV1() != digest {
+		return errors.New("the digest of installed files differs")
+	}
+	return nil
+}
+
+func (builder *copyBuilder) checkInstalledFileSizes(repos *lockjson.Repos, dst string) error {
+	src := repos.SourceDir()
+	noHidden := builder.skipsHidden(repos)
+	ignore, err := readVoltignore(src)
+	if err != nil {
+		return err
+	}
+	return filepath.Walk(src, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		// ".git" and ".gitignore" are not copied from git repository
+		if repos.Type == lockjson.ReposGitType && (rel == ".git" || rel == ".gitignore") {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if noHidden && rel != "." && isHiddenName(fi.Name()) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if fi.IsDir() || fi.Mode()&BuildModeInvalidType != 0 || isVoltignored(ignore, rel) {
+			return nil
+		}
+		// The files larger than -max-file-size are not installed
+		if builder.opts.MaxFileSize > 0 && fi.Size() > builder.opts.MaxFileSize {
+			return nil
+		}
+		// doc/tags is re-generated by ":helptags"
+		if isHelptagsFile(filepath.ToSlash(rel)) {
+			return nil
+		}
+		di, err := os.Stat(filepath.Join(dst, rel))
+		if err != nil {
+			return err
+		}
+		if di.Size() != fi.Size() {
+			return errors.New(filepath.ToSlash(rel) + " has different size")
+		}
+		return nil
+	})
+}
+
 // Remove ~/.vim/volt/opt/{repos} and copy from ~/volt/repos/{repos}
-func (builder *copyBuilder) updateGitRepos(repos *lockjson.Repos, r *git.Repository, copyFromGitObjects bool, vimExePath string, done chan actionReposResult) {
-	src := pathutil.FullReposPath(repos.Path)
-	dst := pathutil.EncodeReposPath(repos.Path)
+func (builder *copyBuilder) updateGitRepos(ctx context.Context, repos *lockjson.Repos, r *git.Repository, copyFromGitObjects bool, vimExePath string, done chan actionReposResult) {
+	src := repos.SourceDir()
+	dst := repos.EncodedPath()
 
 	// Remove ~/.vim/volt/opt/{repos}
 	// TODO: Do not remove here, copy newer files only after
@@ -347,55 +599,52 @@ func (builder *copyBuilder) updateGitRepos(repos *lockjson.Repos, r *git.Reposit
 
 	if copyFromGitObjects {
 		logger.Debug("Copy from git objects: " + repos.Path)
-		builder.updateBareGitRepos(r, src, dst, repos, vimExePath, done)
+		files, sizes, err := builder.installGitTree(ctx, r, dst, repos, vimExePath)
+		done <- actionReposResult{
+			err:   err,
+			repos: repos,
+			files: files,
+			sizes: sizes,
+		}
 	} else {
 		logger.Debug("Copy from filesystem: " + repos.Path)
-		builder.updateNonBareGitRepos(r, src, dst, repos, vimExePath, done)
+		builder.updateNonBareGitRepos(ctx, r, src, dst, repos, vimExePath, done)
 	}
 }
 
-func (builder *copyBuilder) updateBareGitRepos(r *git.Repository, src, dst string, repos *lockjson.Repos, vimExePath string, done chan actionReposResult) {
-	// Get locked commit hash
-	commit := plumbing.NewHash(repos.Version)
-	commitObj, err := r.CommitObject(commit)
-	if err != nil {
-		done <- actionReposResult{
-			err:   errors.New("failed to get HEAD commit object: " + err.Error()),
-			repos: repos,
-		}
-		return
+var BuildModeInvalidType = os.ModeSymlink | os.ModeNamedPipe | os.ModeSocket | os.ModeDevice
+
+// Symbolic links of static repositories are installed as symbolic links
+var staticModeInvalidType = BuildModeInvalidType &^ os.ModeSymlink
+
+// Hard-link (or copy) src to dst like fileutil.TryLinkFile(), but copy it
+// with the bits of mask cleared if perm has them, because a hard link
+// shares the mode with src.
+func tryLinkFileMasked(src, dst string, buf []byte, perm, mask os.FileMode) error {
+	if perm&mask == 0 {
+		return fileutil.TryLinkFile(src, dst, buf, perm)
 	}
+	return fileutil.CopyFile(src, dst, buf, perm&^mask)
+}
 
-	// Get tree hash of commit hash
-	tree, err := r.TreeObject(commitObj.TreeHash)
+func (builder *copyBuilder) updateNonBareGitRepos(ctx context.Context, r *git.Repository, src, dst string, repos *lockjson.Repos, vimExePath string, done chan actionReposResult) {
+	filter, err := builder.sourceFilter(repos)
 	if err != nil {
 		done <- actionReposResult{
-			err:   errors.New("failed to get tree " + commit.String() + ": " + err.Error()),
+			err:   err,
 			repos: repos,
 		}
 		return
 	}
 
-	// Copy files
-	files := make(buildinfo.FileMap, 512)
-	err = tree.Files().ForEach(func(file *object.File) error {
-		osMode, err := file.Mode.ToOSFileMode()
-		if err != nil {
-			return errors.New("failed to convert file mode: " + err.Error())
-		}
-
-		contents, err := file.Contents()
-		if err != nil {
-			return errors.New("failed to get file contents: " + err.Error())
+	buf := make([]byte, 32*1024)
+	if filter.ignore != nil || builder.opts.MaxFileSize > 0 || builder.opts.FileModeMask != 0 {
+		if err := os.MkdirAll(dst, 0755); err == nil {
+			err = tryLinkDirIgnored(ctx, src, src, dst, buf, filter, builder.opts.FileModeMask)
 		}
-
-		filename := filepath.Join(dst, file.Name)
-		os.MkdirAll(filepath.Dir(filename), 0755)
-		ioutil.WriteFile(filename, []byte(contents), osMode)
-
-		files[file.Name] = file.Hash.String() // blob hash
-		return nil
-	})
+	} else {
+		err = builder.linkNonBareGitRepos(ctx, src, dst, buf)
+	}
 	if err != nil {
 		done <- actionReposResult{
 			err:   err,
@@ -405,7 +654,7 @@ func (builder *copyBuilder) updateBareGitRepos(r *git.Repository, src, dst strin
 	}
 
 	// Run ":helptags" to generate tags file
-	err = builder.helptags(repos.Path, vimExePath)
+	err = builder.helptags(ctx, repos, vimExePath)
 	if err != nil {
 		done <- actionReposResult{
 			err:   err,
@@ -417,25 +666,22 @@ func (builder *copyBuilder) updateBareGitRepos(r *git.Repository, src, dst strin
 	done <- actionReposResult{
 		err:   nil,
 		repos: repos,
-		files: files,
+		files: nil, // all files are overwritten next time even when timestamp is older
 	}
 }
 
-var BuildModeInvalidType = os.ModeSymlink | os.ModeNamedPipe | os.ModeSocket | os.ModeDevice
-
-func (builder *copyBuilder) updateNonBareGitRepos(r *git.Repository, src, dst string, repos *lockjson.Repos, vimExePath string, done chan actionReposResult) {
+// Hard-link (or copy) the files and directories of src to dst except
+// ".git" and ".gitignore", when no files are filtered (see sourceFilter())
+func (*copyBuilder) linkNonBareGitRepos(ctx context.Context, src, dst string, buf []byte) error {
 	files, err := ioutil.ReadDir(src)
 	if err != nil {
-		done <- actionReposResult{
-			err:   err,
-			repos: repos,
-		}
-		return
+		return err
 	}
-
-	buf := make([]byte, 32*1024)
-	created := make(map[string]bool, len(files))
+	created := false
 	for _, file := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		// Skip ".git" and ".gitignore"
 		if file.Name() == ".git" || file.Name() == ".gitignore" {
 			continue
@@ -444,50 +690,33 @@ func (builder *copyBuilder) updateNonBareGitRepos(r *git.Repository, src, dst st
 			// Currenly skip the invalid files...
 			continue
 		}
-		if !created[dst] {
+		if !created {
 			os.MkdirAll(dst, 0755)
-			created[dst] = true
+			created = true
 		}
 		from := filepath.Join(src, file.Name())
 		to := filepath.Join(dst, file.Name())
-		var err error
 		if file.IsDir() {
 			err = fileutil.TryLinkDir(from, to, buf, file.Mode(), BuildModeInvalidType)
 		} else {
 			err = fileutil.TryLinkFile(from, to, buf, file.Mode())
 		}
 		if err != nil {
-			done <- actionReposResult{
-				err:   err,
-				repos: repos,
-			}
-			return
-		}
-	}
-
-	// Run ":helptags" to generate tags file
-	err = builder.helptags(repos.Path, vimExePath)
-	if err != nil {
-		done <- actionReposResult{
-			err:   err,
-			repos: repos,
+			return err
 		}
-		return
-	}
-
-	done <- actionReposResult{
-		err:   nil,
-		repos: repos,
-		files: nil, // all files are overwritten next time even when timestamp is older
 	}
+	return nil
 }
 
 func (builder *copyBuilder) hasChangedStaticRepos(repos *lockjson.Repos, buildRepos *buildinfo.Repos, optDir string) bool {
 	if buildRepos == nil { // Full build
 		return true
 	}
+	if builder.hasChangedPlacement(repos, buildRepos) || repos.Subdir != buildRepos.Subdir {
+		return true
+	}
 
-	src := pathutil.FullReposPath(repos.Path)
+	src := repos.SourceDir()
 
 	// Get latest mtime of src
 	// TODO: Don't check mtime here, do it when copy altogether
@@ -509,13 +738,44 @@ func (builder *copyBuilder) hasChangedStaticRepos(repos *lockjson.Repos, buildRe
 		return true
 	}
 
-	return dstModTime.Before(srcModTime)
+	if dstModTime.Before(srcModTime) {
+		return true
+	}
+	return builder.isInstalledReposDamaged(repos, buildRepos)
+}
+
+// Returns true if hidden files of repos must not be installed
+func (builder *copyBuilder) skipsHidden(repos *lockjson.Repos) bool {
+	return builder.opts.NoHidden && (repos.Type == lockjson.ReposStaticType || repos.Type == lockjson.ReposLocalType) && !builder.opts.KeepHidden[repos.Path]
+}
+
+// Returns the filter of the files under the source directory of repos which
+// copy strategy installs from the filesystem
+func (builder *copyBuilder) sourceFilter(repos *lockjson.Repos) (*dirFilter, error) {
+	ignore, err := readVoltignore(repos.SourceDir())
+	if err != nil {
+		return nil, errors.New("failed to read " + voltignoreName + ": " + err.Error())
+	}
+	filter := &dirFilter{
+		ignore: ignore,
+		tooLarge: func(rel string, size int64) bool {
+			return builder.isTooLarge(repos, rel, size)
+		},
+	}
+	if repos.Type == lockjson.ReposGitType {
+		filter.skipGit = true
+		filter.ignoreType = BuildModeInvalidType
+	} else {
+		filter.noHidden = builder.skipsHidden(repos)
+		filter.ignoreType = staticModeInvalidType
+	}
+	return filter, nil
 }
 
 // Remove ~/.vim/volt/opt/{repos} and copy from ~/volt/repos/{repos}
-func (builder *copyBuilder) updateStaticRepos(repos *lockjson.Repos, vimExePath string, done chan actionReposResult) {
-	src := pathutil.FullReposPath(repos.Path)
-	dst := pathutil.EncodeReposPath(repos.Path)
+func (builder *copyBuilder) updateStaticRepos(ctx context.Context, repos *lockjson.Repos, vimExePath string, done chan actionReposResult) {
+	src := repos.SourceDir()
+	dst := repos.EncodedPath()
 
 	// Remove ~/.vim/volt/opt/{repos}
 	// TODO: Do not remove here, copy newer files only after
@@ -529,6 +789,7 @@ func (builder *copyBuilder) updateStaticRepos(repos *lockjson.Repos, vimExePath
 	}
 
 	// Copy ~/volt/repos/{repos} to ~/.vim/volt/opt/{repos}
+	os.MkdirAll(filepath.Dir(dst), 0755)
 	buf := make([]byte, 32*1024)
 	si, err := os.Stat(src)
 	if err != nil {
@@ -545,7 +806,19 @@ func (builder *copyBuilder) updateStaticRepos(repos *lockjson.Repos, vimExePath
 		}
 		return
 	}
-	err = fileutil.TryLinkDir(src, dst, buf, si.Mode(), BuildModeInvalidType)
+	filter, err := builder.sourceFilter(repos)
+	if err != nil {
+		done <- actionReposResult{
+			err:   err,
+			repos: repos,
+		}
+		return
+	}
+	if filter.ignore != nil || filter.noHidden || builder.opts.MaxFileSize > 0 || builder.opts.FileModeMask != 0 {
+		err = tryLinkDirIgnored(ctx, src, src, dst, buf, filter, builder.opts.FileModeMask)
+	} else {
+		err = fileutil.TryLinkDirParallel(ctx, src, dst, si.Mode(), staticModeInvalidType, runtime.NumCPU())
+	}
 	if err != nil {
 		done <- actionReposResult{
 			err:   errors.New("failed to copy static directory: " + err.Error()),
@@ -555,7 +828,7 @@ func (builder *copyBuilder) updateStaticRepos(repos *lockjson.Repos, vimExePath
 	}
 
 	// Run ":helptags" to generate tags file
-	err = builder.helptags(repos.Path, vimExePath)
+	err = builder.helptags(ctx, repos, vimExePath)
 	if err != nil {
 		done <- actionReposResult{
 			err:   err,
@@ -0,0 +1,41 @@
+package builder
+
+import (
+	"context"
+	"errors"
+
+	"gopkg.in/src-d/go-git.v4"
+
+	"github.com/vim-volt/volt/gitutil"
+	"github.com/vim-volt/volt/lockjson"
+	"github.com/vim-volt/volt/pathutil"
+)
+
+// ExtractGitTree writes the files of version (commit hash, tag or branch
+// name) of the git repository reposPath in $VOLTPATH/repos to dst, in the
+// same way as copy strategy installs git repositories: .voltignore of the
+// commit is applied, and MaxFileSize, FileModeMask and VerifyCopy of opts
+// are respected. The whole tree is written regardless of subdir in
+// lock.json, and ":helptags" is not run. opts may be nil.
+func ExtractGitTree(ctx context.Context, reposPath pathutil.ReposPath, version, dst string, opts *Options) error {
+	if opts == nil {
+		opts = &Options{}
+	}
+	builder := &BaseBuilder{opts: *opts}
+	repos := &lockjson.Repos{Type: lockjson.ReposGitType, Path: reposPath}
+
+	var r *git.Repository
+	err := builder.retryGit(repos, "opening repository", func() (err error) {
+		r, err = git.PlainOpen(pathutil.FullReposPath(reposPath))
+		return err
+	})
+	if err != nil {
+		return errors.New("failed to open repository: " + err.Error())
+	}
+	repos.Version, err = gitutil.ResolveVersion(r, version)
+	if err != nil {
+		return err
+	}
+	_, _, err = builder.extractGitTree(ctx, r, dst, repos)
+	return err
+}
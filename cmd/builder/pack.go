@@ -0,0 +1,358 @@
+package builder
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/vim-volt/volt/lockjson"
+	"github.com/vim-volt/volt/logger"
+	"github.com/vim-volt/volt/pathutil"
+	"github.com/vim-volt/volt/plugconf"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// Pack writes the files which copy strategy installs for the current profile
+// (pack/volt/{start,opt}, the bundled plugconf, vimrc and gvimrc) to tw,
+// instead of the vim directory.
+// The files of repositories are filtered and tags files are generated in
+// the same way as copy strategy with opts.
+// Entry names are relative to the vim directory (e.g. "pack/volt/opt/...").
+// build-info.json is not written.
+func Pack(ctx context.Context, tw *tar.Writer, opts *Options) error {
+	if opts == nil {
+		opts = &Options{}
+	}
+	builder := &copyBuilder{BaseBuilder{opts: *opts}}
+	return builder.pack(ctx, &tarPacker{tw: tw, dirs: make(map[string]bool, 64)})
+}
+
+// tarPacker writes entries to tar archive.
+// Parent directories are written before their entries.
+type tarPacker struct {
+	tw   *tar.Writer
+	dirs map[string]bool
+}
+
+func (builder *copyBuilder) pack(ctx context.Context, p *tarPacker) error {
+	// Read lock.json
+	lockJSON, err := lockjson.Read()
+	if err != nil {
+		return errors.New("could not read lock.json: " + err.Error())
+	}
+
+	// Get current profile's repos list
+	reposList, err := builder.getCurrentReposList(lockJSON)
+	if err != nil {
+		return err
+	}
+
+	// Vim is needed to generate tags files like copy strategy
+	var vimExePath string
+	if !builder.opts.NoHelptags {
+		vimExePath, err = pathutil.VimExecutable()
+		if err != nil {
+			return err
+		}
+	}
+
+	vimDir := pathutil.VimDir()
+	for i := range reposList {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		dst, err := filepath.Rel(vimDir, reposList[i].EncodedPath())
+		if err != nil {
+			return err
+		}
+		rp := &reposPacker{p: p, dst: filepath.ToSlash(dst), helptags: !builder.opts.NoHelptags}
+		err = builder.packRepos(ctx, rp, &reposList[i], vimExePath)
+		if err != nil {
+			return errors.New("failed to pack repository '" + reposList[i].Path.String() + "': " + err.Error())
+		}
+		logger.Progressf("[%d/%d] Packing %s repository %s ... Done.", i+1, len(reposList), reposList[i].Type, reposList[i].Path)
+	}
+
+	// Write bundled plugconf file
+	content, merr := plugconf.GenerateBundlePlugconf(lockJSON.CurrentProfileName, reposList)
+	if merr.ErrorOrNil() != nil {
+		// Return vim script parse errors
+		return merr
+	}
+	bundled, err := filepath.Rel(vimDir, pathutil.BundledPlugConf())
+	if err != nil {
+		return err
+	}
+	err = p.writeFile(filepath.ToSlash(bundled), content, 0644, time.Now())
+	if err != nil {
+		return err
+	}
+
+	// Write vimrc and gvimrc
+	if builder.opts.NoVimrc {
+		return nil
+	}
+	for _, rc := range []struct{ src, dst string }{
+		{pathutil.ProfileVimrc, pathutil.Vimrc},
+		{pathutil.ProfileGvimrc, pathutil.Gvimrc},
+	} {
+		src := filepath.Join(pathutil.RCDir(lockJSON.CurrentProfileName), rc.src)
+		fi, err := os.Stat(src)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		content, err := ioutil.ReadFile(src)
+		if err != nil {
+			return err
+		}
+		content = append([]byte(magicCommentLine()+fmt.Sprintf(magicCommentNext, src)), content...)
+		err = p.writeFile(rc.dst, content, fi.Mode(), fi.ModTime())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Write the files of repos which copy strategy installs to rp, and the
+// tags files which ":helptags" generates from them
+func (builder *copyBuilder) packRepos(ctx context.Context, rp *reposPacker, repos *lockjson.Repos, vimExePath string) error {
+	defer rp.removeDocDir()
+	var err error
+	switch repos.Type {
+	case lockjson.ReposGitType:
+		err = builder.packReposGit(ctx, rp, repos)
+	case lockjson.ReposStaticType, lockjson.ReposLocalType:
+		err = builder.packReposStatic(ctx, rp, repos)
+	default:
+		err = errors.New("invalid repository type: " + string(repos.Type))
+	}
+	if err != nil || rp.docDir == "" {
+		return err
+	}
+	if err := builder.helptagsDir(ctx, repos, rp.docDir, vimExePath); err != nil {
+		return err
+	}
+	return rp.writeTags()
+}
+
+// Write files of ~/volt/repos/{repos} like copy strategy installs them
+// (see copyReposGit())
+func (builder *copyBuilder) packReposGit(ctx context.Context, rp *reposPacker, repos *lockjson.Repos) error {
+	r, cfg, err := builder.openReposGit(repos)
+	if err != nil {
+		return err
+	}
+	if !builder.copiesFromGitObjects(repos, builder.isCleanWorktree(r, cfg)) {
+		logger.Debug("Pack from filesystem: " + repos.Path)
+		return builder.packDir(ctx, rp, repos)
+	}
+
+	logger.Debug("Pack from git objects: " + repos.Path)
+	commitObj, err := builder.lockedCommit(r, repos)
+	if err != nil {
+		return err
+	}
+	// The same modification time as extractGitTree() sets
+	modTime := commitObj.Committer.When
+	return builder.walkInstalledGitFiles(ctx, r, commitObj, repos, func(file *object.File, mode os.FileMode) error {
+		return rp.writeBlob(file.Name, file, mode, modTime)
+	})
+}
+
+// Write files of ~/volt/repos/{repos} like copy strategy installs them
+// (see updateStaticRepos())
+func (builder *copyBuilder) packReposStatic(ctx context.Context, rp *reposPacker, repos *lockjson.Repos) error {
+	si, err := os.Stat(repos.SourceDir())
+	if err != nil {
+		return errors.New("failed to pack static directory: " + err.Error())
+	}
+	if !si.IsDir() {
+		return errors.New("failed to pack static directory: source is not a directory")
+	}
+	return builder.packDir(ctx, rp, repos)
+}
+
+// Write files under the source directory of repos which copy strategy
+// installs from the filesystem (see sourceFilter()).
+// Symbolic links are written as symbolic link entries (not followed).
+func (builder *copyBuilder) packDir(ctx context.Context, rp *reposPacker, repos *lockjson.Repos) error {
+	src := repos.SourceDir()
+	filter, err := builder.sourceFilter(repos)
+	if err != nil {
+		return err
+	}
+	return walkDirIgnored(ctx, src, src, filter, func(fullpath string, fi os.FileInfo) error {
+		rel, err := filepath.Rel(src, fullpath)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if fi.Mode()&os.ModeSymlink != 0 {
+			link, err := os.Readlink(fullpath)
+			if err != nil {
+				return err
+			}
+			return rp.p.writeSymlink(path.Join(rp.dst, rel), link, fi.ModTime())
+		}
+		f, err := os.Open(fullpath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return rp.writeFile(rel, f, fi.Size(), fi.Mode()&^builder.opts.FileModeMask, fi.ModTime())
+	})
+}
+
+// reposPacker writes the files of a repository under dst of tar archive.
+// If helptags is true, the files directly under doc/ are also written to
+// {docDir}/doc to generate the tags files by ":helptags" after all files
+// were written, and the tags files in the repository are not written.
+type reposPacker struct {
+	p        *tarPacker
+	dst      string
+	helptags bool
+	// The temporary directory which is created when the first file under
+	// doc/ is written
+	docDir string
+}
+
+// Write the blob of file without reading it all into memory
+func (rp *reposPacker) writeBlob(rel string, file *object.File, mode os.FileMode, modTime time.Time) (err error) {
+	r, err := file.Reader()
+	if err != nil {
+		return errors.New("failed to get file contents: " + err.Error())
+	}
+	defer func() {
+		if e := r.Close(); err == nil && e != nil {
+			err = errors.New("failed to get file contents: " + e.Error())
+		}
+	}()
+	return rp.writeFile(rel, r, file.Size, mode, modTime)
+}
+
+// Write size bytes read from r as rel (slash-separated path relative to the
+// installed directory)
+func (rp *reposPacker) writeFile(rel string, r io.Reader, size int64, mode os.FileMode, modTime time.Time) error {
+	if rp.helptags && path.Dir(rel) == "doc" {
+		// doc/tags is re-generated by ":helptags"
+		if isHelptagsFile(rel) {
+			return nil
+		}
+		if rp.docDir == "" {
+			dir, err := ioutil.TempDir("", "volt-pack-")
+			if err != nil {
+				return err
+			}
+			rp.docDir = dir
+			if err := os.Mkdir(filepath.Join(dir, "doc"), 0755); err != nil {
+				return err
+			}
+		}
+		f, err := os.Create(filepath.Join(rp.docDir, "doc", path.Base(rel)))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = io.TeeReader(r, f)
+	}
+	return rp.p.writeFileFrom(path.Join(rp.dst, rel), r, size, mode, modTime)
+}
+
+// Write the tags files which ":helptags" generated in {docDir}/doc
+func (rp *reposPacker) writeTags() error {
+	docdir := filepath.Join(rp.docDir, "doc")
+	files, err := ioutil.ReadDir(docdir)
+	if err != nil {
+		return err
+	}
+	for _, fi := range files {
+		rel := "doc/" + fi.Name()
+		if fi.IsDir() || !isHelptagsFile(rel) {
+			continue
+		}
+		f, err := os.Open(filepath.Join(docdir, fi.Name()))
+		if err != nil {
+			return err
+		}
+		err = rp.p.writeFileFrom(path.Join(rp.dst, rel), f, fi.Size(), 0644, fi.ModTime())
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rp *reposPacker) removeDocDir() {
+	if rp.docDir != "" {
+		os.RemoveAll(rp.docDir)
+	}
+}
+
+func (p *tarPacker) writeFile(name string, content []byte, mode os.FileMode, modTime time.Time) error {
+	return p.writeFileFrom(name, bytes.NewReader(content), int64(len(content)), mode, modTime)
+}
+
+// Write size bytes read from r as a regular file entry.
+// The size is written to the header before the contents, so it fails if r
+// has fewer bytes (e.g. the file was truncated while it was written).
+func (p *tarPacker) writeFileFrom(name string, r io.Reader, size int64, mode os.FileMode, modTime time.Time) error {
+	if err := p.writeParentDirs(name); err != nil {
+		return err
+	}
+	err := p.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     int64(mode.Perm()),
+		Size:     size,
+		ModTime:  modTime,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyN(p.tw, r, size)
+	return err
+}
+
+func (p *tarPacker) writeSymlink(name, link string, modTime time.Time) error {
+	if err := p.writeParentDirs(name); err != nil {
+		return err
+	}
+	return p.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeSymlink,
+		Name:     name,
+		Linkname: link,
+		Mode:     0777,
+		ModTime:  modTime,
+	})
+}
+
+// Write directory entries of name's parent directories
+// which were not written yet
+func (p *tarPacker) writeParentDirs(name string) error {
+	dir := path.Dir(name)
+	if dir == "." || dir == "/" || p.dirs[dir] {
+		return nil
+	}
+	if err := p.writeParentDirs(dir); err != nil {
+		return err
+	}
+	p.dirs[dir] = true
+	return p.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     dir + "/",
+		Mode:     0755,
+		ModTime:  time.Now(),
+	})
+}
@@ -0,0 +1,61 @@
+package builder
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vim-volt/volt/lockjson"
+	"github.com/vim-volt/volt/logger"
+	"github.com/vim-volt/volt/pathutil"
+)
+
+// Create the symlinks and directories of "post_install" of the installed
+// repositories. This is done on every build, so the removed ones are
+// created again.
+func (builder *BaseBuilder) installPostInstall(reposList lockjson.ReposList) error {
+	for i := range reposList {
+		repos := &reposList[i]
+		for _, p := range repos.PostInstall {
+			if err := builder.createPostInstall(repos, &p); err != nil {
+				return errors.New(repos.Path.String() + ": post_install: " + err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+func (*BaseBuilder) createPostInstall(repos *lockjson.Repos, p *lockjson.PostInstall) error {
+	// lock.json validation guarantees p.Path is under the home directory
+	dst := filepath.Join(pathutil.HomeDir(), filepath.FromSlash(strings.TrimPrefix(p.Path, "~/")))
+
+	if p.Target == "" {
+		if err := os.MkdirAll(dst, 0755); err != nil {
+			return errors.New("could not create directory " + dst + ": " + err.Error())
+		}
+		return nil
+	}
+
+	target := filepath.Join(repos.EncodedPath(), filepath.FromSlash(p.Target))
+	if fi, err := os.Lstat(dst); err == nil {
+		// Do not overwrite the files which the user created
+		if fi.Mode()&os.ModeSymlink == 0 {
+			return errors.New(dst + " already exists and is not a symlink")
+		}
+		if link, err := os.Readlink(dst); err == nil && link == target {
+			return nil
+		}
+		if err := os.Remove(dst); err != nil {
+			return errors.New("could not remove old symlink " + dst + ": " + err.Error())
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return errors.New("could not create directory " + filepath.Dir(dst) + ": " + err.Error())
+	}
+	if err := os.Symlink(target, dst); err != nil {
+		return errors.New("could not create symlink " + dst + ": " + err.Error())
+	}
+	logger.Debug("Created symlink " + dst + " -> " + target)
+	return nil
+}
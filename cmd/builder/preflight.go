@@ -0,0 +1,163 @@
+package builder
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/vim-volt/volt/gitutil"
+	"github.com/vim-volt/volt/lockjson"
+	"github.com/vim-volt/volt/pathutil"
+	"github.com/vim-volt/volt/plugconf"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+func (builder *symlinkBuilder) Preflight() error {
+	return builder.preflight()
+}
+
+func (builder *copyBuilder) Preflight() error {
+	return builder.preflight()
+}
+
+// Validate the current profile before Build() modifies anything.
+// Repositories are validated concurrently, and all problems are returned
+// at once so that users can fix them in one go.
+// The locked revisions of git repositories are checked even by symlink
+// strategy, because bare repositories are installed from them and a broken
+// lock.json should not be found after the previous build was removed.
+func (builder *BaseBuilder) preflight() error {
+	lockJSON, err := lockjson.Read()
+	if err != nil {
+		return errors.New("could not read lock.json: " + err.Error())
+	}
+	reposList, err := builder.getUnresolvedReposList(lockJSON)
+	if err != nil {
+		return err
+	}
+
+	var merr *multierror.Error
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	workers := runtime.NumCPU()
+	if builder.opts.NoParallel {
+		workers = 1
+	}
+	sem := make(chan struct{}, workers)
+	for _, i := range builder.reposOrder(reposList) {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(repos *lockjson.Repos) {
+			defer func() { <-sem; wg.Done() }()
+			errs := builder.preflightRepos(lockJSON.CurrentProfileName, repos)
+			mutex.Lock()
+			merr = multierror.Append(merr, errs...)
+			mutex.Unlock()
+		}(&reposList[i])
+	}
+	wg.Wait()
+
+	merr = multierror.Append(merr, builder.preflightEncodedPaths(reposList)...)
+	merr = multierror.Append(merr, builder.preflightRCFiles(lockJSON.CurrentProfileName)...)
+	if merr.ErrorOrNil() == nil {
+		return nil
+	}
+	// Show errors in the same order regardless of goroutines' timing
+	sortErrors(merr.Errors)
+	return merr
+}
+
+func (*BaseBuilder) preflightRepos(profileName string, repos *lockjson.Repos) []error {
+	var errs []error
+	src := repos.ReposDir()
+	if !pathutil.Exists(src) {
+		errs = append(errs, errors.New(repos.Path.String()+": repository does not exist: "+src))
+	} else if repos.Type == lockjson.ReposGitType {
+		if err := preflightRevision(src, repos.Version); err != nil {
+			errs = append(errs, errors.New(repos.Path.String()+": "+err.Error()))
+		}
+	}
+	if path := plugconf.LookUpPlugconf(profileName, repos.Path); path != "" {
+		if _, err := plugconf.ParsePlugconfFile(path, 0, repos.Path); err != nil {
+			// err has the repository path already
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// Checks that version of the git repository src resolves to a commit whose
+// tree object exists
+func preflightRevision(src, version string) error {
+	r, err := git.PlainOpen(src)
+	if err != nil {
+		return errors.New("failed to open repository: " + err.Error())
+	}
+	hash, err := gitutil.ResolveVersion(r, version)
+	if err != nil {
+		return errors.New("locked revision does not exist: " + err.Error())
+	}
+	commit, err := r.CommitObject(plumbing.NewHash(hash))
+	if err == nil {
+		_, err = commit.Tree()
+	}
+	if err != nil {
+		return errors.New("tree of locked revision " + hash + " does not exist: " + err.Error())
+	}
+	return nil
+}
+
+// Distinct repositories must not be installed to the same directory,
+// otherwise the one installed last overwrites the other without errors.
+// The directories are compared case-insensitively because they collide on
+// case-insensitive filesystems (macOS and Windows) where lock.json may be
+// used too.
+func (*BaseBuilder) preflightEncodedPaths(reposList lockjson.ReposList) []error {
+	var errs []error
+	installed := make(map[string]pathutil.ReposPath, len(reposList))
+	for i := range reposList {
+		dst := reposList[i].EncodedPath()
+		key := strings.ToLower(dst)
+		if other, exists := installed[key]; exists && other != reposList[i].Path {
+			errs = append(errs, errors.New("repositories "+other.String()+" and "+reposList[i].Path.String()+" are installed to the same directory: "+dst))
+			continue
+		}
+		installed[key] = reposList[i].Path
+	}
+	return errs
+}
+
+// installRCFile() fails when the destination does not have magic comment
+// unless it is backed up
+func (builder *BaseBuilder) preflightRCFiles(profileName string) []error {
+	if builder.opts.NoVimrc || builder.opts.BackupRC {
+		return nil
+	}
+	var errs []error
+	vimDir := pathutil.VimDir()
+	for _, rc := range []struct{ src, dst string }{
+		{pathutil.ProfileVimrc, filepath.Join(vimDir, pathutil.Vimrc)},
+		{pathutil.ProfileGvimrc, filepath.Join(vimDir, pathutil.Gvimrc)},
+	} {
+		src := filepath.Join(pathutil.RCDir(profileName), rc.src)
+		if _, err := os.Stat(src); err != nil {
+			continue
+		}
+		if pathutil.Exists(rc.dst) && !builder.HasMagicComment(rc.dst) {
+			errs = append(errs, errors.New("'"+rc.dst+"' does not have magic comment"))
+		}
+	}
+	return errs
+}
+
+func sortErrors(errs []error) {
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].Error() < errs[j].Error()
+	})
+}
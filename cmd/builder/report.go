@@ -0,0 +1,142 @@
+package builder
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/vim-volt/volt/lockjson"
+	"github.com/vim-volt/volt/pathutil"
+)
+
+// Report is the summary of a build which is written by 'volt build -report'
+// (or shown by 'volt build -format json').
+// Unlike build-info.json which is the state of installed files,
+// it is the log of the run.
+type Report struct {
+	// The time when the build started (RFC3339 format)
+	Time     string `json:"time"`
+	Profile  string `json:"profile"`
+	Strategy string `json:"strategy"`
+	// true if it was full build
+	Full       bool          `json:"full"`
+	Success    bool          `json:"success"`
+	Error      string        `json:"error,omitempty"`
+	DurationMs int64         `json:"duration_ms"`
+	Repos      []ReportRepos `json:"repos"`
+
+	start time.Time
+}
+
+// Outcomes of a repository (ReportRepos.Status)
+const (
+	ReportInstalled = "installed"
+	// The repository was up to date, or was not installed by -skip-missing
+	ReportSkipped = "skipped"
+	ReportFailed  = "failed"
+)
+
+type ReportRepos struct {
+	Type       lockjson.ReposType `json:"type"`
+	Path       pathutil.ReposPath `json:"path"`
+	Version    string             `json:"version,omitempty"`
+	Status     string             `json:"status"`
+	Error      string             `json:"error,omitempty"`
+	DurationMs int64              `json:"duration_ms"`
+	// The total size of installed files (bytes)
+	Size int64 `json:"size"`
+}
+
+// NewReport returns the report of the build which starts now
+func NewReport(profileName, strategy string) *Report {
+	start := time.Now()
+	return &Report{
+		Time:     start.Format(time.RFC3339),
+		Profile:  profileName,
+		Strategy: strategy,
+		Repos:    make([]ReportRepos, 0, 32),
+		start:    start,
+	}
+}
+
+// Finish records err as the result of the build.
+// The repositories of reposList which were neither installed nor failed
+// are recorded as skipped.
+func (report *Report) Finish(reposList lockjson.ReposList, err error) {
+	reported := make(map[pathutil.ReposPath]bool, len(report.Repos))
+	for i := range report.Repos {
+		reported[report.Repos[i].Path] = true
+	}
+	for i := range reposList {
+		if !reported[reposList[i].Path] {
+			report.Repos = append(report.Repos, ReportRepos{
+				Type:    reposList[i].Type,
+				Path:    reposList[i].Path,
+				Version: reposList[i].Version,
+				Status:  ReportSkipped,
+			})
+		}
+	}
+	report.Success = err == nil
+	if err != nil {
+		report.Error = err.Error()
+	}
+	report.DurationMs = durationMs(time.Since(report.start))
+}
+
+// Bytes returns the report as indented JSON
+func (report *Report) Bytes() ([]byte, error) {
+	return json.MarshalIndent(report, "", "  ")
+}
+
+// Write writes the report to path as JSON
+func (report *Report) Write(path string) error {
+	b, err := report.Bytes()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
+
+// Record the result of a repository to Options.Report
+func (builder *BaseBuilder) reportRepos(result *actionReposResult) {
+	if builder.opts.Report == nil || result.repos == nil {
+		return
+	}
+	r := ReportRepos{
+		Type:       result.repos.Type,
+		Path:       result.repos.Path,
+		Version:    result.repos.Version,
+		Status:     ReportInstalled,
+		DurationMs: durationMs(result.duration),
+		Size:       result.size,
+	}
+	if result.err != nil {
+		r.Status = ReportFailed
+		r.Error = result.err.Error()
+	}
+	builder.opts.Report.Repos = append(builder.opts.Report.Repos, r)
+}
+
+// Returns the total size of the files installed for repos.
+// The linked directory is followed if symlink strategy installed it.
+func installedSize(repos *lockjson.Repos) int64 {
+	dir, err := filepath.EvalSymlinks(repos.EncodedPath())
+	if err != nil {
+		return 0
+	}
+	var size int64
+	filepath.Walk(dir, func(_ string, fi os.FileInfo, err error) error {
+		if err == nil && fi.Mode().IsRegular() {
+			size += fi.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+func durationMs(d time.Duration) int64 {
+	return int64(d / time.Millisecond)
+}
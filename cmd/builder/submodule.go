@@ -0,0 +1,119 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+
+	"gopkg.in/src-d/go-billy.v3/memfs"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/gitignore"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+
+	"github.com/vim-volt/volt/lockjson"
+	"github.com/vim-volt/volt/logger"
+)
+
+// Call fn with each file of the submodules in tree (the source tree of
+// commitObj), like walkGitTree() does for the files of the repository.
+// The files are read from the commit which tree records (gitlink) in the
+// object store of the submodule ($GIT_DIR/modules/{name}), and their names
+// are prefixed with the path of the submodule. Nested submodules are walked
+// recursively. The submodules which are not initialized are skipped with
+// warnings.
+func (builder *BaseBuilder) walkSubmodules(ctx context.Context, r *git.Repository, commitObj *object.Commit, tree *object.Tree, repos *lockjson.Repos, ignore gitignore.Matcher, fn func(file *object.File) error) error {
+	var modules *config.Modules
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+	for {
+		name, entry, err := walker.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.New("failed to walk tree " + commitObj.TreeHash.String() + ": " + err.Error())
+		}
+		if entry.Mode != filemode.Submodule || isVoltignored(ignore, name) {
+			continue
+		}
+		if modules == nil {
+			modules, err = readGitmodules(r, commitObj)
+			if err != nil {
+				return err
+			}
+		}
+
+		// The paths in .gitmodules are relative to the repository root
+		module, exists := modules.Submodules[path.Join(repos.Subdir, name)]
+		if !exists {
+			logger.Warnf("%s: submodule %s is not installed because it is not in .gitmodules", repos.Path, name)
+			continue
+		}
+		sub, subCommit, err := openSubmodule(r, module.Name, entry)
+		if err != nil {
+			logger.Warnf("%s: submodule '%s' (%s) is not installed because it is not initialized: %s", repos.Path, module.Name, name, err.Error())
+			logger.Warn("  Please run 'git submodule update --init --recursive' in the repository.")
+			continue
+		}
+
+		subRepos := &lockjson.Repos{Type: lockjson.ReposGitType, Path: repos.Path, Version: subCommit.Hash.String()}
+		err = builder.walkGitTree(ctx, sub, subCommit, subRepos, func(file *object.File) error {
+			subFile := *file
+			subFile.Name = path.Join(name, file.Name)
+			if isVoltignored(ignore, subFile.Name) {
+				return nil
+			}
+			return fn(&subFile)
+		})
+		if err != nil {
+			return errors.New("submodule '" + module.Name + "': " + err.Error())
+		}
+	}
+}
+
+// Returns .gitmodules of the root tree of commitObj
+func readGitmodules(r *git.Repository, commitObj *object.Commit) (*config.Modules, error) {
+	modules := config.NewModules()
+	tree, err := r.TreeObject(commitObj.TreeHash)
+	if err != nil {
+		return nil, errors.New("failed to get tree " + commitObj.Hash.String() + ": " + err.Error())
+	}
+	file, err := tree.File(".gitmodules")
+	if err == object.ErrFileNotFound {
+		return modules, nil
+	}
+	if err != nil {
+		return nil, errors.New("failed to read .gitmodules: " + err.Error())
+	}
+	content, err := file.Contents()
+	if err != nil {
+		return nil, errors.New("failed to read .gitmodules: " + err.Error())
+	}
+	if err := modules.Unmarshal([]byte(content)); err != nil {
+		return nil, errors.New("failed to parse .gitmodules: " + err.Error())
+	}
+	return modules, nil
+}
+
+// Opens the object store of the submodule name of r, and returns the commit
+// of gitlink entry in it
+func openSubmodule(r *git.Repository, name string, entry object.TreeEntry) (*git.Repository, *object.Commit, error) {
+	s, err := r.Storer.Module(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Only the objects are read. The worktree is given because the config
+	// of a submodule is not bare.
+	sub, err := git.Open(s, memfs.New())
+	if err != nil {
+		return nil, nil, err
+	}
+	commitObj, err := sub.CommitObject(entry.Hash)
+	if err != nil {
+		return nil, nil, errors.New("failed to get commit object " + entry.Hash.String() + ": " + err.Error())
+	}
+	return sub, commitObj, nil
+}
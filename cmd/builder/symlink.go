@@ -1,6 +1,7 @@
 package builder
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -8,10 +9,14 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"sync"
 
 	"gopkg.in/src-d/go-git.v4"
+	gitconfig "gopkg.in/src-d/go-git.v4/config"
 
 	"github.com/vim-volt/volt/cmd/buildinfo"
+	"github.com/vim-volt/volt/fileutil"
 	"github.com/vim-volt/volt/gitutil"
 	"github.com/vim-volt/volt/lockjson"
 	"github.com/vim-volt/volt/logger"
@@ -23,8 +28,11 @@ type symlinkBuilder struct {
 	BaseBuilder
 }
 
-// TODO: rollback when return err (!= nil)
-func (builder *symlinkBuilder) Build(buildInfo *buildinfo.BuildInfo, buildReposMap map[pathutil.ReposPath]*buildinfo.Repos) error {
+// Build installs the repositories of current profile.
+// If an error was returned, the files and symlinks created by the build are
+// removed and the replaced files are restored. build-info.json is written
+// only when the build succeeded.
+func (builder *symlinkBuilder) Build(ctx context.Context, buildInfo *buildinfo.BuildInfo, buildReposMap map[pathutil.ReposPath]*buildinfo.Repos) (err error) {
 	// Exit if vim executable was not found in PATH
 	if _, err := pathutil.VimExecutable(); err != nil {
 		return err
@@ -40,11 +48,24 @@ func (builder *symlinkBuilder) Build(buildInfo *buildinfo.BuildInfo, buildReposM
 		return err
 	}
 
-	logger.Info("Installing vimrc and gvimrc ...")
+	rollback := &symlinkRollback{}
+	defer func() {
+		if err != nil {
+			logger.Info("Rolling back the build ...")
+			if e := rollback.run(); e != nil {
+				logger.Error("Failed to roll back the build: " + e.Error())
+			}
+		}
+	}()
 
 	vimDir := pathutil.VimDir()
 	vimrcPath := filepath.Join(vimDir, pathutil.Vimrc)
 	gvimrcPath := filepath.Join(vimDir, pathutil.Gvimrc)
+	for _, path := range []string{vimrcPath, gvimrcPath, pathutil.BundledPlugConf()} {
+		if err := rollback.saveFile(path); err != nil {
+			return err
+		}
+	}
 	err = builder.installVimrcAndGvimrc(
 		lockJSON.CurrentProfileName, vimrcPath, gvimrcPath,
 	)
@@ -63,52 +84,96 @@ func (builder *symlinkBuilder) Build(buildInfo *buildinfo.BuildInfo, buildReposM
 	if err != nil {
 		return err
 	}
+	if err := builder.checkVimVersion(vimExePath); err != nil {
+		return err
+	}
+	if err := builder.checkRequirements(vimExePath, lockJSON.CurrentProfileName, reposList); err != nil {
+		return err
+	}
 
 	buildInfo.Repos = make([]buildinfo.Repos, 0, len(reposList))
 	done := make(chan actionReposResult, len(reposList))
-	for i := range reposList {
-		go builder.installRepos(&reposList[i], vimExePath, done)
+	for _, i := range builder.reposOrder(reposList) {
+		repos := &reposList[i]
+		builder.goReposAction(ctx, repos, done, func(ctx context.Context, done chan actionReposResult) {
+			builder.installRepos(ctx, repos, vimExePath, rollback, done)
+		})
 		// Make build-info.json data
 		buildInfo.Repos = append(buildInfo.Repos, buildinfo.Repos{
-			Type:    reposList[i].Type,
-			Path:    reposList[i].Path,
-			Version: reposList[i].Version,
+			Type:          reposList[i].Type,
+			Path:          reposList[i].Path,
+			Version:       reposList[i].Version,
+			Placement:     reposList[i].Placement,
+			Subdir:        reposList[i].Subdir,
+			CommitSubject: commitSubject(&reposList[i]),
 		})
 	}
+	// Wait all repositories to report their results,
+	// and return the first error
+	var firstErr error
+	linked := make([]*lockjson.Repos, 0, len(reposList))
 	for i := 0; i < len(reposList); i++ {
 		result := <-done
+		builder.reportRepos(&result)
+		builder.progressRepos(&result, i+1, len(reposList))
 		if result.err != nil {
-			return err
+			if firstErr == nil {
+				firstErr = result.err
+			}
+			continue
 		}
 		if result.repos != nil {
-			logger.Debug("Installing " + string(result.repos.Type) + " repository " + result.repos.Path.String() + " ... Done.")
+			if result.copied {
+				r := buildInfo.Repos.FindByReposPath(result.repos.Path)
+				r.Copied = true
+				r.DigestV1 = result.digest
+			} else {
+				linked = append(linked, result.repos)
+			}
 		}
 	}
+	if firstErr != nil {
+		return firstErr
+	}
+
+	// Run ":helptags" to generate tags files of linked repositories.
+	// The copied repositories already have them.
+	if err := builder.helptagsAll(ctx, linked, vimExePath); err != nil {
+		return err
+	}
+	logger.Infof("Installed %d repositories", len(reposList))
 
 	// Write bundled plugconf file
-	content, merr := plugconf.GenerateBundlePlugconf(reposList)
+	content, merr := plugconf.GenerateBundlePlugconf(lockJSON.CurrentProfileName, reposList)
 	if merr.ErrorOrNil() != nil {
 		// Return vim script parse errors
 		return merr
 	}
-	os.MkdirAll(filepath.Dir(pathutil.BundledPlugConf()), 0755)
-	err = ioutil.WriteFile(pathutil.BundledPlugConf(), content, 0644)
+	err = builder.writeBundledPlugconf(content)
 	if err != nil {
 		return err
 	}
 
+	// Create symlinks and directories of "post_install"
+	if err := builder.installPostInstall(reposList); err != nil {
+		return err
+	}
+
 	// Write build-info.json
 	return buildInfo.Write()
 }
 
-func (builder *symlinkBuilder) installRepos(repos *lockjson.Repos, vimExePath string, done chan actionReposResult) {
+func (builder *symlinkBuilder) installRepos(ctx context.Context, repos *lockjson.Repos, vimExePath string, rollback *symlinkRollback, done chan actionReposResult) {
 	src := pathutil.FullReposPath(repos.Path)
-	dst := pathutil.EncodeReposPath(repos.Path)
+	dst := repos.EncodedPath()
 
-	copied := false
+	var r *git.Repository
 	if repos.Type == lockjson.ReposGitType {
 		// Open a repository to determine it is bare repository or not
-		r, err := git.PlainOpen(src)
+		err := builder.retryGit(repos, "opening repository", func() (err error) {
+			r, err = git.PlainOpen(src)
+			return err
+		})
 		if err != nil {
 			done <- actionReposResult{
 				err: fmt.Errorf("repository %q: %s", src, err.Error()),
@@ -116,60 +181,215 @@ func (builder *symlinkBuilder) installRepos(repos *lockjson.Repos, vimExePath st
 			return
 		}
 
-		// Show warning when HEAD and locked revision are different
-		head, err := gitutil.GetHEADRepository(r)
+		var cfg *gitconfig.Config
+		err = builder.retryGit(repos, "reading repository config", func() (err error) {
+			cfg, err = r.Config()
+			return err
+		})
 		if err != nil {
 			done <- actionReposResult{
-				err: fmt.Errorf("failed to get HEAD revision of %q: %s", src, err.Error()),
+				err: fmt.Errorf("failed to get repository config of %q: %s", src, err.Error()),
 			}
 			return
 		}
-		if head != repos.Version {
-			logger.Warnf("%s: HEAD and locked revision are different", repos.Path)
-			logger.Warn("  HEAD: " + head)
-			logger.Warn("  locked revision: " + repos.Version)
-			logger.Warn("  Please run 'volt get -l' to update locked revision.")
-		}
 
-		cfg, err := r.Config()
-		if err != nil {
-			done <- actionReposResult{
-				err: fmt.Errorf("failed to get repository config of %q: %s", src, err.Error()),
+		// Show warning when HEAD and locked revision are different.
+		// HEAD of bare repository is not installed, so it is not checked.
+		if !cfg.Core.IsBare {
+			head, err := gitutil.GetHEADRepository(r)
+			if err != nil {
+				done <- actionReposResult{
+					err: fmt.Errorf("failed to get HEAD revision of %q: %s", src, err.Error()),
+				}
+				return
+			}
+			if head != repos.Version {
+				logger.Warnf("%s: HEAD and locked revision are different", repos.Path)
+				logger.Warn("  HEAD: " + head)
+				logger.Warn("  locked revision: " + repos.Version)
+				logger.Warn("  Please run 'volt get -l' to update locked revision.")
 			}
-			return
 		}
+
 		if cfg.Core.IsBare {
+			// Bare repository has no files to link to.
 			// * Copy files from git objects under vim dir
 			// * Run ":helptags" to generate tags file
-			updateDone := make(chan actionReposResult)
-			(&copyBuilder{}).updateBareGitRepos(r, src, dst, repos, vimExePath, updateDone)
-			result := <-updateDone
-			if result.err != nil {
-				done <- actionReposResult{err: result.err}
+			if !pathutil.Exists(dst) {
+				rollback.addDir(dst)
+			}
+			files, sizes, err := builder.installGitTree(ctx, r, dst, repos, vimExePath)
+			if err != nil {
+				done <- actionReposResult{err: err}
 				return
 			}
-			copied = true
+			done <- actionReposResult{repos: repos, copied: true, files: files, sizes: sizes}
+			return
 		}
 	}
 
-	if !copied {
-		// Make symlinks under vim dir
-		if err := builder.symlink(src, dst); err != nil {
-			done <- actionReposResult{err: err}
-			return
+	// Do not make a dangling symlink
+	if repos.Subdir != "" && !pathutil.Exists(repos.SourceDir()) {
+		done <- actionReposResult{
+			err: fmt.Errorf("subdir %q of %q does not exist", repos.Subdir, src),
 		}
-		// Run ":helptags" to generate tags file
-		if err := builder.helptags(repos.Path, vimExePath); err != nil {
+		return
+	}
+	// Make symlinks under vim dir
+	os.MkdirAll(filepath.Dir(dst), 0755)
+	err := makeSymlink(repos.SourceDir(), dst)
+	if jerr, ok := err.(*junctionError); ok {
+		// Creating a junction needs the privilege which may not be given
+		// (e.g. on locked-down machines). Install a copy instead not to
+		// fail the build.
+		logger.Warnf("%s: %s", repos.Path, jerr.Error())
+		logger.Warn("  Copying the repository instead of linking to it.")
+		logger.Warn("  Please run 'volt build' again after the repository was changed.")
+		if err := builder.copyRepos(ctx, r, repos, vimExePath, rollback); err != nil {
 			done <- actionReposResult{err: err}
 			return
 		}
+		done <- actionReposResult{repos: repos, copied: true}
+		return
+	}
+	if err != nil {
+		done <- actionReposResult{err: err}
+		return
 	}
+	rollback.addSymlink(dst)
+	// ":helptags" is run by Build() for all linked repositories at once
 	done <- actionReposResult{repos: repos}
 }
 
-func (*symlinkBuilder) symlink(src, dst string) error {
+// Copies the files of repos to the installed directory when a symlink to it
+// could not be created. The files of git repository are extracted from the
+// locked revision (r must not be nil), and the files of static repository are
+// copied from the directory.
+func (builder *symlinkBuilder) copyRepos(ctx context.Context, r *git.Repository, repos *lockjson.Repos, vimExePath string, rollback *symlinkRollback) error {
+	dst := repos.EncodedPath()
+	if !pathutil.Exists(dst) {
+		rollback.addDir(dst)
+	}
+	if repos.Type == lockjson.ReposGitType {
+		_, _, err := builder.installGitTree(ctx, r, dst, repos, vimExePath)
+		return err
+	}
+	err := fileutil.CopyDir(ctx, repos.SourceDir(), dst, 0755, staticModeInvalidType, runtime.NumCPU())
+	if err != nil {
+		return errors.New("failed to copy " + repos.SourceDir() + ": " + err.Error())
+	}
+	// Run ":helptags" to generate tags file
+	return builder.helptags(ctx, repos, vimExePath)
+}
+
+// junctionError is returned by makeSymlink() when "mklink /J" failed
+type junctionError struct {
+	src, dst string
+	output   string
+	err      error
+}
+
+func (e *junctionError) Error() string {
+	msg := "could not create a junction " + e.dst + " to " + e.src + ": " + e.err.Error()
+	if e.output != "" {
+		msg += ": " + e.output
+	}
+	return msg
+}
+
+// Creates a symlink dst to src. On Windows, a junction is created instead
+// because creating a symlink needs the administrator privilege.
+// It is a variable to replace in tests.
+var makeSymlink = func(src, dst string) error {
 	if runtime.GOOS == "windows" {
-		return exec.Command("cmd", "/c", "mklink", "/J", dst, src).Run()
+		out, err := exec.Command("cmd", "/c", "mklink", "/J", dst, src).CombinedOutput()
+		if err != nil {
+			return &junctionError{src: src, dst: dst, output: strings.TrimSpace(string(out)), err: err}
+		}
+		return nil
 	}
 	return os.Symlink(src, dst)
 }
+
+// symlinkRollback records what a build changed to undo it when the build
+// failed
+type symlinkRollback struct {
+	mu       sync.Mutex
+	symlinks []string
+	dirs     []string
+	files    []savedFile
+}
+
+// The content of a file before the build. If exists is false, the file is
+// removed on rollback.
+type savedFile struct {
+	path    string
+	exists  bool
+	content []byte
+	mode    os.FileMode
+}
+
+// Saves the current content of path to restore it on rollback
+func (r *symlinkRollback) saveFile(path string) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		r.files = append(r.files, savedFile{path: path})
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.New("could not save " + path + ": " + err.Error())
+	}
+	r.files = append(r.files, savedFile{path: path, exists: true, content: content, mode: info.Mode()})
+	return nil
+}
+
+func (r *symlinkRollback) addSymlink(path string) {
+	r.mu.Lock()
+	r.symlinks = append(r.symlinks, path)
+	r.mu.Unlock()
+}
+
+func (r *symlinkRollback) addDir(path string) {
+	r.mu.Lock()
+	r.dirs = append(r.dirs, path)
+	r.mu.Unlock()
+}
+
+// Removes the created symlinks and directories, and restores the saved
+// files. Continues on errors and returns the first one.
+func (r *symlinkRollback) run() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var firstErr error
+	// Do not use os.RemoveAll() for symlinks not to remove the files of the
+	// junctions on Windows
+	for _, path := range r.symlinks {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) && firstErr == nil {
+			firstErr = err
+		}
+		logger.Debug("Removed symlink " + path)
+	}
+	for _, path := range r.dirs {
+		if err := os.RemoveAll(path); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		logger.Debug("Removed " + path)
+	}
+	for _, f := range r.files {
+		var err error
+		if f.exists {
+			err = ioutil.WriteFile(f.path, f.content, f.mode)
+		} else if err = os.Remove(f.path); os.IsNotExist(err) {
+			err = nil
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
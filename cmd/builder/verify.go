@@ -0,0 +1,250 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+
+	"github.com/vim-volt/volt/cmd/buildinfo"
+	"github.com/vim-volt/volt/config"
+	"github.com/vim-volt/volt/lockjson"
+	"github.com/vim-volt/volt/pathutil"
+)
+
+// The kinds of Difference
+const (
+	// The file is not installed
+	DiffMissing = "missing"
+	// The content of the installed file differs from the source
+	DiffModified = "modified"
+	// The installed file does not exist in the source
+	DiffExtra = "extra"
+)
+
+// Difference is an installed file (or directory) which differs from what
+// 'volt build' installs
+type Difference struct {
+	Kind      string
+	ReposPath pathutil.ReposPath
+	// Path is the installed file under ~/.vim/pack/volt
+	Path string
+}
+
+// Verify compares the installed files of the repositories of current profile
+// with the files of their locked revisions (or source directories for static
+// repositories), and returns the differences sorted by path.
+// The repositories installed by symlink strategy are verified to link to
+// their source directories. doc/tags files are not compared because
+// ":helptags" generates them. opts may be nil.
+func Verify(ctx context.Context, opts *Options) ([]Difference, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	builder := &copyBuilder{BaseBuilder{opts: *opts}}
+	return builder.verify(ctx)
+}
+
+func (builder *copyBuilder) verify(ctx context.Context) ([]Difference, error) {
+	lockJSON, err := lockjson.Read()
+	if err != nil {
+		return nil, errors.New("could not read lock.json: " + err.Error())
+	}
+	reposList, err := builder.getCurrentReposList(lockJSON)
+	if err != nil {
+		return nil, err
+	}
+	buildInfo, err := buildinfo.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []Difference
+	for i := range reposList {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		repos := &reposList[i]
+		d, err := builder.verifyRepos(ctx, repos, buildInfo.Repos.FindByReposPath(repos.Path), buildInfo.Strategy)
+		if err != nil {
+			return nil, errors.New(repos.Path.String() + ": " + err.Error())
+		}
+		diffs = append(diffs, d...)
+	}
+	sort.Slice(diffs, func(i, j int) bool {
+		return diffs[i].Path < diffs[j].Path
+	})
+	return diffs, nil
+}
+
+func (builder *copyBuilder) verifyRepos(ctx context.Context, repos *lockjson.Repos, buildRepos *buildinfo.Repos, strategy string) ([]Difference, error) {
+	dst := repos.EncodedPath()
+	fi, err := os.Lstat(dst)
+	if os.IsNotExist(err) {
+		return []Difference{{Kind: DiffMissing, ReposPath: repos.Path, Path: dst}}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Symlink strategy links to the source directory except for bare
+	// repositories, whose files are copied like copy strategy
+	if strategy == config.SymlinkBuilder && fi.Mode()&os.ModeSymlink != 0 {
+		if link, err := os.Readlink(dst); err != nil || link != repos.SourceDir() {
+			return []Difference{{Kind: DiffModified, ReposPath: repos.Path, Path: dst}}, nil
+		}
+		return nil, nil
+	}
+
+	var expected map[string]string
+	if repos.Type == lockjson.ReposGitType && (buildRepos == nil || !buildRepos.DirtyWorktree) {
+		expected, err = builder.gitTreeHashes(ctx, repos)
+	} else {
+		// Copy strategy copies files from the worktree if it was dirty
+		expected, err = builder.dirHashes(repos.SourceDir(), repos)
+	}
+	if err != nil {
+		return nil, err
+	}
+	installed, err := builder.dirHashes(dst, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var diffs []Difference
+	for name, hash := range expected {
+		file := filepath.Join(dst, filepath.FromSlash(name))
+		if h, exists := installed[name]; !exists {
+			diffs = append(diffs, Difference{Kind: DiffMissing, ReposPath: repos.Path, Path: file})
+		} else if h != hash {
+			diffs = append(diffs, Difference{Kind: DiffModified, ReposPath: repos.Path, Path: file})
+		}
+	}
+	for name := range installed {
+		if _, exists := expected[name]; !exists {
+			file := filepath.Join(dst, filepath.FromSlash(name))
+			diffs = append(diffs, Difference{Kind: DiffExtra, ReposPath: repos.Path, Path: file})
+		}
+	}
+	return diffs, nil
+}
+
+// Returns the blob hashes of the files of the locked revision which copy
+// strategy installs.
+// key: slash-separated path relative to the installed directory
+func (builder *copyBuilder) gitTreeHashes(ctx context.Context, repos *lockjson.Repos) (map[string]string, error) {
+	r, err := git.PlainOpen(pathutil.FullReposPath(repos.Path))
+	if err != nil {
+		return nil, errors.New("failed to open repository: " + err.Error())
+	}
+	commitObj, err := builder.lockedCommit(r, repos)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make(map[string]string, 512)
+	err = builder.walkGitTree(ctx, r, commitObj, repos, func(file *object.File) error {
+		if !isHelptagsFile(file.Name) {
+			hashes[file.Name] = file.Hash.String()
+		}
+		return nil
+	})
+	return hashes, err
+}
+
+// Returns the blob hashes of the files under dir (see hashDir()).
+// If repos is not nil, dir is its source directory, and the files which
+// copy strategy does not install are excluded.
+// key: slash-separated path relative to dir
+func (builder *copyBuilder) dirHashes(dir string, repos *lockjson.Repos) (map[string]string, error) {
+	var ignore func(rel string, fi os.FileInfo) bool
+	if repos != nil {
+		matcher, err := readVoltignore(dir)
+		if err != nil {
+			return nil, errors.New("failed to read " + voltignoreName + ": " + err.Error())
+		}
+		noHidden := builder.skipsHidden(repos)
+		isGit := repos.Type == lockjson.ReposGitType
+		ignore = func(rel string, fi os.FileInfo) bool {
+			if isGit && (rel == ".git" || rel == ".gitignore") {
+				return true
+			}
+			return (noHidden && isHiddenName(fi.Name())) || (!fi.IsDir() && isVoltignored(matcher, rel))
+		}
+	}
+	return hashDir(dir, ignore)
+}
+
+// Returns the blob hashes of the files under dir except doc/tags.
+// The files and directories for which ignore returns true are skipped
+// (ignore may be nil).
+// key: slash-separated path relative to dir
+func hashDir(dir string, ignore func(rel string, fi os.FileInfo) bool) (map[string]string, error) {
+	hashes := make(map[string]string, 512)
+	err := filepath.Walk(dir, func(file string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if file == dir {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if ignore != nil && ignore(rel, fi) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if fi.IsDir() || fi.Mode()&BuildModeInvalidType != 0 || isHelptagsFile(rel) {
+			return nil
+		}
+		hash, err := hashFile(file, -1)
+		if err != nil {
+			return err
+		}
+		hashes[rel] = hash
+		return nil
+	})
+	return hashes, err
+}
+
+// Returns the blob hash of the file. The contents are streamed to the
+// hasher like verifyGitFile(), so large files do not consume memory as much
+// as their size. If size is not negative, fails without reading the
+// contents when the file has a different size.
+func hashFile(filename string, size int64) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if size >= 0 && info.Size() != size {
+		return "", fmt.Errorf("has %d bytes but %d bytes are expected", info.Size(), size)
+	}
+	h := plumbing.NewHasher(plumbing.BlobObject, info.Size())
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return h.Sum().String(), nil
+}
+
+// Returns true if rel is doc/tags or doc/tags-{lang} which ":helptags"
+// generates
+func isHelptagsFile(rel string) bool {
+	return path.Dir(rel) == "doc" && (path.Base(rel) == "tags" || strings.HasPrefix(path.Base(rel), "tags-"))
+}
@@ -0,0 +1,135 @@
+package builder
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/format/gitignore"
+
+	"github.com/vim-volt/volt/fileutil"
+)
+
+// .voltignore at the root of a repository has gitignore-style patterns.
+// The matched files are not installed by copy strategy.
+const voltignoreName = ".voltignore"
+
+// Parse .voltignore content.
+// Patterns are relative to the root of the repository.
+func parseVoltignore(content string) gitignore.Matcher {
+	var patterns []gitignore.Pattern
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, gitignore.ParsePattern(line, nil))
+	}
+	return gitignore.NewMatcher(patterns)
+}
+
+// Read {dir}/.voltignore.
+// Returns nil matcher if .voltignore does not exist.
+func readVoltignore(dir string) (gitignore.Matcher, error) {
+	content, err := ioutil.ReadFile(filepath.Join(dir, voltignoreName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return parseVoltignore(string(content)), nil
+}
+
+// Returns true if relPath (relative to the root of the repository)
+// must not be installed.
+func isVoltignored(ignore gitignore.Matcher, relPath string) bool {
+	if ignore == nil {
+		return false
+	}
+	if relPath == voltignoreName {
+		return true
+	}
+	return ignore.Match(strings.Split(filepath.ToSlash(relPath), "/"), false)
+}
+
+// Returns true if name is a hidden file or directory name (e.g. ".github")
+func isHiddenName(name string) bool {
+	return strings.HasPrefix(name, ".")
+}
+
+// dirFilter decides which files under the source directory of a repository
+// are installed by copy strategy
+type dirFilter struct {
+	// The files matched by .voltignore are skipped
+	ignore gitignore.Matcher
+	// If true, hidden files and directories are skipped
+	noHidden bool
+	// If true, ".git" and ".gitignore" of the root directory are skipped
+	skipGit bool
+	// If not nil, the files for which it returns true are skipped.
+	// It receives the path relative to the root and the file size.
+	tooLarge func(string, int64) bool
+	// The files whose type is in ignoreType are skipped
+	ignoreType os.FileMode
+}
+
+// Call fn with each file under src which is not skipped by filter.
+// root is the root directory of the repository.
+// It stops walking when ctx is cancelled.
+func walkDirIgnored(ctx context.Context, root, src string, filter *dirFilter, fn func(path string, fi os.FileInfo) error) error {
+	return filepath.Walk(src, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if (filter.noHidden && path != src && isHiddenName(fi.Name())) ||
+			(filter.skipGit && filepath.Dir(path) == filepath.Clean(root) && (fi.Name() == ".git" || fi.Name() == ".gitignore")) {
+			if fi.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if fi.IsDir() || fi.Mode()&filter.ignoreType != 0 {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if isVoltignored(filter.ignore, rel) {
+			return nil
+		}
+		if filter.tooLarge != nil && filter.tooLarge(rel, fi.Size()) {
+			return nil
+		}
+		return fn(path, fi)
+	})
+}
+
+// Copy (or hard-link) files under src to dst like fileutil.TryLinkDir(),
+// but skip the files which filter skips (see walkDirIgnored()).
+// The bits of mask are cleared from the modes of installed files.
+// Symbolic links are recreated as symbolic links unless filter skips them.
+// root is the root directory of the repository.
+// The directories which have no files to install are not created.
+// It stops copying when ctx is cancelled.
+func tryLinkDirIgnored(ctx context.Context, root, src, dst string, buf []byte, filter *dirFilter, mask os.FileMode) error {
+	return walkDirIgnored(ctx, root, src, filter, func(path string, fi os.FileInfo) error {
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		to := filepath.Join(dst, rel)
+		if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return fileutil.CopySymlink(path, to)
+		}
+		return tryLinkFileMasked(path, to, buf, fi.Mode(), mask)
+	})
+}
@@ -1,9 +1,15 @@
 package buildinfo
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"io"
 	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
 
 	"github.com/vim-volt/volt/lockjson"
 	"github.com/vim-volt/volt/pathutil"
@@ -13,6 +19,12 @@ type BuildInfo struct {
 	Repos    ReposList `json:"repos"`
 	Version  int64     `json:"version"`
 	Strategy string    `json:"strategy"`
+	// The profile which was current when it was built
+	// (empty if it was built by older volt)
+	Profile string `json:"profile,omitempty"`
+	// The vim which generated doc/tags files (e.g. "vim 8.2.1234").
+	// Empty if it was built by older volt or the version was not detected
+	VimVersion string `json:"vim_version,omitempty"`
 }
 
 type ReposList []Repos
@@ -23,11 +35,45 @@ type Repos struct {
 	Version       string             `json:"version"`
 	Files         FileMap            `json:"files,omitempty"`
 	DirtyWorktree bool               `json:"dirty_worktree,omitempty"`
+	// "start" or "opt" ("opt" if empty)
+	Placement lockjson.ReposPlacement `json:"placement,omitempty"`
+	// The installed subdirectory of the repository (see lockjson.Repos)
+	Subdir string `json:"subdir,omitempty"`
+	// The first line of the commit message of Version (git repository only)
+	CommitSubject string `json:"commit_subject,omitempty"`
+	// True if the installed directory is a copy of the repository instead of
+	// a symlink (e.g. bare repository, or the junction could not be created
+	// on Windows). Used by symlink strategy only
+	Copied bool `json:"copied,omitempty"`
+	// The digest of the installed files (see FileMap.DigestV1()) to detect
+	// the files modified after the build. Empty if the installed directory
+	// is a symlink, or if it was built by older volt
+	DigestV1 string `json:"digest_v1,omitempty"`
+	// The sizes of the blobs of Files to detect truncated files before
+	// reading them. Empty if it was built by older volt
+	FileSizes map[string]int64 `json:"file_sizes,omitempty"`
 }
 
 // key: filepath, value: version
 type FileMap map[string]string
 
+// DigestV1 returns the hex-encoded SHA-256 of the lines
+// "{filepath}\x00{version}\n" sorted by filepath. The versions are the blob
+// hashes of the files, so the digest can be computed from either git
+// objects or installed files.
+func (files FileMap) DigestV1() string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	h := sha256.New()
+	for _, name := range names {
+		io.WriteString(h, name+"\x00"+files[name]+"\n")
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
 func Read() (*BuildInfo, error) {
 	// Return initial build-info.json struct
 	// if the file does not exist
@@ -57,18 +103,101 @@ func Read() (*BuildInfo, error) {
 }
 
 func (buildInfo *BuildInfo) Write() error {
+	bytes, err := buildInfo.Bytes()
+	if err != nil {
+		return err
+	}
+	// Write to build-info.json.
+	// Rename the written file not to leave broken build-info.json on failure
+	path := pathutil.BuildInfoJSON()
+	tmp := path + ".tmp"
+	err = writeFile(tmp, bytes, 0644)
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// writeFile is replaced in tests to fail in the middle of writing
+var writeFile = ioutil.WriteFile
+
+// Bytes returns the same content as Write() writes to build-info.json
+func (buildInfo *BuildInfo) Bytes() ([]byte, error) {
 	// Validate build-info.json
 	err := buildInfo.validate()
 	if err != nil {
-		return errors.New("validation failed: build-info.json: " + err.Error())
+		return nil, errors.New("validation failed: build-info.json: " + err.Error())
 	}
+	return json.MarshalIndent(buildInfo, "", "  ")
+}
 
-	// Write to build-info.json
-	bytes, err := json.MarshalIndent(buildInfo, "", "  ")
+// AppendCheckpoint appends repos to the checkpoint file, which records the
+// repositories installed by the current build so that the build can be
+// resumed after it was interrupted.
+// The checkpoint file has one JSON of Repos per line.
+func AppendCheckpoint(repos *Repos) error {
+	bytes, err := json.Marshal(repos)
 	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile(pathutil.BuildInfoJSON(), bytes, 0644)
+	f, err := os.OpenFile(pathutil.BuildCheckpointJSON(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.New("failed to open build checkpoint: " + err.Error())
+	}
+	_, err = f.Write(append(bytes, '\n'))
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return errors.New("failed to write build checkpoint: " + err.Error())
+	}
+	return nil
+}
+
+// ReadCheckpoint returns the repositories recorded by AppendCheckpoint().
+// If the same repository was recorded more than once, the last one is used.
+// Returns empty list if the checkpoint file does not exist.
+func ReadCheckpoint() (ReposList, error) {
+	content, err := ioutil.ReadFile(pathutil.BuildCheckpointJSON())
+	if os.IsNotExist(err) {
+		return ReposList{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	reposList := make(ReposList, 0, 32)
+	for _, line := range strings.Split(string(content), "\n") {
+		var repos Repos
+		// The last line is broken if volt was killed while writing it
+		if line == "" || json.Unmarshal([]byte(line), &repos) != nil {
+			continue
+		}
+		if r := reposList.FindByReposPath(repos.Path); r != nil {
+			*r = repos
+		} else {
+			reposList = append(reposList, repos)
+		}
+	}
+	return reposList, nil
+}
+
+// RemoveCheckpoint removes the checkpoint file if it exists
+func RemoveCheckpoint() error {
+	err := os.Remove(pathutil.BuildCheckpointJSON())
+	if err != nil && !os.IsNotExist(err) {
+		return errors.New("failed to remove build checkpoint: " + err.Error())
+	}
+	return nil
+}
+
+func (buildInfo *BuildInfo) String() string {
+	bytes, err := buildInfo.Bytes()
+	if err != nil {
+		return "(invalid build-info.json: " + err.Error() + ")"
+	}
+	return string(bytes)
 }
 
 func (buildInfo *BuildInfo) validate() error {
@@ -103,3 +232,40 @@ func (reposList *ReposList) RemoveByReposPath(reposPath pathutil.ReposPath) {
 		}
 	}
 }
+
+// Returns repositories which must be (re)installed or removed
+// to synchronize with reposList (current profile's repos list).
+// Only type, version (of git repository), placement and subdir are compared.
+func (buildInfo *BuildInfo) ChangedReposPathList(reposList lockjson.ReposList) []pathutil.ReposPath {
+	changed := make([]pathutil.ReposPath, 0, len(reposList))
+	for i := range reposList {
+		repos := &reposList[i]
+		r := buildInfo.Repos.FindByReposPath(repos.Path)
+		switch {
+		case r == nil,
+			r.Type != repos.Type,
+			r.Type == lockjson.ReposGitType && r.Version != repos.Version,
+			r.placement() != repos.Placement,
+			r.Subdir != repos.Subdir:
+			changed = append(changed, repos.Path)
+		}
+	}
+	for i := range buildInfo.Repos {
+		if !reposList.Contains(buildInfo.Repos[i].Path) {
+			changed = append(changed, buildInfo.Repos[i].Path)
+		}
+	}
+	return changed
+}
+
+// Returns true if ChangedReposPathList() is not empty
+func (buildInfo *BuildInfo) Changed(reposList lockjson.ReposList) bool {
+	return len(buildInfo.ChangedReposPathList(reposList)) > 0
+}
+
+func (repos *Repos) placement() lockjson.ReposPlacement {
+	if repos.Placement == "" {
+		return lockjson.ReposOptPlacement
+	}
+	return repos.Placement
+}
@@ -0,0 +1,167 @@
+package buildinfo
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/vim-volt/volt/lockjson"
+	"github.com/vim-volt/volt/pathutil"
+)
+
+func TestBytes(t *testing.T) {
+	buildInfo := &BuildInfo{
+		Repos: ReposList{
+			{
+				Type:    lockjson.ReposGitType,
+				Path:    "github.com/tyru/caw.vim",
+				Version: "41d9a5b4e2e4ef6d6ec1b14c7bbe7a1f0f7b1a3c",
+				Files: FileMap{
+					"plugin/caw.vim": "8f1a8ea2b08c5c4ea4e8f1e1ce4fd9d5b2b3d7a1",
+				},
+				DigestV1: "5b0e8c2fa3d6a6b1f5e0c7d4e9a8b7c6d5e4f3a2b1c0d9e8f7a6b5c4d3e2f1a0",
+			},
+			{
+				Type:          lockjson.ReposStaticType,
+				Path:          "localhost/local/hello",
+				Version:       "2018-03-17T00:00:00+09:00",
+				DirtyWorktree: true,
+			},
+		},
+		Version:  2,
+		Strategy: "copy",
+	}
+
+	b, err := buildInfo.Bytes()
+	if err != nil {
+		t.Fatal("Bytes() returned non-nil error: " + err.Error())
+	}
+	var got BuildInfo
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal("failed to parse Bytes() output: " + err.Error())
+	}
+	if !reflect.DeepEqual(&got, buildInfo) {
+		t.Errorf("expected %+v but got %+v", buildInfo, &got)
+	}
+	if buildInfo.String() != string(b) {
+		t.Errorf("String() and Bytes() returned different content: %q, %q", buildInfo.String(), string(b))
+	}
+}
+
+func TestReadWithoutDigest(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "volt-test-")
+	if err != nil {
+		t.Fatal("failed to create temp dir: " + err.Error())
+	}
+	defer os.RemoveAll(tmpdir)
+	defer os.Setenv("VOLT_HOME", os.Getenv("VOLT_HOME"))
+	os.Setenv("VOLT_HOME", tmpdir)
+	os.MkdirAll(pathutil.VimVoltDir(), 0755)
+
+	// build-info.json written by older volt
+	content := `{"repos": [{"type": "static", "path": "localhost/local/hello", "version": "2018-03-17T00:00:00+09:00"}], "version": 2, "strategy": "copy"}`
+	if err := ioutil.WriteFile(pathutil.BuildInfoJSON(), []byte(content), 0644); err != nil {
+		t.Fatal("failed to write build-info.json: " + err.Error())
+	}
+	buildInfo, err := Read()
+	if err != nil {
+		t.Fatal("Read() returned non-nil error: " + err.Error())
+	}
+	if len(buildInfo.Repos) != 1 || buildInfo.Repos[0].DigestV1 != "" {
+		t.Errorf("unexpected repos: %+v", buildInfo.Repos)
+	}
+}
+
+func TestFileMapDigestV1(t *testing.T) {
+	files := FileMap{
+		"plugin/caw.vim":   "8f1a8ea2b08c5c4ea4e8f1e1ce4fd9d5b2b3d7a1",
+		"autoload/caw.vim": "41d9a5b4e2e4ef6d6ec1b14c7bbe7a1f0f7b1a3c",
+	}
+	digest := files.DigestV1()
+	if len(digest) != 64 {
+		t.Errorf("expected hex-encoded SHA-256 but got %q", digest)
+	}
+	// The order of insertion does not matter
+	same := FileMap{}
+	same["autoload/caw.vim"] = files["autoload/caw.vim"]
+	same["plugin/caw.vim"] = files["plugin/caw.vim"]
+	if same.DigestV1() != digest {
+		t.Errorf("expected %q but got %q", digest, same.DigestV1())
+	}
+	for _, other := range []FileMap{
+		{"plugin/caw.vim": "8f1a8ea2b08c5c4ea4e8f1e1ce4fd9d5b2b3d7a1"},
+		{
+			"plugin/caw.vim":   "8f1a8ea2b08c5c4ea4e8f1e1ce4fd9d5b2b3d7a1",
+			"autoload/caw.vim": "0000000000000000000000000000000000000000",
+		},
+		{
+			"plugin/caw.vim":    "8f1a8ea2b08c5c4ea4e8f1e1ce4fd9d5b2b3d7a1",
+			"autoload/caw2.vim": "41d9a5b4e2e4ef6d6ec1b14c7bbe7a1f0f7b1a3c",
+		},
+	} {
+		if other.DigestV1() == digest {
+			t.Errorf("%v: expected different digest from %v", other, files)
+		}
+	}
+}
+
+func TestBytesDuplicateRepos(t *testing.T) {
+	buildInfo := &BuildInfo{
+		Repos: ReposList{
+			{Type: lockjson.ReposStaticType, Path: "localhost/local/hello"},
+			{Type: lockjson.ReposStaticType, Path: "localhost/local/hello"},
+		},
+	}
+	if _, err := buildInfo.Bytes(); err == nil {
+		t.Error("expected validation error but got nil")
+	}
+}
+
+func TestWriteFailure(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "volt-test-")
+	if err != nil {
+		t.Fatal("failed to create temp dir: " + err.Error())
+	}
+	defer os.RemoveAll(tmpdir)
+	defer os.Setenv("VOLT_HOME", os.Getenv("VOLT_HOME"))
+	os.Setenv("VOLT_HOME", tmpdir)
+	os.MkdirAll(pathutil.VimVoltDir(), 0755)
+
+	buildInfo := &BuildInfo{
+		Repos:    ReposList{{Type: lockjson.ReposStaticType, Path: "localhost/local/hello"}},
+		Version:  2,
+		Strategy: "copy",
+	}
+	if err := buildInfo.Write(); err != nil {
+		t.Fatal("Write() returned non-nil error: " + err.Error())
+	}
+	old, err := ioutil.ReadFile(pathutil.BuildInfoJSON())
+	if err != nil {
+		t.Fatal("failed to read build-info.json: " + err.Error())
+	}
+
+	// Write the half of the content and fail
+	orig := writeFile
+	defer func() { writeFile = orig }()
+	writeFile = func(filename string, data []byte, perm os.FileMode) error {
+		ioutil.WriteFile(filename, data[:len(data)/2], perm)
+		return errors.New("disk full")
+	}
+	buildInfo.Strategy = "symlink"
+	if err := buildInfo.Write(); err == nil {
+		t.Fatal("Write() returned nil error")
+	}
+	got, err := ioutil.ReadFile(pathutil.BuildInfoJSON())
+	if err != nil {
+		t.Fatal("failed to read build-info.json: " + err.Error())
+	}
+	if string(got) != string(old) {
+		t.Errorf("build-info.json was changed: %q", string(got))
+	}
+	if pathutil.Exists(pathutil.BuildInfoJSON() + ".tmp") {
+		t.Error("the temporary file was not removed")
+	}
+}
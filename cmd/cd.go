@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/vim-volt/volt/lockjson"
+	"github.com/vim-volt/volt/logger"
+	"github.com/vim-volt/volt/pathutil"
+)
+
+func init() {
+	cmdMap["cd"] = &cdCmd{}
+}
+
+type cdCmd struct {
+	helped    bool
+	source    bool
+	installed bool
+}
+
+func (cmd *cdCmd) FlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.SetOutput(os.Stdout)
+	fs.Usage = func() {
+		fmt.Print(`
+Usage
+  volt cd [-help] [-source | -installed] {repository}
+
+Quick example
+  $ cd "$(volt cd tyru/caw.vim)"             # changes directory to $VOLTPATH/repos/github.com/tyru/caw.vim
+  $ cd "$(volt cd -installed tyru/caw.vim)"  # changes directory to ~/.vim/pack/volt/opt/github.com_tyru_caw.vim
+
+Description
+  Print the absolute path of the directory of {repository}.
+  If -source option was given or no option was given, print the path under $VOLTPATH/repos.
+  If -installed option was given, print the path under ~/.vim/pack/volt/opt (or ~/.vim/pack/volt/start).
+  {repository} must be in current profile.` + "\n\n")
+		fmt.Println("Options")
+		fs.PrintDefaults()
+		fmt.Println()
+		cmd.helped = true
+	}
+	fs.BoolVar(&cmd.source, "source", false, "print the path of the repository under $VOLTPATH/repos (default)")
+	fs.BoolVar(&cmd.installed, "installed", false, "print the path of the installed directory under ~/.vim/pack/volt")
+	return fs
+}
+
+func (cmd *cdCmd) Run(args []string) int {
+	reposPath, err := cmd.parseArgs(args)
+	if err == ErrShowedHelp {
+		return 0
+	}
+	if err != nil {
+		logger.Error("Failed to parse args: " + err.Error())
+		return 10
+	}
+
+	dir, err := cmd.getDir(reposPath)
+	if err != nil {
+		logger.Error("Failed to get directory: " + err.Error())
+		return 11
+	}
+
+	fmt.Println(dir)
+	return 0
+}
+
+func (cmd *cdCmd) parseArgs(args []string) (pathutil.ReposPath, error) {
+	fs := cmd.FlagSet()
+	fs.Parse(args)
+	if cmd.helped {
+		return "", ErrShowedHelp
+	}
+	if cmd.source && cmd.installed {
+		return "", errors.New("-source and -installed cannot be given at the same time")
+	}
+	if len(fs.Args()) != 1 {
+		fs.Usage()
+		return "", errors.New("repository was not given")
+	}
+	return pathutil.NormalizeRepos(fs.Args()[0])
+}
+
+func (cmd *cdCmd) getDir(reposPath pathutil.ReposPath) (string, error) {
+	// Read lock.json
+	lockJSON, err := lockjson.ReadNoMigrationMsg()
+	if err != nil {
+		return "", errors.New("could not read lock.json: " + err.Error())
+	}
+	profile, err := lockJSON.Profiles.FindByName(lockJSON.CurrentProfileName)
+	if err != nil {
+		return "", err
+	}
+	reposList, err := lockJSON.GetReposListByProfile(profile)
+	if err != nil {
+		return "", err
+	}
+	repos, err := reposList.FindByPath(reposPath)
+	if err != nil {
+		return "", errors.New(reposPath.String() + " is not in current profile '" + profile.Name + "'")
+	}
+
+	if cmd.installed {
+		return repos.EncodedPath(), nil
+	}
+	return repos.ReposDir(), nil
+}
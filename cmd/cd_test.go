@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/vim-volt/volt/config"
+	"github.com/vim-volt/volt/internal/testutil"
+	"github.com/vim-volt/volt/lockjson"
+	"github.com/vim-volt/volt/pathutil"
+)
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) Prints the path under $VOLTPATH/repos
+// (b) Prints the path under ~/.vim/pack/volt/opt
+// (c) Prints the path under ~/.vim/pack/volt/start for start placement
+//
+// * Run `volt cd {repos}` (A, B, a)
+// * Run `volt cd -source {repos}` (A, B, a)
+// * Run `volt cd -installed {repos}` (A, B, b)
+// * Run `volt cd -installed {repos}` after `volt profile add -start` (A, B, c)
+func TestVoltCd(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	reposPath := pathutil.ReposPath("localhost/local/hello")
+	teardown := testutil.SetUpRepos(t, "hello", lockjson.ReposStaticType, []pathutil.ReposPath{reposPath}, config.SymlinkBuilder)
+	defer teardown()
+
+	// =============== run =============== //
+
+	for _, tt := range []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"cd", reposPath.String()}, pathutil.FullReposPath(reposPath)},
+		{[]string{"cd", "-source", reposPath.String()}, pathutil.FullReposPath(reposPath)},
+		{[]string{"cd", "-installed", reposPath.String()}, filepath.Join(pathutil.VimVoltOptDir(), "localhost_local_hello")},
+	} {
+		out, err := testutil.RunVolt(tt.args...)
+		// (A, B)
+		testutil.SuccessExit(t, out, err)
+		// (a, b)
+		if string(out) != tt.expected+"\n" {
+			t.Errorf("volt %v: expected %q but got %q", tt.args, tt.expected+"\n", string(out))
+		}
+	}
+
+	out, err := testutil.RunVolt("profile", "add", "-start", "default", reposPath.String())
+	testutil.SuccessExit(t, out, err)
+
+	out, err = testutil.RunVolt("cd", "-installed", reposPath.String())
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	// (c)
+	expected := filepath.Join(pathutil.VimVoltStartDir(), "localhost_local_hello") + "\n"
+	if string(out) != expected {
+		t.Errorf("expected %q but got %q", expected, string(out))
+	}
+}
+
+// Checks:
+// (A) Shows `[ERROR]` message
+// (B) Exit with non-zero status
+//
+// * Run `volt cd {repos}` (repository is not in current profile) (A, B)
+// * Run `volt cd` (A, B)
+// * Run `volt cd -source -installed {repos}` (A, B)
+func TestErrVoltCd(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	reposPath := pathutil.ReposPath("localhost/local/hello")
+	teardown := testutil.SetUpRepos(t, "hello", lockjson.ReposStaticType, []pathutil.ReposPath{reposPath}, config.SymlinkBuilder)
+	defer teardown()
+
+	// =============== run =============== //
+
+	for _, args := range [][]string{
+		{"cd", "github.com/tyru/caw.vim"},
+		{"cd"},
+		{"cd", "-source", "-installed", reposPath.String()},
+	} {
+		out, err := testutil.RunVolt(args...)
+		// (A, B)
+		testutil.FailExit(t, out, err)
+	}
+}
@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/vim-volt/volt/lockjson"
+	"github.com/vim-volt/volt/logger"
+	"github.com/vim-volt/volt/pathutil"
+	"github.com/vim-volt/volt/transaction"
+)
+
+func init() {
+	cmdMap["clean"] = &cleanCmd{}
+}
+
+type cleanCmd struct {
+	helped  bool
+	current bool
+	dryRun  bool
+}
+
+func (cmd *cleanCmd) setDryRun() {
+	cmd.dryRun = true
+}
+
+func (cmd *cleanCmd) FlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.SetOutput(os.Stdout)
+	fs.Usage = func() {
+		fmt.Print(`
+Usage
+  volt clean [-help] [-current] [-dry-run]
+
+Quick example
+  $ volt clean          # removes directories under ~/.vim/pack/volt/{start,opt} which no profile installs
+  $ volt clean -current # removes directories which current profile does not install
+  $ volt clean -dry-run # shows the directories to remove
+
+Description
+  Remove directories (and symlinks or files) under ~/.vim/pack/volt/start and ~/.vim/pack/volt/opt which are not the installed directory of any repository of any profile in $VOLTPATH/lock.json (e.g. left by repositories which were removed from lock.json, or stale symlinks left by symlink strategy).
+  If -current option was given, the directories which are not installed by current profile are removed instead.
+  ~/.vim/pack/volt/start/system (bundled plugconf) is never removed, and ~/.vim/vimrc and ~/.vim/gvimrc are not touched.
+
+  If -dry-run option was given (or VOLT_DRY_RUN environment variable is not empty), the directories to remove are shown as "Would remove ..." messages, and nothing is removed.` + "\n\n")
+		fmt.Println("Options")
+		fs.PrintDefaults()
+		fmt.Println()
+		cmd.helped = true
+	}
+	fs.BoolVar(&cmd.current, "current", false, "keep only the directories of current profile")
+	fs.BoolVar(&cmd.dryRun, "dry-run", cmd.dryRun, "show the directories to remove instead of removing them")
+	return fs
+}
+
+func (cmd *cleanCmd) Run(args []string) int {
+	err := cmd.parseArgs(args)
+	if err == ErrShowedHelp {
+		return 0
+	}
+	if err != nil {
+		logger.Error("Failed to parse args: " + err.Error())
+		return 10
+	}
+
+	if !cmd.dryRun {
+		// Begin transaction
+		err = transaction.Create()
+		if err != nil {
+			logger.Error("Failed to begin transaction:", err.Error())
+			return 11
+		}
+		defer transaction.Remove()
+	}
+
+	err = cmd.doClean()
+	if err != nil {
+		logger.Error("Failed to clean: " + err.Error())
+		return 12
+	}
+	return 0
+}
+
+func (cmd *cleanCmd) parseArgs(args []string) error {
+	fs := cmd.FlagSet()
+	fs.Parse(args)
+	if cmd.helped {
+		return ErrShowedHelp
+	}
+	if len(fs.Args()) > 0 {
+		fs.Usage()
+		return errors.New("too many arguments")
+	}
+	return nil
+}
+
+func (cmd *cleanCmd) doClean() error {
+	lockJSON, err := lockjson.Read()
+	if err != nil {
+		return errors.New("could not read lock.json: " + err.Error())
+	}
+	orphans, err := cmd.getOrphanedDirs(lockJSON)
+	if err != nil {
+		return err
+	}
+	if len(orphans) == 0 {
+		logger.Info("No directories to remove")
+		return nil
+	}
+	for _, dir := range orphans {
+		if cmd.dryRun {
+			logger.Info("Would remove " + dir)
+			continue
+		}
+		// RemoveAll() removes a symlink itself, not the directory it links to
+		if err := os.RemoveAll(dir); err != nil {
+			return errors.New("failed to remove " + dir + ": " + err.Error())
+		}
+		logger.Info("Removed " + dir)
+	}
+	return nil
+}
+
+// Returns the paths under ~/.vim/pack/volt/{start,opt} which are not
+// installed directories of the repositories of all profiles (or current
+// profile if -current option was given), sorted by path
+func (cmd *cleanCmd) getOrphanedDirs(lockJSON *lockjson.LockJSON) ([]string, error) {
+	profiles := lockJSON.Profiles
+	if cmd.current {
+		profile, err := lockJSON.Profiles.FindByName(lockJSON.CurrentProfileName)
+		if err != nil {
+			return nil, err
+		}
+		profiles = lockjson.ProfileList{*profile}
+	}
+	wantDir := make(map[string]bool, len(lockJSON.Repos))
+	for i := range profiles {
+		reposList, err := lockJSON.GetReposListByProfile(&profiles[i])
+		if err != nil {
+			return nil, err
+		}
+		for j := range reposList {
+			wantDir[reposList[j].EncodedPath()] = true
+		}
+	}
+
+	var orphans []string
+	for _, dir := range []string{pathutil.VimVoltOptDir(), pathutil.VimVoltStartDir()} {
+		files, err := ioutil.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		for i := range files {
+			// Skip ~/.vim/pack/volt/start/system
+			if dir == pathutil.VimVoltStartDir() && files[i].Name() == "system" {
+				continue
+			}
+			path := filepath.Join(dir, files[i].Name())
+			if !wantDir[path] {
+				orphans = append(orphans, path)
+			}
+		}
+	}
+	sort.Strings(orphans)
+	return orphans, nil
+}
@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vim-volt/volt/internal/testutil"
+	"github.com/vim-volt/volt/pathutil"
+)
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) Shows the directories to remove but does not remove them
+// (b) Removes directories, symlinks and files which no profile installs
+// (c) Does not remove the installed directories of any profile, start/system and vimrc
+// (d) Removes the installed directories of other profiles
+// (e) Shows nothing to remove
+//
+// * Run `volt clean -dry-run` (A, B, a, c)
+// * Run `volt clean` (A, B, b, c)
+// * Run `volt clean -current` (A, B, d)
+// * Run `volt clean` again (A, B, e)
+func TestVoltClean(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	testutil.InstallConfig(t, "strategy-copy.toml")
+	installProfileRC(t, "default", "vimrc-nomagic.vim", pathutil.ProfileVimrc)
+	args := []string{"get"}
+	for _, name := range []string{"alpha", "bravo"} {
+		path := filepath.Join(pathutil.FullReposPath(pathutil.ReposPath("localhost/local/"+name)), "plugin", name+".vim")
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte("\" "+name+"\n"), 0644); err != nil {
+			t.Fatal("failed to write " + path)
+		}
+		args = append(args, "localhost/local/"+name)
+	}
+	out, err := testutil.RunVolt(args...)
+	testutil.SuccessExit(t, out, err)
+
+	// bravo is installed by "other" profile only, and its directory is left
+	// (e.g. by the build of "other" profile)
+	for _, args := range [][]string{
+		{"profile", "new", "other"},
+		{"profile", "add", "other", "localhost/local/bravo"},
+		{"profile", "rm", "default", "localhost/local/bravo"},
+	} {
+		out, err := testutil.RunVolt(args...)
+		testutil.SuccessExit(t, out, err)
+	}
+	bravo := pathutil.EncodeReposPath("localhost/local/bravo")
+	os.MkdirAll(bravo, 0755)
+
+	// The directory of the removed repository, the stale symlink, and the
+	// file which no profile installs
+	staleDir := pathutil.EncodeReposPath("localhost/local/stale")
+	os.MkdirAll(filepath.Join(staleDir, "plugin"), 0755)
+	staleLink := pathutil.EncodeReposPath("localhost/local/link")
+	linkTarget := pathutil.FullReposPath("localhost/local/alpha")
+	if err := os.Symlink(linkTarget, staleLink); err != nil {
+		t.Fatal("failed to create symlink: " + err.Error())
+	}
+	staleFile := filepath.Join(pathutil.VimVoltStartDir(), "stale.vim")
+	if err := ioutil.WriteFile(staleFile, []byte(""), 0644); err != nil {
+		t.Fatal("failed to write " + staleFile)
+	}
+
+	kept := []string{
+		pathutil.EncodeReposPath("localhost/local/alpha"),
+		pathutil.BundledPlugConf(),
+		filepath.Join(pathutil.VimDir(), pathutil.Vimrc),
+		linkTarget,
+	}
+	checkExists := func(paths []string, exists bool) {
+		t.Helper()
+		for _, path := range paths {
+			if _, err := os.Lstat(path); (err == nil) != exists {
+				t.Errorf("expected %s exists=%v", path, exists)
+			}
+		}
+	}
+
+	// =============== run =============== //
+
+	out, err = testutil.RunVolt("clean", "-dry-run")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	// (a)
+	for _, path := range []string{staleLink, staleDir, staleFile} {
+		if !strings.Contains(string(out), "Would remove "+path+"\n") {
+			t.Errorf("expected %s is shown but got: %s", path, string(out))
+		}
+	}
+	if strings.Count(string(out), "Would remove ") != 3 {
+		t.Errorf("expected 3 directories are shown but got: %s", string(out))
+	}
+	checkExists([]string{staleDir, staleLink, staleFile}, true)
+
+	out, err = testutil.RunVolt("clean")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	// (b)
+	checkExists([]string{staleDir, staleLink, staleFile}, false)
+	// (c)
+	checkExists(append(kept, bravo), true)
+
+	out, err = testutil.RunVolt("clean", "-current")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	// (d)
+	checkExists([]string{bravo}, false)
+	// (c)
+	checkExists(kept, true)
+
+	out, err = testutil.RunVolt("clean")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	// (e)
+	if !strings.Contains(string(out), "No directories to remove") {
+		t.Errorf("expected nothing is removed but got: %s", string(out))
+	}
+}
@@ -1,9 +1,14 @@
 package cmd
 
 import (
+	"errors"
 	"flag"
+	"os"
 
+	"github.com/vim-volt/volt/cmd/builder"
+	"github.com/vim-volt/volt/config"
 	"github.com/vim-volt/volt/logger"
+	"github.com/vim-volt/volt/pathutil"
 )
 
 var cmdMap = make(map[string]Cmd)
@@ -13,10 +18,73 @@ type Cmd interface {
 	FlagSet() *flag.FlagSet
 }
 
+// dryRunner is implemented by the commands which modify files and can show
+// what they would do instead (e.g. -dry-run option)
+type dryRunner interface {
+	setDryRun()
+}
+
+// The commands which do not modify any files.
+// The other commands must implement dryRunner to run while VOLT_DRY_RUN is set
+var readOnlyCmds = map[string]bool{
+	"cd":          true,
+	"du":          true,
+	"help":        true,
+	"lint":        true,
+	"list":        true,
+	"orphans":     true,
+	"search":      true,
+	"startuptime": true,
+	"status":      true,
+	"verify":      true,
+	"version":     true,
+}
+
 func Run(subCmd string, args []string) int {
 	if self, exists := cmdMap[subCmd]; exists {
+		if err := setPackageName(); err != nil {
+			logger.Error(err.Error())
+			return 4
+		}
+		setMagicComment()
+		if os.Getenv("VOLT_DRY_RUN") != "" && !readOnlyCmds[subCmd] {
+			dr, ok := self.(dryRunner)
+			if !ok {
+				logger.Error("'volt " + subCmd + "' does not support dry-run: unset VOLT_DRY_RUN to run it")
+				return 5
+			}
+			dr.setDryRun()
+		}
 		return self.Run(args)
 	}
 	logger.Error("Unknown command '" + subCmd + "'")
 	return 3
 }
+
+// Change the package name of (vim dir)/pack/{name} to
+// VOLT_PACKAGE environment variable, or build.package_name of config.toml.
+// Errors of config.toml are reported by each command which reads it.
+func setPackageName() error {
+	if name := os.Getenv("VOLT_PACKAGE"); name != "" {
+		if err := pathutil.SetPackageName(name); err != nil {
+			return errors.New("VOLT_PACKAGE is invalid: " + err.Error())
+		}
+		return nil
+	}
+	cfg, err := config.Read()
+	if err != nil {
+		return nil
+	}
+	return pathutil.SetPackageName(cfg.Build.PackageName)
+}
+
+// Change the magic comment of installed vimrc and gvimrc to
+// build.magic_comment of config.toml.
+// Errors of config.toml are reported by each command which reads it.
+func setMagicComment() {
+	cfg, err := config.Read()
+	if err != nil || cfg.Build.MagicComment == "" {
+		return
+	}
+	builder.SetMagicComment(cfg.Build.MagicComment, voltVersion)
+}
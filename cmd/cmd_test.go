@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/vim-volt/volt/gitutil"
+	"github.com/vim-volt/volt/internal/testutil"
+	"github.com/vim-volt/volt/pathutil"
+)
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (C) Show `[ERROR]` message
+// (D) Exit with non-zero status
+// (a) lock.json is not changed
+// (b) ~/.vim/pack/volt is not built
+// (c) The worktree of repositories is not changed
+// (d) The difference of lock.json is shown
+// (e) The commands which do not support dry-run refuse to run
+//
+// * Run `volt build` with VOLT_DRY_RUN=1 (A, B, a, b, c)
+// * Run `volt update -yes` with VOLT_DRY_RUN=1 (A, B, a, b, c, d)
+// * Run `volt disable {repository}` with VOLT_DRY_RUN=1 (A, B, a, b, c, d)
+// * Run `volt profile new {name}` with VOLT_DRY_RUN=1 (A, B, a, b, c)
+// * Run `volt outdated` with VOLT_DRY_RUN=1 (A, B, a, b, c)
+// * Run `volt list` with VOLT_DRY_RUN=1 (A, B, a, b, c)
+// * Run `volt get -l` with VOLT_DRY_RUN=1 (C, D, a, b, c, e)
+func TestVoltDryRunEnv(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	testutil.InstallConfig(t, "strategy-copy.toml")
+	versions := setUpOutdatedRepos(t, "alpha")
+	reposPath := pathutil.ReposPath("localhost/local/alpha")
+	lockJSONContent, err := ioutil.ReadFile(pathutil.LockJSON())
+	if err != nil {
+		t.Fatal("failed to read lock.json: " + err.Error())
+	}
+	checkUnchanged := func() {
+		t.Helper()
+		// (a)
+		content, err := ioutil.ReadFile(pathutil.LockJSON())
+		if err != nil {
+			t.Fatal("failed to read lock.json: " + err.Error())
+		}
+		if !bytes.Equal(content, lockJSONContent) {
+			t.Errorf("lock.json was changed: %s", string(content))
+		}
+		// (b)
+		if pathutil.Exists(pathutil.VimVoltDir()) {
+			t.Errorf("%s was built", pathutil.VimVoltDir())
+		}
+		// (c)
+		if head, err := gitutil.GetHEAD(reposPath); err != nil || head != versions["alpha"][0] {
+			t.Errorf("expected HEAD of %s is %s but got %s (%v)", reposPath, versions["alpha"][0], head, err)
+		}
+	}
+	os.Setenv("VOLT_DRY_RUN", "1")
+	defer os.Unsetenv("VOLT_DRY_RUN")
+
+	// =============== run =============== //
+
+	for _, tt := range []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"build"}, []string{"not built yet"}},
+		{[]string{"update", "-yes"}, []string{`-      "version": "` + versions["alpha"][0], `+      "version": "` + versions["alpha"][1]}},
+		{[]string{"disable", reposPath.String()}, []string{`-        "` + reposPath.String() + `"`}},
+		{[]string{"profile", "new", "foo"}, nil},
+		{[]string{"outdated"}, []string{reposPath.String() + "\t1 commit behind"}},
+		{[]string{"list"}, nil},
+	} {
+		out, err := testutil.RunVolt(tt.args...)
+		// (A, B)
+		testutil.SuccessExit(t, out, err)
+		// (d)
+		for _, expected := range tt.expected {
+			if !strings.Contains(string(out), expected) {
+				t.Errorf("volt %s: expected %q but got: %s", strings.Join(tt.args, " "), expected, string(out))
+			}
+		}
+		checkUnchanged()
+	}
+
+	out, err := testutil.RunVolt("get", "-l")
+	// (C, D)
+	testutil.FailExit(t, out, err)
+	// (e)
+	if !strings.Contains(string(out), "'volt get' does not support dry-run") {
+		t.Errorf("expected error of dry-run but got: %s", string(out))
+	}
+	checkUnchanged()
+}
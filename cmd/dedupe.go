@@ -0,0 +1,261 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/vim-volt/volt/lockjson"
+	"github.com/vim-volt/volt/logger"
+	"github.com/vim-volt/volt/pathutil"
+)
+
+func init() {
+	cmdMap["dedupe"] = &dedupeCmd{}
+}
+
+type dedupeCmd struct {
+	helped bool
+	yes    bool
+	dryRun bool
+}
+
+func (cmd *dedupeCmd) setDryRun() {
+	cmd.dryRun = true
+}
+
+func (cmd *dedupeCmd) FlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.SetOutput(os.Stdout)
+	fs.Usage = func() {
+		fmt.Print(`
+Usage
+  volt dedupe [-help] [-yes] [-dry-run]
+
+Quick example
+  $ volt dedupe          # merges repositories whose paths are the same after normalization (asks before writing lock.json)
+  $ volt dedupe -dry-run # shows how lock.json is changed by merging them
+  $ volt dedupe -yes     # merges them without asking
+
+Description
+  Find repositories in $VOLTPATH/lock.json whose paths differ but are the same after normalization (e.g. "github.com/tyru/caw.vim" and "tyru/caw.vim.git"), and merge each group of them into one repository.
+
+  The kept repository is the one whose directory exists under $VOLTPATH/repos, preferring the one whose path is normalized, then the first one in lock.json. Its version and the other properties are kept (the description of the others is used if it has none). The profiles which have the other repositories get the kept one instead, and it is installed under ~/.vim/pack/volt/start if any of them was in "start_repos_path" of the profile.
+
+  The merged repositories and the difference of lock.json are shown, and lock.json is written after confirmation unless -yes option was given. If -dry-run option was given, lock.json is not written.
+  The directories of the removed repositories under $VOLTPATH/repos are not removed. Run 'volt orphans' to find them.` + "\n\n")
+		fmt.Println("Options")
+		fs.PrintDefaults()
+		fmt.Println()
+		cmd.helped = true
+	}
+	fs.BoolVar(&cmd.yes, "yes", false, "write lock.json without confirmation")
+	fs.BoolVar(&cmd.dryRun, "dry-run", cmd.dryRun, "show the difference of lock.json instead of writing it")
+	return fs
+}
+
+func (cmd *dedupeCmd) Run(args []string) int {
+	err := cmd.parseArgs(args)
+	if err == ErrShowedHelp {
+		return 0
+	}
+	if err != nil {
+		logger.Error("Failed to parse args: " + err.Error())
+		return 10
+	}
+
+	err = cmd.doDedupe()
+	if err != nil {
+		logger.Error("Failed to merge repositories: " + err.Error())
+		return 11
+	}
+	return 0
+}
+
+func (cmd *dedupeCmd) parseArgs(args []string) error {
+	fs := cmd.FlagSet()
+	fs.Parse(args)
+	if cmd.helped {
+		return ErrShowedHelp
+	}
+	if len(fs.Args()) > 0 {
+		fs.Usage()
+		return errors.New("too many arguments")
+	}
+	return nil
+}
+
+func (cmd *dedupeCmd) doDedupe() error {
+	// Read and write lock.json in a transaction, so lock.json is not changed
+	// if merging fails midway
+	var merged int
+	err := lockjson.WithLock(func(lockJSON *lockjson.LockJSON) (bool, error) {
+		before, err := lockJSON.Marshal()
+		if err != nil {
+			return false, err
+		}
+
+		groups := cmd.findDuplicates(lockJSON.Repos)
+		if len(groups) == 0 {
+			logger.Info("No duplicate repositories were found in lock.json")
+			return false, nil
+		}
+		for _, group := range groups {
+			kept, removed := cmd.chooseKept(group)
+			for _, reposPath := range removed {
+				fmt.Printf("# %s > merged into %s\n", reposPath, kept)
+			}
+			if err := cmd.merge(lockJSON, kept, removed); err != nil {
+				return false, err
+			}
+			merged += len(removed)
+		}
+
+		if cmd.dryRun {
+			return false, (&profileCmd{}).showLockJSONDiff(before, lockJSON)
+		}
+		after, err := lockJSON.Marshal()
+		if err != nil {
+			return false, err
+		}
+		fmt.Print(formatUnifiedDiff("lock.json", string(before), string(after), 3))
+		if !cmd.yes {
+			ok, err := cmd.confirm()
+			if err != nil {
+				return false, err
+			}
+			if !ok {
+				logger.Info("lock.json was not changed")
+				merged = 0
+				return false, nil
+			}
+		}
+		return true, nil
+	})
+	if err != nil {
+		return err
+	}
+	if merged > 0 && !cmd.dryRun {
+		logger.Infof("Merged %d repositories", merged)
+	}
+	return nil
+}
+
+// Returns the groups of repositories whose paths are the same after
+// normalization, in the order of lock.json
+func (*dedupeCmd) findDuplicates(reposList lockjson.ReposList) [][]pathutil.ReposPath {
+	groups := make(map[pathutil.ReposPath][]pathutil.ReposPath, len(reposList))
+	order := make([]pathutil.ReposPath, 0, len(reposList))
+	for i := range reposList {
+		// Invalid paths were already rejected by the validation of lock.json
+		normalized, err := pathutil.NormalizeRepos(reposList[i].Path.String())
+		if err != nil {
+			continue
+		}
+		if _, exists := groups[normalized]; !exists {
+			order = append(order, normalized)
+		}
+		groups[normalized] = append(groups[normalized], reposList[i].Path)
+	}
+	result := make([][]pathutil.ReposPath, 0, len(order))
+	for _, normalized := range order {
+		if len(groups[normalized]) > 1 {
+			result = append(result, groups[normalized])
+		}
+	}
+	return result
+}
+
+// Returns the path of the repository which is kept in the group, and the
+// paths of the others.
+// The repository whose directory exists is preferred, then the one whose
+// path is normalized, then the first one.
+func (*dedupeCmd) chooseKept(group []pathutil.ReposPath) (pathutil.ReposPath, []pathutil.ReposPath) {
+	keptIndex, keptScore := 0, -1
+	for i, reposPath := range group {
+		score := 0
+		if pathutil.Exists(pathutil.FullReposPath(reposPath)) {
+			score += 2
+		}
+		if normalized, err := pathutil.NormalizeRepos(reposPath.String()); err == nil && normalized == reposPath {
+			score++
+		}
+		if score > keptScore {
+			keptIndex, keptScore = i, score
+		}
+	}
+	removed := make([]pathutil.ReposPath, 0, len(group)-1)
+	for i, reposPath := range group {
+		if i != keptIndex {
+			removed = append(removed, reposPath)
+		}
+	}
+	return group[keptIndex], removed
+}
+
+// Removes the repositories of removed from lock.json, and replaces them in
+// profiles with kept
+func (*dedupeCmd) merge(lockJSON *lockjson.LockJSON, kept pathutil.ReposPath, removed []pathutil.ReposPath) error {
+	keptRepos, err := lockJSON.Repos.FindByPath(kept)
+	if err != nil {
+		return err
+	}
+	isRemoved := make(map[pathutil.ReposPath]bool, len(removed))
+	for _, reposPath := range removed {
+		isRemoved[reposPath] = true
+		repos, err := lockJSON.Repos.FindByPath(reposPath)
+		if err != nil {
+			return err
+		}
+		if keptRepos.Description == "" {
+			keptRepos.Description = repos.Description
+		}
+	}
+
+	// Replace removed repositories in profiles, and remove the duplicates
+	replace := func(list []pathutil.ReposPath) []pathutil.ReposPath {
+		result := make([]pathutil.ReposPath, 0, len(list))
+		found := false
+		for _, reposPath := range list {
+			if reposPath == kept || isRemoved[reposPath] {
+				if found {
+					continue
+				}
+				reposPath = kept
+				found = true
+			}
+			result = append(result, reposPath)
+		}
+		return result
+	}
+	for i := range lockJSON.Profiles {
+		profile := &lockJSON.Profiles[i]
+		profile.ReposPath = replace(profile.ReposPath)
+		if len(profile.StartReposPath) > 0 {
+			profile.StartReposPath = replace(profile.StartReposPath)
+		}
+	}
+
+	// Remove repositories (keptRepos is invalid after this)
+	for _, reposPath := range removed {
+		if err := lockJSON.Repos.RemoveAllByPath(reposPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Asks whether to write lock.json. Returns false if the input was closed
+func (*dedupeCmd) confirm() (bool, error) {
+	fmt.Print("Write lock.json? [y/N]: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	answer := strings.ToLower(strings.TrimSpace(line))
+	return answer == "y" || answer == "yes", nil
+}
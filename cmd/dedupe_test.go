@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/vim-volt/volt/internal/testutil"
+	"github.com/vim-volt/volt/lockjson"
+	"github.com/vim-volt/volt/pathutil"
+)
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) The merged repositories are shown
+// (b) lock.json is not changed
+// (c) The repository whose directory exists is kept with its version
+// (d) The description of the removed repository is used if the kept one has none
+// (e) Profiles have the kept repository instead of the removed one without duplicates
+// (f) "start_repos_path" of the removed repository is moved to the kept one
+// (g) Nothing is merged if there are no duplicates
+//
+// * Run `volt dedupe -dry-run` (A, B, a, b)
+// * Run `volt dedupe` and answer "n" (A, B, a, b)
+// * Run `volt dedupe` and answer "y" (A, B, a, c, d, e, f)
+// * Run `volt dedupe -yes` (A, B, g)
+func TestVoltDedupe(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	kept := pathutil.ReposPath("localhost/local/alpha")
+	removed := pathutil.ReposPath("localhost/local/alpha.git")
+	first := setUpLocalGitRepos(t, kept)
+	version := getLockedVersion(t, kept)
+
+	// Add "localhost/local/alpha.git" which has no directory
+	lockJSON, err := lockjson.Read()
+	if err != nil {
+		t.Fatal("lockjson.Read() failed: " + err.Error())
+	}
+	lockJSON.Repos = append(lockJSON.Repos, lockjson.Repos{
+		Type:        lockjson.ReposGitType,
+		Path:        removed,
+		Version:     first.String(),
+		Description: "duplicated",
+	})
+	profile, err := lockJSON.Profiles.FindByName(lockJSON.CurrentProfileName)
+	if err != nil {
+		t.Fatal("lockJSON.Profiles.FindByName() failed: " + err.Error())
+	}
+	profile.ReposPath = append(profile.ReposPath, removed)
+	lockJSON.Profiles = append(lockJSON.Profiles, lockjson.Profile{
+		Name:           "other",
+		ReposPath:      []pathutil.ReposPath{removed},
+		StartReposPath: []pathutil.ReposPath{removed},
+	})
+	if err := lockJSON.Write(); err != nil {
+		t.Fatal("lockJSON.Write() failed: " + err.Error())
+	}
+	lockJSONContent, err := ioutil.ReadFile(pathutil.LockJSON())
+	if err != nil {
+		t.Fatal("failed to read lock.json: " + err.Error())
+	}
+	checkUnchanged := func() {
+		t.Helper()
+		content, err := ioutil.ReadFile(pathutil.LockJSON())
+		if err != nil {
+			t.Fatal("failed to read lock.json: " + err.Error())
+		}
+		if !bytes.Equal(content, lockJSONContent) {
+			t.Errorf("lock.json was changed: %s", string(content))
+		}
+	}
+	mergedLine := "# localhost/local/alpha.git > merged into localhost/local/alpha\n"
+
+	// =============== run =============== //
+
+	out, err := testutil.RunVolt("dedupe", "-dry-run")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	// (a)
+	if !strings.Contains(string(out), mergedLine) {
+		t.Errorf("expected %q but got: %s", mergedLine, string(out))
+	}
+	// (b)
+	checkUnchanged()
+
+	for _, answer := range []string{"n", "y"} {
+		cmd := testutil.VoltCommand("dedupe")
+		cmd.Stdin = strings.NewReader(answer + "\n")
+		out, err = cmd.CombinedOutput()
+		// (A, B)
+		testutil.SuccessExit(t, out, err)
+		// (a)
+		if !strings.Contains(string(out), mergedLine) {
+			t.Errorf("expected %q but got: %s", mergedLine, string(out))
+		}
+		if answer == "n" {
+			// (b)
+			checkUnchanged()
+		}
+	}
+
+	lockJSON, err = lockjson.Read()
+	if err != nil {
+		t.Fatal("lockjson.Read() failed: " + err.Error())
+	}
+	// (c, d)
+	expected := lockjson.ReposList{{
+		Type:        lockjson.ReposGitType,
+		Path:        kept,
+		Version:     version,
+		Description: "duplicated",
+	}}
+	if !reflect.DeepEqual(lockJSON.Repos, expected) {
+		t.Errorf("expected repos %+v but got %+v", expected, lockJSON.Repos)
+	}
+	// (e, f)
+	for _, p := range lockJSON.Profiles {
+		if len(p.ReposPath) != 1 || p.ReposPath[0] != kept {
+			t.Errorf("expected repos_path of profile %s is [%s] but got %v", p.Name, kept, p.ReposPath)
+		}
+		isStart := len(p.StartReposPath) == 1 && p.StartReposPath[0] == kept
+		if isStart != (p.Name == "other") || (!isStart && len(p.StartReposPath) > 0) {
+			t.Errorf("unexpected start_repos_path of profile %s: %v", p.Name, p.StartReposPath)
+		}
+	}
+
+	out, err = testutil.RunVolt("dedupe", "-yes")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	// (g)
+	if !strings.Contains(string(out), "No duplicate repositories were found") {
+		t.Errorf("expected no duplicates but got: %s", string(out))
+	}
+}
@@ -16,6 +16,11 @@ func init() {
 
 type disableCmd struct {
 	helped bool
+	dryRun bool
+}
+
+func (cmd *disableCmd) setDryRun() {
+	cmd.dryRun = true
 }
 
 func (cmd *disableCmd) FlagSet() *flag.FlagSet {
@@ -24,19 +29,20 @@ func (cmd *disableCmd) FlagSet() *flag.FlagSet {
 	fs.Usage = func() {
 		fmt.Print(`
 Usage
-  volt disable [-help] {repository} [{repository2} ...]
+  volt disable [-help] [-dry-run] {repository} [{repository2} ...]
 
 Quick example
   $ volt disable tyru/caw.vim # will disable tyru/caw.vim plugin in current profile
 
 Description
   This is shortcut of:
-  volt profile rm {current profile} {repository} [{repository2} ...]` + "\n\n")
-		//fmt.Println("Options")
-		//fs.PrintDefaults()
+  volt profile rm [-dry-run] {current profile} {repository} [{repository2} ...]` + "\n\n")
+		fmt.Println("Options")
+		fs.PrintDefaults()
 		fmt.Println()
 		cmd.helped = true
 	}
+	fs.BoolVar(&cmd.dryRun, "dry-run", cmd.dryRun, "show the difference of lock.json instead of writing it")
 	return fs
 }
 
@@ -50,7 +56,7 @@ func (cmd *disableCmd) Run(args []string) int {
 		return 10
 	}
 
-	profCmd := profileCmd{}
+	profCmd := profileCmd{dryRun: cmd.dryRun}
 	err = profCmd.doRm(append(
 		[]string{"-current"},
 		reposPathList.Strings()...,
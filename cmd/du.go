@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/vim-volt/volt/logger"
+	"github.com/vim-volt/volt/pathutil"
+)
+
+func init() {
+	cmdMap["du"] = &duCmd{}
+}
+
+type duCmd struct {
+	helped bool
+}
+
+func (cmd *duCmd) FlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.SetOutput(os.Stdout)
+	fs.Usage = func() {
+		fmt.Print(`
+Usage
+  volt du [-help]
+
+Quick example
+  $ volt du # will show disk usage of start, opt and repos directories
+
+Description
+  Show disk usage (in bytes) of the following directories, broken down by repository:
+  * ~/.vim/pack/volt/start
+  * ~/.vim/pack/volt/opt
+  * $VOLTPATH/repos
+  Sizes are the sum of the regular files actually found in each directory
+  (symbolic links are not followed), sorted in descending order.` + "\n\n")
+		//fmt.Println("Options")
+		//fs.PrintDefaults()
+		fmt.Println()
+		cmd.helped = true
+	}
+	return fs
+}
+
+func (cmd *duCmd) Run(args []string) int {
+	err := cmd.parseArgs(args)
+	if err == ErrShowedHelp {
+		return 0
+	}
+	if err != nil {
+		logger.Error("Failed to parse args: " + err.Error())
+		return 10
+	}
+
+	usages, err := cmd.getDiskUsages()
+	if err != nil {
+		logger.Error("Failed to get disk usage: " + err.Error())
+		return 11
+	}
+
+	fmt.Print(cmd.format(usages))
+	return 0
+}
+
+func (cmd *duCmd) parseArgs(args []string) error {
+	fs := cmd.FlagSet()
+	fs.Parse(args)
+	if cmd.helped {
+		return ErrShowedHelp
+	}
+	return nil
+}
+
+// Disk usage of one directory (start, opt, repos)
+type dirUsage struct {
+	name  string
+	dir   string
+	total int64
+	repos []reposUsage
+}
+
+// Disk usage of one repository (or other entry) in the directory
+type reposUsage struct {
+	name string
+	size int64
+}
+
+func (cmd *duCmd) getDiskUsages() ([]dirUsage, error) {
+	start, err := cmd.getInstalledUsage("start", pathutil.VimVoltStartDir())
+	if err != nil {
+		return nil, err
+	}
+	opt, err := cmd.getInstalledUsage("opt", pathutil.VimVoltOptDir())
+	if err != nil {
+		return nil, err
+	}
+	repos, err := cmd.getReposUsage("repos", filepath.Join(pathutil.VoltPath(), "repos"))
+	if err != nil {
+		return nil, err
+	}
+	return []dirUsage{*start, *opt, *repos}, nil
+}
+
+// Entries of ~/.vim/pack/volt/{start,opt} are encoded repos path
+// (e.g. "github.com_tyru_caw.vim")
+func (cmd *duCmd) getInstalledUsage(name, dir string) (*dirUsage, error) {
+	return cmd.getUsage(name, dir, func(rel []string) string {
+		if len(rel) < 2 || rel[0] == "system" {
+			return rel[0]
+		}
+		return string(pathutil.DecodeReposPath(rel[0]))
+	})
+}
+
+// Entries of $VOLTPATH/repos are "{site}/{user}/{name}"
+func (cmd *duCmd) getReposUsage(name, dir string) (*dirUsage, error) {
+	return cmd.getUsage(name, dir, func(rel []string) string {
+		if len(rel) < 4 {
+			return strings.Join(rel, "/")
+		}
+		return strings.Join(rel[:3], "/")
+	})
+}
+
+// Walk dir and sum up sizes of regular files.
+// keyOf receives a path relative to dir split by path separator,
+// and returns the entry name to which the file belongs.
+func (*duCmd) getUsage(name, dir string, keyOf func([]string) string) (*dirUsage, error) {
+	usage := &dirUsage{name: name, dir: dir}
+	if !pathutil.Exists(dir) {
+		return usage, nil
+	}
+	sizes := make(map[string]int64, 32)
+	err := filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.Mode().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		sizes[keyOf(strings.Split(filepath.ToSlash(rel), "/"))] += fi.Size()
+		usage.total += fi.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, errors.New("failed to walk " + dir + ": " + err.Error())
+	}
+	for key, size := range sizes {
+		usage.repos = append(usage.repos, reposUsage{name: key, size: size})
+	}
+	sort.Slice(usage.repos, func(i, j int) bool {
+		if usage.repos[i].size != usage.repos[j].size {
+			return usage.repos[i].size > usage.repos[j].size
+		}
+		return usage.repos[i].name < usage.repos[j].name
+	})
+	return usage, nil
+}
+
+func (*duCmd) format(usages []dirUsage) string {
+	var sum int64
+	var b bytes.Buffer
+	for _, u := range usages {
+		fmt.Fprintf(&b, "%d\t%s (%s)\n", u.total, u.name, u.dir)
+		for _, r := range u.repos {
+			fmt.Fprintf(&b, "  %d\t%s\n", r.size, r.name)
+		}
+		sum += u.total
+	}
+	fmt.Fprintf(&b, "%d\ttotal\n", sum)
+	return b.String()
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vim-volt/volt/internal/testutil"
+	"github.com/vim-volt/volt/pathutil"
+)
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) Output shows sizes of files actually placed under directories
+//
+// * Run `volt du` (A, B, a)
+func TestVoltDu(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+
+	foo := pathutil.ReposPath("localhost/local/foo")
+	bar := pathutil.ReposPath("github.com/tyru/bar.vim")
+	optDir := pathutil.VimVoltOptDir()
+	startDir := pathutil.VimVoltStartDir()
+	reposDir := filepath.Join(pathutil.VoltPath(), "repos")
+	for path, size := range map[string]int{
+		filepath.Join(pathutil.FullReposPath(foo), "plugin", "foo.vim"):         100,
+		filepath.Join(pathutil.FullReposPath(bar), "plugin", "bar.vim"):         300,
+		filepath.Join(pathutil.FullReposPath(bar), "doc", "bar.txt"):            20,
+		filepath.Join(pathutil.EncodeReposPath(foo), "plugin", "foo.vim"):       100,
+		filepath.Join(pathutil.EncodeReposPath(foo), "plugin", "manual.vim"):    50,
+		filepath.Join(pathutil.EncodeReposPathTo(startDir, bar), "doc", "tags"): 7,
+		pathutil.BundledPlugConf():                                              30,
+	} {
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(strings.Repeat("x", size)), 0644); err != nil {
+			t.Fatal("failed to write " + path)
+		}
+	}
+
+	// =============== run =============== //
+
+	out, err := testutil.RunVolt("du")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+
+	// (a)
+	expected := fmt.Sprintf(`37	start (%s)
+  30	system
+  7	github.com/tyru/bar.vim
+150	opt (%s)
+  150	localhost/local/foo
+420	repos (%s)
+  320	github.com/tyru/bar.vim
+  100	localhost/local/foo
+607	total
+`, startDir, optDir, reposDir)
+	if string(out) != expected {
+		t.Errorf("=== expected ===\n%s\n=== got ===\n%s", expected, string(out))
+	}
+}
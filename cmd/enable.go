@@ -16,6 +16,11 @@ func init() {
 
 type enableCmd struct {
 	helped bool
+	dryRun bool
+}
+
+func (cmd *enableCmd) setDryRun() {
+	cmd.dryRun = true
 }
 
 func (cmd *enableCmd) FlagSet() *flag.FlagSet {
@@ -24,19 +29,20 @@ func (cmd *enableCmd) FlagSet() *flag.FlagSet {
 	fs.Usage = func() {
 		fmt.Print(`
 Usage
-  volt enable [-help] {repository} [{repository2} ...]
+  volt enable [-help] [-dry-run] {repository} [{repository2} ...]
 
 Quick example
   $ volt enable tyru/caw.vim # will enable tyru/caw.vim plugin in current profile
 
 Description
   This is shortcut of:
-  volt profile add {current profile} {repository} [{repository2} ...]` + "\n\n")
-		//fmt.Println("Options")
-		//fs.PrintDefaults()
+  volt profile add [-dry-run] {current profile} {repository} [{repository2} ...]` + "\n\n")
+		fmt.Println("Options")
+		fs.PrintDefaults()
 		fmt.Println()
 		cmd.helped = true
 	}
+	fs.BoolVar(&cmd.dryRun, "dry-run", cmd.dryRun, "show the difference of lock.json instead of writing it")
 	return fs
 }
 
@@ -50,7 +56,7 @@ func (cmd *enableCmd) Run(args []string) int {
 		return 10
 	}
 
-	profCmd := profileCmd{}
+	profCmd := profileCmd{dryRun: cmd.dryRun}
 	err = profCmd.doAdd(append(
 		[]string{"-current"},
 		reposPathList.Strings()...,
@@ -0,0 +1,164 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/vim-volt/volt/lockjson"
+	"github.com/vim-volt/volt/logger"
+	"github.com/vim-volt/volt/pathutil"
+	"github.com/vim-volt/volt/plugconf"
+)
+
+func init() {
+	cmdMap["export-config"] = &exportConfigCmd{}
+}
+
+type exportConfigCmd struct {
+	helped      bool
+	profileName string
+}
+
+func (cmd *exportConfigCmd) FlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.SetOutput(os.Stdout)
+	fs.Usage = func() {
+		fmt.Print(`
+Usage
+  volt export-config [-help] [-profile {name}] {file | -}
+
+Quick example
+  $ volt export-config vimrc.vim               # writes vimrc and plugin configuration of current profile to vimrc.vim
+  $ volt export-config -profile work vimrc.vim # writes those of profile "work"
+  $ volt export-config - | less                # writes them to stdout
+
+Description
+  Write the configuration of a profile to a single Vim script {file}, which can be used as vimrc on a machine without volt:
+    * a header which lists the repositories of the profile and where Vim loads them from
+    * $VOLTPATH/rc/{profile}/vimrc.vim (if it exists)
+    * the bundled plugconf of the profile (see 'volt build')
+  The plugin code is not written. Install the listed repositories in the directories shown in the header (or use 'volt pack' to carry them too).
+
+  If -profile option was not given, current profile is used.
+  If {file} is "-", the script is written to stdout.` + "\n\n")
+		fmt.Println("Options")
+		fs.PrintDefaults()
+		fmt.Println()
+		cmd.helped = true
+	}
+	fs.StringVar(&cmd.profileName, "profile", "", "profile name (default: current profile)")
+	return fs
+}
+
+func (cmd *exportConfigCmd) Run(args []string) int {
+	file, err := cmd.parseArgs(args)
+	if err == ErrShowedHelp {
+		return 0
+	}
+	if err != nil {
+		logger.Error("Failed to parse args: " + err.Error())
+		return 10
+	}
+
+	content, err := cmd.generate()
+	if err != nil {
+		logger.Error("Failed to export config: " + err.Error())
+		return 11
+	}
+
+	if file == "-" {
+		_, err = os.Stdout.Write(content)
+	} else {
+		os.MkdirAll(filepath.Dir(file), 0755)
+		err = ioutil.WriteFile(file, content, 0644)
+	}
+	if err != nil {
+		logger.Error("Failed to write config: " + err.Error())
+		return 12
+	}
+	if file != "-" {
+		logger.Info("Wrote " + file)
+	}
+	return 0
+}
+
+func (cmd *exportConfigCmd) parseArgs(args []string) (string, error) {
+	fs := cmd.FlagSet()
+	fs.Parse(args)
+	if cmd.helped {
+		return "", ErrShowedHelp
+	}
+	if len(fs.Args()) != 1 {
+		fs.Usage()
+		return "", errors.New("output file was not given")
+	}
+	return fs.Args()[0], nil
+}
+
+// Returns the exported Vim script: the header, vimrc and the bundled plugconf
+// in the order Vim loads them
+func (cmd *exportConfigCmd) generate() ([]byte, error) {
+	// Read lock.json
+	lockJSON, err := lockjson.Read()
+	if err != nil {
+		return nil, errors.New("could not read lock.json: " + err.Error())
+	}
+	profileName := cmd.profileName
+	if profileName == "" {
+		profileName = lockJSON.CurrentProfileName
+	}
+	profile, err := lockJSON.Profiles.FindByName(profileName)
+	if err != nil {
+		return nil, err
+	}
+	reposList, err := lockJSON.GetReposListByProfile(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	// The repositories are sorted in the order they are loaded
+	bundled, merr := plugconf.GenerateBundlePlugconf(profileName, reposList)
+	if merr.ErrorOrNil() != nil {
+		return nil, merr
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "\" This file was exported by 'volt export-config' from profile %q.\n", profileName)
+	buf.WriteString("\" It consists of vimrc and the plugin configuration of the profile, and can be used without volt.\n")
+	buf.WriteString("\" The following repositories are needed in the directories under ~/.vim (or ~/vimfiles):\n")
+	buf.WriteString("\"\n")
+	if len(reposList) == 0 {
+		buf.WriteString("\"   (no repositories)\n")
+	}
+	for i := range reposList {
+		dir, err := filepath.Rel(pathutil.VimDir(), reposList[i].EncodedPath())
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&buf, "\"   %s (%s)\n", reposList[i].Path, filepath.ToSlash(dir))
+	}
+
+	// vimrc is sourced before the bundled plugconf, because Vim loads plugins
+	// after vimrc. The bundled plugconf is the last because it may ":finish".
+	vimrc := filepath.Join(pathutil.RCDir(profileName), pathutil.ProfileVimrc)
+	if pathutil.Exists(vimrc) {
+		content, err := ioutil.ReadFile(vimrc)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&buf, "\n\" ===== vimrc: %s =====\n\n", vimrc)
+		buf.Write(content)
+		if len(content) > 0 && content[len(content)-1] != '\n' {
+			buf.WriteString("\n")
+		}
+	}
+	buf.WriteString("\n\" ===== bundled plugconf =====\n\n")
+	buf.Write(bundled)
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
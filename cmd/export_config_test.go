@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vim-volt/volt/config"
+	"github.com/vim-volt/volt/internal/testutil"
+	"github.com/vim-volt/volt/lockjson"
+	"github.com/vim-volt/volt/pathutil"
+)
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) The header lists the repositories of the profile
+// (b) The exported file can be sourced without errors
+// (c) vimrc and s:config() of plugconf are executed, and the plugin is loaded
+//
+// * Run `volt export-config {file}` (A, B, a, b, c)
+func TestVoltExportConfig(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	hello := pathutil.ReposPath("localhost/local/hello")
+	teardown := testutil.SetUpRepos(t, "hello", lockjson.ReposStaticType, []pathutil.ReposPath{hello}, config.CopyBuilder)
+	defer teardown()
+
+	vimrc := filepath.Join(pathutil.RCDir("default"), pathutil.ProfileVimrc)
+	os.MkdirAll(filepath.Dir(vimrc), 0755)
+	if err := ioutil.WriteFile(vimrc, []byte("let g:volt_test_vimrc = 1\n"), 0644); err != nil {
+		t.Fatal("failed to write " + vimrc)
+	}
+	plugconfPath := pathutil.Plugconf(hello)
+	os.MkdirAll(filepath.Dir(plugconfPath), 0755)
+	plugconfContent := "function! s:config()\n  let g:volt_test_config = 1\nendfunction\n"
+	if err := ioutil.WriteFile(plugconfPath, []byte(plugconfContent), 0644); err != nil {
+		t.Fatal("failed to write " + plugconfPath)
+	}
+	file := filepath.Join(pathutil.VoltPath(), "out", "vimrc.vim")
+	// Install the plugin to ~/.vim/pack/volt/opt to load it by :packadd
+	out, err := testutil.RunVolt("build")
+	testutil.SuccessExit(t, out, err)
+
+	// =============== run =============== //
+
+	out, err = testutil.RunVolt("export-config", file)
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal("failed to read " + file + ": " + err.Error())
+	}
+	// (a)
+	expected := "\"   localhost/local/hello (pack/volt/opt/localhost_local_hello)\n"
+	if !strings.Contains(string(content), expected) {
+		t.Errorf("expected %q is listed but got:\n%s", expected, string(content))
+	}
+
+	// (b, c)
+	result := filepath.Join(pathutil.VoltPath(), "out", "result.txt")
+	vim := exec.Command("vim", "-N", "-u", "NONE", "-i", "NONE", "-es",
+		"-c", "source "+file,
+		"-c", "doautocmd VimEnter",
+		"-c", "call writefile([v:errmsg, get(g:, 'volt_test_vimrc'), get(g:, 'volt_test_config'), exists(':Hello')], '"+result+"')",
+		"-c", "qall!")
+	if out, err := vim.CombinedOutput(); err != nil {
+		t.Fatalf("failed to source %s: %s: %s\n%s", file, err.Error(), string(out), string(content))
+	}
+	got, err := ioutil.ReadFile(result)
+	if err != nil {
+		t.Fatal("failed to read " + result + ": " + err.Error())
+	}
+	if string(got) != "\n1\n1\n2\n" {
+		t.Errorf("expected [v:errmsg, vimrc, s:config(), :Hello] are ['', 1, 1, 2] but got %q", string(got))
+	}
+}
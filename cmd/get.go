@@ -13,6 +13,7 @@ import (
 	"strings"
 
 	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
 
 	"github.com/vim-volt/volt/config"
 	"github.com/vim-volt/volt/fileutil"
@@ -34,6 +35,8 @@ type getCmd struct {
 	helped   bool
 	lockJSON bool
 	upgrade  bool
+	// key: repository path, value: ref given by "{repository}@{ref}"
+	refs map[pathutil.ReposPath]string
 }
 
 func (cmd *getCmd) FlagSet() *flag.FlagSet {
@@ -48,6 +51,7 @@ Quick example
   $ volt get tyru/caw.vim     # will install tyru/caw.vim plugin
   $ volt get -u tyru/caw.vim  # will upgrade tyru/caw.vim plugin
   $ volt get -l -u            # will upgrade all installed plugins
+  $ volt get tyru/caw.vim@v1.0.0  # will install tyru/caw.vim plugin and lock the tag v1.0.0
   $ VOLT_DEBUG=1 volt get tyru/caw.vim  # will output more verbosely
 
   $ mkdir -p ~/volt/repos/localhost/local/hello/plugin
@@ -102,6 +106,9 @@ Repository path
   3. https://{site}/{user}/{name}
   4. http://{site}/{user}/{name}
 
+  "@{ref}" can be appended to {repository} (e.g. "tyru/caw.vim@v1.0.0").
+  {ref} is a tag, branch or commit hash. The commit of {ref} is checked out and locked in lock.json instead of the default branch's one.
+
 Options`)
 		fs.PrintDefaults()
 		fmt.Println()
@@ -171,11 +178,15 @@ func (cmd *getCmd) getReposPathList(args []string, lockJSON *lockjson.LockJSON)
 			reposPathList = append(reposPathList, repos.Path)
 		}
 	} else {
+		cmd.refs = make(map[pathutil.ReposPath]string, len(args))
 		for _, arg := range args {
-			reposPath, err := pathutil.NormalizeRepos(arg)
+			reposPath, ref, err := pathutil.NormalizeReposWithRef(arg)
 			if err != nil {
 				return nil, err
 			}
+			if ref != "" {
+				cmd.refs[reposPath] = ref
+			}
 			reposPathList = append(reposPathList, reposPath)
 		}
 	}
@@ -425,6 +436,31 @@ func (cmd *getCmd) installPlugin(reposPath pathutil.ReposPath, repos *lockjson.R
 		}
 	}
 
+	// Check out the ref given by "{repository}@{ref}"
+	if ref := cmd.refs[reposPath]; ref != "" {
+		if err == nil && reposType == lockjson.ReposGitType {
+			toHash, err = cmd.checkoutRef(reposPath, ref)
+		} else if err == nil {
+			err = errors.New("not a git repository")
+		}
+		if err != nil {
+			result := errors.New("failed to check out " + ref + ": " + err.Error())
+			if doInstall {
+				logger.Debug("Rollbacking " + fullReposPath + " ...")
+				err = cmd.removeDir(fullReposPath)
+				if err != nil {
+					result = multierror.Append(result, err)
+				}
+			}
+			done <- getParallelResult{
+				reposPath: reposPath,
+				status:    fmt.Sprintf(fmtInstallFailed, reposPath),
+				err:       result,
+			}
+			return
+		}
+	}
+
 	if upgraded {
 		if fromHash != toHash {
 			status = fmt.Sprintf(fmtUpgraded, reposPath, fromHash, toHash)
@@ -445,6 +481,36 @@ func (cmd *getCmd) installPlugin(reposPath pathutil.ReposPath, repos *lockjson.R
 	}
 }
 
+// Resolve ref (tag, branch or commit hash) to a commit hash, and check out
+// the commit (HEAD is detached).
+// The worktree is not changed if the repository is bare.
+func (*getCmd) checkoutRef(reposPath pathutil.ReposPath, ref string) (string, error) {
+	r, err := git.PlainOpen(pathutil.FullReposPath(reposPath))
+	if err != nil {
+		return "", err
+	}
+	hash, err := gitutil.ResolveCommit(r, ref)
+	if err != nil {
+		return "", err
+	}
+	cfg, err := r.Config()
+	if err != nil {
+		return "", err
+	}
+	if cfg.Core.IsBare {
+		return hash, nil
+	}
+	wt, err := r.Worktree()
+	if err != nil {
+		return "", err
+	}
+	err = wt.Checkout(&git.CheckoutOptions{Hash: plumbing.NewHash(hash)})
+	if err != nil {
+		return "", err
+	}
+	return hash, nil
+}
+
 func (cmd *getCmd) installPlugconf(reposPath pathutil.ReposPath, pluginResult *getParallelResult, done chan<- getParallelResult) {
 	// Install plugconf
 	logger.Debug("Installing plugconf " + reposPath + " ...")
@@ -539,6 +605,10 @@ func (cmd *getCmd) fetchPlugconf(reposPath pathutil.ReposPath) error {
 		logger.Debugf("plugconf '%s' exists... skip", filename)
 		return nil
 	}
+	if reposPlugconf := pathutil.ReposPlugconf(reposPath); pathutil.Exists(reposPlugconf) {
+		logger.Debugf("plugconf '%s' is shipped with the repository... skip", reposPlugconf)
+		return nil
+	}
 
 	// If non-nil error returned from FetchPlugconf(),
 	// create skeleton plugconf file
@@ -582,7 +652,7 @@ func (*getCmd) updateReposVersion(lockJSON *lockjson.LockJSON, reposPath pathuti
 	} else {
 		// repos is found in lock.json
 		// -> previous operation is upgrade
-		repos.Version = version
+		setReposVersion(repos, version)
 	}
 
 	if !profile.ReposPath.Contains(reposPath) {
@@ -593,6 +663,21 @@ func (*getCmd) updateReposVersion(lockJSON *lockjson.LockJSON, reposPath pathuti
 	return added
 }
 
+// Set repos.Version to version.
+// If tree_hash is given, it is updated to the tree hash of version.
+func setReposVersion(repos *lockjson.Repos, version string) {
+	if repos.TreeHash != "" && repos.Version != version {
+		repos.TreeHash = ""
+		if r, err := git.PlainOpen(pathutil.FullReposPath(repos.Path)); err == nil {
+			repos.TreeHash, _ = gitutil.GetTreeHash(r, version)
+		}
+		if repos.TreeHash == "" {
+			logger.Warnf("%s: removed tree_hash because it could not get the tree hash of %s", repos.Path, version)
+		}
+	}
+	repos.Version = version
+}
+
 func (cmd *getCmd) gitFetch(r *git.Repository, workDir string, remote string, cfg *config.Config) error {
 	err := r.Fetch(&git.FetchOptions{
 		RemoteName: remote,
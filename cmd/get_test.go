@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -573,3 +574,141 @@ func gitResetHard(reposPath pathutil.ReposPath, ref string) (current plumbing.Ha
 	})
 	return
 }
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) The commit of given ref is locked in lock.json
+// (b) The commit of given ref is installed
+// (c) The repository is not added to lock.json
+//
+// * Run `volt get {repos}@{annotated tag}` (A, B, a, b)
+// * Run `volt get {repos}@{branch}` (A, B, a, b)
+// * Run `volt get {repos}` (A, B, a, b)
+// * Run `volt get {repos}@{unknown ref}` (!A, !B, c)
+func TestVoltGetRef(t *testing.T) {
+	reposPath := pathutil.ReposPath("localhost/local/refs")
+	for _, tt := range []struct {
+		suffix string
+		commit int
+	}{
+		{"@v1", 0},
+		{"@feature", 1},
+		{"", 2},
+	} {
+		t.Run("suffix="+tt.suffix, func(t *testing.T) {
+			// =============== setup =============== //
+
+			testutil.SetUpEnv(t)
+			commits := setUpRefsRepos(t, reposPath)
+
+			// =============== run =============== //
+
+			out, err := testutil.RunVolt("get", reposPath.String()+tt.suffix)
+			// (A, B)
+			testutil.SuccessExit(t, out, err)
+
+			// (a)
+			lockJSON, err := lockjson.Read()
+			if err != nil {
+				t.Fatal("lockjson.Read() failed: " + err.Error())
+			}
+			repos, err := lockJSON.Repos.FindByPath(reposPath)
+			if err != nil {
+				t.Fatal("repository was not added to lock.json: " + err.Error())
+			}
+			if repos.Version != commits[tt.commit].String() {
+				t.Errorf("expected locked version %s but got %s", commits[tt.commit], repos.Version)
+			}
+
+			// (b)
+			content, err := ioutil.ReadFile(filepath.Join(pathutil.EncodeReposPath(reposPath), "plugin", "refs.vim"))
+			if err != nil {
+				t.Fatal("failed to read installed file: " + err.Error())
+			}
+			expected := fmt.Sprintf("\" commit %d\n", tt.commit)
+			if string(content) != expected {
+				t.Errorf("expected %q but got %q", expected, string(content))
+			}
+		})
+	}
+
+	t.Run("suffix=@no-such-ref", func(t *testing.T) {
+		// =============== setup =============== //
+
+		testutil.SetUpEnv(t)
+		setUpRefsRepos(t, reposPath)
+
+		// =============== run =============== //
+
+		out, err := testutil.RunVolt("get", reposPath.String()+"@no-such-ref")
+		// (!A, !B)
+		testutil.FailExit(t, out, err)
+		// (c)
+		testReposPathWereNotAdded(t, reposPath)
+	})
+}
+
+// Make git repository reposPath which has three commits on master branch.
+// The first commit has annotated tag "v1", and the second commit is
+// pointed by branch "feature". Returns the commits in order.
+func setUpRefsRepos(t *testing.T, reposPath pathutil.ReposPath) []plumbing.Hash {
+	t.Helper()
+	fullpath := pathutil.FullReposPath(reposPath)
+	r, err := git.PlainInit(fullpath, false)
+	if err != nil {
+		t.Fatal("git.PlainInit() failed: " + err.Error())
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		t.Fatal("r.Worktree() failed: " + err.Error())
+	}
+	signature := &object.Signature{
+		Name:  "John Doe",
+		Email: "john@doe.org",
+		When:  time.Now(),
+	}
+	filename := filepath.Join(fullpath, "plugin", "refs.vim")
+	os.MkdirAll(filepath.Dir(filename), 0755)
+	commits := make([]plumbing.Hash, 0, 3)
+	for i := 0; i < 3; i++ {
+		if err := ioutil.WriteFile(filename, []byte(fmt.Sprintf("\" commit %d\n", i)), 0644); err != nil {
+			t.Fatal("ioutil.WriteFile() failed: " + err.Error())
+		}
+		if _, err := w.Add("plugin/refs.vim"); err != nil {
+			t.Fatal("w.Add() failed: " + err.Error())
+		}
+		hash, err := w.Commit(fmt.Sprintf("commit %d", i), &git.CommitOptions{Author: signature})
+		if err != nil {
+			t.Fatal("w.Commit() failed: " + err.Error())
+		}
+		commits = append(commits, hash)
+	}
+
+	// Annotated tag "v1"
+	tag := &object.Tag{
+		Name:       "v1",
+		Tagger:     *signature,
+		Message:    "v1\n",
+		TargetType: plumbing.CommitObject,
+		Target:     commits[0],
+	}
+	obj := r.Storer.NewEncodedObject()
+	if err := tag.Encode(obj); err != nil {
+		t.Fatal("tag.Encode() failed: " + err.Error())
+	}
+	tagHash, err := r.Storer.SetEncodedObject(obj)
+	if err != nil {
+		t.Fatal("r.Storer.SetEncodedObject() failed: " + err.Error())
+	}
+	for name, hash := range map[string]plumbing.Hash{
+		"refs/tags/v1":       tagHash,
+		"refs/heads/feature": commits[1],
+	} {
+		ref := plumbing.NewHashReference(plumbing.ReferenceName(name), hash)
+		if err := r.Storer.SetReference(ref); err != nil {
+			t.Fatal("r.Storer.SetReference() failed: " + err.Error())
+		}
+	}
+	return commits
+}
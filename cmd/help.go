@@ -41,10 +41,16 @@ Command
   get [-l] [-u] [{repository} ...]
     Install or upgrade given {repository} list, or add local {repository} list as plugins
 
+  outdated [-offline] [{repository} ...]
+    List git repositories whose tracked branch has newer commits than locked revision (does not change lock.json)
+
+  update (-interactive | -yes | -select {repository} | -pin {repository}) [{repository} ...]
+    Update locked revision of outdated git repositories (chosen interactively or by options), and build ~/.vim/pack/volt/
+
   rm [-r] [-p] {repository} [{repository2} ...]
     Remove vim plugin from ~/.vim/pack/volt/opt/ directory
 
-  list [-f {text/template string}]
+  list [-long] [-f {text/template string}]
     Vim plugin information extractor.
     Unless -f flag was given, this command shows vim plugins of **current profile** (not all installed plugins) by default.
 
@@ -74,15 +80,54 @@ Command
   profile rename {old} {new}
     Rename profile {old} to {new}
 
-  profile add {name} {repository} [{repository2} ...]
+  profile add [-start] {name} {repository} [{repository2} ...]
     Add one or more repositories to profile
 
   profile rm {name} {repository} [{repository2} ...]
     Remove one or more repositories to profile
 
-  build [-full]
+  profile diff [-json] {name1} {name2}
+    Show the difference of repositories between two profiles
+
+  build [-full] [-no-vimrc]
     Build ~/.vim/pack/volt/ directory
 
+  pack [-no-vimrc] {file}
+    Write files which 'volt build' installs to a tarball ({file}.tar.gz or {file}.tar)
+
+  export-config [-profile {name}] {file}
+    Write vimrc and plugin configuration of a profile to a single Vim script which can be used without volt
+
+  status [-quiet]
+    Check if ~/.vim/pack/volt/ directory is up to date (exits with non-zero if 'volt build' is needed)
+
+  verify
+    Check if installed files under ~/.vim/pack/volt/ are the same as the locked revisions (exits with non-zero if they differ)
+
+  startuptime [-top {count}] [-runs {count}]
+    Show how long it takes to load each plugin at Vim startup
+
+  du
+    Show disk usage of ~/.vim/pack/volt/{start,opt} and $VOLTPATH/repos directories
+
+  cd [-source | -installed] {repository}
+    Print the path of the repository directory under $VOLTPATH/repos or ~/.vim/pack/volt
+
+  orphans
+    List repositories under $VOLTPATH/repos which are not used by any profile
+
+  clean [-current] [-dry-run]
+    Remove directories under ~/.vim/pack/volt/{start,opt} which are not installed by any profile
+
+  lint
+    Check $VOLTPATH/lock.json for common problems and show suggested fixes
+
+  dedupe [-yes] [-dry-run]
+    Merge repositories in $VOLTPATH/lock.json whose paths are the same after normalization
+
+  search [-doc] {term}
+    Search repositories in $VOLTPATH/lock.json by path, description and doc files
+
   migrate
     Convert old version $VOLTPATH/lock.json structure into the latest version
 
@@ -90,7 +135,17 @@ Command
     Upgrade to the latest volt command, or if -check was given, it only checks the newer version is available
 
   version
-    Show volt command version` + "\n\n")
+    Show volt command version
+
+Environment variables
+  VOLT_DRY_RUN
+    If not empty, the commands which modify files run in dry-run mode and make no changes:
+    build, update, dedupe, clean, enable, disable and profile work as if -dry-run was given, and outdated as if -offline was given.
+    The other commands which modify files (e.g. get, rm) refuse to run
+
+  VOLT_HOME
+    The vim directory where volt installs plugins (~/.vim/pack/volt) and vimrc.
+    ~/.vim (~/vimfiles on Windows) by default. Vim must load it (e.g. add it to 'packpath')` + "\n\n")
 		//cmd.helped = true
 	}
 	return fs
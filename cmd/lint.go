@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/vim-volt/volt/gitutil"
+	"github.com/vim-volt/volt/lockjson"
+	"github.com/vim-volt/volt/logger"
+	"github.com/vim-volt/volt/pathutil"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+func init() {
+	cmdMap["lint"] = &lintCmd{}
+}
+
+type lintCmd struct {
+	helped bool
+}
+
+func (cmd *lintCmd) FlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.SetOutput(os.Stdout)
+	fs.Usage = func() {
+		fmt.Print(`
+Usage
+  volt lint [-help]
+
+Quick example
+  $ volt lint # will check $VOLTPATH/lock.json for common problems
+
+Description
+  Check $VOLTPATH/lock.json for the problems which are not detected by the validation of lock.json, and show them with suggested fixes.
+  Errors (volt build will fail):
+  * The repository directory does not exist under $VOLTPATH/repos
+  * The version of git repository is not a full commit hash, or not a commit of the repository
+  * The subdir of the repository does not exist
+  Warnings:
+  * The repository path is not the form of "{site}/{user}/{name}" which 'volt get' writes
+  * The repository is not in any profile
+  * The profile has no repositories
+  This command exits with 1 if any error was found, otherwise exits with 0.` + "\n\n")
+		//fmt.Println("Options")
+		//fs.PrintDefaults()
+		fmt.Println()
+		cmd.helped = true
+	}
+	return fs
+}
+
+func (cmd *lintCmd) Run(args []string) int {
+	err := cmd.parseArgs(args)
+	if err == ErrShowedHelp {
+		return 0
+	}
+	if err != nil {
+		logger.Error("Failed to parse args: " + err.Error())
+		return 10
+	}
+
+	lockJSON, err := lockjson.Read()
+	if err != nil {
+		logger.Error("Failed to read lock.json: " + err.Error())
+		return 11
+	}
+
+	problems := cmd.lint(lockJSON)
+	numErrors := 0
+	for _, p := range problems {
+		if p.isError {
+			numErrors++
+			logger.Error(p.message)
+			logger.Error("  " + p.suggestion)
+		} else {
+			logger.Warn(p.message)
+			logger.Warn("  " + p.suggestion)
+		}
+	}
+	if len(problems) == 0 {
+		logger.Info("No problems were found in lock.json")
+		return 0
+	}
+	logger.Infof("Found %d errors and %d warnings in lock.json", numErrors, len(problems)-numErrors)
+	if numErrors > 0 {
+		return 1
+	}
+	return 0
+}
+
+func (cmd *lintCmd) parseArgs(args []string) error {
+	fs := cmd.FlagSet()
+	fs.Parse(args)
+	if cmd.helped {
+		return ErrShowedHelp
+	}
+	return nil
+}
+
+type lintProblem struct {
+	isError    bool
+	message    string
+	suggestion string
+}
+
+var rxCommitHash = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// Returns the problems of repos[] and profiles[] in the order of lock.json
+func (cmd *lintCmd) lint(lockJSON *lockjson.LockJSON) []lintProblem {
+	problems := make([]lintProblem, 0, 8)
+	for i := range lockJSON.Repos {
+		problems = append(problems, cmd.lintRepos(lockJSON, &lockJSON.Repos[i])...)
+	}
+	for i := range lockJSON.Profiles {
+		profile := &lockJSON.Profiles[i]
+		if len(profile.ReposPath) > 0 {
+			continue
+		}
+		suggestion := "Run 'volt profile destroy " + profile.Name + "' if the profile is not used."
+		if profile.Name == lockJSON.CurrentProfileName {
+			suggestion = "Run 'volt enable {repository}' to add repositories to the profile."
+		}
+		problems = append(problems, lintProblem{
+			message:    "profile '" + profile.Name + "' has no repositories",
+			suggestion: suggestion,
+		})
+	}
+	return problems
+}
+
+func (cmd *lintCmd) lintRepos(lockJSON *lockjson.LockJSON, repos *lockjson.Repos) []lintProblem {
+	problems := make([]lintProblem, 0, 2)
+	if normalized, err := pathutil.NormalizeRepos(repos.Path.String()); err == nil && normalized != repos.Path {
+		suggestion := "Run 'volt rm " + repos.Path.String() + "' and 'volt get " + normalized.String() + "' to install it again."
+		if lockJSON.Repos.Contains(normalized) {
+			suggestion = "Run 'volt dedupe' to merge it into '" + normalized.String() + "'."
+		}
+		problems = append(problems, lintProblem{
+			message:    "repository path '" + repos.Path.String() + "' is not normalized",
+			suggestion: suggestion,
+		})
+	}
+	if len(lockJSON.Profiles.ProfilesContaining(repos.Path)) == 0 {
+		problems = append(problems, lintProblem{
+			message:    "repository '" + repos.Path.String() + "' is not in any profile",
+			suggestion: "Run 'volt rm " + repos.Path.String() + "' if the repository is not used.",
+		})
+	}
+	if p := cmd.checkSource(repos); p != nil {
+		problems = append(problems, *p)
+	}
+	return problems
+}
+
+// Returns the problem if the repository cannot be installed by 'volt build'
+func (cmd *lintCmd) checkSource(repos *lockjson.Repos) *lintProblem {
+	src := repos.ReposDir()
+	if !pathutil.Exists(src) {
+		return &lintProblem{
+			isError:    true,
+			message:    "repository '" + repos.Path.String() + "' does not exist: " + src,
+			suggestion: "Run 'volt get " + repos.Path.String() + "' to install it, or 'volt rm " + repos.Path.String() + "' to remove it from lock.json.",
+		}
+	}
+	if repos.Type != lockjson.ReposGitType {
+		return cmd.checkSubdir(repos, pathutil.Exists(repos.SourceDir()))
+	}
+
+	tree, err := cmd.resolveTree(src, repos.Version)
+	if err != nil && !rxCommitHash.MatchString(repos.Version) {
+		return &lintProblem{
+			isError:    true,
+			message:    "version '" + repos.Version + "' of repository '" + repos.Path.String() + "' is neither a full commit hash nor a tag or branch",
+			suggestion: "Run 'volt get -l' to update locked revision.",
+		}
+	}
+	if err != nil {
+		return &lintProblem{
+			isError:    true,
+			message:    "version '" + repos.Version + "' of repository '" + repos.Path.String() + "' is not resolvable: " + err.Error(),
+			suggestion: "Run 'volt get -l' to update locked revision.",
+		}
+	}
+	if repos.Subdir == "" {
+		return nil
+	}
+	_, err = tree.Tree(repos.Subdir)
+	return cmd.checkSubdir(repos, err == nil)
+}
+
+func (*lintCmd) checkSubdir(repos *lockjson.Repos, exists bool) *lintProblem {
+	if repos.Subdir == "" || exists {
+		return nil
+	}
+	return &lintProblem{
+		isError:    true,
+		message:    "subdir '" + repos.Subdir + "' of repository '" + repos.Path.String() + "' does not exist",
+		suggestion: "Fix or remove \"subdir\" of the repository in lock.json.",
+	}
+}
+
+// Returns the tree object of version (a commit hash, tag or branch)
+func (*lintCmd) resolveTree(src, version string) (*object.Tree, error) {
+	r, err := git.PlainOpen(src)
+	if err != nil {
+		return nil, errors.New("failed to open repository: " + err.Error())
+	}
+	hash, err := gitutil.ResolveVersion(r, version)
+	if err != nil {
+		return nil, err
+	}
+	commit, err := r.CommitObject(plumbing.NewHash(hash))
+	if err != nil {
+		return nil, err
+	}
+	return commit.Tree()
+}
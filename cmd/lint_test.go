@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vim-volt/volt/internal/testutil"
+	"github.com/vim-volt/volt/pathutil"
+)
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) Shows errors with suggested fixes
+// (b) Shows warnings with suggested fixes
+// (c) Shows the number of errors and warnings
+//
+// * Run `volt lint` with lock.json which has several problems (!A, !B, a, b, c)
+// * Run `volt lint` with lock.json which has no problems (A, B)
+func TestVoltLint(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	version := setUpLocalGitRepos(t, "localhost/local/git")
+	setUpLocalGitRepos(t, "localhost/local/short")
+	setUpLocalGitRepos(t, "localhost/local/unknown")
+	for _, name := range []string{"hello", "unused", "sub.git"} {
+		path := filepath.Join(pathutil.FullReposPath(pathutil.ReposPath("localhost/local/"+name)), "plugin", "hello.vim")
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte("\" hello\n"), 0644); err != nil {
+			t.Fatal("failed to write " + path)
+		}
+	}
+	writeLockJSON(t, `{
+  "version": 3,
+  "current_profile_name": "default",
+  "repos": [
+    {"type": "static", "path": "localhost/local/hello"},
+    {"type": "static", "path": "localhost/local/missing"},
+    {"type": "static", "path": "localhost/local/unused"},
+    {"type": "static", "path": "localhost/local/sub.git", "subdir": "none"},
+    {"type": "git", "path": "localhost/local/git", "version": "`+version.String()+`"},
+    {"type": "git", "path": "localhost/local/short", "version": "0123abc"},
+    {"type": "git", "path": "localhost/local/unknown", "version": "0123456789012345678901234567890123456789"}
+  ],
+  "profiles": [
+    {
+      "name": "default",
+      "repos_path": [
+        "localhost/local/hello",
+        "localhost/local/missing",
+        "localhost/local/sub.git",
+        "localhost/local/git",
+        "localhost/local/short",
+        "localhost/local/unknown"
+      ]
+    },
+    {"name": "empty", "repos_path": []}
+  ]
+}`)
+
+	// =============== run =============== //
+
+	out, err := testutil.RunVolt("lint")
+	// (!A, !B)
+	testutil.FailExit(t, out, err)
+	for _, expected := range []string{
+		// (a)
+		"[ERROR] repository 'localhost/local/missing' does not exist: ",
+		"[ERROR]   Run 'volt get localhost/local/missing' to install it, or 'volt rm localhost/local/missing' to remove it from lock.json.",
+		"[ERROR] subdir 'none' of repository 'localhost/local/sub.git' does not exist",
+		"[ERROR] version '0123abc' of repository 'localhost/local/short' is neither a full commit hash nor a tag or branch",
+		"[ERROR]   Run 'volt get -l' to update locked revision.",
+		"[ERROR] version '0123456789012345678901234567890123456789' of repository 'localhost/local/unknown' is not resolvable: ",
+		// (b)
+		"[WARN] repository path 'localhost/local/sub.git' is not normalized",
+		"[WARN]   Run 'volt rm localhost/local/sub.git' and 'volt get localhost/local/sub' to install it again.",
+		"[WARN] repository 'localhost/local/unused' is not in any profile",
+		"[WARN] profile 'empty' has no repositories",
+		"[WARN]   Run 'volt profile destroy empty' if the profile is not used.",
+		// (c)
+		"[INFO] Found 4 errors and 3 warnings in lock.json",
+	} {
+		if !strings.Contains(string(out), expected) {
+			t.Errorf("expected %q but got: %s", expected, string(out))
+		}
+	}
+	if strings.Contains(string(out), "localhost/local/git'") || strings.Contains(string(out), "'localhost/local/hello'") {
+		t.Errorf("expected no problems of valid repositories but got: %s", string(out))
+	}
+
+	writeLockJSON(t, `{
+  "version": 3,
+  "current_profile_name": "default",
+  "repos": [
+    {"type": "static", "path": "localhost/local/hello"},
+    {"type": "git", "path": "localhost/local/git", "version": "`+version.String()+`"}
+  ],
+  "profiles": [
+    {"name": "default", "repos_path": ["localhost/local/hello", "localhost/local/git"]}
+  ]
+}`)
+	out, err = testutil.RunVolt("lint")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+}
+
+func writeLockJSON(t *testing.T, content string) {
+	t.Helper()
+	if err := ioutil.WriteFile(pathutil.LockJSON(), []byte(content), 0644); err != nil {
+		t.Fatal("failed to write lock.json: " + err.Error())
+	}
+}
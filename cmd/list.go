@@ -8,8 +8,10 @@ import (
 	"os"
 	"text/template"
 
+	"github.com/vim-volt/volt/cmd/buildinfo"
 	"github.com/vim-volt/volt/lockjson"
 	"github.com/vim-volt/volt/logger"
+	"github.com/vim-volt/volt/pathutil"
 )
 
 func init() {
@@ -19,6 +21,7 @@ func init() {
 type listCmd struct {
 	helped bool
 	format string
+	long   bool
 }
 
 func (cmd *listCmd) FlagSet() *flag.FlagSet {
@@ -27,10 +30,11 @@ func (cmd *listCmd) FlagSet() *flag.FlagSet {
 	fs.Usage = func() {
 		fmt.Print(`
 Usage
-  volt list [-help] [-f {text/template string}]
+  volt list [-help] [-long] [-f {text/template string}]
 
 Quick example
   $ volt list # will list installed plugins
+  $ volt list -long # will list installed plugins with their type, version and description
 
   Show all installed repositories:
 
@@ -53,9 +57,17 @@ Template functions
   currentProfile (Profile (see "Structures"))
     Returns current profile
 
-  currentProfile (Profile (see "Structures"))
+  profile name (Profile (see "Structures"))
     Returns given name's profile
 
+  repos path (Repos (see "Structures"))
+    Returns given path's repository
+
+  commitSubject repos (string)
+    Returns the first line of the commit message of the installed revision
+    of given repository (recorded in $VOLTPATH/build-info.json by "volt build").
+    Returns empty string if the repository is static, or the locked revision is not installed yet
+
   version (string)
     Returns volt version string. format is "v{major}.{minor}.{patch}" (e.g. "v0.3.0")
 
@@ -89,6 +101,35 @@ Structures
 
         // Git commit hash. if "type" is "static" this property does not exist
         "version": <string>,
+
+        // Why the repository was added (optional, written by user).
+        // "volt list -long" shows this
+        "description": <string>,
+
+        // Subdirectory of the repository which is installed as the plugin
+        // root like "editors/vim" (optional, written by user).
+        // The whole repository is installed if this property does not exist
+        "subdir": <string>,
+
+        // Symlinks and directories which "volt build" creates after
+        // installing the repository (optional, written by user).
+        // "path" must be under the home directory like "~/.cache/plugin".
+        // "path" links to "target" (relative to the installed directory)
+        // if "target" exists, otherwise "path" is created as a directory
+        "post_install": [
+          { "path": <string>, "target": <string> },
+        ],
+
+        // Expected hash of the tree object of "version" (optional, written
+        // by user, like "git rev-parse {version}^{tree}").
+        // "volt build" (copy strategy) refuses to install the repository
+        // if the tree hash of "version" differs.
+        // "volt get" updates this when it updates "version"
+        "tree_hash": <string>,
+
+        // If true, "volt update" does not update "version" (optional,
+        // written by "volt update -pin")
+        "pinned": <bool>,
       },
     ],
 
@@ -99,19 +140,25 @@ Structures
 
       // Repositories ("volt list" shows these repositories)
       "repos_path": [ <string> ],
+
+      // If false, "volt build" does not generate doc/tags of the
+      // repositories on this profile (optional, true by default)
+      "generate_helptags": <bool>,
     ]
   }
 
 Description
   Vim plugin information extractor.
   If -f flag is not given, this command shows vim plugins of **current profile** (not all installed plugins) by default.
-  If -f flag is given, it renders by given template which can access the information of lock.json .` + "\n\n")
-		//fmt.Println("Options")
-		//fs.PrintDefaults()
+  If -f flag is given, it renders by given template which can access the information of lock.json .
+  If -long flag is given, it also shows type, version, the commit subject of the installed version, subdir and description of each repository. -long and -f flags cannot be given together.` + "\n\n")
+		fmt.Println("Options")
+		fs.PrintDefaults()
 		fmt.Println()
 		cmd.helped = true
 	}
 	fs.StringVar(&cmd.format, "f", cmd.defaultTemplate(), "text/template format string")
+	fs.BoolVar(&cmd.long, "long", false, "show type, version and description of repositories")
 	return fs
 }
 
@@ -124,13 +171,51 @@ repos path:
 `
 }
 
+func (*listCmd) longTemplate() string {
+	return `name: {{ .CurrentProfileName }}
+repos path:
+{{- range currentProfile.ReposPath }}
+  {{ . }}
+{{- with repos . }}
+    type: {{ .Type }}
+{{- if .Version }}
+    version: {{ .Version }}
+{{- end }}
+{{- with commitSubject . }}
+    commit: {{ . }}
+{{- end }}
+{{- if .Subdir }}
+    subdir: {{ .Subdir }}
+{{- end }}
+{{- if .Description }}
+    description: {{ .Description }}
+{{- end }}
+{{- end }}
+{{- end }}
+`
+}
+
 func (cmd *listCmd) Run(args []string) int {
 	fs := cmd.FlagSet()
 	fs.Parse(args)
 	if cmd.helped {
 		return 0
 	}
-	if err := cmd.list(cmd.format); err != nil {
+	format := cmd.format
+	if cmd.long {
+		formatGiven := false
+		fs.Visit(func(f *flag.Flag) {
+			if f.Name == "f" {
+				formatGiven = true
+			}
+		})
+		if formatGiven {
+			logger.Error("Failed to parse args: -long and -f flags cannot be given together")
+			return 10
+		}
+		format = cmd.longTemplate()
+	}
+	if err := cmd.list(format); err != nil {
 		logger.Error("Failed to render template:", err.Error())
 		return 10
 	}
@@ -143,8 +228,13 @@ func (cmd *listCmd) list(format string) error {
 	if err != nil {
 		return errors.New("failed to read lock.json: " + err.Error())
 	}
+	// Read build-info.json (commitSubject returns empty string if it failed)
+	buildInfo, err := buildinfo.Read()
+	if err != nil {
+		buildInfo = &buildinfo.BuildInfo{}
+	}
 	// Parse template string
-	t, err := template.New("volt").Funcs(cmd.funcMap(lockJSON)).Parse(format)
+	t, err := template.New("volt").Funcs(cmd.funcMap(lockJSON, buildInfo)).Parse(format)
 	if err != nil {
 		return err
 	}
@@ -152,7 +242,7 @@ func (cmd *listCmd) list(format string) error {
 	return t.Execute(os.Stdout, lockJSON)
 }
 
-func (*listCmd) funcMap(lockJSON *lockjson.LockJSON) template.FuncMap {
+func (*listCmd) funcMap(lockJSON *lockjson.LockJSON, buildInfo *buildinfo.BuildInfo) template.FuncMap {
 	profileOf := func(name string) *lockjson.Profile {
 		profile, err := lockJSON.Profiles.FindByName(name)
 		if err != nil {
@@ -178,6 +268,24 @@ func (*listCmd) funcMap(lockJSON *lockjson.LockJSON) template.FuncMap {
 			return profileOf(lockJSON.CurrentProfileName)
 		},
 		"profile": profileOf,
+		"repos": func(path pathutil.ReposPath) *lockjson.Repos {
+			repos, err := lockJSON.Repos.FindByPath(path)
+			if err != nil {
+				return nil
+			}
+			return repos
+		},
+		"commitSubject": func(repos *lockjson.Repos) string {
+			if repos == nil {
+				return ""
+			}
+			r := buildInfo.Repos.FindByReposPath(repos.Path)
+			// The subject of other revision is not shown
+			if r == nil || r.Version != repos.Version {
+				return ""
+			}
+			return r.CommitSubject
+		},
 		"version": func() string {
 			return voltVersion
 		},
@@ -2,10 +2,13 @@ package cmd
 
 import (
 	"strconv"
+	"strings"
 	"testing"
 
+	"github.com/vim-volt/volt/cmd/buildinfo"
 	"github.com/vim-volt/volt/internal/testutil"
 	"github.com/vim-volt/volt/lockjson"
+	"github.com/vim-volt/volt/pathutil"
 )
 
 // Checks:
@@ -165,3 +168,143 @@ func TestVoltListFunctions(t *testing.T) {
 		}
 	})
 }
+
+// Checks:
+// (a) description is kept after lock.json is written
+// (b) `volt list -long` shows description of the repository
+// (c) `volt list -long` does not show description line of the repository without description
+// (d) `volt list -long -f ...` fails
+func TestVoltListLongDescription(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	described := pathutil.ReposPath("localhost/local/described")
+	other := pathutil.ReposPath("localhost/local/other")
+
+	lockJSON, err := lockjson.Read()
+	if err != nil {
+		t.Fatal("failed to read lock.json: " + err.Error())
+	}
+	lockJSON.Repos = append(lockJSON.Repos,
+		lockjson.Repos{Type: lockjson.ReposStaticType, Path: described, Description: "comment out lines"},
+		lockjson.Repos{Type: lockjson.ReposStaticType, Path: other},
+	)
+	profile, err := lockJSON.Profiles.FindByName(lockJSON.CurrentProfileName)
+	if err != nil {
+		t.Fatal("failed to find current profile: " + err.Error())
+	}
+	profile.ReposPath = append(profile.ReposPath, described, other)
+	if err := lockJSON.Write(); err != nil {
+		t.Fatal("failed to write lock.json: " + err.Error())
+	}
+
+	// =============== run =============== //
+
+	// lock.json is read and written
+	out, err := testutil.RunVolt("profile", "new", "another")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+
+	// (a)
+	lockJSON, err = lockjson.Read()
+	if err != nil {
+		t.Fatal("failed to read lock.json: " + err.Error())
+	}
+	repos, err := lockJSON.Repos.FindByPath(described)
+	if err != nil {
+		t.Fatal("repository was removed from lock.json: " + err.Error())
+	}
+	if repos.Description != "comment out lines" {
+		t.Errorf("expected description %q but got %q", "comment out lines", repos.Description)
+	}
+
+	out, err = testutil.RunVolt("list", "-long")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	// (b)
+	expected := "  " + described.String() + "\n    type: static\n    description: comment out lines\n"
+	if !strings.Contains(string(out), expected) {
+		t.Errorf("expected %q in output but got:\n%s", expected, string(out))
+	}
+	// (c)
+	expected = "  " + other.String() + "\n    type: static\n"
+	if !strings.HasSuffix(string(out), expected) {
+		t.Errorf("expected output ends with %q but got:\n%s", expected, string(out))
+	}
+
+	out, err = testutil.RunVolt("list", "-long", "-f", "{{ version }}")
+	// (d)
+	testutil.FailExit(t, out, err)
+}
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) build-info.json has the commit subject of the installed revision
+// (b) `volt list -long` shows the commit subject of the installed revision
+// (c) `volt list -long` does not show the commit subject if the locked revision is not installed
+//
+// * Run `volt build` and `volt list -long` (A, B, a, b)
+// * Change the locked revision and run `volt list -long` (A, B, c)
+func TestVoltListLongCommitSubject(t *testing.T) {
+	for _, strategy := range testutil.AvailableStrategies() {
+		t.Run("strategy="+strategy, func(t *testing.T) {
+			// =============== setup =============== //
+
+			testutil.SetUpEnv(t)
+			testutil.InstallConfig(t, "strategy-"+strategy+".toml")
+			reposPath := pathutil.ReposPath("localhost/local/subject")
+			// Locks the second commit "hello world"
+			first := setUpLocalGitRepos(t, reposPath)
+
+			// =============== run =============== //
+
+			out, err := testutil.RunVolt("build")
+			// (A, B)
+			testutil.SuccessExit(t, out, err)
+
+			// (a)
+			buildInfo, err := buildinfo.Read()
+			if err != nil {
+				t.Fatal("buildinfo.Read() failed: " + err.Error())
+			}
+			buildRepos := buildInfo.Repos.FindByReposPath(reposPath)
+			if buildRepos == nil {
+				t.Fatal("repository was not found in build-info.json")
+			}
+			if buildRepos.CommitSubject != "hello world" {
+				t.Errorf("expected commit subject %q but got %q", "hello world", buildRepos.CommitSubject)
+			}
+
+			out, err = testutil.RunVolt("list", "-long")
+			// (A, B)
+			testutil.SuccessExit(t, out, err)
+			// (b)
+			expected := "    version: " + buildRepos.Version + "\n    commit: hello world\n"
+			if !strings.Contains(string(out), expected) {
+				t.Errorf("expected %q in output but got:\n%s", expected, string(out))
+			}
+
+			lockJSON, err := lockjson.Read()
+			if err != nil {
+				t.Fatal("failed to read lock.json: " + err.Error())
+			}
+			repos, err := lockJSON.Repos.FindByPath(reposPath)
+			if err != nil {
+				t.Fatal("failed to find repository: " + err.Error())
+			}
+			repos.Version = first.String()
+			if err := lockJSON.Write(); err != nil {
+				t.Fatal("failed to write lock.json: " + err.Error())
+			}
+
+			out, err = testutil.RunVolt("list", "-long")
+			// (A, B)
+			testutil.SuccessExit(t, out, err)
+			// (c)
+			if strings.Contains(string(out), "commit:") {
+				t.Errorf("expected commit subject is not shown but got:\n%s", string(out))
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vim-volt/volt/cmd/buildinfo"
+	"github.com/vim-volt/volt/config"
+	"github.com/vim-volt/volt/internal/testutil"
+	"github.com/vim-volt/volt/lockjson"
+	"github.com/vim-volt/volt/pathutil"
+)
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) lock.json v2 is migrated to the latest version
+// (b) "default_build" is not set
+// (c) "build.strategy" of config.toml changed after the migration is used
+//
+// * Run `volt migrate` (A, B, a, b)
+// * Run `volt build` after changing "build.strategy" of config.toml (A, B, c)
+func TestVoltMigrateDefaultBuild(t *testing.T) {
+	for _, strategy := range testutil.AvailableStrategies() {
+		t.Run("strategy="+strategy, func(t *testing.T) {
+			// =============== setup =============== //
+
+			testutil.SetUpEnv(t)
+			testutil.InstallConfig(t, "strategy-"+strategy+".toml")
+			lockfile := pathutil.LockJSON()
+			os.MkdirAll(filepath.Dir(lockfile), 0755)
+			content := `{
+  "version": 2,
+  "current_profile_name": "default",
+  "repos": [],
+  "profiles": [{"name": "default", "repos_path": []}]
+}`
+			if err := ioutil.WriteFile(lockfile, []byte(content), 0644); err != nil {
+				t.Fatal("failed to write " + lockfile)
+			}
+
+			// =============== run =============== //
+
+			out, err := testutil.RunVolt("migrate")
+			// (A, B)
+			testutil.SuccessExit(t, out, err)
+
+			lockJSON, err := lockjson.ReadNoMigrationMsg()
+			if err != nil {
+				t.Fatal("lockjson.Read() failed: " + err.Error())
+			}
+			// (a)
+			if lockJSON.Version != 3 {
+				t.Errorf("expected version 3 but got %d", lockJSON.Version)
+			}
+			// (b)
+			if lockJSON.DefaultBuild != "" {
+				t.Errorf("expected default_build is not set but got %q", lockJSON.DefaultBuild)
+			}
+
+			other := config.CopyBuilder
+			if strategy == config.CopyBuilder {
+				other = config.SymlinkBuilder
+			}
+			testutil.InstallConfig(t, "strategy-"+other+".toml")
+			out, err = testutil.RunVolt("build")
+			// (A, B)
+			testutil.SuccessExit(t, out, err)
+			// (c)
+			buildInfo, err := buildinfo.Read()
+			if err != nil {
+				t.Fatal("buildinfo.Read() failed: " + err.Error())
+			}
+			if buildInfo.Strategy != other {
+				t.Errorf("expected strategy %q but got %q", other, buildInfo.Strategy)
+			}
+		})
+	}
+}
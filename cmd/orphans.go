@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vim-volt/volt/lockjson"
+	"github.com/vim-volt/volt/logger"
+	"github.com/vim-volt/volt/pathutil"
+)
+
+func init() {
+	cmdMap["orphans"] = &orphansCmd{}
+}
+
+type orphansCmd struct {
+	helped bool
+}
+
+func (cmd *orphansCmd) FlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.SetOutput(os.Stdout)
+	fs.Usage = func() {
+		fmt.Print(`
+Usage
+  volt orphans [-help]
+
+Quick example
+  $ volt orphans # will list repositories which are not used by any profile
+
+Description
+  List repositories under $VOLTPATH/repos which are not used by any profile, with their disk usage (in bytes), sorted in descending order.
+  Each line shows the reason:
+  * "not in any profile": the repository is in lock.json but no profile has it.
+    It can be removed by 'volt rm {repository}'.
+  * "not in lock.json": the directory is not managed by volt.
+    It can be removed by deleting the directory manually.
+  This command does not remove any repository.` + "\n\n")
+		//fmt.Println("Options")
+		//fs.PrintDefaults()
+		fmt.Println()
+		cmd.helped = true
+	}
+	return fs
+}
+
+func (cmd *orphansCmd) Run(args []string) int {
+	err := cmd.parseArgs(args)
+	if err == ErrShowedHelp {
+		return 0
+	}
+	if err != nil {
+		logger.Error("Failed to parse args: " + err.Error())
+		return 10
+	}
+
+	orphans, err := cmd.getOrphans()
+	if err != nil {
+		logger.Error("Failed to get orphaned repositories: " + err.Error())
+		return 11
+	}
+
+	for _, o := range orphans {
+		fmt.Printf("%d\t%s\t(%s)\n", o.size, o.reposPath, o.reason)
+	}
+	return 0
+}
+
+func (cmd *orphansCmd) parseArgs(args []string) error {
+	fs := cmd.FlagSet()
+	fs.Parse(args)
+	if cmd.helped {
+		return ErrShowedHelp
+	}
+	return nil
+}
+
+type orphanRepos struct {
+	reposPath pathutil.ReposPath
+	size      int64
+	reason    string
+}
+
+// Returns repositories under $VOLTPATH/repos which are not used by any profile
+// (sorted by size in descending order)
+func (cmd *orphansCmd) getOrphans() ([]orphanRepos, error) {
+	lockJSON, err := lockjson.Read()
+	if err != nil {
+		return nil, errors.New("could not read lock.json: " + err.Error())
+	}
+
+	usage, err := (&duCmd{}).getReposUsage("repos", filepath.Join(pathutil.VoltPath(), "repos"))
+	if err != nil {
+		return nil, err
+	}
+
+	orphans := make([]orphanRepos, 0, len(usage.repos))
+	for _, r := range usage.repos {
+		// Skip files which are not in "{site}/{user}/{name}" directory
+		if strings.Count(r.name, "/") != 2 {
+			continue
+		}
+		reposPath := pathutil.ReposPath(r.name)
+		if !lockJSON.Repos.Contains(reposPath) {
+			orphans = append(orphans, orphanRepos{reposPath, r.size, "not in lock.json"})
+		} else if len(lockJSON.Profiles.ProfilesContaining(reposPath)) == 0 {
+			orphans = append(orphans, orphanRepos{reposPath, r.size, "not in any profile"})
+		}
+	}
+	return orphans, nil
+}
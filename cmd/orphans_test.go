@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vim-volt/volt/config"
+	"github.com/vim-volt/volt/internal/testutil"
+	"github.com/vim-volt/volt/lockjson"
+	"github.com/vim-volt/volt/pathutil"
+)
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) Repositories used by a profile are not listed
+// (b) Repositories not in any profile are listed
+// (c) Directories not in lock.json are listed
+//
+// * Run `volt orphans` (A, B, a, c)
+// * Run `volt orphans` after `volt disable <repos>` (A, B, b, c)
+func TestVoltOrphans(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	hello := pathutil.ReposPath("localhost/local/hello")
+	teardown := testutil.SetUpRepos(t, "hello", lockjson.ReposStaticType, []pathutil.ReposPath{hello}, config.SymlinkBuilder)
+	defer teardown()
+
+	unmanaged := filepath.Join(pathutil.FullReposPath("github.com/foo/bar.vim"), "plugin", "bar.vim")
+	os.MkdirAll(filepath.Dir(unmanaged), 0755)
+	if err := ioutil.WriteFile(unmanaged, []byte(strings.Repeat("x", 10000)), 0644); err != nil {
+		t.Fatal("failed to write " + unmanaged)
+	}
+	fi, err := os.Stat(filepath.Join(pathutil.FullReposPath(hello), "plugin", "hello.vim"))
+	if err != nil {
+		t.Fatal("failed to stat hello.vim: " + err.Error())
+	}
+
+	// =============== run =============== //
+
+	out, err := testutil.RunVolt("orphans")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	// (a, c)
+	expected := "10000\tgithub.com/foo/bar.vim\t(not in lock.json)\n"
+	if string(out) != expected {
+		t.Errorf("expected %q but got %q", expected, string(out))
+	}
+
+	out, err = testutil.RunVolt("disable", hello.String())
+	testutil.SuccessExit(t, out, err)
+
+	out, err = testutil.RunVolt("orphans")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	// (b, c)
+	expected += fmt.Sprintf("%d\t%s\t(not in any profile)\n", fi.Size(), hello)
+	if string(out) != expected {
+		t.Errorf("expected %q but got %q", expected, string(out))
+	}
+}
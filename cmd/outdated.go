@@ -0,0 +1,251 @@
+package cmd
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/vim-volt/volt/config"
+	"github.com/vim-volt/volt/gitutil"
+	"github.com/vim-volt/volt/lockjson"
+	"github.com/vim-volt/volt/logger"
+	"github.com/vim-volt/volt/pathutil"
+	"github.com/vim-volt/volt/transaction"
+	"gopkg.in/src-d/go-git.v4"
+)
+
+func init() {
+	cmdMap["outdated"] = &outdatedCmd{}
+}
+
+type outdatedCmd struct {
+	helped  bool
+	offline bool
+}
+
+// Fetching writes to repositories, so dry-run does not fetch
+func (cmd *outdatedCmd) setDryRun() {
+	cmd.offline = true
+}
+
+func (cmd *outdatedCmd) FlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.SetOutput(os.Stdout)
+	fs.Usage = func() {
+		fmt.Print(`
+Usage
+  volt outdated [-help] [-offline] [{repository} ...]
+
+Quick example
+  $ volt outdated                        # fetches and lists git repositories which have newer commits than locked revision
+  $ volt outdated -offline               # same as above, but does not fetch
+  $ volt outdated tyru/caw.vim           # checks only tyru/caw.vim
+
+Description
+  List git repositories in $VOLTPATH/lock.json (or given {repository} list) whose tracked branch has newer commits than the locked revision ("version" of lock.json), with the number of the commits and the revisions. Up-to-date repositories are not shown.
+  The tracked branch is the upstream branch of current branch (e.g. "origin/master") of $VOLTPATH/repos/{repository}. If it has no upstream branch, current branch is used. If HEAD is detached, the default branch (which "origin/HEAD" points to, or "main" or "master") is used instead of current branch.
+
+  This command fetches the upstream remote of each repository first, which updates only remote-tracking branches (e.g. "origin/master"). lock.json, the worktree of repositories and ~/.vim/pack/volt are not changed. Run 'volt get -u {repository}' to update them.
+  If -offline option was given, the remote-tracking branches which were already fetched are used without network access.` + "\n\n")
+		fmt.Println("Options")
+		fs.PrintDefaults()
+		fmt.Println()
+		cmd.helped = true
+	}
+	fs.BoolVar(&cmd.offline, "offline", cmd.offline, "use only already fetched refs (does not fetch)")
+	return fs
+}
+
+func (cmd *outdatedCmd) Run(args []string) int {
+	args, err := cmd.parseArgs(args)
+	if err == ErrShowedHelp {
+		return 0
+	}
+	if err != nil {
+		logger.Error("Failed to parse args: " + err.Error())
+		return 10
+	}
+
+	// Read lock.json
+	lockJSON, err := lockjson.Read()
+	if err != nil {
+		logger.Error("Could not read lock.json: " + err.Error())
+		return 11
+	}
+
+	reposList, err := cmd.getReposList(args, lockJSON)
+	if err != nil {
+		logger.Error("Could not get repos list: " + err.Error())
+		return 12
+	}
+
+	// Fetching writes to repositories
+	if !cmd.offline {
+		err = transaction.Create()
+		if err != nil {
+			logger.Error("Failed to begin transaction: " + err.Error())
+			return 13
+		}
+		defer transaction.Remove()
+	}
+
+	outdated, err := cmd.getOutdated(reposList)
+	for _, o := range outdated {
+		fmt.Printf("%s\t%s\n", o.reposPath, o.format())
+	}
+	if err != nil {
+		logger.Error(err.Error())
+		return 20
+	}
+	return 0
+}
+
+func (cmd *outdatedCmd) parseArgs(args []string) ([]string, error) {
+	fs := cmd.FlagSet()
+	fs.Parse(args)
+	if cmd.helped {
+		return nil, ErrShowedHelp
+	}
+	return fs.Args(), nil
+}
+
+// Returns git repositories of args, or all git repositories in lock.json
+// if args is empty
+func (cmd *outdatedCmd) getReposList(args []string, lockJSON *lockjson.LockJSON) ([]lockjson.Repos, error) {
+	if len(args) == 0 {
+		reposList := make([]lockjson.Repos, 0, len(lockJSON.Repos))
+		for _, repos := range lockJSON.Repos {
+			if repos.Type == lockjson.ReposGitType {
+				reposList = append(reposList, repos)
+			}
+		}
+		return reposList, nil
+	}
+	reposList := make([]lockjson.Repos, 0, len(args))
+	for _, arg := range args {
+		reposPath, err := pathutil.NormalizeRepos(arg)
+		if err != nil {
+			return nil, err
+		}
+		repos, err := lockJSON.Repos.FindByPath(reposPath)
+		if err != nil {
+			return nil, err
+		}
+		if repos.Type != lockjson.ReposGitType {
+			return nil, errors.New("'" + reposPath.String() + "' is not a git repository")
+		}
+		reposList = append(reposList, *repos)
+	}
+	return reposList, nil
+}
+
+type outdatedRepos struct {
+	reposPath pathutil.ReposPath
+	version   string
+	tip       string
+	behind    int
+	err       error
+}
+
+// Returns e.g. "3 commits behind ({version}..{tip})"
+func (o *outdatedRepos) format() string {
+	unit := "commits"
+	if o.behind == 1 {
+		unit = "commit"
+	}
+	return fmt.Sprintf("%d %s behind (%s..%s)", o.behind, unit, o.version, o.tip)
+}
+
+// Returns repositories whose tracked branch has newer commits than the
+// locked revision (sorted by repository path).
+// The repositories which could not be checked are shown as warnings, and
+// the error is returned after checking all repositories.
+func (cmd *outdatedCmd) getOutdated(reposList []lockjson.Repos) ([]outdatedRepos, error) {
+	var cfg *config.Config
+	if !cmd.offline {
+		var err error
+		cfg, err = config.Read()
+		if err != nil {
+			return nil, errors.New("could not read config.toml: " + err.Error())
+		}
+	}
+
+	done := make(chan outdatedRepos, len(reposList))
+	for i := range reposList {
+		go func(repos *lockjson.Repos) {
+			done <- cmd.checkRepos(repos, cfg)
+		}(&reposList[i])
+	}
+
+	outdated := make([]outdatedRepos, 0, len(reposList))
+	failed := false
+	for range reposList {
+		result := <-done
+		if result.err != nil {
+			logger.Warnf("%s: %s", result.reposPath, result.err.Error())
+			failed = true
+		} else if result.behind > 0 {
+			outdated = append(outdated, result)
+		}
+	}
+	sort.Slice(outdated, func(i, j int) bool {
+		return outdated[i].reposPath < outdated[j].reposPath
+	})
+	if failed {
+		return outdated, errors.New("could not check some repositories")
+	}
+	return outdated, nil
+}
+
+// Fetches the repository unless cfg is nil, and counts the commits of the
+// tracked branch which are newer than the locked revision
+func (cmd *outdatedCmd) checkRepos(repos *lockjson.Repos, cfg *config.Config) outdatedRepos {
+	result := outdatedRepos{reposPath: repos.Path, version: repos.Version}
+	fullpath := pathutil.FullReposPath(repos.Path)
+	r, err := git.PlainOpen(fullpath)
+	if err != nil {
+		result.err = errors.New("failed to open repository: " + err.Error())
+		return result
+	}
+
+	if cfg != nil {
+		// The repository which has no upstream remote is not fetched
+		remote, _, err := gitutil.GetTrackedBranch(r)
+		if err != nil {
+			result.err = err
+			return result
+		}
+		if remote != "" {
+			logger.Debug("Fetching " + repos.Path + " ...")
+			err = (&getCmd{}).gitFetch(r, fullpath, remote, cfg)
+			if err != nil && err != git.NoErrAlreadyUpToDate {
+				result.err = errors.New("failed to fetch: " + err.Error())
+				return result
+			}
+		} else {
+			logger.Debugf("Skip fetching %s: no upstream remote", repos.Path)
+		}
+	}
+
+	result.tip, err = gitutil.GetUpstreamHEAD(r)
+	if err != nil {
+		result.err = errors.New("failed to get the tracked branch: " + err.Error())
+		return result
+	}
+	// "version" may be a tag or branch
+	version, err := gitutil.ResolveVersion(r, repos.Version)
+	if err != nil {
+		result.err = err
+		return result
+	}
+	if result.tip == version {
+		return result
+	}
+	result.behind, err = gitutil.CountNewCommits(r, version, result.tip)
+	if err != nil {
+		result.err = errors.New("failed to count commits: " + err.Error())
+	}
+	return result
+}
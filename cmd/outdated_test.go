@@ -0,0 +1,233 @@
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/vim-volt/volt/gitutil"
+	"github.com/vim-volt/volt/internal/testutil"
+	"github.com/vim-volt/volt/lockjson"
+	"github.com/vim-volt/volt/pathutil"
+	"gopkg.in/src-d/go-git.v4"
+	gitconfig "gopkg.in/src-d/go-git.v4/config"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) Repositories whose locked revision is behind the branch are listed
+// (b) Already fetched commits of the upstream branch are counted
+// (c) Only given repositories are checked
+// (d) lock.json and the worktree of repositories are not changed
+// (e) Repositories which have no upstream remote are not fetched
+//
+// * Run `volt outdated -offline` (A, B, a, b, d)
+// * Run `volt outdated {repository}` (A, B, a, c, d, e)
+func TestVoltOutdated(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	behind := pathutil.ReposPath("localhost/local/behind")
+	first := setUpLocalGitRepos(t, behind)
+	behindHead := getLockedVersion(t, behind)
+	setLockedVersion(t, behind, first.String())
+	setUpLocalGitRepos(t, "localhost/local/latest")
+
+	// "tracking" has a newer commit only in "origin/master" which is
+	// already fetched
+	tracking := pathutil.ReposPath("localhost/local/tracking")
+	setUpLocalGitRepos(t, tracking)
+	trackingLocked := getLockedVersion(t, tracking)
+	_, trackingHead, err := gitCommitOne(tracking)
+	if err != nil {
+		t.Fatal("gitCommitOne() failed: " + err.Error())
+	}
+	r := setUpTrackingBranch(t, tracking, trackingHead, plumbing.NewHash(trackingLocked))
+	lockJSONContent, err := ioutil.ReadFile(pathutil.LockJSON())
+	if err != nil {
+		t.Fatal("failed to read lock.json: " + err.Error())
+	}
+	checkUnchanged := func() {
+		t.Helper()
+		content, err := ioutil.ReadFile(pathutil.LockJSON())
+		if err != nil {
+			t.Fatal("failed to read lock.json: " + err.Error())
+		}
+		if !bytes.Equal(content, lockJSONContent) {
+			t.Errorf("lock.json was changed: %s", string(content))
+		}
+		if head, err := gitutil.GetHEADRepository(r); err != nil || head != trackingLocked {
+			t.Errorf("expected HEAD of %s is %s but got %s (%v)", tracking, trackingLocked, head, err)
+		}
+	}
+	behindLine := "localhost/local/behind\t1 commit behind (" + first.String() + ".." + behindHead + ")\n"
+	trackingLine := "localhost/local/tracking\t1 commit behind (" + trackingLocked + ".." + trackingHead.String() + ")\n"
+
+	// =============== run =============== //
+
+	out, err := testutil.RunVolt("outdated", "-offline")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	// (a, b)
+	if expected := behindLine + trackingLine; string(out) != expected {
+		t.Errorf("expected %q but got %q", expected, string(out))
+	}
+	// (d)
+	checkUnchanged()
+
+	out, err = testutil.RunVolt("outdated", behind.String(), "localhost/local/latest")
+	// (A, B, e)
+	testutil.SuccessExit(t, out, err)
+	// (a, c)
+	if expected := behindLine; string(out) != expected {
+		t.Errorf("expected %q but got %q", expected, string(out))
+	}
+	// (d)
+	checkUnchanged()
+}
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (C) Show `[ERROR]`, `[WARN]` messages
+// (D) Exit with non-zero status
+// (a) The branch which HEAD points to is used even if it is not "master"
+// (b) "master" branch is used if HEAD is detached
+// (c) An error is shown if the default branch cannot be determined
+//
+// * Run `volt outdated -offline {repository}` (A, B, a, b)
+// * Run `volt outdated -offline {repository}` (C, D, c)
+func TestVoltOutdatedDefaultBranch(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+
+	// "trunk" has only "trunk" branch
+	trunk := pathutil.ReposPath("localhost/local/trunk")
+	trunkFirst := setUpLocalGitRepos(t, trunk)
+	trunkHead := getLockedVersion(t, trunk)
+	setLockedVersion(t, trunk, trunkFirst.String())
+	r := openRepos(t, trunk)
+	setRef(t, r, plumbing.NewHashReference("refs/heads/trunk", plumbing.NewHash(trunkHead)))
+	setRef(t, r, plumbing.NewSymbolicReference(plumbing.HEAD, "refs/heads/trunk"))
+	if err := r.Storer.RemoveReference("refs/heads/master"); err != nil {
+		t.Fatal("r.Storer.RemoveReference() failed: " + err.Error())
+	}
+
+	// "detached" has detached HEAD at the locked revision
+	detached := pathutil.ReposPath("localhost/local/detached")
+	detachedFirst := setUpLocalGitRepos(t, detached)
+	detachedHead := getLockedVersion(t, detached)
+	setLockedVersion(t, detached, detachedFirst.String())
+	setRef(t, openRepos(t, detached), plumbing.NewHashReference(plumbing.HEAD, detachedFirst))
+
+	// "nobranch" has detached HEAD and neither "main" nor "master" branch
+	nobranch := pathutil.ReposPath("localhost/local/nobranch")
+	setUpLocalGitRepos(t, nobranch)
+	r = openRepos(t, nobranch)
+	setRef(t, r, plumbing.NewHashReference(plumbing.HEAD, plumbing.NewHash(getLockedVersion(t, nobranch))))
+	if err := r.Storer.RemoveReference("refs/heads/master"); err != nil {
+		t.Fatal("r.Storer.RemoveReference() failed: " + err.Error())
+	}
+
+	// =============== run =============== //
+
+	out, err := testutil.RunVolt("outdated", "-offline", trunk.String(), detached.String())
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	// (a, b)
+	expected := "localhost/local/detached\t1 commit behind (" + detachedFirst.String() + ".." + detachedHead + ")\n" +
+		"localhost/local/trunk\t1 commit behind (" + trunkFirst.String() + ".." + trunkHead + ")\n"
+	if string(out) != expected {
+		t.Errorf("expected %q but got %q", expected, string(out))
+	}
+
+	out, err = testutil.RunVolt("outdated", "-offline", nobranch.String())
+	// (C, D)
+	testutil.FailExit(t, out, err)
+	// (c)
+	if !strings.Contains(string(out), "could not determine the default branch") {
+		t.Errorf("expected an error about the default branch but got: %s", string(out))
+	}
+}
+
+func openRepos(t *testing.T, reposPath pathutil.ReposPath) *git.Repository {
+	t.Helper()
+	r, err := git.PlainOpen(pathutil.FullReposPath(reposPath))
+	if err != nil {
+		t.Fatal("git.PlainOpen() failed: " + err.Error())
+	}
+	return r
+}
+
+func setRef(t *testing.T, r *git.Repository, ref *plumbing.Reference) {
+	t.Helper()
+	if err := r.Storer.SetReference(ref); err != nil {
+		t.Fatal("r.Storer.SetReference() failed: " + err.Error())
+	}
+}
+
+// Make current branch of git repository reposPath track "origin/master"
+// which points to tip as if it was fetched, and reset current branch to head
+func setUpTrackingBranch(t *testing.T, reposPath pathutil.ReposPath, tip, head plumbing.Hash) *git.Repository {
+	t.Helper()
+	r, err := git.PlainOpen(pathutil.FullReposPath(reposPath))
+	if err != nil {
+		t.Fatal("git.PlainOpen() failed: " + err.Error())
+	}
+	_, err = r.CreateRemote(&gitconfig.RemoteConfig{
+		Name: "origin",
+		URLs: []string{"https://" + reposPath.String()},
+	})
+	if err != nil {
+		t.Fatal("r.CreateRemote() failed: " + err.Error())
+	}
+	if err := gitutil.SetUpstreamRemote(r, "origin"); err != nil {
+		t.Fatal("gitutil.SetUpstreamRemote() failed: " + err.Error())
+	}
+	err = r.Storer.SetReference(plumbing.NewHashReference("refs/remotes/origin/master", tip))
+	if err != nil {
+		t.Fatal("r.Storer.SetReference() failed: " + err.Error())
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		t.Fatal("r.Worktree() failed: " + err.Error())
+	}
+	err = w.Reset(&git.ResetOptions{Commit: head, Mode: git.HardReset})
+	if err != nil {
+		t.Fatal("w.Reset() failed: " + err.Error())
+	}
+	return r
+}
+
+func getLockedVersion(t *testing.T, reposPath pathutil.ReposPath) string {
+	t.Helper()
+	lockJSON, err := lockjson.Read()
+	if err != nil {
+		t.Fatal("lockjson.Read() failed: " + err.Error())
+	}
+	repos, err := lockJSON.Repos.FindByPath(reposPath)
+	if err != nil {
+		t.Fatal("lockJSON.Repos.FindByPath() failed: " + err.Error())
+	}
+	return repos.Version
+}
+
+func setLockedVersion(t *testing.T, reposPath pathutil.ReposPath, version string) {
+	t.Helper()
+	lockJSON, err := lockjson.Read()
+	if err != nil {
+		t.Fatal("lockjson.Read() failed: " + err.Error())
+	}
+	repos, err := lockJSON.Repos.FindByPath(reposPath)
+	if err != nil {
+		t.Fatal("lockJSON.Repos.FindByPath() failed: " + err.Error())
+	}
+	repos.Version = version
+	if err := lockJSON.Write(); err != nil {
+		t.Fatal("lockJSON.Write() failed: " + err.Error())
+	}
+}
@@ -0,0 +1,210 @@
+package cmd
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vim-volt/volt/cmd/builder"
+	"github.com/vim-volt/volt/config"
+	"github.com/vim-volt/volt/lockjson"
+	"github.com/vim-volt/volt/logger"
+	"github.com/vim-volt/volt/transaction"
+)
+
+func init() {
+	cmdMap["pack"] = &packCmd{}
+}
+
+type packCmd struct {
+	helped      bool
+	noVimrc     bool
+	noHidden    bool
+	maxFileSize int64
+	modeMask    fileModeMaskFlag
+}
+
+func (cmd *packCmd) FlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.SetOutput(os.Stdout)
+	fs.Usage = func() {
+		fmt.Print(`
+Usage
+  volt pack [-help] [-no-vimrc] [-no-hidden] [-max-file-size {bytes}] [-file-mode-mask {mode}] {file | -}
+
+Quick example
+  $ volt pack vim.tar.gz            # writes files of current profile to vim.tar.gz
+  $ volt pack -no-vimrc vim.tar     # does not write vimrc and gvimrc, and does not compress
+  $ tar xzf vim.tar.gz -C ~/.vim    # extracts them on other machine
+  $ volt pack - | ssh host 'tar xz -C ~/.vim'    # writes gzipped tarball to stdout, and extracts it on remote host
+
+Description
+  Write the files which 'volt build' installs with copy strategy for current profile to a tarball {file}, without touching ~/.vim:
+    * pack/volt/opt/ and pack/volt/start/ directories
+    * pack/volt/start/system/plugin/bundled_plugconf.vim
+    * vimrc and gvimrc (unless -no-vimrc option was given)
+  Entry names are relative to vim directory (~/.vim), so the tarball can be extracted there.
+  The files are filtered in the same way as 'volt build' with copy strategy: .voltignore, "build.no_hidden" and "build.keep_hidden" of config.toml, and -no-hidden, -max-file-size and -file-mode-mask options (see 'volt build -help'). File modes are preserved, and symbolic links of static repositories are written as symbolic links.
+
+  If {file} ends with ".tar.gz" or ".tgz", the tarball is compressed with gzip.
+
+  If {file} is "-", the gzipped tarball is streamed to stdout while the files are read, without writing a temporary file. Messages other than errors are not shown because they would be mixed into the tarball. If it failed on the way, the tarball is incomplete and volt exits with non-zero status.
+
+  doc/tags files are generated by ":helptags" like 'volt build', so Vim is needed unless "generate_helptags" of current profile is false.` + "\n\n")
+		fmt.Println("Options")
+		fs.PrintDefaults()
+		fmt.Println()
+		cmd.helped = true
+	}
+	fs.BoolVar(&cmd.noVimrc, "no-vimrc", false, "do not write vimrc and gvimrc")
+	fs.BoolVar(&cmd.noHidden, "no-hidden", false, "do not write hidden files of static repositories")
+	fs.Int64Var(&cmd.maxFileSize, "max-file-size", 0, "do not write files larger than this size in bytes")
+	fs.Var(&cmd.modeMask, "file-mode-mask", "clear the permission bits of `mode` (octal) from written files")
+	return fs
+}
+
+func (cmd *packCmd) Run(args []string) int {
+	file, err := cmd.parseArgs(args)
+	if err == ErrShowedHelp {
+		return 0
+	}
+	if err != nil {
+		logger.Error("Failed to parse args: " + err.Error())
+		return 10
+	}
+
+	// Begin transaction
+	err = transaction.Create()
+	if err != nil {
+		logger.Error("Failed to begin transaction:", err.Error())
+		return 11
+	}
+	defer transaction.Remove()
+
+	err = cmd.doPack(file)
+	if err != nil {
+		logger.Error("Failed to pack:", err.Error())
+		return 12
+	}
+
+	return 0
+}
+
+func (cmd *packCmd) parseArgs(args []string) (string, error) {
+	fs := cmd.FlagSet()
+	fs.Parse(args)
+	if cmd.helped {
+		return "", ErrShowedHelp
+	}
+	if len(fs.Args()) != 1 {
+		fs.Usage()
+		return "", errors.New("output file was not given")
+	}
+	if cmd.maxFileSize < 0 {
+		return "", errors.New("-max-file-size must not be negative")
+	}
+	return fs.Args()[0], nil
+}
+
+func (cmd *packCmd) doPack(file string) error {
+	if file == "-" {
+		// Do not mix messages into the tarball (errors are written to stderr)
+		logger.SetLevel(logger.ErrorLevel)
+		return cmd.writeTarball(os.Stdout, true)
+	}
+
+	// Write to a temporary file, and rename it to file when succeeded
+	os.MkdirAll(filepath.Dir(file), 0755)
+	tmp, err := ioutil.TempFile(filepath.Dir(file), ".volt-pack")
+	if err != nil {
+		return err
+	}
+	err = cmd.writeTarball(tmp, cmd.isGzip(file))
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), file)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	logger.Info("Wrote " + file)
+	return nil
+}
+
+func (*packCmd) isGzip(file string) bool {
+	return strings.HasSuffix(file, ".tar.gz") || strings.HasSuffix(file, ".tgz")
+}
+
+func (cmd *packCmd) writeTarball(w io.Writer, compress bool) (err error) {
+	if compress {
+		gw := gzip.NewWriter(w)
+		defer func() {
+			if e := gw.Close(); err == nil {
+				err = e
+			}
+		}()
+		w = gw
+	}
+	opts, err := cmd.options()
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(w)
+	defer func() {
+		if e := tw.Close(); err == nil {
+			err = e
+		}
+	}()
+	return builder.Pack(context.Background(), tw, opts)
+}
+
+// Returns the options of copy strategy which 'volt build' uses with the same
+// config.toml and options
+func (cmd *packCmd) options() (*builder.Options, error) {
+	cfg, err := config.Read()
+	if err != nil {
+		return nil, errors.New("could not read config.toml: " + err.Error())
+	}
+	lockJSON, err := lockjson.Read()
+	if err != nil {
+		return nil, errors.New("could not read lock.json: " + err.Error())
+	}
+	excludeDocs, err := excludeDocsRepos(cfg)
+	if err != nil {
+		return nil, err
+	}
+	keepHidden, err := keepHiddenRepos(cfg)
+	if err != nil {
+		return nil, err
+	}
+	noHelptags := false
+	if profile, err := lockJSON.Profiles.FindByName(lockJSON.CurrentProfileName); err == nil {
+		noHelptags = !profile.GeneratesHelptags()
+	}
+	return &builder.Options{
+		NoVimrc:             cmd.noVimrc,
+		GitRetries:          *cfg.Build.GitRetries,
+		ExcludeDocsFromTags: excludeDocs,
+		NoHelptags:          noHelptags,
+		HelpLanguages:       cfg.Build.HelpLanguages,
+		NoHidden:            cmd.noHidden || *cfg.Build.NoHidden,
+		KeepHidden:          keepHidden,
+		MaxFileSize:         cmd.maxFileSize,
+		FileModeMask:        os.FileMode(cmd.modeMask),
+	}, nil
+}
@@ -0,0 +1,290 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vim-volt/volt/config"
+	"github.com/vim-volt/volt/internal/testutil"
+	"github.com/vim-volt/volt/lockjson"
+	"github.com/vim-volt/volt/pathutil"
+)
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) The tarball has files of repositories, bundled plugconf and vimrc
+// (b) Symbolic links are written as symbolic link entries
+// (c) File modes are preserved
+// (d) ~/.vim/pack/volt is not created
+//
+// * Run `volt pack {file}.tar.gz` (A, B, a, b, c, d)
+func TestVoltPack(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	hello := pathutil.ReposPath("localhost/local/hello")
+	teardown := testutil.SetUpRepos(t, "hello", lockjson.ReposStaticType, []pathutil.ReposPath{hello}, config.CopyBuilder)
+	defer teardown()
+
+	reposDir := pathutil.FullReposPath(hello)
+	script := filepath.Join(reposDir, "bin", "hello.sh")
+	os.MkdirAll(filepath.Dir(script), 0755)
+	if err := ioutil.WriteFile(script, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal("failed to write " + script)
+	}
+	if err := os.Symlink("hello.vim", filepath.Join(reposDir, "plugin", "link.vim")); err != nil {
+		t.Fatal("failed to create symlink: " + err.Error())
+	}
+	vimrc := filepath.Join(pathutil.RCDir("default"), pathutil.ProfileVimrc)
+	os.MkdirAll(filepath.Dir(vimrc), 0755)
+	if err := ioutil.WriteFile(vimrc, []byte("set nocompatible\n"), 0644); err != nil {
+		t.Fatal("failed to write " + vimrc)
+	}
+	file := filepath.Join(pathutil.VoltPath(), "out", "vim.tar.gz")
+	if err := os.RemoveAll(pathutil.VimVoltDir()); err != nil {
+		t.Fatal("failed to remove " + pathutil.VimVoltDir())
+	}
+
+	// =============== run =============== //
+
+	out, err := testutil.RunVolt("pack", file)
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+
+	// (a, b, c)
+	entries := readTarGz(t, file)
+	optDir := "pack/volt/opt/localhost_local_hello/"
+	for name, check := range map[string]func(*tar.Header) bool{
+		optDir + "plugin/hello.vim": func(h *tar.Header) bool {
+			return h.Typeflag == tar.TypeReg
+		},
+		optDir + "plugin/link.vim": func(h *tar.Header) bool {
+			return h.Typeflag == tar.TypeSymlink && h.Linkname == "hello.vim"
+		},
+		optDir + "bin/hello.sh": func(h *tar.Header) bool {
+			return h.Typeflag == tar.TypeReg && h.Mode == 0755
+		},
+		"pack/volt/start/system/plugin/bundled_plugconf.vim": func(h *tar.Header) bool {
+			return h.Typeflag == tar.TypeReg
+		},
+		"vimrc": func(h *tar.Header) bool {
+			return h.Typeflag == tar.TypeReg
+		},
+	} {
+		h, exists := entries[name]
+		if !exists {
+			t.Errorf("%s does not have %s", file, name)
+		} else if !check(h) {
+			t.Errorf("unexpected entry of %s: %+v", name, h)
+		}
+	}
+	if _, exists := entries["gvimrc"]; exists {
+		t.Errorf("%s has gvimrc", file)
+	}
+
+	// (d)
+	if pathutil.Exists(pathutil.VimVoltDir()) {
+		t.Errorf("%s was created", pathutil.VimVoltDir())
+	}
+}
+
+// Checks:
+// (A) Exit with zero status
+// (a) The tarball has the same files with the same modes as
+//     `volt build -strategy copy` installs with the same options
+// (b) The tarball has doc/tags generated by ":helptags"
+//
+// * Run `volt build -strategy copy` with filtering options (A)
+// * Run `volt pack {file}.tar.gz` with the same options (A, a, b)
+func TestVoltPackSameAsCopyBuild(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	hello := pathutil.ReposPath("localhost/local/hello")
+	reposDir := pathutil.FullReposPath(hello)
+	for name, content := range map[string]string{
+		"plugin/hello.vim":   "\" hello\n",
+		"plugin/ignored.vim": "\" ignored\n",
+		"plugin/large.vim":   "\" " + strings.Repeat("x", 200) + "\n",
+		"doc/hello.txt":      "*hello.txt*\n",
+		".hidden.vim":        "\" hidden\n",
+		".voltignore":        "plugin/ignored.vim\n",
+	} {
+		path := filepath.Join(reposDir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal("failed to write " + path)
+		}
+	}
+	out, err := testutil.RunVolt("get", hello.String())
+	testutil.SuccessExit(t, out, err)
+	options := []string{"-no-hidden", "-max-file-size", "100", "-file-mode-mask", "0044"}
+
+	// =============== run =============== //
+
+	out, err = testutil.RunVolt(append([]string{"build", "-strategy", "copy", "-full"}, options...)...)
+	// (A)
+	if err != nil {
+		t.Fatal("expected success exit but exited with failure: " + err.Error() + "\n" + string(out))
+	}
+	installDir := pathutil.EncodeReposPath(hello)
+	installed := make(map[string]os.FileMode)
+	err = filepath.Walk(installDir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil || fi.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(installDir, path)
+		installed[filepath.ToSlash(rel)] = fi.Mode().Perm()
+		return err
+	})
+	if err != nil {
+		t.Fatal("failed to walk " + installDir + ": " + err.Error())
+	}
+
+	file := filepath.Join(pathutil.VoltPath(), "out", "vim.tar.gz")
+	out, err = testutil.RunVolt(append(append([]string{"pack"}, options...), file)...)
+	// (A)
+	if err != nil {
+		t.Fatal("expected success exit but exited with failure: " + err.Error() + "\n" + string(out))
+	}
+
+	// (a)
+	optDir := "pack/volt/opt/localhost_local_hello/"
+	packed := make(map[string]os.FileMode)
+	for name, h := range readTarGz(t, file) {
+		if strings.HasPrefix(name, optDir) && h.Typeflag == tar.TypeReg {
+			packed[strings.TrimPrefix(name, optDir)] = os.FileMode(h.Mode)
+		}
+	}
+	if len(packed) != len(installed) {
+		t.Errorf("expected %v but got %v", installed, packed)
+	}
+	for name, mode := range installed {
+		if m, exists := packed[name]; !exists {
+			t.Errorf("%s does not have %s", file, name)
+		} else if !isHelptagsName(name) && m != mode {
+			t.Errorf("expected mode %o of %s but got %o", mode, name, m)
+		}
+	}
+	for _, name := range []string{"plugin/ignored.vim", "plugin/large.vim", ".hidden.vim", ".voltignore"} {
+		if _, exists := packed[name]; exists {
+			t.Errorf("%s has %s", file, name)
+		}
+	}
+	// (b)
+	if _, exists := packed["doc/tags"]; !exists {
+		t.Errorf("%s does not have doc/tags", file)
+	}
+}
+
+// Returns true if name is doc/tags or doc/tags-{lang}
+func isHelptagsName(name string) bool {
+	return strings.HasPrefix(name, "doc/tags")
+}
+
+// Checks:
+// (A) Does not show any messages
+// (B) Exit with zero status
+// (a) The gzipped tarball is written to stdout
+// (b) The entries are the same as `volt pack {file}.tar.gz` writes
+//
+// * Run `volt pack -` (A, B, a, b)
+func TestVoltPackStdout(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	hello := pathutil.ReposPath("localhost/local/hello")
+	teardown := testutil.SetUpRepos(t, "hello", lockjson.ReposStaticType, []pathutil.ReposPath{hello}, config.CopyBuilder)
+	defer teardown()
+
+	reposDir := pathutil.FullReposPath(hello)
+	script := filepath.Join(reposDir, "bin", "hello.sh")
+	os.MkdirAll(filepath.Dir(script), 0755)
+	if err := ioutil.WriteFile(script, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal("failed to write " + script)
+	}
+	if err := os.Symlink("hello.vim", filepath.Join(reposDir, "plugin", "link.vim")); err != nil {
+		t.Fatal("failed to create symlink: " + err.Error())
+	}
+	file := filepath.Join(pathutil.VoltPath(), "out", "vim.tar.gz")
+	out, err := testutil.RunVolt("pack", file)
+	testutil.SuccessExit(t, out, err)
+	expected := readTarGz(t, file)
+
+	// =============== run =============== //
+
+	cmd := testutil.VoltCommand("pack", "-")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal("failed to get stdout: " + err.Error())
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal("failed to start volt: " + err.Error())
+	}
+	// (a)
+	entries := readTarGzFrom(t, "stdout", stdout)
+	err = cmd.Wait()
+	// (B)
+	if err != nil {
+		t.Error("expected success exit but exited with failure: " + err.Error())
+	}
+	// (A)
+	if stderr.Len() > 0 {
+		t.Errorf("expected no messages but got: %s", stderr.String())
+	}
+
+	// (b)
+	if len(entries) != len(expected) {
+		t.Errorf("expected %d entries but got %d entries", len(expected), len(entries))
+	}
+	for name, e := range expected {
+		h, exists := entries[name]
+		if !exists {
+			t.Errorf("stdout does not have %s", name)
+		} else if h.Typeflag != e.Typeflag || h.Mode != e.Mode || h.Size != e.Size || h.Linkname != e.Linkname {
+			t.Errorf("expected %+v but got %+v", e, h)
+		}
+	}
+}
+
+// Returns tar headers of the entries in gzipped tarball
+func readTarGz(t *testing.T, file string) map[string]*tar.Header {
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal("failed to open " + file + ": " + err.Error())
+	}
+	defer f.Close()
+	return readTarGzFrom(t, file, f)
+}
+
+// Returns tar headers of the entries in gzipped tarball read from r.
+// name is used for error messages.
+func readTarGzFrom(t *testing.T, name string, r io.Reader) map[string]*tar.Header {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		t.Fatal("failed to read " + name + ": " + err.Error())
+	}
+	entries := make(map[string]*tar.Header)
+	tr := tar.NewReader(gr)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal("failed to read " + name + ": " + err.Error())
+		}
+		entries[strings.TrimSuffix(h.Name, "/")] = h
+	}
+	return entries
+}
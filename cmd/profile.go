@@ -1,19 +1,26 @@
 package cmd
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"strings"
 
+	"github.com/sergi/go-diff/diffmatchpatch"
 	"github.com/vim-volt/volt/lockjson"
 	"github.com/vim-volt/volt/logger"
 	"github.com/vim-volt/volt/pathutil"
 	"github.com/vim-volt/volt/transaction"
+	"gopkg.in/src-d/go-git.v4/utils/diff"
 )
 
 type profileCmd struct {
 	helped bool
+	// Show the difference of lock.json instead of writing it
+	dryRun bool
 }
 
 var profileSubCmd = make(map[string]func([]string) error)
@@ -22,6 +29,10 @@ func init() {
 	cmdMap["profile"] = &profileCmd{}
 }
 
+func (cmd *profileCmd) setDryRun() {
+	cmd.dryRun = true
+}
+
 func (cmd *profileCmd) FlagSet() *flag.FlagSet {
 	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
 	fs.SetOutput(os.Stdout)
@@ -31,7 +42,7 @@ Usage
   profile [-help] {command}
 
 Command
-  profile set [-n] {name}
+  profile set [-dry-run] [-n] {name}
     Set profile name to {name}.
 
   profile show [-current | {name}]
@@ -40,22 +51,35 @@ Command
   profile list
     List all profiles.
 
-  profile new {name}
+  profile new [-dry-run] {name}
     Create new profile of {name}. This command does not switch to profile {name}.
 
-  profile destroy {name}
+  profile destroy [-dry-run] {name}
     Delete profile of {name}.
     NOTE: Cannot delete current profile.
 
-  profile rename {old} {new}
+  profile rename [-dry-run] {old} {new}
     Rename profile {old} to {new}.
 
-  profile add [-current | {name}] {repository} [{repository2} ...]
+  profile add [-dry-run] [-start] [-current | {name}] {repository} [{repository2} ...]
     Add one or more repositories to profile {name}.
+    If -start was given, the repositories are installed to
+    "~/.vim/pack/volt/start" and loaded by Vim automatically on profile {name}.
+    Otherwise they are installed to "~/.vim/pack/volt/opt".
 
-  profile rm [-current | {name}] {repository} [{repository2} ...]
+  profile rm [-dry-run] [-current | {name}] {repository} [{repository2} ...]
     Remove one or more repositories from profile {name}.
 
+  If -dry-run was given to the above commands which modify lock.json (set,
+  new, destroy, rename, add and rm), the difference of lock.json is shown in
+  unified diff format instead of writing it. $VOLTPATH/rc/{name} and
+  ~/.vim/pack/volt are not changed either.
+
+  profile diff [-json] {name1} {name2}
+    Show repositories which are only in profile {name1}, only in profile {name2},
+    and in both profiles but installed differently (type, version or placement).
+    If -json was given, print the result as JSON.
+
 Quick example
   $ volt profile list   # default profile is "default"
   * default
@@ -72,10 +96,14 @@ Quick example
 
   $ volt enable tyru/caw.vim    # enable loading tyru/caw.vim on current profile
   $ volt profile add foo tyru/caw.vim    # enable loading tyru/caw.vim on "foo" profile
+  $ volt profile add -start foo tyru/caw.vim    # install tyru/caw.vim to start directory on "foo" profile
 
   $ volt disable tyru/caw.vim   # disable loading tyru/caw.vim on current profile
   $ volt profile rm foo tyru/caw.vim    # disable loading tyru/caw.vim on "foo" profile
 
+  $ volt profile diff default foo   # show the difference between "default" and "foo"
+  $ volt profile rename -dry-run foo bar   # show how lock.json is changed by renaming "foo"
+
   $ volt profile destroy foo   # will delete profile "foo"` + "\n\n")
 		cmd.helped = true
 	}
@@ -94,6 +122,9 @@ func (cmd *profileCmd) Run(args []string) int {
 	}
 
 	subCmd := args[0]
+	if profileMutatingCmds[subCmd] {
+		args = append(args[:1], cmd.parseDryRun(args[1:])...)
+	}
 	switch subCmd {
 	case "set":
 		err = cmd.doSet(args[1:])
@@ -111,6 +142,8 @@ func (cmd *profileCmd) Run(args []string) int {
 		err = cmd.doAdd(args[1:])
 	case "rm":
 		err = cmd.doRm(args[1:])
+	case "diff":
+		err = cmd.doDiff(args[1:])
 	default:
 		logger.Error("unknown subcommand: " + subCmd)
 		return 11
@@ -137,6 +170,33 @@ func (cmd *profileCmd) parseArgs(args []string) ([]string, error) {
 	return fs.Args(), nil
 }
 
+// The subcommands which modify lock.json (-dry-run can be given)
+var profileMutatingCmds = map[string]bool{
+	"set":     true,
+	"new":     true,
+	"destroy": true,
+	"rename":  true,
+	"add":     true,
+	"rm":      true,
+}
+
+// Remove -dry-run from the options of a subcommand (the arguments before
+// the first non-option argument), and set cmd.dryRun if it was given
+func (cmd *profileCmd) parseDryRun(args []string) []string {
+	rest := make([]string, 0, len(args))
+	for i, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			return append(rest, args[i:]...)
+		}
+		if arg == "-dry-run" {
+			cmd.dryRun = true
+		} else {
+			rest = append(rest, arg)
+		}
+	}
+	return rest
+}
+
 func (*profileCmd) getCurrentProfile() (string, error) {
 	lockJSON, err := lockjson.Read()
 	if err != nil {
@@ -170,21 +230,34 @@ func (cmd *profileCmd) doSet(args []string) error {
 		return fmt.Errorf("'%s' is current profile", profileName)
 	}
 
+	before, err := lockJSON.Marshal()
+	if err != nil {
+		return err
+	}
+
 	// Create given profile unless the profile exists
 	if _, err = lockJSON.Profiles.FindByName(profileName); err != nil {
 		if !createProfile {
 			return err
 		}
-		if err = cmd.doNew([]string{profileName}); err != nil {
-			return err
-		}
-		// Read lock.json again
-		lockJSON, err = lockjson.Read()
-		if err != nil {
-			return errors.New("failed to read lock.json: " + err.Error())
-		}
-		if _, err = lockJSON.Profiles.FindByName(profileName); err != nil {
-			return err
+		if cmd.dryRun {
+			// Add the profile only to the structure in memory
+			lockJSON.Profiles = append(lockJSON.Profiles, lockjson.Profile{
+				Name:      profileName,
+				ReposPath: make([]pathutil.ReposPath, 0),
+			})
+		} else {
+			if err = cmd.doNew([]string{profileName}); err != nil {
+				return err
+			}
+			// Read lock.json again
+			lockJSON, err = lockjson.Read()
+			if err != nil {
+				return errors.New("failed to read lock.json: " + err.Error())
+			}
+			if _, err = lockJSON.Profiles.FindByName(profileName); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -199,6 +272,9 @@ func (cmd *profileCmd) doSet(args []string) error {
 	lockJSON.CurrentProfileName = profileName
 
 	// Write to lock.json
+	if cmd.dryRun {
+		return cmd.showLockJSONDiff(before, lockJSON)
+	}
 	err = lockJSON.Write()
 	if err != nil {
 		return err
@@ -207,7 +283,7 @@ func (cmd *profileCmd) doSet(args []string) error {
 	logger.Info("Changed current profile: " + profileName)
 
 	// Build ~/.vim/pack/volt dir
-	err = (&buildCmd{}).doBuild(false)
+	err = (&buildCmd{switchedProfile: true}).doBuild(false)
 	if err != nil {
 		return errors.New("could not build " + pathutil.VimVoltDir() + ": " + err.Error())
 	}
@@ -275,6 +351,10 @@ func (cmd *profileCmd) doNew(args []string) error {
 	if err == nil {
 		return errors.New("profile '" + profileName + "' already exists")
 	}
+	before, err := lockJSON.Marshal()
+	if err != nil {
+		return err
+	}
 
 	// Begin transaction
 	err = transaction.Create()
@@ -290,6 +370,9 @@ func (cmd *profileCmd) doNew(args []string) error {
 	})
 
 	// Write to lock.json
+	if cmd.dryRun {
+		return cmd.showLockJSONDiff(before, lockJSON)
+	}
 	err = lockJSON.Write()
 	if err != nil {
 		return err
@@ -324,6 +407,10 @@ func (cmd *profileCmd) doDestroy(args []string) error {
 	if index < 0 {
 		return errors.New("profile '" + profileName + "' does not exist")
 	}
+	before, err := lockJSON.Marshal()
+	if err != nil {
+		return err
+	}
 
 	// Begin transaction
 	err = transaction.Create()
@@ -334,6 +421,9 @@ func (cmd *profileCmd) doDestroy(args []string) error {
 
 	// Remove the specified profile
 	lockJSON.Profiles = append(lockJSON.Profiles[:index], lockJSON.Profiles[index+1:]...)
+	if cmd.dryRun {
+		return cmd.showLockJSONDiff(before, lockJSON)
+	}
 
 	// Remove $VOLTPATH/rc/{profile} dir
 	rcDir := pathutil.RCDir(profileName)
@@ -378,6 +468,10 @@ func (cmd *profileCmd) doRename(args []string) error {
 	if lockJSON.Profiles.FindIndexByName(newName) >= 0 {
 		return errors.New("profile '" + newName + "' already exists")
 	}
+	before, err := lockJSON.Marshal()
+	if err != nil {
+		return err
+	}
 
 	// Begin transaction
 	err = transaction.Create()
@@ -391,6 +485,9 @@ func (cmd *profileCmd) doRename(args []string) error {
 	if lockJSON.CurrentProfileName == oldName {
 		lockJSON.CurrentProfileName = newName
 	}
+	if cmd.dryRun {
+		return cmd.showLockJSONDiff(before, lockJSON)
+	}
 
 	// Rename $VOLTPATH/rc/{profile} dir
 	oldRCDir := pathutil.RCDir(oldName)
@@ -420,6 +517,11 @@ func (cmd *profileCmd) doAdd(args []string) error {
 	}
 
 	// Parse args
+	placement := lockjson.ReposOptPlacement
+	if len(args) > 0 && args[0] == "-start" {
+		placement = lockjson.ReposStartPlacement
+		args = args[1:]
+	}
 	profileName, reposPathList, err := cmd.parseAddArgs(lockJSON, "add", args)
 	if err != nil {
 		return errors.New("failed to parse args: " + err.Error())
@@ -433,15 +535,19 @@ func (cmd *profileCmd) doAdd(args []string) error {
 	lockJSON, err = cmd.transactProfile(lockJSON, profileName, func(profile *lockjson.Profile) {
 		// Add repositories to profile if the repository does not exist
 		for _, reposPath := range reposPathList {
-			if profile.ReposPath.Contains(reposPath) {
-				logger.Warn("repository '" + reposPath.String() + "' is already enabled")
-			} else {
+			if !profile.ReposPath.Contains(reposPath) {
 				profile.ReposPath = append(profile.ReposPath, reposPath)
+				cmd.setPlacement(profile, reposPath, placement)
 				logger.Info("Enabled '" + reposPath.String() + "' on profile '" + profileName + "'")
+			} else if profile.PlacementOf(reposPath) != placement {
+				cmd.setPlacement(profile, reposPath, placement)
+				logger.Info("Moved '" + reposPath.String() + "' to " + string(placement) + " on profile '" + profileName + "'")
+			} else {
+				logger.Warn("repository '" + reposPath.String() + "' is already enabled")
 			}
 		}
 	})
-	if err != nil {
+	if err != nil || cmd.dryRun {
 		return err
 	}
 
@@ -479,13 +585,14 @@ func (cmd *profileCmd) doRm(args []string) error {
 			if index >= 0 {
 				// Remove profile.ReposPath[index]
 				profile.ReposPath = append(profile.ReposPath[:index], profile.ReposPath[index+1:]...)
+				cmd.setPlacement(profile, reposPath, lockjson.ReposOptPlacement)
 				logger.Info("Disabled '" + reposPath.String() + "' from profile '" + profileName + "'")
 			} else {
 				logger.Warn("repository '" + reposPath.String() + "' is already disabled")
 			}
 		}
 	})
-	if err != nil {
+	if err != nil || cmd.dryRun {
 		return err
 	}
 
@@ -498,6 +605,130 @@ func (cmd *profileCmd) doRm(args []string) error {
 	return nil
 }
 
+// JSON output of "volt profile diff -json"
+type profileDiffJSON struct {
+	Profiles     [2]string            `json:"profiles"`
+	OnlyInFirst  []pathutil.ReposPath `json:"only_in_first"`
+	OnlyInSecond []pathutil.ReposPath `json:"only_in_second"`
+	Changed      []profileDiffChange  `json:"changed"`
+}
+
+type profileDiffChange struct {
+	Path   pathutil.ReposPath `json:"path"`
+	First  profileDiffRepos   `json:"first"`
+	Second profileDiffRepos   `json:"second"`
+}
+
+type profileDiffRepos struct {
+	Type      lockjson.ReposType      `json:"type"`
+	Version   string                  `json:"version"`
+	Placement lockjson.ReposPlacement `json:"placement"`
+}
+
+func (cmd *profileCmd) doDiff(args []string) error {
+	// Parse args
+	asJSON := false
+	if len(args) > 0 && args[0] == "-json" {
+		asJSON = true
+		args = args[1:]
+	}
+	if len(args) != 2 {
+		cmd.FlagSet().Usage()
+		logger.Error("'volt profile diff' receives two profile names.")
+		return nil
+	}
+
+	// Read lock.json
+	lockJSON, err := lockjson.Read()
+	if err != nil {
+		return errors.New("failed to read lock.json: " + err.Error())
+	}
+
+	var reposLists [2]lockjson.ReposList
+	for i, profileName := range args {
+		profile, err := lockJSON.Profiles.FindByName(profileName)
+		if err != nil {
+			return err
+		}
+		reposLists[i], err = lockJSON.GetReposListByProfile(profile)
+		if err != nil {
+			return err
+		}
+	}
+	diff := reposLists[0].Diff(reposLists[1])
+
+	if asJSON {
+		return cmd.printDiffJSON(args[0], args[1], diff)
+	}
+	fmt.Print(cmd.formatDiff(args[0], args[1], diff))
+	return nil
+}
+
+func (*profileCmd) formatDiff(first, second string, diff *lockjson.ReposListDiff) string {
+	var b bytes.Buffer
+	for _, section := range []struct {
+		name      string
+		reposList lockjson.ReposList
+	}{
+		{first, diff.Removed},
+		{second, diff.Added},
+	} {
+		fmt.Fprintf(&b, "Only in '%s':\n", section.name)
+		if len(section.reposList) == 0 {
+			b.WriteString("  (none)\n")
+		}
+		for i := range section.reposList {
+			fmt.Fprintf(&b, "  %s\n", section.reposList[i].Path)
+		}
+	}
+	b.WriteString("Different:\n")
+	if len(diff.Changed) == 0 {
+		b.WriteString("  (none)\n")
+	}
+	for _, c := range diff.Changed {
+		changes := make([]string, 0, 3)
+		if c.Old.Type != c.New.Type {
+			changes = append(changes, fmt.Sprintf("type: %s -> %s", c.Old.Type, c.New.Type))
+		}
+		if c.Old.Version != c.New.Version {
+			changes = append(changes, fmt.Sprintf("version: %s -> %s", c.Old.Version, c.New.Version))
+		}
+		if c.Old.Placement != c.New.Placement {
+			changes = append(changes, fmt.Sprintf("placement: %s -> %s", c.Old.Placement, c.New.Placement))
+		}
+		fmt.Fprintf(&b, "  %s (%s)\n", c.Old.Path, strings.Join(changes, ", "))
+	}
+	return b.String()
+}
+
+func (*profileCmd) printDiffJSON(first, second string, diff *lockjson.ReposListDiff) error {
+	result := profileDiffJSON{
+		Profiles:     [2]string{first, second},
+		OnlyInFirst:  make([]pathutil.ReposPath, 0, len(diff.Removed)),
+		OnlyInSecond: make([]pathutil.ReposPath, 0, len(diff.Added)),
+		Changed:      make([]profileDiffChange, 0, len(diff.Changed)),
+	}
+	for i := range diff.Removed {
+		result.OnlyInFirst = append(result.OnlyInFirst, diff.Removed[i].Path)
+	}
+	for i := range diff.Added {
+		result.OnlyInSecond = append(result.OnlyInSecond, diff.Added[i].Path)
+	}
+	for _, c := range diff.Changed {
+		result.Changed = append(result.Changed, profileDiffChange{
+			Path:   c.Old.Path,
+			First:  profileDiffRepos{c.Old.Type, c.Old.Version, c.Old.Placement},
+			Second: profileDiffRepos{c.New.Type, c.New.Version, c.New.Placement},
+		})
+	}
+	b, err := json.MarshalIndent(&result, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(b))
+	return nil
+}
+
 func (cmd *profileCmd) parseAddArgs(lockJSON *lockjson.LockJSON, subCmd string, args []string) (string, []pathutil.ReposPath, error) {
 	if len(args) == 0 {
 		cmd.FlagSet().Usage()
@@ -526,13 +757,31 @@ func (cmd *profileCmd) parseAddArgs(lockJSON *lockjson.LockJSON, subCmd string,
 	return profileName, reposPathList, nil
 }
 
-// Run modifyProfile and write modified structure to lock.json
-func (*profileCmd) transactProfile(lockJSON *lockjson.LockJSON, profileName string, modifyProfile func(*lockjson.Profile)) (*lockjson.LockJSON, error) {
+// Set placement of reposPath on the profile.
+// reposPath must be in profile.ReposPath unless placement is "opt".
+func (*profileCmd) setPlacement(profile *lockjson.Profile, reposPath pathutil.ReposPath, placement lockjson.ReposPlacement) {
+	index := profile.StartReposPath.IndexOf(reposPath)
+	if placement == lockjson.ReposStartPlacement {
+		if index < 0 {
+			profile.StartReposPath = append(profile.StartReposPath, reposPath)
+		}
+	} else if index >= 0 {
+		profile.StartReposPath = append(profile.StartReposPath[:index], profile.StartReposPath[index+1:]...)
+	}
+}
+
+// Run modifyProfile and write modified structure to lock.json.
+// If -dry-run was given, the difference is shown instead.
+func (cmd *profileCmd) transactProfile(lockJSON *lockjson.LockJSON, profileName string, modifyProfile func(*lockjson.Profile)) (*lockjson.LockJSON, error) {
 	// Return error if profiles[]/name does not match profileName
 	profile, err := lockJSON.Profiles.FindByName(profileName)
 	if err != nil {
 		return nil, err
 	}
+	before, err := lockJSON.Marshal()
+	if err != nil {
+		return nil, err
+	}
 
 	// Begin transaction
 	err = transaction.Create()
@@ -544,9 +793,95 @@ func (*profileCmd) transactProfile(lockJSON *lockjson.LockJSON, profileName stri
 	modifyProfile(profile)
 
 	// Write to lock.json
+	if cmd.dryRun {
+		return lockJSON, cmd.showLockJSONDiff(before, lockJSON)
+	}
 	err = lockJSON.Write()
 	if err != nil {
 		return nil, err
 	}
 	return lockJSON, nil
 }
+
+// Show the difference between before (the content of lock.json before
+// modification) and lockJSON in unified diff format, instead of writing it
+func (*profileCmd) showLockJSONDiff(before []byte, lockJSON *lockjson.LockJSON) error {
+	after, err := lockJSON.Marshal()
+	if err != nil {
+		return err
+	}
+	fmt.Print(formatUnifiedDiff("lock.json", string(before), string(after), 3))
+	logger.Info("lock.json was not changed because -dry-run was given")
+	return nil
+}
+
+// Returns the unified diff of lines from src to dst with context lines.
+// Returns empty string if there is no difference.
+func formatUnifiedDiff(name, src, dst string, context int) string {
+	type diffLine struct {
+		op   byte // ' ', '-' or '+'
+		text string
+	}
+	lines := make([]diffLine, 0, 64)
+	for _, d := range diff.Do(src, dst) {
+		op := byte(' ')
+		if d.Type == diffmatchpatch.DiffDelete {
+			op = '-'
+		} else if d.Type == diffmatchpatch.DiffInsert {
+			op = '+'
+		}
+		for _, text := range strings.SplitAfter(d.Text, "\n") {
+			if text != "" {
+				lines = append(lines, diffLine{op, strings.TrimSuffix(text, "\n")})
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	srcLine, dstLine := 1, 1 // line numbers of lines[i]
+	for i := 0; i < len(lines); {
+		if lines[i].op == ' ' {
+			srcLine++
+			dstLine++
+			i++
+			continue
+		}
+		// Make a hunk: from "context" lines before the change to
+		// "context" lines after the last change which is within
+		// 2 * context lines from the previous one
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for j := i; j < len(lines) && j <= end+2*context; j++ {
+			if lines[j].op != ' ' {
+				end = j
+			}
+		}
+		end += context + 1
+		if end > len(lines) {
+			end = len(lines)
+		}
+		hunkSrc, hunkDst := srcLine-(i-start), dstLine-(i-start)
+		var srcCount, dstCount int
+		for _, l := range lines[start:end] {
+			if l.op != '+' {
+				srcCount++
+			}
+			if l.op != '-' {
+				dstCount++
+			}
+		}
+		if buf.Len() == 0 {
+			fmt.Fprintf(&buf, "--- a/%s\n+++ b/%s\n", name, name)
+		}
+		fmt.Fprintf(&buf, "@@ -%d,%d +%d,%d @@\n", hunkSrc, srcCount, hunkDst, dstCount)
+		for _, l := range lines[start:end] {
+			fmt.Fprintf(&buf, "%c%s\n", l.op, l.text)
+		}
+		srcLine, dstLine = hunkSrc+srcCount, hunkDst+dstCount
+		i = end
+	}
+	return buf.String()
+}
@@ -3,6 +3,9 @@ package cmd
 import (
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -119,6 +122,82 @@ func TestVoltProfileSet(t *testing.T) {
 	})
 }
 
+// Checks:
+// (a) Bundled plugconf loads only the plugins of current profile
+// (b) Bundled plugconf uses the profile plugconf of current profile
+// (c) Bundled plugconf does not have the config of previous profile
+//
+// * Run `volt profile set foo` and `volt profile set default` (A, B, a, b, c)
+func TestVoltProfileSetBundledPlugconf(t *testing.T) {
+	testProfileMatrix(t, func(t *testing.T, strategy string) {
+		// =============== setup =============== //
+
+		testutil.SetUpEnv(t)
+		testutil.InstallConfig(t, "strategy-"+strategy+".toml")
+		for _, name := range []string{"alpha", "bravo"} {
+			dir := filepath.Join(pathutil.VoltPath(), "repos", "localhost", "local", name, "plugin")
+			os.MkdirAll(dir, 0755)
+			if err := ioutil.WriteFile(filepath.Join(dir, name+".vim"), []byte("\" "+name), 0644); err != nil {
+				t.Fatal("failed to write plugin: " + err.Error())
+			}
+			out, err := testutil.RunVolt("get", "localhost/local/"+name)
+			testutil.SuccessExit(t, out, err)
+		}
+		out, err := testutil.RunVolt("profile", "new", "foo")
+		testutil.SuccessExit(t, out, err)
+		out, err = testutil.RunVolt("profile", "add", "foo", "localhost/local/alpha")
+		testutil.SuccessExit(t, out, err)
+
+		plugconfs := map[string]string{
+			pathutil.Plugconf("localhost/local/alpha"):               "alpha_global",
+			pathutil.ProfilePlugconf("foo", "localhost/local/alpha"): "alpha_foo",
+		}
+		for path, name := range plugconfs {
+			os.MkdirAll(filepath.Dir(path), 0755)
+			content := "function! s:config()\n  let g:" + name + " = 1\nendfunction\n"
+			if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal("failed to write plugconf: " + err.Error())
+			}
+		}
+
+		for _, tt := range []struct {
+			profile    string
+			contains   []string
+			notContain []string
+		}{
+			{"foo", []string{"localhost_local_alpha", "g:alpha_foo"}, []string{"localhost_local_bravo", "g:alpha_global"}},
+			{"default", []string{"localhost_local_alpha", "localhost_local_bravo", "g:alpha_global"}, []string{"g:alpha_foo"}},
+		} {
+			// =============== run =============== //
+
+			out, err := testutil.RunVolt("profile", "set", tt.profile)
+			// (A, B)
+			testutil.SuccessExit(t, out, err)
+
+			content, err := ioutil.ReadFile(pathutil.BundledPlugConf())
+			if err != nil {
+				t.Fatal("failed to read bundled plugconf: " + err.Error())
+			}
+			// (a, b)
+			for _, s := range tt.contains {
+				if !strings.Contains(string(content), s) {
+					t.Errorf("profile %s: bundled plugconf does not contain %q:\n%s", tt.profile, s, content)
+				}
+			}
+			// (a, c)
+			for _, s := range tt.notContain {
+				if strings.Contains(string(content), s) {
+					t.Errorf("profile %s: bundled plugconf contains %q:\n%s", tt.profile, s, content)
+				}
+			}
+		}
+
+		out, err = testutil.RunVolt("status")
+		// (A, B)
+		testutil.SuccessExit(t, out, err)
+	})
+}
+
 // Checks:
 // (a) Output has profile name
 // (b) Output has "repos path"
@@ -629,6 +708,58 @@ func TestVoltProfileRename(t *testing.T) {
 	})
 }
 
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) lock.json is not changed
+// (b) The difference of lock.json is shown in unified diff format
+//
+// * Run `volt profile rename -dry-run <src> <dst>` (<src>: exists & not current profile, <dst>: not exist) (A, B, a, b)
+func TestVoltProfileRenameDryRun(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	out, err := testutil.RunVolt("profile", "new", "foo")
+	testutil.SuccessExit(t, out, err)
+
+	oldContent, err := ioutil.ReadFile(pathutil.LockJSON())
+	if err != nil {
+		t.Fatal("failed to read lock.json: " + err.Error())
+	}
+
+	// =============== run =============== //
+
+	out, err = testutil.RunVolt("profile", "rename", "-dry-run", "foo", "bar")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+
+	// (a)
+	content, err := ioutil.ReadFile(pathutil.LockJSON())
+	if err != nil {
+		t.Fatal("failed to read lock.json: " + err.Error())
+	}
+	if string(content) != string(oldContent) {
+		t.Errorf("expected lock.json is not changed but changed:\n%s", string(content))
+	}
+
+	// (b)
+	expected := `--- a/lock.json
++++ b/lock.json
+@@ -8,7 +8,7 @@
+       "repos_path": []
+     },
+     {
+-      "name": "foo",
++      "name": "bar",
+       "repos_path": []
+     }
+   ]
+`
+	if !strings.Contains(string(out), expected) {
+		t.Errorf("expected output contains:\n%s\nbut got:\n%s", expected, string(out))
+	}
+}
+
 // Checks:
 // (a) given repositories are added to profile
 // (b) other profiles which was not specified do not change
@@ -1139,8 +1270,171 @@ func TestVoltProfileRm(t *testing.T) {
 	})
 }
 
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) The repository is installed under start directory on profile "a"
+// (b) The repository is installed under opt directory on profile "b"
+// (c) Bundled plugconf does not ":packadd" the repository under start directory
+//
+// * Run `volt profile add -start a <repos>`, `volt profile add b <repos>` and switch profiles (A, B, a, b, c)
+func TestVoltProfileAddStart(t *testing.T) {
+	testProfileMatrix(t, func(t *testing.T, strategy string) {
+		// =============== setup =============== //
+
+		testutil.SetUpEnv(t)
+		reposPath := pathutil.ReposPath("localhost/local/hello")
+		teardown := testutil.SetUpRepos(t, "hello", lockjson.ReposStaticType, []pathutil.ReposPath{reposPath}, strategy)
+		defer teardown()
+		testutil.InstallConfig(t, "strategy-"+strategy+".toml")
+
+		for _, name := range []string{"a", "b"} {
+			out, err := testutil.RunVolt("profile", "new", name)
+			testutil.SuccessExit(t, out, err)
+		}
+		out, err := testutil.RunVolt("profile", "add", "-start", "a", reposPath.String())
+		testutil.SuccessExit(t, out, err)
+		out, err = testutil.RunVolt("profile", "add", "b", reposPath.String())
+		testutil.SuccessExit(t, out, err)
+
+		lockJSON, err := lockjson.Read()
+		if err != nil {
+			t.Fatal("lockjson.Read() returned non-nil error: " + err.Error())
+		}
+		for name, placement := range map[string]lockjson.ReposPlacement{
+			"a": lockjson.ReposStartPlacement,
+			"b": lockjson.ReposOptPlacement,
+		} {
+			reposList := getReposList(t, lockJSON, name)
+			if len(reposList) != 1 || reposList[0].Placement != placement {
+				t.Errorf("expected '%s' is %s on profile '%s' but got: %+v", reposPath, placement, name, reposList)
+			}
+		}
+
+		startDir := pathutil.EncodeReposPathTo(pathutil.VimVoltStartDir(), reposPath)
+		optDir := pathutil.EncodeReposPath(reposPath)
+
+		// =============== run =============== //
+
+		for _, tt := range []struct {
+			profile   string
+			installed string
+			removed   string
+		}{
+			{"a", startDir, optDir},
+			{"b", optDir, startDir},
+			{"a", startDir, optDir},
+		} {
+			out, err := testutil.RunVolt("profile", "set", tt.profile)
+			// (A, B)
+			testutil.SuccessExit(t, out, err)
+
+			// (a, b)
+			if !pathutil.Exists(filepath.Join(tt.installed, "plugin", "hello.vim")) {
+				t.Errorf("expected '%s' is installed on profile '%s' but not installed", tt.installed, tt.profile)
+			}
+			if pathutil.Exists(tt.removed) {
+				t.Errorf("expected '%s' is not installed on profile '%s' but installed", tt.removed, tt.profile)
+			}
+
+			// (c)
+			content, err := ioutil.ReadFile(pathutil.BundledPlugConf())
+			if err != nil {
+				t.Fatal("could not read bundled plugconf: " + err.Error())
+			}
+			hasPackadd := strings.Contains(string(content), "packadd "+filepath.Base(optDir))
+			if hasPackadd != (tt.installed == optDir) {
+				t.Errorf("unexpected :packadd on profile '%s' (packadd=%v): %s", tt.profile, hasPackadd, string(content))
+			}
+		}
+	})
+}
+
 // ============================================
 
+// Checks:
+// (a) Repositories only in the first profile are shown
+// (b) Repositories only in the second profile are shown
+// (c) Repositories installed differently are shown with the difference
+// (d) Repositories installed in the same way are not shown
+//
+// * Run `volt profile diff <profile1> <profile2>` (A, B, a, b, c, d)
+// * Run `volt profile diff -json <profile1> <profile2>` (A, B, a, b, c, d)
+// * Run `volt profile diff <profile1> <profile2>` (<profile2>: not exist) (!A, !B)
+func TestVoltProfileDiff(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	lockJSON, err := lockjson.Read()
+	if err != nil {
+		t.Fatal("lockjson.Read() returned non-nil error: " + err.Error())
+	}
+	for _, name := range []string{"alpha", "bravo", "charlie", "delta"} {
+		lockJSON.Repos = append(lockJSON.Repos, lockjson.Repos{
+			Type: lockjson.ReposStaticType,
+			Path: pathutil.ReposPath("localhost/local/" + name),
+		})
+	}
+	lockJSON.Profiles = append(lockJSON.Profiles,
+		lockjson.Profile{
+			Name:           "work",
+			ReposPath:      []pathutil.ReposPath{"localhost/local/alpha", "localhost/local/bravo", "localhost/local/charlie"},
+			StartReposPath: []pathutil.ReposPath{"localhost/local/bravo"},
+		},
+		lockjson.Profile{
+			Name:      "home",
+			ReposPath: []pathutil.ReposPath{"localhost/local/bravo", "localhost/local/charlie", "localhost/local/delta"},
+		},
+	)
+	if err := lockJSON.Write(); err != nil {
+		t.Fatal("lockJSON.Write() returned non-nil error: " + err.Error())
+	}
+
+	// =============== run =============== //
+
+	out, err := testutil.RunVolt("profile", "diff", "work", "home")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	// (a, b, c, d)
+	expected := `Only in 'work':
+  localhost/local/alpha
+Only in 'home':
+  localhost/local/delta
+Different:
+  localhost/local/bravo (placement: start -> opt)
+`
+	if string(out) != expected {
+		t.Errorf("expected:\n%s\nbut got:\n%s", expected, string(out))
+	}
+
+	out, err = testutil.RunVolt("profile", "diff", "-json", "work", "home")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	var result profileDiffJSON
+	if err := json.Unmarshal(out, &result); err != nil {
+		t.Fatal("json.Unmarshal() returned non-nil error: " + err.Error() + "\n" + string(out))
+	}
+	// (a)
+	if len(result.OnlyInFirst) != 1 || result.OnlyInFirst[0] != "localhost/local/alpha" {
+		t.Errorf("unexpected only_in_first: %v", result.OnlyInFirst)
+	}
+	// (b)
+	if len(result.OnlyInSecond) != 1 || result.OnlyInSecond[0] != "localhost/local/delta" {
+		t.Errorf("unexpected only_in_second: %v", result.OnlyInSecond)
+	}
+	// (c, d)
+	if len(result.Changed) != 1 ||
+		result.Changed[0].Path != "localhost/local/bravo" ||
+		result.Changed[0].First.Placement != lockjson.ReposStartPlacement ||
+		result.Changed[0].Second.Placement != lockjson.ReposOptPlacement {
+		t.Errorf("unexpected changed: %+v", result.Changed)
+	}
+
+	out, err = testutil.RunVolt("profile", "diff", "work", "not_existing_profile")
+	// (!A, !B)
+	testutil.FailExit(t, out, err)
+}
+
 func getReposList(t *testing.T, lockJSON *lockjson.LockJSON, profileName string) lockjson.ReposList {
 	currentProfile, err := lockJSON.Profiles.FindByName(profileName)
 	if err != nil {
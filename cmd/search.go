@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/vim-volt/volt/lockjson"
+	"github.com/vim-volt/volt/logger"
+)
+
+func init() {
+	cmdMap["search"] = &searchCmd{}
+}
+
+type searchCmd struct {
+	helped bool
+	doc    bool
+}
+
+func (cmd *searchCmd) FlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.SetOutput(os.Stdout)
+	fs.Usage = func() {
+		fmt.Print(`
+Usage
+  volt search [-help] [-doc] {term}
+
+Quick example
+  $ volt search markdown      # will list repositories whose path or description contains "markdown"
+  $ volt search -doc browser  # will also search the first lines of doc files
+
+Description
+  Search repositories in $VOLTPATH/lock.json for {term} (case-insensitive), and list the matched repositories with where {term} was found.
+  This is a local search over lock.json and the files under $VOLTPATH/repos, it does not access the network.
+  The repositories are listed in the following order of where {term} was found:
+    1. "name": {name} of the repository path "{site}/{user}/{name}"
+    2. "path": the repository path
+    3. "description": "description" of the repository in lock.json
+    4. "doc/{file}": the first line of doc files under $VOLTPATH/repos/{repository}/doc (only if -doc option was given)
+  This command exits with 1 if no repository was matched.` + "\n\n")
+		fmt.Println("Options")
+		fs.PrintDefaults()
+		fmt.Println()
+		cmd.helped = true
+	}
+	fs.BoolVar(&cmd.doc, "doc", false, "also search the first lines of doc files")
+	return fs
+}
+
+func (cmd *searchCmd) Run(args []string) int {
+	term, err := cmd.parseArgs(args)
+	if err == ErrShowedHelp {
+		return 0
+	}
+	if err != nil {
+		logger.Error("Failed to parse args: " + err.Error())
+		return 10
+	}
+
+	lockJSON, err := lockjson.ReadNoMigrationMsg()
+	if err != nil {
+		logger.Error("Failed to read lock.json: " + err.Error())
+		return 11
+	}
+
+	results := cmd.search(lockJSON.Repos, term)
+	if len(results) == 0 {
+		return 1
+	}
+	for _, r := range results {
+		fmt.Printf("%s\t(%s)\n", r.repos.Path, r.where)
+	}
+	return 0
+}
+
+func (cmd *searchCmd) parseArgs(args []string) (string, error) {
+	fs := cmd.FlagSet()
+	fs.Parse(args)
+	if cmd.helped {
+		return "", ErrShowedHelp
+	}
+	if len(fs.Args()) != 1 || fs.Arg(0) == "" {
+		fs.Usage()
+		return "", errors.New("volt search requires one search term")
+	}
+	return fs.Arg(0), nil
+}
+
+type searchResult struct {
+	repos *lockjson.Repos
+	// Smaller is better
+	rank int
+	// e.g. "name", "description: {description}", "doc/{file}: {line}"
+	where string
+}
+
+// Returns the repositories which match term, sorted by the rank.
+// The repositories of the same rank are in the order of reposList.
+func (cmd *searchCmd) search(reposList lockjson.ReposList, term string) []searchResult {
+	term = strings.ToLower(term)
+	results := make([]searchResult, 0, len(reposList))
+	for i := range reposList {
+		if r := cmd.match(&reposList[i], term); r != nil {
+			results = append(results, *r)
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].rank < results[j].rank
+	})
+	return results
+}
+
+// Returns the best match of repos, or nil if term is not found
+func (cmd *searchCmd) match(repos *lockjson.Repos, term string) *searchResult {
+	contains := func(s string) bool {
+		return strings.Contains(strings.ToLower(s), term)
+	}
+	reposPath := repos.Path.String()
+	if contains(path.Base(reposPath)) {
+		return &searchResult{repos, 0, "name"}
+	}
+	if contains(reposPath) {
+		return &searchResult{repos, 1, "path"}
+	}
+	if contains(repos.Description) {
+		return &searchResult{repos, 2, "description: " + repos.Description}
+	}
+	if !cmd.doc {
+		return nil
+	}
+	for _, doc := range cmd.readDocFirstLines(repos) {
+		if contains(doc.line) {
+			return &searchResult{repos, 3, "doc/" + doc.name + ": " + doc.line}
+		}
+	}
+	return nil
+}
+
+type docFirstLine struct {
+	name string
+	line string
+}
+
+// Returns the first lines of files under $VOLTPATH/repos/{repos}/doc
+// (sorted by filename). doc/tags and doc/tags-{lang} are skipped.
+// Returns nil if the directory cannot be read (e.g. bare repository).
+func (*searchCmd) readDocFirstLines(repos *lockjson.Repos) []docFirstLine {
+	dir := filepath.Join(repos.SourceDir(), "doc")
+	names, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		return nil
+	}
+	sort.Strings(names)
+	docs := make([]docFirstLine, 0, len(names))
+	for _, name := range names {
+		base := filepath.Base(name)
+		// Generated by ":helptags"
+		if base == "tags" || strings.HasPrefix(base, "tags-") {
+			continue
+		}
+		file, err := os.Open(name)
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(file)
+		if scanner.Scan() {
+			docs = append(docs, docFirstLine{base, strings.TrimSpace(scanner.Text())})
+		}
+		file.Close()
+	}
+	return docs
+}
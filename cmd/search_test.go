@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vim-volt/volt/internal/testutil"
+	"github.com/vim-volt/volt/pathutil"
+)
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) Lists the repositories matched in name, path and description
+// (b) The repositories are ranked by where the term was found
+// (c) Doc files are searched only if -doc option was given
+// (d) doc/tags-{lang} generated by ":helptags" is not searched
+//
+// * Run `volt search markdown` (A, B, a, b)
+// * Run `volt search browser` (A, !B)
+// * Run `volt search -doc browser` (A, B, c)
+// * Run `volt search -doc jump` (A, B, d)
+// * Run `volt search` (!A, !B)
+func TestVoltSearch(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	path := filepath.Join(pathutil.FullReposPath("localhost/local/open"), "doc", "open.txt")
+	os.MkdirAll(filepath.Dir(path), 0755)
+	if err := ioutil.WriteFile(path, []byte("*open.txt* Open URI with your favorite browser\n\nAuthor: tyru\n"), 0644); err != nil {
+		t.Fatal("failed to write " + path)
+	}
+	for name, content := range map[string]string{
+		"tags-ja":       "jump\topen.jax\t/*jump*\n",
+		"tagsearch.txt": "*tagsearch.txt* Jump to tags\n",
+	} {
+		path := filepath.Join(filepath.Dir(path), name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal("failed to write " + path)
+		}
+	}
+	writeLockJSON(t, `{
+  "version": 3,
+  "current_profile_name": "default",
+  "repos": [
+    {"type": "static", "path": "localhost/local/preview", "description": "Preview Markdown files"},
+    {"type": "static", "path": "localhost/markdown/syntax"},
+    {"type": "static", "path": "localhost/local/vim-markdown"},
+    {"type": "static", "path": "localhost/local/open"}
+  ],
+  "profiles": [
+    {
+      "name": "default",
+      "repos_path": []
+    }
+  ]
+}`)
+
+	// =============== run =============== //
+
+	out, err := testutil.RunVolt("search", "markdown")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	// (a, b)
+	expected := "localhost/local/vim-markdown\t(name)\n" +
+		"localhost/markdown/syntax\t(path)\n" +
+		"localhost/local/preview\t(description: Preview Markdown files)\n"
+	if string(out) != expected {
+		t.Errorf("expected:\n%s\nbut got:\n%s", expected, string(out))
+	}
+
+	out, err = testutil.RunVolt("search", "browser")
+	// (!B)
+	if err == nil {
+		t.Error("expected failure exit but exited with success")
+	}
+	// (A)
+	if string(out) != "" {
+		t.Errorf("expected no output but got: %s", string(out))
+	}
+
+	out, err = testutil.RunVolt("search", "-doc", "browser")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	// (c)
+	expected = "localhost/local/open\t(doc/open.txt: *open.txt* Open URI with your favorite browser)\n"
+	if string(out) != expected {
+		t.Errorf("expected:\n%s\nbut got:\n%s", expected, string(out))
+	}
+
+	out, err = testutil.RunVolt("search", "-doc", "jump")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	// (d)
+	expected = "localhost/local/open\t(doc/tagsearch.txt: *tagsearch.txt* Jump to tags)\n"
+	if string(out) != expected {
+		t.Errorf("expected:\n%s\nbut got:\n%s", expected, string(out))
+	}
+
+	out, err = testutil.RunVolt("search")
+	// (!A, !B)
+	testutil.FailExit(t, out, err)
+}
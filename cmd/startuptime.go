@@ -0,0 +1,245 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vim-volt/volt/logger"
+	"github.com/vim-volt/volt/pathutil"
+)
+
+func init() {
+	cmdMap["startuptime"] = &startuptimeCmd{}
+}
+
+type startuptimeCmd struct {
+	helped bool
+	top    int
+	runs   int
+}
+
+func (cmd *startuptimeCmd) FlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.SetOutput(os.Stdout)
+	fs.Usage = func() {
+		fmt.Print(`
+Usage
+  volt startuptime [-help] [-top {count}] [-runs {count}]
+
+Quick example
+  $ volt startuptime          # shows the 10 plugins which take the longest time to load at startup
+  $ volt startuptime -top 0   # shows all plugins
+  $ volt startuptime -runs 5  # shows the average of 5 startups
+
+Description
+  Start Vim with --startuptime option and quit it, and show how long it took to source the files of each repository installed under ~/.vim/pack/volt/{start,opt} (in milliseconds, sorted in descending order).
+  The time of the bundled plugconf is shown as "system". The last line shows the whole startup time.
+
+  The plugins which are loaded lazily (see "s:loaded_on()" of plugconf) are not loaded at startup, so they are not shown. Consider loading the slowest plugins lazily.
+
+  Run 'volt build' before this to measure the current profile. Vim is looked up in the same way as 'volt build' (VOLT_VIM environment variable or "vim" in $PATH).` + "\n\n")
+		fmt.Println("Options")
+		fs.PrintDefaults()
+		fmt.Println()
+		cmd.helped = true
+	}
+	fs.IntVar(&cmd.top, "top", 10, "the number of shown plugins (0 shows all)")
+	fs.IntVar(&cmd.runs, "runs", 1, "start vim this many times and show the average")
+	return fs
+}
+
+func (cmd *startuptimeCmd) Run(args []string) int {
+	err := cmd.parseArgs(args)
+	if err == ErrShowedHelp {
+		return 0
+	}
+	if err != nil {
+		logger.Error("Failed to parse args: " + err.Error())
+		return 10
+	}
+
+	vimExePath, err := pathutil.VimExecutable()
+	if err != nil {
+		logger.Error("Failed to find vim executable: " + err.Error())
+		return 11
+	}
+
+	times, total, err := cmd.measure(vimExePath)
+	if err != nil {
+		logger.Error("Failed to measure startup time: " + err.Error())
+		return 12
+	}
+
+	fmt.Print(cmd.format(times, total))
+	return 0
+}
+
+func (cmd *startuptimeCmd) parseArgs(args []string) error {
+	fs := cmd.FlagSet()
+	fs.Parse(args)
+	if cmd.helped {
+		return ErrShowedHelp
+	}
+	if cmd.top < 0 {
+		fs.Usage()
+		return errors.New("-top must be 0 or greater")
+	}
+	if cmd.runs < 1 {
+		fs.Usage()
+		return errors.New("-runs must be 1 or greater")
+	}
+	if len(fs.Args()) > 0 {
+		fs.Usage()
+		return errors.New("too many arguments")
+	}
+	return nil
+}
+
+// Time to source the files of one repository (or "system")
+type reposStartuptime struct {
+	name string
+	msec float64
+}
+
+// Runs vim cmd.runs times, and returns the average times of repositories
+// and the whole startup time
+func (cmd *startuptimeCmd) measure(vimExePath string) ([]reposStartuptime, float64, error) {
+	sums := make(map[string]float64, 32)
+	var total float64
+	for i := 0; i < cmd.runs; i++ {
+		log, err := cmd.runVim(vimExePath)
+		if err != nil {
+			return nil, 0, err
+		}
+		times, t, err := cmd.parseLog(bytes.NewReader(log))
+		if err != nil {
+			return nil, 0, err
+		}
+		for name, msec := range times {
+			sums[name] += msec
+		}
+		total += t
+	}
+
+	result := make([]reposStartuptime, 0, len(sums))
+	for name, sum := range sums {
+		result = append(result, reposStartuptime{name: name, msec: sum / float64(cmd.runs)})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].msec != result[j].msec {
+			return result[i].msec > result[j].msec
+		}
+		return result[i].name < result[j].name
+	})
+	return result, total / float64(cmd.runs), nil
+}
+
+// Starts and quits vim, and returns the content of --startuptime log
+func (*startuptimeCmd) runVim(vimExePath string) ([]byte, error) {
+	tmp, err := ioutil.TempFile("", "volt-startuptime")
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	vimArgs := []string{"--startuptime", tmp.Name(), "--not-a-term", "-c", "qall!"}
+	logger.Debugf("Executing '%s %s' ...", vimExePath, strings.Join(vimArgs, " "))
+	vim := exec.Command(vimExePath, vimArgs...)
+	if out, err := vim.CombinedOutput(); err != nil {
+		return nil, errors.New("failed to run vim: " + err.Error() + ": " + string(out))
+	}
+	return ioutil.ReadFile(tmp.Name())
+}
+
+// Parses --startuptime log, and returns the "self" times of sourced files
+// per repository, and the clock of the last line.
+//
+// The lines of sourced files are "{clock}  {self+sourced}  {self}: sourcing {file}",
+// and the other lines are "{clock}  {elapsed}: {message}".
+func (cmd *startuptimeCmd) parseLog(r io.Reader) (map[string]float64, float64, error) {
+	times := make(map[string]float64, 32)
+	var total float64
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		// The last clock is the whole startup time
+		if clock, err := strconv.ParseFloat(fields[0], 64); err == nil {
+			total = clock
+		}
+		i := strings.Index(line, ": sourcing ")
+		if len(fields) < 5 || i < 0 || fields[3] != "sourcing" {
+			continue
+		}
+		self, err := strconv.ParseFloat(strings.TrimSuffix(fields[2], ":"), 64)
+		if err != nil {
+			return nil, 0, errors.New("invalid startuptime log: " + line)
+		}
+		file := line[i+len(": sourcing "):]
+		if name := cmd.reposNameOf(file); name != "" {
+			times[name] += self
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, err
+	}
+	return times, total, nil
+}
+
+// Returns the repository path to which file belongs, or "system" for the
+// bundled plugconf. Returns "" if file is not installed by volt.
+// Files under $VOLTPATH/repos are the targets of symlinks which symlink
+// strategy installs.
+func (*startuptimeCmd) reposNameOf(file string) string {
+	if strings.HasPrefix(file, "~/") {
+		file = filepath.Join(pathutil.HomeDir(), file[2:])
+	}
+	for _, dir := range []string{pathutil.VimVoltStartDir(), pathutil.VimVoltOptDir()} {
+		if rel, err := filepath.Rel(dir, file); err == nil && !strings.HasPrefix(rel, "..") {
+			entries := strings.Split(filepath.ToSlash(rel), "/")
+			if len(entries) < 2 {
+				return ""
+			}
+			if entries[0] == "system" {
+				return "system"
+			}
+			return string(pathutil.DecodeReposPath(entries[0]))
+		}
+	}
+	reposDir := filepath.Join(pathutil.VoltPath(), "repos")
+	if rel, err := filepath.Rel(reposDir, file); err == nil && !strings.HasPrefix(rel, "..") {
+		entries := strings.Split(filepath.ToSlash(rel), "/")
+		if len(entries) < 4 {
+			return ""
+		}
+		return strings.Join(entries[:3], "/")
+	}
+	return ""
+}
+
+func (cmd *startuptimeCmd) format(times []reposStartuptime, total float64) string {
+	if cmd.top > 0 && len(times) > cmd.top {
+		times = times[:cmd.top]
+	}
+	var b bytes.Buffer
+	for _, t := range times {
+		fmt.Fprintf(&b, "%.3f\t%s\n", t.msec, t.name)
+	}
+	fmt.Fprintf(&b, "%.3f\ttotal\n", total)
+	return b.String()
+}
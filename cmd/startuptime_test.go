@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/vim-volt/volt/internal/testutil"
+	"github.com/vim-volt/volt/pathutil"
+)
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) The times of sourced files are summed up per repository in descending order
+// (b) The files not installed by volt are not shown
+// (c) The last line shows the whole startup time
+// (d) Only the slowest {count} repositories are shown
+//
+// * Run `volt startuptime` (A, B, a, b, c)
+// * Run `volt startuptime -runs 2` (A, B, a, b, c)
+// * Run `volt startuptime -top 1` (A, B, a, b, c, d)
+func TestVoltStartuptime(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake vim executable is a shell script")
+	}
+
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	optDir := pathutil.VimVoltOptDir()
+	startDir := pathutil.VimVoltStartDir()
+	reposDir := filepath.Join(pathutil.VoltPath(), "repos")
+	log := `
+
+times in msec
+ clock   self+sourced   self:  sourced script
+ clock   elapsed:              other lines
+
+000.008  000.008: --- VIM STARTING ---
+001.189  000.179  000.179: sourcing /usr/share/vim/vim90/debian.vim
+002.000  000.500  000.500: sourcing ` + filepath.Join(optDir, "github.com_tyru_caw.vim", "plugin", "caw.vim") + `
+004.000  001.500  001.000: sourcing ` + filepath.Join(optDir, "github.com_tyru_caw.vim", "autoload", "caw.vim") + `
+005.000  000.250  000.250: sourcing ` + filepath.Join(startDir, "system", "plugin", "bundled_plugconf.vim") + `
+009.000  003.000  003.000: sourcing ` + filepath.Join(reposDir, "github.com", "tyru", "open-browser.vim", "plugin", "openbrowser.vim") + `
+010.000  000.100  000.100: sourcing ~/.vim/pack/volt/start/github.com_tyru_eskk.vim/plugin/eskk.vim
+012.345  000.196: opening buffers
+`
+	sample := filepath.Join(os.Getenv("HOME"), "startuptime.log")
+	if err := ioutil.WriteFile(sample, []byte(log), 0644); err != nil {
+		t.Fatal("failed to write " + sample)
+	}
+	// Fake vim executable which writes the sample log to the file of
+	// --startuptime argument
+	fakeVim := filepath.Join(os.Getenv("HOME"), "fake-vim")
+	script := "#!/bin/sh\nif [ \"$1\" = --startuptime ]; then\n  cp " + sample + " \"$2\"\nfi\n"
+	if err := ioutil.WriteFile(fakeVim, []byte(script), 0755); err != nil {
+		t.Fatal("failed to write " + fakeVim)
+	}
+	os.Setenv("VOLT_VIM", fakeVim)
+	defer os.Unsetenv("VOLT_VIM")
+
+	all := "3.000\tgithub.com/tyru/open-browser.vim\n" +
+		"1.500\tgithub.com/tyru/caw.vim\n" +
+		"0.250\tsystem\n" +
+		"0.100\tgithub.com/tyru/eskk.vim\n" +
+		"12.345\ttotal\n"
+
+	// =============== run =============== //
+
+	for _, tt := range []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"startuptime"}, all},
+		{[]string{"startuptime", "-runs", "2"}, all},
+		{[]string{"startuptime", "-top", "1"}, "3.000\tgithub.com/tyru/open-browser.vim\n12.345\ttotal\n"},
+	} {
+		out, err := testutil.RunVolt(tt.args...)
+		// (A, B)
+		testutil.SuccessExit(t, out, err)
+		// (a, b, c, d)
+		if string(out) != tt.expected {
+			t.Errorf("volt %v: expected %q but got %q", tt.args, tt.expected, string(out))
+		}
+	}
+}
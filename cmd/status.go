@@ -0,0 +1,365 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/vim-volt/volt/cmd/builder"
+	"github.com/vim-volt/volt/cmd/buildinfo"
+	"github.com/vim-volt/volt/config"
+	"github.com/vim-volt/volt/gitutil"
+	"github.com/vim-volt/volt/lockjson"
+	"github.com/vim-volt/volt/logger"
+	"github.com/vim-volt/volt/pathutil"
+	"github.com/vim-volt/volt/plugconf"
+)
+
+func init() {
+	cmdMap["status"] = &statusCmd{}
+}
+
+type statusCmd struct {
+	helped  bool
+	quiet   bool
+	summary bool
+	profile string
+	json    bool
+}
+
+func (cmd *statusCmd) FlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.SetOutput(os.Stdout)
+	fs.Usage = func() {
+		fmt.Print(`
+Usage
+  volt status [-help] [-quiet]
+  volt status -summary [-profile {name}] [-json]
+
+Quick example
+  $ volt status # will show what 'volt build' is going to change
+  $ volt status -quiet || volt build # will build only when it is needed
+  $ volt status -summary # will show profiles and repositories of current profile
+  $ volt status -profile foo -json # will show repositories of profile "foo" as JSON
+
+Description
+  Check if ~/.vim/pack/volt directory, ~/.vim/vimrc and ~/.vim/gvimrc are up to date with $VOLTPATH (lock.json, repos, plugconf and rc).
+  This command exits with 0 when they are up to date, otherwise exits with 1.
+  This command does not lock $VOLTPATH, so it can be run while other volt command is running.
+
+  If -summary was given, the summary of lock.json is shown instead: current profile name, the number of repositories of each profile, and the repositories of current profile (or profile {name} if -profile was given) with their type, short version and placement. The repositories whose installed directory does not exist under ~/.vim/pack/volt/start or ~/.vim/pack/volt/opt are marked as "needs rebuild". If -json was given, the summary is printed as JSON. -profile and -json imply -summary. This command exits with 0 unless an error occurred.` + "\n\n")
+		fmt.Println("Options")
+		fs.PrintDefaults()
+		fmt.Println()
+		cmd.helped = true
+	}
+	fs.BoolVar(&cmd.quiet, "quiet", false, "print nothing, only exit with status")
+	fs.BoolVar(&cmd.summary, "summary", false, "show the summary of profiles and repositories")
+	fs.StringVar(&cmd.profile, "profile", "", "show the repositories of the profile instead of current profile (implies -summary)")
+	fs.BoolVar(&cmd.json, "json", false, "print the summary as JSON (implies -summary)")
+	return fs
+}
+
+func (cmd *statusCmd) Run(args []string) int {
+	err := cmd.parseArgs(args)
+	if err == ErrShowedHelp {
+		return 0
+	}
+	if err != nil {
+		logger.Error("Failed to parse args: " + err.Error())
+		return 10
+	}
+
+	if cmd.summary {
+		summary, err := cmd.getSummary()
+		if err != nil {
+			logger.Error("Failed to get status: " + err.Error())
+			return 11
+		}
+		if cmd.json {
+			b, err := json.MarshalIndent(summary, "", "  ")
+			if err != nil {
+				logger.Error("Failed to get status: " + err.Error())
+				return 11
+			}
+			fmt.Println(string(b))
+		} else {
+			fmt.Print(cmd.formatSummary(summary))
+		}
+		return 0
+	}
+
+	changes, err := cmd.getChanges()
+	if err != nil {
+		logger.Error("Failed to get status: " + err.Error())
+		return 11
+	}
+
+	if !cmd.quiet {
+		if len(changes) == 0 {
+			fmt.Println("Up to date.")
+		}
+		for _, change := range changes {
+			fmt.Println(change)
+		}
+	}
+	if len(changes) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func (cmd *statusCmd) parseArgs(args []string) error {
+	fs := cmd.FlagSet()
+	fs.Parse(args)
+	if cmd.helped {
+		return ErrShowedHelp
+	}
+	if fs.NArg() > 0 {
+		return errors.New("'volt status' receives no arguments")
+	}
+	if cmd.quiet && (cmd.summary || cmd.profile != "" || cmd.json) {
+		return errors.New("-quiet cannot be used with -summary, -profile and -json")
+	}
+	if cmd.profile != "" || cmd.json {
+		cmd.summary = true
+	}
+	return nil
+}
+
+// JSON output of "volt status -summary -json"
+type statusSummary struct {
+	CurrentProfile string               `json:"current_profile"`
+	Profiles       []statusProfileCount `json:"profiles"`
+	// The profile whose repositories are shown
+	Profile string              `json:"profile"`
+	Repos   []statusReposStatus `json:"repos"`
+}
+
+type statusProfileCount struct {
+	Name  string `json:"name"`
+	Repos int    `json:"repos"`
+}
+
+type statusReposStatus struct {
+	Type      lockjson.ReposType      `json:"type"`
+	Path      pathutil.ReposPath      `json:"path"`
+	Version   string                  `json:"version"`
+	Placement lockjson.ReposPlacement `json:"placement"`
+	// Installed is false if the installed directory does not exist
+	// ("volt build" is needed)
+	Installed bool `json:"installed"`
+}
+
+// Returns the summary of lock.json for "volt status -summary"
+func (cmd *statusCmd) getSummary() (*statusSummary, error) {
+	lockJSON, err := lockjson.Read()
+	if err != nil {
+		return nil, errors.New("could not read lock.json: " + err.Error())
+	}
+	profileName := cmd.profile
+	if profileName == "" {
+		profileName = lockJSON.CurrentProfileName
+	}
+	profile, err := lockJSON.Profiles.FindByName(profileName)
+	if err != nil {
+		return nil, err
+	}
+	reposList, err := lockJSON.GetReposListByProfile(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &statusSummary{
+		CurrentProfile: lockJSON.CurrentProfileName,
+		Profiles:       make([]statusProfileCount, 0, len(lockJSON.Profiles)),
+		Profile:        profileName,
+		Repos:          make([]statusReposStatus, 0, len(reposList)),
+	}
+	for i := range lockJSON.Profiles {
+		summary.Profiles = append(summary.Profiles, statusProfileCount{
+			Name:  lockJSON.Profiles[i].Name,
+			Repos: len(lockJSON.Profiles[i].ReposPath),
+		})
+	}
+	for i := range reposList {
+		repos := &reposList[i]
+		summary.Repos = append(summary.Repos, statusReposStatus{
+			Type:      repos.Type,
+			Path:      repos.Path,
+			Version:   repos.Version,
+			Placement: repos.Placement,
+			Installed: pathutil.Exists(repos.EncodedPath()),
+		})
+	}
+	return summary, nil
+}
+
+func (*statusCmd) formatSummary(summary *statusSummary) string {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "Current profile: %s\n", summary.CurrentProfile)
+	b.WriteString("Profiles:\n")
+	for _, p := range summary.Profiles {
+		mark := " "
+		if p.Name == summary.CurrentProfile {
+			mark = "*"
+		}
+		fmt.Fprintf(&b, "%s %s (%d repositories)\n", mark, p.Name, p.Repos)
+	}
+	fmt.Fprintf(&b, "Repositories of profile '%s':\n", summary.Profile)
+	if len(summary.Repos) == 0 {
+		b.WriteString("  (none)\n")
+	}
+	for _, r := range summary.Repos {
+		attrs := []string{string(r.Type)}
+		if r.Type == lockjson.ReposGitType {
+			attrs = append(attrs, shortVersion(r.Version))
+		}
+		attrs = append(attrs, string(r.Placement))
+		fmt.Fprintf(&b, "  %s (%s)", r.Path, strings.Join(attrs, ", "))
+		if !r.Installed {
+			b.WriteString(" needs rebuild")
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// Returns the abbreviated commit hash like "git log --oneline".
+// Tag and branch names are returned as they are
+func shortVersion(version string) string {
+	if gitutil.IsFullHash(version) {
+		return version[:7]
+	}
+	return version
+}
+
+// Returns messages of the differences which 'volt build' is going to change.
+// Returns empty list if ~/.vim/pack/volt is up to date.
+func (cmd *statusCmd) getChanges() ([]string, error) {
+	// Read config.toml
+	cfg, err := config.Read()
+	if err != nil {
+		return nil, errors.New("could not read config.toml: " + err.Error())
+	}
+
+	// Read lock.json
+	lockJSON, err := lockjson.ReadNoMigrationMsg()
+	if err != nil {
+		return nil, errors.New("could not read lock.json: " + err.Error())
+	}
+	profile, err := lockJSON.Profiles.FindByName(lockJSON.CurrentProfileName)
+	if err != nil {
+		return nil, err
+	}
+	reposList, err := lockJSON.GetReposListByProfile(profile)
+	if err != nil {
+		return nil, err
+	}
+	if err := builder.ResolveVersions(reposList); err != nil {
+		return nil, err
+	}
+
+	// Read build-info.json
+	if !pathutil.Exists(pathutil.BuildInfoJSON()) {
+		return []string{"not built yet: " + pathutil.BuildInfoJSON()}, nil
+	}
+	buildInfo, err := buildinfo.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	strategy := (&buildCmd{}).getStrategy(cfg, lockJSON)
+	changes := make([]string, 0, 8)
+	if buildInfo.Version != currentBuildInfoVersion {
+		changes = append(changes, fmt.Sprintf("build-info.json version: %d -> %d", buildInfo.Version, currentBuildInfoVersion))
+	}
+	if buildInfo.Strategy != strategy {
+		changes = append(changes, fmt.Sprintf("strategy: %s -> %s", buildInfo.Strategy, strategy))
+	}
+	if buildInfo.Profile != "" && buildInfo.Profile != lockJSON.CurrentProfileName {
+		changes = append(changes, fmt.Sprintf("profile: %s -> %s", buildInfo.Profile, lockJSON.CurrentProfileName))
+	}
+	if info := currentVimVersion(); info != nil && buildInfo.VimVersion != "" && !info.SameMajor(buildInfo.VimVersion) {
+		changes = append(changes, fmt.Sprintf("vim: %s -> %s", buildInfo.VimVersion, info))
+	}
+
+	// Repositories
+	for _, reposPath := range buildInfo.ChangedReposPathList(reposList) {
+		changes = append(changes, "repository: "+reposPath.String())
+	}
+	if strategy == config.CopyBuilder {
+		// Static repositories are copied again when they are modified
+		for i := range reposList {
+			if reposList[i].Type != lockjson.ReposStaticType && reposList[i].Type != lockjson.ReposLocalType {
+				continue
+			}
+			r := buildInfo.Repos.FindByReposPath(reposList[i].Path)
+			if r != nil && cmd.modifiedAfter(reposList[i].ReposDir(), r.Version) {
+				changes = append(changes, "repository: "+r.Path.String())
+			}
+		}
+	}
+
+	// vimrc and gvimrc
+	vimDir := pathutil.VimDir()
+	for _, rc := range []struct{ src, dst string }{
+		{pathutil.ProfileVimrc, filepath.Join(vimDir, pathutil.Vimrc)},
+		{pathutil.ProfileGvimrc, filepath.Join(vimDir, pathutil.Gvimrc)},
+	} {
+		base := &builder.BaseBuilder{}
+		changed, err := base.RCFileChanged(lockJSON.CurrentProfileName, rc.src, rc.dst)
+		if err != nil {
+			return nil, err
+		}
+		if !changed {
+			continue
+		}
+		// Show the reason if the content differs from the source
+		if err := base.VerifyRCFile(lockJSON.CurrentProfileName, rc.src, rc.dst); err != nil {
+			changes = append(changes, "rc file: "+err.Error())
+		} else {
+			changes = append(changes, "rc file: "+rc.dst)
+		}
+	}
+
+	// Bundled plugconf
+	content, merr := plugconf.GenerateBundlePlugconf(lockJSON.CurrentProfileName, reposList)
+	if merr.ErrorOrNil() != nil {
+		return nil, merr
+	}
+	installed, err := ioutil.ReadFile(pathutil.BundledPlugConf())
+	if err != nil || string(installed) != string(content) {
+		changes = append(changes, "bundled plugconf: "+pathutil.BundledPlugConf())
+	}
+
+	return changes, nil
+}
+
+// Returns true if any file under dir was modified after the time
+// (RFC3339 format recorded in build-info.json)
+func (*statusCmd) modifiedAfter(dir, t string) bool {
+	builtTime, err := time.Parse(time.RFC3339, t)
+	if err != nil {
+		return true
+	}
+	modified := false
+	err = filepath.Walk(dir, func(_ string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// build-info.json does not have sub-second precision
+		if builtTime.Before(fi.ModTime().Truncate(time.Second)) {
+			modified = true
+		}
+		return nil
+	})
+	return err != nil || modified
+}
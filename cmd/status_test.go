@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vim-volt/volt/internal/testutil"
+	"github.com/vim-volt/volt/lockjson"
+	"github.com/vim-volt/volt/pathutil"
+)
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (C) Prints nothing
+//
+// * Run `volt status -quiet` (up to date) (A, B, C)
+// * Run `volt status -quiet` (not built yet) (A, !B, C)
+// * Run `volt status -quiet` (repository was disabled) (A, !B, C)
+// * Run `volt status -quiet` (vimrc was modified) (A, !B, C)
+// * Run `volt status -quiet` (plugconf was modified) (A, !B, C)
+func TestVoltStatusQuiet(t *testing.T) {
+	reposPath := pathutil.ReposPath("localhost/local/hello")
+
+	for _, tt := range []struct {
+		name     string
+		upToDate bool
+		modify   func(t *testing.T)
+	}{
+		{"up to date", true, func(t *testing.T) {}},
+		{"not built yet", false, func(t *testing.T) {
+			os.RemoveAll(pathutil.VimVoltDir())
+		}},
+		{"repository was disabled", false, func(t *testing.T) {
+			lockJSON, err := lockjson.Read()
+			if err != nil {
+				t.Fatal("lockjson.Read() returned non-nil error: " + err.Error())
+			}
+			lockJSON.Profiles[0].ReposPath = lockJSON.Profiles[0].ReposPath[:0]
+			if err := lockJSON.Write(); err != nil {
+				t.Fatal("lockJSON.Write() returned non-nil error: " + err.Error())
+			}
+		}},
+		{"vimrc was modified", false, func(t *testing.T) {
+			vimrc := filepath.Join(pathutil.RCDir("default"), pathutil.ProfileVimrc)
+			if err := ioutil.WriteFile(vimrc, []byte("\" modified\n"), 0644); err != nil {
+				t.Fatal("failed to write " + vimrc)
+			}
+		}},
+		{"plugconf was modified", false, func(t *testing.T) {
+			content := "function! s:config()\n  let g:hello = 1\nendfunction\n"
+			os.MkdirAll(filepath.Dir(pathutil.Plugconf(reposPath)), 0755)
+			if err := ioutil.WriteFile(pathutil.Plugconf(reposPath), []byte(content), 0644); err != nil {
+				t.Fatal("failed to write plugconf")
+			}
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			testProfileMatrix(t, func(t *testing.T, strategy string) {
+				// =============== setup =============== //
+
+				testutil.SetUpEnv(t)
+				teardown := testutil.SetUpRepos(t, "hello", lockjson.ReposStaticType, []pathutil.ReposPath{reposPath}, strategy)
+				defer teardown()
+				testutil.InstallConfig(t, "strategy-"+strategy+".toml")
+				installProfileRC(t, "default", "vimrc-nomagic.vim", pathutil.ProfileVimrc)
+
+				out, err := testutil.RunVolt("build")
+				testutil.SuccessExit(t, out, err)
+
+				tt.modify(t)
+
+				// =============== run =============== //
+
+				out, err = testutil.RunVolt("status", "-quiet")
+				// (A)
+				outstr := string(out)
+				if strings.Contains(outstr, "[WARN]") || strings.Contains(outstr, "[ERROR]") {
+					t.Errorf("expected no error but has error: %s", outstr)
+				}
+				// (B)
+				if tt.upToDate && err != nil {
+					t.Errorf("expected success exit but exited with failure: %s", err.Error())
+				} else if !tt.upToDate && err == nil {
+					t.Error("expected failure exit but exited with success")
+				}
+				// (C)
+				if outstr != "" {
+					t.Errorf("expected no output but got: %s", outstr)
+				}
+			})
+		})
+	}
+}
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) Shows that the installed vimrc differs from the source
+// (b) `volt build` updates the installed vimrc with the reason
+//
+// * Run `volt status` (vimrc source was modified) (A, !B, a)
+// * Run `volt build` and `volt status` (A, B, b)
+func TestVoltStatusRCFile(t *testing.T) {
+	testProfileMatrix(t, func(t *testing.T, strategy string) {
+		// =============== setup =============== //
+
+		testutil.SetUpEnv(t)
+		reposPathList := []pathutil.ReposPath{"localhost/local/hello"}
+		teardown := testutil.SetUpRepos(t, "hello", lockjson.ReposStaticType, reposPathList, strategy)
+		defer teardown()
+		testutil.InstallConfig(t, "strategy-"+strategy+".toml")
+		installProfileRC(t, "default", "vimrc-nomagic.vim", pathutil.ProfileVimrc)
+		out, err := testutil.RunVolt("build")
+		testutil.SuccessExit(t, out, err)
+
+		src := filepath.Join(pathutil.RCDir("default"), pathutil.ProfileVimrc)
+		dst := filepath.Join(pathutil.VimDir(), pathutil.Vimrc)
+		if err := ioutil.WriteFile(src, []byte("\" modified\n"), 0644); err != nil {
+			t.Fatal("failed to write " + src)
+		}
+		reason := dst + " differs from " + src
+
+		// =============== run =============== //
+
+		out, err = testutil.RunVolt("status")
+		// (!B)
+		if err == nil {
+			t.Error("expected failure exit but exited with success")
+		}
+		// (A, a)
+		if expected := "rc file: " + reason + "\n"; string(out) != expected {
+			t.Errorf("expected %q but got %q", expected, string(out))
+		}
+
+		out, err = testutil.RunVolt("build")
+		// (A, B)
+		testutil.SuccessExit(t, out, err)
+		// (b)
+		if expected := "Updating " + dst + " (" + reason + ")"; !strings.Contains(string(out), expected) {
+			t.Errorf("expected %q but got: %s", expected, string(out))
+		}
+		out, err = testutil.RunVolt("status")
+		// (A, B)
+		testutil.SuccessExit(t, out, err)
+	})
+}
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) Shows current profile, the number of repositories of each profile, and the repositories of current profile
+// (b) Shows "needs rebuild" for the repository which is not installed
+// (c) Shows the repositories of the profile given by -profile as JSON
+//
+// * Run `volt status -summary` (A, B, a)
+// * Run `volt status -summary` after removing the installed repository (A, B, b)
+// * Run `volt status -profile foo -json` (A, B, c)
+func TestVoltStatusSummary(t *testing.T) {
+	testProfileMatrix(t, func(t *testing.T, strategy string) {
+		// =============== setup =============== //
+
+		testutil.SetUpEnv(t)
+		reposPath := pathutil.ReposPath("localhost/local/hello")
+		teardown := testutil.SetUpRepos(t, "hello", lockjson.ReposStaticType, []pathutil.ReposPath{reposPath}, strategy)
+		defer teardown()
+		testutil.InstallConfig(t, "strategy-"+strategy+".toml")
+		out, err := testutil.RunVolt("build")
+		testutil.SuccessExit(t, out, err)
+		out, err = testutil.RunVolt("profile", "new", "foo")
+		testutil.SuccessExit(t, out, err)
+
+		// =============== run =============== //
+
+		out, err = testutil.RunVolt("status", "-summary")
+		// (A, B)
+		testutil.SuccessExit(t, out, err)
+		// (a)
+		expected := "Current profile: default\n" +
+			"Profiles:\n" +
+			"* default (1 repositories)\n" +
+			"  foo (0 repositories)\n" +
+			"Repositories of profile 'default':\n" +
+			"  localhost/local/hello (static, opt)\n"
+		if string(out) != expected {
+			t.Errorf("expected %q but got %q", expected, string(out))
+		}
+
+		if err := os.RemoveAll(pathutil.EncodeReposPath(reposPath)); err != nil {
+			t.Fatal("failed to remove installed repository: " + err.Error())
+		}
+		out, err = testutil.RunVolt("status", "-summary")
+		// (A, B)
+		testutil.SuccessExit(t, out, err)
+		// (b)
+		if expected := "  localhost/local/hello (static, opt) needs rebuild\n"; !strings.Contains(string(out), expected) {
+			t.Errorf("expected %q but got: %s", expected, string(out))
+		}
+
+		out, err = testutil.RunVolt("status", "-profile", "foo", "-json")
+		// (A, B)
+		testutil.SuccessExit(t, out, err)
+		// (c)
+		var summary statusSummary
+		if err := json.Unmarshal(out, &summary); err != nil {
+			t.Fatal("failed to parse JSON: " + err.Error())
+		}
+		if summary.CurrentProfile != "default" || summary.Profile != "foo" || len(summary.Profiles) != 2 || len(summary.Repos) != 0 {
+			t.Errorf("unexpected summary: %+v", summary)
+		}
+	})
+}
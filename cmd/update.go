@@ -0,0 +1,406 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/vim-volt/volt/gitutil"
+	"github.com/vim-volt/volt/lockjson"
+	"github.com/vim-volt/volt/logger"
+	"github.com/vim-volt/volt/pathutil"
+	"github.com/vim-volt/volt/transaction"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+func init() {
+	cmdMap["update"] = &updateCmd{}
+}
+
+type updateCmd struct {
+	helped      bool
+	interactive bool
+	yes         bool
+	offline     bool
+	dryRun      bool
+	selected    reposListFlag
+	pinned      reposListFlag
+}
+
+// reposListFlag is the value of the option which can be given multiple times
+type reposListFlag []string
+
+func (f *reposListFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *reposListFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+func (cmd *updateCmd) FlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.SetOutput(os.Stdout)
+	fs.Usage = func() {
+		fmt.Print(`
+Usage
+  volt update [-help] [-offline] [-dry-run] (-interactive | -yes | -select {repository} ... | -pin {repository} ...) [{repository} ...]
+
+Quick example
+  $ volt update -interactive              # asks whether to update, skip or pin each outdated repository
+  $ volt update -yes                      # updates all outdated repositories
+  $ volt update -yes -dry-run             # shows how lock.json is changed by updating all outdated repositories
+  $ volt update -select tyru/caw.vim      # updates only tyru/caw.vim, and skips the others
+  $ volt update -pin tyru/caw.vim         # does not update tyru/caw.vim by 'volt update' after this
+
+Description
+  Update the locked revision ("version" of $VOLTPATH/lock.json) of the outdated git repositories to the latest commit of the tracked branch, and build ~/.vim/pack/volt . The outdated repositories are the ones which 'volt outdated' lists (it fetches them unless -offline option was given). If {repository} list was given, only the repositories are checked.
+
+  What to do with each outdated repository is chosen by:
+    * -interactive: asks "update", "skip" or "pin" for each repository. "quit" skips the rest.
+    * -yes: updates all.
+    * -select {repository}: updates the repository, and skips the others. This option can be given multiple times.
+    * -pin {repository}: pins the repository. This option can be given multiple times, and can be used with -select.
+  Pinned repositories have "pinned": true in lock.json, and 'volt update' does not show or update them until "pinned" is removed from lock.json.
+
+  The choices are applied together after all repositories were chosen: the worktree of non-bare repositories is fast-forwarded to the latest commit, and lock.json is written once. If the worktree of any chosen repository has changes or local commits which are not in the tracked branch, nothing is updated.
+
+  If -dry-run option was given (or VOLT_DRY_RUN environment variable is not empty), the difference of lock.json is shown instead of writing it, and repositories are neither fetched (same as -offline) nor updated.` + "\n\n")
+		fmt.Println("Options")
+		fs.PrintDefaults()
+		fmt.Println()
+		cmd.helped = true
+	}
+	fs.BoolVar(&cmd.interactive, "interactive", false, "choose what to do with each outdated repository")
+	fs.BoolVar(&cmd.yes, "yes", false, "update all outdated repositories")
+	fs.BoolVar(&cmd.offline, "offline", false, "use only already fetched refs (does not fetch)")
+	fs.BoolVar(&cmd.dryRun, "dry-run", cmd.dryRun, "show the difference of lock.json instead of updating")
+	fs.Var(&cmd.selected, "select", "update {repository} and skip the others (can be given multiple times)")
+	fs.Var(&cmd.pinned, "pin", "pin {repository} (can be given multiple times)")
+	return fs
+}
+
+func (cmd *updateCmd) Run(args []string) int {
+	args, err := cmd.parseArgs(args)
+	if err == ErrShowedHelp {
+		return 0
+	}
+	if err != nil {
+		logger.Error("Failed to parse args: " + err.Error())
+		return 10
+	}
+
+	// Begin transaction
+	err = transaction.Create()
+	if err != nil {
+		logger.Error("Failed to begin transaction: " + err.Error())
+		return 11
+	}
+	defer transaction.Remove()
+
+	err = cmd.doUpdate(args)
+	if err != nil {
+		logger.Error("Failed to update: " + err.Error())
+		return 12
+	}
+	return 0
+}
+
+func (cmd *updateCmd) setDryRun() {
+	cmd.dryRun = true
+}
+
+func (cmd *updateCmd) parseArgs(args []string) ([]string, error) {
+	fs := cmd.FlagSet()
+	fs.Parse(args)
+	if cmd.helped {
+		return nil, ErrShowedHelp
+	}
+	modes := 0
+	for _, given := range []bool{cmd.interactive, cmd.yes, len(cmd.selected) > 0 || len(cmd.pinned) > 0} {
+		if given {
+			modes++
+		}
+	}
+	if modes != 1 {
+		fs.Usage()
+		return nil, errors.New("one of -interactive, -yes or -select / -pin must be given")
+	}
+	return fs.Args(), nil
+}
+
+const (
+	fmtPinned  = "# %s > pinned"
+	fmtSkipped = "# %s > skipped"
+)
+
+// What to do with an outdated repository
+type updateChoice int
+
+const (
+	updateSkip updateChoice = iota
+	updateApply
+	updatePin
+)
+
+func (cmd *updateCmd) doUpdate(args []string) error {
+	// Read lock.json
+	lockJSON, err := lockjson.Read()
+	if err != nil {
+		return errors.New("could not read lock.json: " + err.Error())
+	}
+	before, err := lockJSON.Marshal()
+	if err != nil {
+		return err
+	}
+
+	// Pin repositories of -pin option
+	statusList := make([]string, 0, len(lockJSON.Repos))
+	modified := false
+	for _, arg := range cmd.pinned {
+		repos, err := cmd.findRepos(arg, lockJSON)
+		if err != nil {
+			return err
+		}
+		repos.Pinned = true
+		statusList = append(statusList, fmt.Sprintf(fmtPinned, repos.Path))
+		modified = true
+	}
+
+	// Get outdated repositories except pinned ones
+	outdatedCmd := &outdatedCmd{offline: cmd.offline || cmd.dryRun}
+	reposList, err := outdatedCmd.getReposList(args, lockJSON)
+	if err != nil {
+		return err
+	}
+	unpinned := make([]lockjson.Repos, 0, len(reposList))
+	for i := range reposList {
+		if !reposList[i].Pinned {
+			unpinned = append(unpinned, reposList[i])
+		}
+	}
+	outdated, err := outdatedCmd.getOutdated(unpinned)
+	if err != nil {
+		return err
+	}
+
+	choices, err := cmd.choose(outdated, lockJSON)
+	if err != nil {
+		return err
+	}
+
+	// Check all repositories before changing anything
+	for i := range outdated {
+		if choices[i] != updateApply {
+			continue
+		}
+		if err := cmd.checkFastForward(&outdated[i]); err != nil {
+			return fmt.Errorf("cannot update %s: %s", outdated[i].reposPath, err.Error())
+		}
+	}
+
+	updated := false
+	for i := range outdated {
+		o := &outdated[i]
+		repos, err := lockJSON.Repos.FindByPath(o.reposPath)
+		if err != nil {
+			return err
+		}
+		switch choices[i] {
+		case updateApply:
+			if !cmd.dryRun {
+				if err := cmd.fastForward(o); err != nil {
+					return fmt.Errorf("failed to update %s: %s", o.reposPath, err.Error())
+				}
+			}
+			setReposVersion(repos, o.tip)
+			statusList = append(statusList, fmt.Sprintf(fmtRevUpdate, o.reposPath, o.version, o.tip))
+			updated = true
+			modified = true
+		case updatePin:
+			repos.Pinned = true
+			statusList = append(statusList, fmt.Sprintf(fmtPinned, o.reposPath))
+			modified = true
+		default:
+			statusList = append(statusList, fmt.Sprintf(fmtSkipped, o.reposPath))
+		}
+	}
+
+	if cmd.dryRun {
+		return (&profileCmd{}).showLockJSONDiff(before, lockJSON)
+	}
+
+	if modified {
+		// Write to lock.json
+		err = lockJSON.Write()
+		if err != nil {
+			return errors.New("could not write to lock.json: " + err.Error())
+		}
+	}
+
+	if updated {
+		// Build ~/.vim/pack/volt dir
+		err = (&buildCmd{}).doBuild(false)
+		if err != nil {
+			return errors.New("could not build " + pathutil.VimVoltDir() + ": " + err.Error())
+		}
+	}
+
+	// Show results
+	for i := range statusList {
+		fmt.Println(statusList[i])
+	}
+	return nil
+}
+
+// Returns the choice of each outdated repository by the options
+func (cmd *updateCmd) choose(outdated []outdatedRepos, lockJSON *lockjson.LockJSON) ([]updateChoice, error) {
+	choices := make([]updateChoice, len(outdated))
+	if cmd.interactive {
+		return choices, cmd.ask(outdated, choices)
+	}
+	if cmd.yes {
+		for i := range choices {
+			choices[i] = updateApply
+		}
+		return choices, nil
+	}
+
+	// -select option (-pin option was already applied)
+	indexes := make(map[pathutil.ReposPath]int, len(outdated))
+	for i := range outdated {
+		indexes[outdated[i].reposPath] = i
+	}
+	for _, arg := range cmd.selected {
+		repos, err := cmd.findRepos(arg, lockJSON)
+		if err != nil {
+			return nil, err
+		}
+		if i, exists := indexes[repos.Path]; exists {
+			choices[i] = updateApply
+		} else if repos.Pinned {
+			logger.Warn(repos.Path.String() + " is pinned")
+		} else {
+			logger.Info(repos.Path.String() + " is up to date")
+		}
+	}
+	return choices, nil
+}
+
+func (*updateCmd) findRepos(arg string, lockJSON *lockjson.LockJSON) (*lockjson.Repos, error) {
+	reposPath, err := pathutil.NormalizeRepos(arg)
+	if err != nil {
+		return nil, err
+	}
+	repos, err := lockJSON.Repos.FindByPath(reposPath)
+	if err != nil {
+		return nil, errors.New("'" + reposPath.String() + "' does not exist in lock.json")
+	}
+	return repos, nil
+}
+
+// Asks the choice of each outdated repository.
+// The rest are skipped if "quit" was answered or the input was closed.
+func (cmd *updateCmd) ask(outdated []outdatedRepos, choices []updateChoice) error {
+	reader := bufio.NewReader(os.Stdin)
+	for i := range outdated {
+		fmt.Printf("%s: %s\n", outdated[i].reposPath, outdated[i].format())
+		for {
+			fmt.Print("[u]pdate, [s]kip, [p]in or [q]uit? ")
+			line, err := reader.ReadString('\n')
+			if err != nil && err != io.EOF {
+				return err
+			}
+			answer := strings.ToLower(strings.TrimSpace(line))
+			if answer == "q" || answer == "quit" || (err == io.EOF && answer == "") {
+				fmt.Println()
+				return nil
+			}
+			if answer == "u" || answer == "update" {
+				choices[i] = updateApply
+			} else if answer == "s" || answer == "skip" {
+				choices[i] = updateSkip
+			} else if answer == "p" || answer == "pin" {
+				choices[i] = updatePin
+			} else {
+				continue
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// Returns an error if the worktree of the repository cannot be
+// fast-forwarded to o.tip.
+// Bare repositories have no worktree to be updated.
+func (cmd *updateCmd) checkFastForward(o *outdatedRepos) error {
+	r, err := git.PlainOpen(pathutil.FullReposPath(o.reposPath))
+	if err != nil {
+		return errors.New("failed to open repository: " + err.Error())
+	}
+	cfg, err := r.Config()
+	if err != nil {
+		return errors.New("failed to get repository config: " + err.Error())
+	}
+	if cfg.Core.IsBare {
+		return nil
+	}
+	head, err := gitutil.GetHEADRepository(r)
+	if err != nil {
+		return errors.New("failed to get HEAD revision: " + err.Error())
+	}
+	if head == o.tip {
+		return nil
+	}
+	wt, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+	st, err := wt.Status()
+	if err != nil {
+		return err
+	}
+	if !st.IsClean() {
+		return errors.New("the worktree has changes")
+	}
+	if n, err := gitutil.CountNewCommits(r, o.tip, head); err != nil {
+		return err
+	} else if n > 0 {
+		return fmt.Errorf("HEAD has %d commits which are not in the tracked branch", n)
+	}
+	return nil
+}
+
+// Fast-forwards current branch of non-bare repository to o.tip
+func (cmd *updateCmd) fastForward(o *outdatedRepos) error {
+	r, err := git.PlainOpen(pathutil.FullReposPath(o.reposPath))
+	if err != nil {
+		return err
+	}
+	cfg, err := r.Config()
+	if err != nil {
+		return err
+	}
+	if cfg.Core.IsBare {
+		return nil
+	}
+	head, err := gitutil.GetHEADRepository(r)
+	if err != nil || head == o.tip {
+		return err
+	}
+	wt, err := r.Worktree()
+	if err != nil {
+		return err
+	}
+	return wt.Reset(&git.ResetOptions{
+		Commit: plumbing.NewHash(o.tip),
+		Mode:   git.HardReset,
+	})
+}
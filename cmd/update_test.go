@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/vim-volt/volt/gitutil"
+	"github.com/vim-volt/volt/internal/testutil"
+	"github.com/vim-volt/volt/lockjson"
+	"github.com/vim-volt/volt/pathutil"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) Only selected repositories are updated to the latest commit
+// (b) Pinned repositories are marked as "pinned" in lock.json
+// (c) Updated repositories are installed
+// (d) The worktree of updated repositories is fast-forwarded
+//
+// * Run `volt update -select {repository} -pin {repository}` (A, B, a, b, c, d)
+func TestVoltUpdateSelect(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	testutil.InstallConfig(t, "strategy-copy.toml")
+	versions := setUpOutdatedRepos(t, "alpha", "bravo", "charlie")
+
+	// =============== run =============== //
+
+	out, err := testutil.RunVolt("update", "-offline", "-select", "localhost/local/alpha", "-pin", "localhost/local/charlie")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	// (a, b)
+	checkUpdatedRepos(t, map[string]string{
+		"alpha":   versions["alpha"][1],
+		"bravo":   versions["bravo"][0],
+		"charlie": versions["charlie"][0],
+	}, []string{"charlie"})
+	for _, expected := range []string{
+		"* localhost/local/alpha > updated lock.json revision (" + versions["alpha"][0] + ".." + versions["alpha"][1] + ")",
+		"# localhost/local/bravo > skipped",
+		"# localhost/local/charlie > pinned",
+	} {
+		if !strings.Contains(string(out), expected) {
+			t.Errorf("expected %q but got: %s", expected, string(out))
+		}
+	}
+	// (c)
+	if !pathutil.Exists(pathutil.EncodeReposPath("localhost/local/alpha")) {
+		t.Errorf("expected localhost/local/alpha is installed")
+	}
+	// (d)
+	for name, i := range map[string]int{"alpha": 1, "bravo": 0} {
+		if head, err := gitutil.GetHEAD(pathutil.ReposPath("localhost/local/" + name)); err != nil || head != versions[name][i] {
+			t.Errorf("expected HEAD of %s is %s but got %s (%v)", name, versions[name][i], head, err)
+		}
+	}
+}
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) Repositories are updated, skipped or pinned as answered
+// (b) Invalid answers are asked again
+// (c) Pinned repositories are not updated by -yes
+//
+// * Run `volt update -interactive` (A, B, a, b)
+// * Run `volt update -yes` (A, B, c)
+func TestVoltUpdateInteractive(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	testutil.InstallConfig(t, "strategy-copy.toml")
+	versions := setUpOutdatedRepos(t, "alpha", "bravo", "charlie")
+
+	// =============== run =============== //
+
+	cmd := testutil.VoltCommand("update", "-offline", "-interactive")
+	cmd.Stdin = strings.NewReader("u\nx\ns\np\n")
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stdout
+	err := cmd.Run()
+	// (A, B)
+	testutil.SuccessExit(t, stdout.Bytes(), err)
+	// (a)
+	checkUpdatedRepos(t, map[string]string{
+		"alpha":   versions["alpha"][1],
+		"bravo":   versions["bravo"][0],
+		"charlie": versions["charlie"][0],
+	}, []string{"charlie"})
+	// (b)
+	if n := strings.Count(stdout.String(), "[u]pdate, [s]kip, [p]in or [q]uit? "); n != 4 {
+		t.Errorf("expected 4 prompts but got %d: %s", n, stdout.String())
+	}
+
+	out, err := testutil.RunVolt("update", "-offline", "-yes")
+	// (A, B)
+	testutil.SuccessExit(t, out, err)
+	// (c)
+	checkUpdatedRepos(t, map[string]string{
+		"alpha":   versions["alpha"][1],
+		"bravo":   versions["bravo"][1],
+		"charlie": versions["charlie"][0],
+	}, []string{"charlie"})
+}
+
+// Set up git repositories "localhost/local/{name}" whose locked revision
+// and HEAD are the first commit, and "origin/master" is the second commit.
+// Returns the first and second commit hashes of each repository.
+func setUpOutdatedRepos(t *testing.T, names ...string) map[string][2]string {
+	t.Helper()
+	versions := make(map[string][2]string, len(names))
+	for _, name := range names {
+		reposPath := pathutil.ReposPath("localhost/local/" + name)
+		first := setUpLocalGitRepos(t, reposPath)
+		second := getLockedVersion(t, reposPath)
+		setUpTrackingBranch(t, reposPath, plumbing.NewHash(second), first)
+		setLockedVersion(t, reposPath, first.String())
+		versions[name] = [2]string{first.String(), second}
+	}
+	return versions
+}
+
+// Checks the locked revision of each repository "localhost/local/{name}",
+// and only pinned repositories have "pinned"
+func checkUpdatedRepos(t *testing.T, expected map[string]string, pinned []string) {
+	t.Helper()
+	lockJSON, err := lockjson.Read()
+	if err != nil {
+		t.Fatal("lockjson.Read() failed: " + err.Error())
+	}
+	for name, version := range expected {
+		repos, err := lockJSON.Repos.FindByPath(pathutil.ReposPath("localhost/local/" + name))
+		if err != nil {
+			t.Fatal("lockJSON.Repos.FindByPath() failed: " + err.Error())
+		}
+		if repos.Version != version {
+			t.Errorf("expected version of %s is %s but got %s", name, version, repos.Version)
+		}
+		isPinned := false
+		for _, p := range pinned {
+			isPinned = isPinned || p == name
+		}
+		if repos.Pinned != isPinned {
+			t.Errorf("expected pinned of %s is %v but got %v", name, isPinned, repos.Pinned)
+		}
+	}
+}
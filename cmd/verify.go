@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/vim-volt/volt/cmd/builder"
+	"github.com/vim-volt/volt/config"
+	"github.com/vim-volt/volt/logger"
+)
+
+func init() {
+	cmdMap["verify"] = &verifyCmd{}
+}
+
+type verifyCmd struct {
+	helped bool
+}
+
+func (cmd *verifyCmd) FlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.SetOutput(os.Stdout)
+	fs.Usage = func() {
+		fmt.Print(`
+Usage
+  volt verify [-help]
+
+Quick example
+  $ volt verify # shows installed files which were modified by hand
+  $ volt verify || volt build -full # installs all files again if some were modified
+
+Description
+  Check if the installed files of the repositories of current profile under ~/.vim/pack/volt/{start,opt} are the same as the files which 'volt build' installs, and show the differences:
+    * "missing": the file (or the directory of the repository) is not installed
+    * "modified": the content of the installed file differs
+    * "extra": the installed file does not exist in the repository
+  Files of git repositories are compared with the files of the locked revision (or the worktree if it was dirty when it was built), and files of static repositories are compared with $VOLTPATH/repos/{repository}. ".voltignore" and "build.no_hidden" of $VOLTPATH/config.toml are applied in the same way as 'volt build'. doc/tags files are not compared because ":helptags" generates them.
+  Repositories installed by symlink strategy are checked that they link to $VOLTPATH/repos/{repository}.
+
+  Local changes of installed files are lost by the next 'volt build' which installs the repository again. Move the changes to the repository (or plugconf) before that.
+  This command exits with 0 when there are no differences, otherwise exits with 1.` + "\n\n")
+		fmt.Println("Options")
+		fs.PrintDefaults()
+		fmt.Println()
+		cmd.helped = true
+	}
+	return fs
+}
+
+func (cmd *verifyCmd) Run(args []string) int {
+	err := cmd.parseArgs(args)
+	if err == ErrShowedHelp {
+		return 0
+	}
+	if err != nil {
+		logger.Error("Failed to parse args: " + err.Error())
+		return 10
+	}
+
+	diffs, err := cmd.verify()
+	if err != nil {
+		logger.Error("Failed to verify: " + err.Error())
+		return 11
+	}
+
+	if len(diffs) == 0 {
+		fmt.Println("All installed files match.")
+		return 0
+	}
+	for _, d := range diffs {
+		fmt.Printf("%s: %s\n", d.Kind, d.Path)
+	}
+	return 1
+}
+
+func (cmd *verifyCmd) parseArgs(args []string) error {
+	fs := cmd.FlagSet()
+	fs.Parse(args)
+	if cmd.helped {
+		return ErrShowedHelp
+	}
+	if len(fs.Args()) > 0 {
+		fs.Usage()
+		return errors.New("too many arguments")
+	}
+	return nil
+}
+
+func (*verifyCmd) verify() ([]builder.Difference, error) {
+	cfg, err := config.Read()
+	if err != nil {
+		return nil, errors.New("could not read config.toml: " + err.Error())
+	}
+	keepHidden, err := keepHiddenRepos(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return builder.Verify(context.Background(), &builder.Options{
+		NoHidden:   *cfg.Build.NoHidden,
+		KeepHidden: keepHidden,
+	})
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vim-volt/volt/config"
+	"github.com/vim-volt/volt/internal/testutil"
+	"github.com/vim-volt/volt/pathutil"
+)
+
+// Checks:
+// (A) Does not show `[ERROR]`, `[WARN]` messages
+// (B) Exit with zero status
+// (a) Shows nothing but a message if the installed files are not changed
+// (b) Shows modified, missing and extra files of git and static repositories
+// (c) Shows the repository whose symlink was removed
+//
+// * Run `volt verify` after `volt build` (A, B, a)
+// * Run `volt verify` after changing the installed files (A, !B, b)
+// * Run `volt verify` after `volt build -full` (A, B, a)
+// * Run `volt verify` after `volt build -strategy symlink` (A, B, a)
+// * Run `volt verify` after removing the symlink (A, !B, c)
+func TestVoltVerify(t *testing.T) {
+	// =============== setup =============== //
+
+	testutil.SetUpEnv(t)
+	testutil.InstallConfig(t, "strategy-copy.toml")
+	gitRepos := pathutil.ReposPath("localhost/local/hello-git")
+	setUpLocalGitRepos(t, gitRepos)
+	staticRepos := pathutil.ReposPath("localhost/local/static")
+	for _, name := range []string{"plugin/static.vim", "autoload/static.vim"} {
+		path := filepath.Join(pathutil.FullReposPath(staticRepos), filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte("\" "+name+"\n"), 0644); err != nil {
+			t.Fatal("failed to write " + path)
+		}
+	}
+	out, err := testutil.RunVolt("get", staticRepos.String())
+	testutil.SuccessExit(t, out, err)
+	out, err = testutil.RunVolt("build")
+	testutil.SuccessExit(t, out, err)
+
+	verify := func(expected string) {
+		t.Helper()
+		out, err := testutil.RunVolt("verify")
+		// (A)
+		if strings.Contains(string(out), "[WARN]") || strings.Contains(string(out), "[ERROR]") {
+			t.Errorf("expected no error but has error: %s", string(out))
+		}
+		// (B)
+		if (err == nil) != (expected == "All installed files match.\n") {
+			t.Errorf("unexpected exit status (%v): %s", err, string(out))
+		}
+		if string(out) != expected {
+			t.Errorf("expected %q but got %q", expected, string(out))
+		}
+	}
+
+	// =============== run =============== //
+
+	// (a)
+	verify("All installed files match.\n")
+
+	gitDir := pathutil.EncodeReposPath(gitRepos)
+	staticDir := pathutil.EncodeReposPath(staticRepos)
+	if err := ioutil.WriteFile(filepath.Join(gitDir, "hello"), []byte("modified"), 0644); err != nil {
+		t.Fatal("failed to modify installed file: " + err.Error())
+	}
+	if err := ioutil.WriteFile(filepath.Join(staticDir, "plugin", "extra.vim"), []byte(""), 0644); err != nil {
+		t.Fatal("failed to add installed file: " + err.Error())
+	}
+	if err := os.Remove(filepath.Join(staticDir, "autoload", "static.vim")); err != nil {
+		t.Fatal("failed to remove installed file: " + err.Error())
+	}
+	// (b)
+	verify("modified: " + filepath.Join(gitDir, "hello") + "\n" +
+		"missing: " + filepath.Join(staticDir, "autoload", "static.vim") + "\n" +
+		"extra: " + filepath.Join(staticDir, "plugin", "extra.vim") + "\n")
+
+	out, err = testutil.RunVolt("build", "-full")
+	testutil.SuccessExit(t, out, err)
+	// (a)
+	verify("All installed files match.\n")
+
+	out, err = testutil.RunVolt("build", "-strategy", config.SymlinkBuilder)
+	testutil.SuccessExit(t, out, err)
+	// (a)
+	verify("All installed files match.\n")
+
+	if err := os.Remove(staticDir); err != nil {
+		t.Fatal("failed to remove symlink: " + err.Error())
+	}
+	// (c)
+	verify("missing: " + staticDir + "\n")
+}
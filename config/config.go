@@ -1,7 +1,11 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"path"
+	"regexp"
+	"strings"
 
 	"github.com/BurntSushi/toml"
 	"github.com/vim-volt/volt/pathutil"
@@ -13,7 +17,34 @@ type Config struct {
 }
 
 type ConfigBuild struct {
-	Strategy string `toml:"strategy"`
+	Strategy     string `toml:"strategy"`
+	ReposTimeout *int   `toml:"repos_timeout"`
+	// The number of times to retry reading a git repository which failed
+	// transiently (e.g. on network filesystems)
+	GitRetries *int `toml:"git_retries"`
+	// key: repository path, value: glob patterns of doc files
+	// (relative to doc directory) which are not indexed by ":helptags"
+	ExcludeDocsFromTags map[string][]string `toml:"exclude_docs_from_tags"`
+	// Languages (e.g. "ja") of translated help whose doc/tags-{lang} are
+	// generated. nil generates all languages, which ":helptags" does
+	HelpLanguages []string `toml:"help_languages"`
+	// The maximum number of Vim processes which run ":helptags" at the
+	// same time. 0 means the number of CPUs
+	HelptagsWorkers int `toml:"helptags_workers"`
+	// Do not install hidden files (dot-prefixed files and directories)
+	// of static repositories by copy strategy
+	NoHidden *bool `toml:"no_hidden"`
+	// Static repositories whose hidden files are installed
+	// even if no_hidden is true
+	KeepHidden []string `toml:"keep_hidden"`
+	// The package name of (vim dir)/pack/{name} which volt manages
+	PackageName string `toml:"package_name"`
+	// The first line of installed vimrc and gvimrc which marks them as
+	// generated by volt. Empty means builder.DefaultMagicComment
+	MagicComment string `toml:"magic_comment"`
+	// The maximum number of the previous (vim dir)/pack/volt directories
+	// which "volt build -keep-old" keeps. 0 means no limit
+	KeepOldMax int `toml:"keep_old_max"`
 }
 
 type ConfigGet struct {
@@ -26,11 +57,24 @@ const (
 	CopyBuilder    = "copy"
 )
 
+// Default value of build.repos_timeout (seconds)
+const DefaultReposTimeout = 10 * 60
+
+// Default value of build.git_retries
+const DefaultGitRetries = 3
+
 func initialConfigTOML() *Config {
 	trueValue := true
+	falseValue := false
+	reposTimeout := DefaultReposTimeout
+	gitRetries := DefaultGitRetries
 	return &Config{
 		Build: ConfigBuild{
-			Strategy: SymlinkBuilder,
+			Strategy:     SymlinkBuilder,
+			ReposTimeout: &reposTimeout,
+			GitRetries:   &gitRetries,
+			NoHidden:     &falseValue,
+			PackageName:  pathutil.DefaultPackageName,
 		},
 		Get: ConfigGet{
 			CreateSkeletonPlugconf: &trueValue,
@@ -62,6 +106,18 @@ func merge(cfg, initCfg *Config) {
 	if cfg.Build.Strategy == "" {
 		cfg.Build.Strategy = initCfg.Build.Strategy
 	}
+	if cfg.Build.ReposTimeout == nil {
+		cfg.Build.ReposTimeout = initCfg.Build.ReposTimeout
+	}
+	if cfg.Build.GitRetries == nil {
+		cfg.Build.GitRetries = initCfg.Build.GitRetries
+	}
+	if cfg.Build.NoHidden == nil {
+		cfg.Build.NoHidden = initCfg.Build.NoHidden
+	}
+	if cfg.Build.PackageName == "" {
+		cfg.Build.PackageName = initCfg.Build.PackageName
+	}
 	if cfg.Get.CreateSkeletonPlugconf == nil {
 		cfg.Get.CreateSkeletonPlugconf = initCfg.Get.CreateSkeletonPlugconf
 	}
@@ -70,9 +126,64 @@ func merge(cfg, initCfg *Config) {
 	}
 }
 
+// The language of help files "*.{lang}x" (e.g. "ja" for "*.jax")
+var helpLanguageRx = regexp.MustCompile(`^[a-z]{2}$`)
+
 func validate(cfg *Config) error {
 	if cfg.Build.Strategy != "symlink" && cfg.Build.Strategy != "copy" {
 		return fmt.Errorf("build.strategy is %q: valid values are %q or %q", cfg.Build.Strategy, "symlink", "copy")
 	}
+	if *cfg.Build.ReposTimeout < 0 {
+		return fmt.Errorf("build.repos_timeout is %d: must be 0 or greater", *cfg.Build.ReposTimeout)
+	}
+	if *cfg.Build.GitRetries < 0 {
+		return fmt.Errorf("build.git_retries is %d: must be 0 or greater", *cfg.Build.GitRetries)
+	}
+	for reposPath, patterns := range cfg.Build.ExcludeDocsFromTags {
+		if _, err := pathutil.NormalizeRepos(reposPath); err != nil {
+			return fmt.Errorf("build.exclude_docs_from_tags has invalid repository %q: %s", reposPath, err.Error())
+		}
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("build.exclude_docs_from_tags has invalid pattern %q: %s", pattern, err.Error())
+			}
+		}
+	}
+	for _, lang := range cfg.Build.HelpLanguages {
+		if !helpLanguageRx.MatchString(lang) {
+			return fmt.Errorf("build.help_languages has invalid language %q: must be two lowercase letters (e.g. \"ja\")", lang)
+		}
+	}
+	if cfg.Build.HelptagsWorkers < 0 {
+		return fmt.Errorf("build.helptags_workers is %d: must be 0 or greater", cfg.Build.HelptagsWorkers)
+	}
+	if cfg.Build.KeepOldMax < 0 {
+		return fmt.Errorf("build.keep_old_max is %d: must be 0 or greater", cfg.Build.KeepOldMax)
+	}
+	if err := pathutil.ValidatePackageName(cfg.Build.PackageName); err != nil {
+		return fmt.Errorf("build.package_name is %q: must be a directory name which does not start with \".\"", cfg.Build.PackageName)
+	}
+	if cfg.Build.MagicComment != "" {
+		if err := ValidateMagicComment(cfg.Build.MagicComment); err != nil {
+			return fmt.Errorf("build.magic_comment is %q: %s", cfg.Build.MagicComment, err.Error())
+		}
+	}
+	for _, reposPath := range cfg.Build.KeepHidden {
+		if _, err := pathutil.NormalizeRepos(reposPath); err != nil {
+			return fmt.Errorf("build.keep_hidden has invalid repository %q: %s", reposPath, err.Error())
+		}
+	}
+	return nil
+}
+
+// ValidateMagicComment returns error if comment cannot be used as the magic
+// comment of installed vimrc and gvimrc. It must be one line Vim comment.
+func ValidateMagicComment(comment string) error {
+	if !strings.HasPrefix(comment, "\"") {
+		return errors.New("must start with '\"'")
+	}
+	if strings.ContainsAny(comment, "\r\n") {
+		return errors.New("must be one line")
+	}
 	return nil
 }
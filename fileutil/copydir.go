@@ -29,16 +29,105 @@
 package fileutil
 
 import (
+	"context"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sync"
 )
 
-// TODO: Parallelism
+// copyFile and linkFile are replaced in tests to observe the copy of each file
+var (
+	copyFile = CopyFile
+	linkFile = TryLinkFile
+)
+
+// MaxCopyWorkers is the maximum number of goroutines which copy files in
+// CopyDir() and TryLinkDirParallel()
+const MaxCopyWorkers = 32
+
+type copyFileJob struct {
+	src, dst string
+	perm     os.FileMode
+}
 
 // CopyDir recursively copies a directory tree, attempting to preserve permissions.
 // Source directory must exist, destination directory must *not* exist.
-func CopyDir(src, dst string, buf []byte, perm os.FileMode, ignoreType os.FileMode) error {
+// Files are copied by at most workers goroutines (1 if workers is less than 1,
+// MaxCopyWorkers if workers is greater than it).
+// If ctx is canceled, CopyDir stops before copying the next file and returns
+// ctx.Err(). Otherwise it returns the first error of the copy.
+func CopyDir(ctx context.Context, src, dst string, perm os.FileMode, ignoreType os.FileMode, workers int) error {
+	return copyDirParallel(ctx, src, dst, perm, ignoreType, workers, false, func(src, dst string, buf []byte, perm os.FileMode) error {
+		return copyFile(src, dst, buf, perm)
+	})
+}
+
+// TryLinkDirParallel is the same as TryLinkDir() but links (or copies) files
+// by at most workers goroutines like CopyDir().
+// Directories and symbolic links are created in the order of the walk, so a
+// file is never linked before its parent directory exists.
+func TryLinkDirParallel(ctx context.Context, src, dst string, perm os.FileMode, ignoreType os.FileMode, workers int) error {
+	return copyDirParallel(ctx, src, dst, perm, ignoreType, workers, true, func(src, dst string, buf []byte, perm os.FileMode) error {
+		return linkFile(src, dst, buf, perm)
+	})
+}
+
+func copyDirParallel(ctx context.Context, src, dst string, perm os.FileMode, ignoreType os.FileMode, workers int, symlink bool, copyFn func(string, string, []byte, os.FileMode) error) error {
+	if workers < 1 {
+		workers = 1
+	} else if workers > MaxCopyWorkers {
+		workers = MaxCopyWorkers
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		firstErr error
+	)
+	setErr := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+		cancel()
+	}
+
+	jobs := make(chan copyFileJob)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Avoid allocating in io.Copy() in CopyFile() each time
+			buf := make([]byte, 32*1024)
+			for job := range jobs {
+				if err := ctx.Err(); err != nil {
+					// Drain jobs without copying
+					setErr(err)
+					continue
+				}
+				if err := copyFn(job.src, job.dst, buf, job.perm); err != nil {
+					setErr(err)
+				}
+			}
+		}()
+	}
+
+	if err := walkCopyDir(ctx, src, dst, perm, ignoreType, symlink, jobs); err != nil {
+		setErr(err)
+	}
+	close(jobs)
+	wg.Wait()
+
+	return firstErr
+}
+
+// Create directories under dst and send the files to jobs.
+// If symlink is true, symbolic links are recreated instead of being sent.
+func walkCopyDir(ctx context.Context, src, dst string, perm os.FileMode, ignoreType os.FileMode, symlink bool, jobs chan<- copyFileJob) error {
 	if err := os.MkdirAll(dst, perm); err != nil {
 		return err
 	}
@@ -48,11 +137,6 @@ func CopyDir(src, dst string, buf []byte, perm os.FileMode, ignoreType os.FileMo
 		return err
 	}
 
-	// Avoid allocating in io.Copy() in CopyFile() each time
-	if buf == nil {
-		buf = make([]byte, 32*1024)
-	}
-
 	for i := range entries {
 		if entries[i].Mode()&ignoreType != 0 {
 			continue
@@ -61,14 +145,22 @@ func CopyDir(src, dst string, buf []byte, perm os.FileMode, ignoreType os.FileMo
 		srcPath := filepath.Join(src, entries[i].Name())
 		dstPath := filepath.Join(dst, entries[i].Name())
 
-		if entries[i].IsDir() {
-			if err = CopyDir(srcPath, dstPath, buf, entries[i].Mode(), ignoreType); err != nil {
+		if symlink && entries[i].Mode()&os.ModeSymlink != 0 {
+			if err = CopySymlink(srcPath, dstPath); err != nil {
 				return err
 			}
-		} else {
-			if err = CopyFile(srcPath, dstPath, buf, entries[i].Mode()); err != nil {
+			continue
+		}
+		if entries[i].IsDir() {
+			if err = walkCopyDir(ctx, srcPath, dstPath, entries[i].Mode(), ignoreType, symlink, jobs); err != nil {
 				return err
 			}
+			continue
+		}
+		select {
+		case jobs <- copyFileJob{srcPath, dstPath, entries[i].Mode()}:
+		case <-ctx.Done():
+			return ctx.Err()
 		}
 	}
 	return nil
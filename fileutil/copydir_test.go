@@ -0,0 +1,200 @@
+package fileutil
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Creates numFiles files under {tmpdir}/src/{a,b}/ and returns the source
+// directory and the destination directory (not created)
+func setUpCopyDir(t *testing.T, numFiles int) (string, string) {
+	tmpdir, err := ioutil.TempDir("", "volt-test-")
+	if err != nil {
+		t.Fatal("failed to create temp dir: " + err.Error())
+	}
+	src := filepath.Join(tmpdir, "src")
+	for i := 0; i < numFiles; i++ {
+		dir := filepath.Join(src, []string{"a", "b"}[i%2])
+		os.MkdirAll(dir, 0755)
+		path := filepath.Join(dir, fmt.Sprintf("%d.txt", i))
+		if err := ioutil.WriteFile(path, []byte(path), 0644); err != nil {
+			t.Fatal("failed to write " + path)
+		}
+	}
+	return src, filepath.Join(tmpdir, "dst")
+}
+
+// Replace copyFile with f, and returns the function to restore it
+func replaceCopyFile(f func(src, dst string, buf []byte, perm os.FileMode) error) func() {
+	orig := copyFile
+	copyFile = f
+	return func() { copyFile = orig }
+}
+
+func countFiles(dir string) int {
+	n := 0
+	filepath.Walk(dir, func(_ string, fi os.FileInfo, err error) error {
+		if err == nil && fi.Mode().IsRegular() {
+			n++
+		}
+		return nil
+	})
+	return n
+}
+
+func TestCopyDir(t *testing.T) {
+	src, dst := setUpCopyDir(t, 20)
+	defer os.RemoveAll(filepath.Dir(src))
+
+	if err := CopyDir(context.Background(), src, dst, 0755, 0, 4); err != nil {
+		t.Fatal("CopyDir() returned non-nil error: " + err.Error())
+	}
+	for i := 0; i < 20; i++ {
+		rel := filepath.Join([]string{"a", "b"}[i%2], fmt.Sprintf("%d.txt", i))
+		b, err := ioutil.ReadFile(filepath.Join(dst, rel))
+		if err != nil {
+			t.Errorf("%s was not copied: %s", rel, err.Error())
+		} else if string(b) != filepath.Join(src, rel) {
+			t.Errorf("%s: expected %q but got %q", rel, filepath.Join(src, rel), string(b))
+		}
+	}
+}
+
+func TestCopyDirConcurrency(t *testing.T) {
+	src, dst := setUpCopyDir(t, 30)
+	defer os.RemoveAll(filepath.Dir(src))
+
+	const workers = 3
+	var (
+		mu         sync.Mutex
+		running    int
+		maxRunning int
+	)
+	defer replaceCopyFile(func(src, dst string, buf []byte, perm os.FileMode) error {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return CopyFile(src, dst, buf, perm)
+	})()
+
+	if err := CopyDir(context.Background(), src, dst, 0755, 0, workers); err != nil {
+		t.Fatal("CopyDir() returned non-nil error: " + err.Error())
+	}
+	if maxRunning > workers {
+		t.Errorf("expected at most %d files are copied at once, but %d files were copied", workers, maxRunning)
+	}
+	if maxRunning < 2 {
+		t.Errorf("expected files are copied in parallel, but at most %d file was copied at once", maxRunning)
+	}
+	if n := countFiles(dst); n != 30 {
+		t.Errorf("expected 30 files are copied but %d files were copied", n)
+	}
+}
+
+func TestCopyDirCancel(t *testing.T) {
+	src, dst := setUpCopyDir(t, 30)
+	defer os.RemoveAll(filepath.Dir(src))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var (
+		mu     sync.Mutex
+		copied int
+	)
+	defer replaceCopyFile(func(src, dst string, buf []byte, perm os.FileMode) error {
+		mu.Lock()
+		copied++
+		if copied == 5 {
+			cancel()
+		}
+		mu.Unlock()
+		return CopyFile(src, dst, buf, perm)
+	})()
+
+	err := CopyDir(ctx, src, dst, 0755, 0, 2)
+	if err != context.Canceled {
+		t.Errorf("expected %v but got %v", context.Canceled, err)
+	}
+	// At most one more file can be copied by the other worker after cancel
+	if n := countFiles(dst); n > 6 {
+		t.Errorf("expected copy stops after cancel, but %d files were copied", n)
+	}
+}
+
+func TestCopyDirMaxWorkers(t *testing.T) {
+	src, dst := setUpCopyDir(t, 2*MaxCopyWorkers+2)
+	defer os.RemoveAll(filepath.Dir(src))
+
+	var (
+		mu         sync.Mutex
+		running    int
+		maxRunning int
+	)
+	defer replaceCopyFile(func(src, dst string, buf []byte, perm os.FileMode) error {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return CopyFile(src, dst, buf, perm)
+	})()
+
+	if err := CopyDir(context.Background(), src, dst, 0755, 0, 10*MaxCopyWorkers); err != nil {
+		t.Fatal("CopyDir() returned non-nil error: " + err.Error())
+	}
+	if maxRunning > MaxCopyWorkers {
+		t.Errorf("expected at most %d files are copied at once, but %d files were copied", MaxCopyWorkers, maxRunning)
+	}
+}
+
+func TestTryLinkDirParallel(t *testing.T) {
+	src, dst := setUpCopyDir(t, 20)
+	defer os.RemoveAll(filepath.Dir(src))
+	if err := os.Symlink("0.txt", filepath.Join(src, "a", "link.txt")); err != nil {
+		t.Skip("symlink is not supported: " + err.Error())
+	}
+
+	if err := TryLinkDirParallel(context.Background(), src, dst, 0755, os.ModeNamedPipe, 4); err != nil {
+		t.Fatal("TryLinkDirParallel() returned non-nil error: " + err.Error())
+	}
+	if n := countFiles(dst); n != 20 {
+		t.Errorf("expected 20 files are linked but %d files were linked", n)
+	}
+	link, err := os.Readlink(filepath.Join(dst, "a", "link.txt"))
+	if err != nil {
+		t.Fatal("symlink was not recreated: " + err.Error())
+	}
+	if link != "0.txt" {
+		t.Errorf("expected symlink target %q but got %q", "0.txt", link)
+	}
+}
+
+func TestTryLinkDirParallelError(t *testing.T) {
+	src, dst := setUpCopyDir(t, 20)
+	defer os.RemoveAll(filepath.Dir(src))
+
+	// Make "a/0.txt" conflict with the linked file
+	os.MkdirAll(filepath.Join(dst, "a", "0.txt"), 0755)
+
+	if err := TryLinkDirParallel(context.Background(), src, dst, 0755, 0, 4); err == nil {
+		t.Error("TryLinkDirParallel() returned nil error")
+	}
+}
@@ -61,6 +61,12 @@ func CopyFile(src, dst string, buf []byte, perm os.FileMode) (err error) {
 		}
 	}()
 
+	// OpenFile() does not change the mode of existing file, and the mode of
+	// new file is masked by umask
+	if err = w.Chmod(perm); err != nil {
+		return
+	}
+
 	_, err = io.CopyBuffer(w, r, buf)
 	if err != nil {
 		return
@@ -54,6 +54,11 @@ func CopyFile(src, dst string, buf []byte, perm os.FileMode) error {
 	if err != nil {
 		return err
 	}
+	// OpenFile() does not change the mode of existing file, and the mode of
+	// new file is masked by umask
+	if err := w.Chmod(perm); err != nil {
+		return err
+	}
 
 	wfd := int(w.Fd())
 	rfd := int(r.Fd())
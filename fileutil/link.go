@@ -35,6 +35,8 @@ import (
 )
 
 // TryLinkDir recursively copies a directory tree, attempting to preserve permissions.
+// Symbolic links are recreated as symbolic links unless ignoreType contains
+// os.ModeSymlink.
 // Source directory must exist, destination directory must *not* exist.
 func TryLinkDir(src, dst string, buf []byte, perm os.FileMode, ignoreType os.FileMode) error {
 	if err := os.MkdirAll(dst, perm); err != nil {
@@ -58,7 +60,11 @@ func TryLinkDir(src, dst string, buf []byte, perm os.FileMode, ignoreType os.Fil
 		srcPath := filepath.Join(src, entries[i].Name())
 		dstPath := filepath.Join(dst, entries[i].Name())
 
-		if entries[i].IsDir() {
+		if entries[i].Mode()&os.ModeSymlink != 0 {
+			if err = CopySymlink(srcPath, dstPath); err != nil {
+				return err
+			}
+		} else if entries[i].IsDir() {
 			if err = TryLinkDir(srcPath, dstPath, buf, entries[i].Mode(), ignoreType); err != nil {
 				return err
 			}
@@ -79,3 +85,13 @@ func TryLinkFile(src, dst string, buf []byte, perm os.FileMode) error {
 	}
 	return CopyFile(src, dst, buf, perm)
 }
+
+// CopySymlink creates the symbolic link dst which has the same target as the
+// symbolic link src. The target is not copied.
+func CopySymlink(src, dst string) error {
+	link, err := os.Readlink(src)
+	if err != nil {
+		return err
+	}
+	return os.Symlink(link, dst)
+}
@@ -0,0 +1,96 @@
+package fileutil
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Creates {tmpdir}/src/bin/run.sh (0755) and the symlink {tmpdir}/src/run.sh
+// to it, and returns the source directory and the destination directory
+// (not created)
+func setUpLinkDir(t *testing.T) (string, string) {
+	tmpdir, err := ioutil.TempDir("", "volt-test-")
+	if err != nil {
+		t.Fatal("failed to create temp dir: " + err.Error())
+	}
+	src := filepath.Join(tmpdir, "src")
+	os.MkdirAll(filepath.Join(src, "bin"), 0755)
+	script := filepath.Join(src, "bin", "run.sh")
+	if err := ioutil.WriteFile(script, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal("failed to write " + script)
+	}
+	if err := os.Symlink(filepath.Join("bin", "run.sh"), filepath.Join(src, "run.sh")); err != nil {
+		os.RemoveAll(tmpdir)
+		t.Skip("cannot create symlink: " + err.Error())
+	}
+	return src, filepath.Join(tmpdir, "dst")
+}
+
+func TestTryLinkDirPreservesModeAndSymlink(t *testing.T) {
+	src, dst := setUpLinkDir(t)
+	defer os.RemoveAll(filepath.Dir(src))
+
+	if err := TryLinkDir(src, dst, nil, 0755, os.ModeNamedPipe); err != nil {
+		t.Fatal("TryLinkDir() returned non-nil error: " + err.Error())
+	}
+
+	fi, err := os.Stat(filepath.Join(dst, "bin", "run.sh"))
+	if err != nil {
+		t.Fatal("bin/run.sh was not copied: " + err.Error())
+	}
+	if fi.Mode().Perm() != 0755 {
+		t.Errorf("expected mode of bin/run.sh is 0755 but got %o", fi.Mode().Perm())
+	}
+	fi, err = os.Lstat(filepath.Join(dst, "run.sh"))
+	if err != nil {
+		t.Fatal("run.sh was not copied: " + err.Error())
+	}
+	if fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("expected run.sh is a symlink but mode is %v", fi.Mode())
+	} else if link, err := os.Readlink(filepath.Join(dst, "run.sh")); err != nil || link != filepath.Join("bin", "run.sh") {
+		t.Errorf("expected run.sh links to %q but got %q (%v)", filepath.Join("bin", "run.sh"), link, err)
+	}
+}
+
+func TestTryLinkDirIgnoresSymlink(t *testing.T) {
+	src, dst := setUpLinkDir(t)
+	defer os.RemoveAll(filepath.Dir(src))
+
+	if err := TryLinkDir(src, dst, nil, 0755, os.ModeSymlink); err != nil {
+		t.Fatal("TryLinkDir() returned non-nil error: " + err.Error())
+	}
+	if _, err := os.Lstat(filepath.Join(dst, "run.sh")); !os.IsNotExist(err) {
+		t.Errorf("expected run.sh is not copied but got %v", err)
+	}
+}
+
+func TestCopyFilePreservesMode(t *testing.T) {
+	src, dst := setUpLinkDir(t)
+	defer os.RemoveAll(filepath.Dir(src))
+
+	os.MkdirAll(dst, 0755)
+	newFile := filepath.Join(dst, "new.sh")
+	if err := CopyFile(filepath.Join(src, "bin", "run.sh"), newFile, nil, 0755); err != nil {
+		t.Fatal("CopyFile() returned non-nil error: " + err.Error())
+	}
+	// The mode of existing file must be changed
+	existingFile := filepath.Join(dst, "existing.sh")
+	if err := ioutil.WriteFile(existingFile, []byte(""), 0600); err != nil {
+		t.Fatal("failed to write " + existingFile)
+	}
+	if err := CopyFile(filepath.Join(src, "bin", "run.sh"), existingFile, nil, 0755); err != nil {
+		t.Fatal("CopyFile() returned non-nil error: " + err.Error())
+	}
+
+	for _, file := range []string{newFile, existingFile} {
+		fi, err := os.Stat(file)
+		if err != nil {
+			t.Fatal("failed to stat " + file + ": " + err.Error())
+		}
+		if fi.Mode().Perm() != 0755 {
+			t.Errorf("expected mode of %s is 0755 but got %o", file, fi.Mode().Perm())
+		}
+	}
+}
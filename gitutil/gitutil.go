@@ -4,10 +4,13 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
+	"strings"
 
 	"github.com/vim-volt/volt/pathutil"
 	git "gopkg.in/src-d/go-git.v4"
 	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/plumbing/storer"
 )
 
 var refHeadsRx = regexp.MustCompile(`^refs/heads/(.+)$`)
@@ -26,11 +29,6 @@ func GetHEAD(reposPath pathutil.ReposPath) (string, error) {
 }
 
 func GetHEADRepository(repos *git.Repository) (string, error) {
-	head, err := repos.Head()
-	if err != nil {
-		return "", err
-	}
-
 	cfg, err := repos.Config()
 	if err != nil {
 		return "", err
@@ -38,6 +36,10 @@ func GetHEADRepository(repos *git.Repository) (string, error) {
 
 	if !cfg.Core.IsBare {
 		// Get reference of local {branch} HEAD
+		head, err := repos.Head()
+		if err != nil {
+			return "", err
+		}
 		commit, err := repos.CommitObject(head.Hash())
 		if err != nil {
 			return "", err
@@ -45,21 +47,135 @@ func GetHEADRepository(repos *git.Repository) (string, error) {
 		return commit.Hash.String(), nil
 	}
 
-	// Get branch name from head.Name().String()
-	// e.g. head.Name().String() = "refs/heads/master"
-	defaultBranch := refHeadsRx.FindStringSubmatch(head.Name().String())
-	if len(defaultBranch) == 0 {
-		return "", errors.New("could not find branch name from HEAD")
+	// Get branch name which HEAD points to
+	// e.g. HEAD is "ref: refs/heads/master"
+	defaultBranch, err := GetDefaultBranch(repos)
+	if err != nil {
+		return "", err
 	}
 
 	// Get reference of remote origin/{branch} HEAD
-	ref, err := repos.Reference(plumbing.ReferenceName("refs/remotes/origin/"+defaultBranch[1]), true)
+	ref, err := repos.Reference(plumbing.ReferenceName("refs/remotes/origin/"+defaultBranch), true)
 	if err != nil {
-		return "", err
+		return "", errors.New("could not find origin/" + defaultBranch + " (default branch): " + err.Error())
 	}
 	return ref.Hash().String(), nil
 }
 
+var refRemotesOriginRx = regexp.MustCompile(`^refs/remotes/origin/(.+)$`)
+
+// The branch names which are tried in order when the default branch cannot
+// be determined by HEAD
+var defaultBranchCandidates = []string{"main", "master"}
+
+// GetDefaultBranch returns the name of the branch which HEAD points to
+// (e.g. "master"). If HEAD is detached, returns the branch which
+// refs/remotes/origin/HEAD points to, or "main" or "master" if it exists
+// as a local or remote-tracking branch.
+func GetDefaultBranch(r *git.Repository) (string, error) {
+	if head, err := r.Storer.Reference(plumbing.HEAD); err == nil && head.Type() == plumbing.SymbolicReference {
+		if branch := refHeadsRx.FindStringSubmatch(head.Target().String()); len(branch) > 0 {
+			return branch[1], nil
+		}
+	}
+	if ref, err := r.Storer.Reference("refs/remotes/origin/HEAD"); err == nil && ref.Type() == plumbing.SymbolicReference {
+		if branch := refRemotesOriginRx.FindStringSubmatch(ref.Target().String()); len(branch) > 0 {
+			return branch[1], nil
+		}
+	}
+	for _, name := range defaultBranchCandidates {
+		for _, refName := range []string{"refs/heads/" + name, "refs/remotes/origin/" + name} {
+			if _, err := r.Storer.Reference(plumbing.ReferenceName(refName)); err == nil {
+				return name, nil
+			}
+		}
+	}
+	return "", errors.New("could not determine the default branch: " +
+		"HEAD is detached, and neither origin/HEAD, 'main' nor 'master' branch exists. " +
+		"Please check out the branch to follow (e.g. 'git checkout {branch}')")
+}
+
+// GetTrackedBranch returns the branch which the repository follows and its
+// upstream remote name (e.g. "origin", "master").
+// The branch is current branch, or the default branch if HEAD is detached
+// (see GetDefaultBranch()). The remote is the upstream remote of the branch,
+// or "origin" if it is not configured but exists. The remote is empty if
+// neither exists.
+func GetTrackedBranch(r *git.Repository) (remote string, branch string, err error) {
+	branch, err = GetDefaultBranch(r)
+	if err != nil {
+		return "", "", err
+	}
+	cfg, err := r.Config()
+	if err != nil {
+		return "", "", err
+	}
+	remote = cfg.Raw.Section("branch").Subsection(branch).Option("remote")
+	if remote == "" {
+		if _, exists := cfg.Remotes["origin"]; exists {
+			remote = "origin"
+		}
+	}
+	return remote, branch, nil
+}
+
+// GetUpstreamHEAD returns the commit hash of the branch which the repository
+// follows (see GetTrackedBranch()).
+// If the repository is bare, this is the same as GetHEADRepository().
+// If the repository is non-bare, this returns the hash of
+// refs/remotes/{remote}/{branch}. If it has no upstream remote or the remote
+// branch was not fetched, this returns the hash of local {branch}.
+func GetUpstreamHEAD(r *git.Repository) (string, error) {
+	cfg, err := r.Config()
+	if err != nil {
+		return "", err
+	}
+	if cfg.Core.IsBare {
+		return GetHEADRepository(r)
+	}
+	remote, branch, err := GetTrackedBranch(r)
+	if err != nil {
+		return "", err
+	}
+	refNames := []string{"refs/heads/" + branch}
+	if remote != "" {
+		refNames = append([]string{"refs/remotes/" + remote + "/" + branch}, refNames...)
+	}
+	for _, name := range refNames {
+		if ref, err := r.Reference(plumbing.ReferenceName(name), true); err == nil {
+			return ref.Hash().String(), nil
+		}
+	}
+	return "", errors.New("could not find branch '" + branch + "'")
+}
+
+// CountNewCommits returns the number of commits which are reachable from tip
+// but not from base (like "git rev-list --count {base}..{tip}").
+func CountNewCommits(r *git.Repository, base, tip string) (int, error) {
+	baseObj, err := r.CommitObject(plumbing.NewHash(base))
+	if err != nil {
+		return 0, errors.New("failed to get commit object " + base + ": " + err.Error())
+	}
+	tipObj, err := r.CommitObject(plumbing.NewHash(tip))
+	if err != nil {
+		return 0, errors.New("failed to get commit object " + tip + ": " + err.Error())
+	}
+	ancestors := make([]plumbing.Hash, 0, 256)
+	err = object.NewCommitPreorderIter(baseObj, nil).ForEach(func(c *object.Commit) error {
+		ancestors = append(ancestors, c.Hash)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	err = object.NewCommitPreorderIter(tipObj, ancestors).ForEach(func(*object.Commit) error {
+		count++
+		return nil
+	})
+	return count, err
+}
+
 // SetUpstreamRemote sets current branch's upstream remote name to remote.
 func SetUpstreamRemote(r *git.Repository, remote string) error {
 	cfg, err := r.Config()
@@ -110,3 +226,136 @@ func GetUpstreamRemote(r *git.Repository) (string, error) {
 	}
 	return remote, nil
 }
+
+var hexRx = regexp.MustCompile(`^[0-9a-f]{4,40}$`)
+
+// ResolveCommit returns the commit hash of rev.
+// rev is a commit hash (abbreviated hash of 4 characters or longer is
+// allowed), a tag or branch name (remote branches are also searched), or
+// a revision like "HEAD~1".
+// Like "git rev-parse", a full commit hash is looked up first, then tags and
+// branches, then abbreviated hashes.
+func ResolveCommit(r *git.Repository, rev string) (string, error) {
+	if fullHashRx.MatchString(rev) {
+		if _, err := r.CommitObject(plumbing.NewHash(rev)); err == nil {
+			return rev, nil
+		}
+	}
+	if ref, ok := lookupRef(r, rev); ok {
+		return peelCommit(r, ref.Hash())
+	}
+	if hexRx.MatchString(rev) && len(rev) < 40 {
+		if hash, err := resolveAbbrevCommit(r, rev); err != nil || hash != "" {
+			return hash, err
+		}
+	}
+	hash, err := r.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return "", fmt.Errorf("could not resolve %q to a commit: %s", rev, err.Error())
+	}
+	return hash.String(), nil
+}
+
+var fullHashRx = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// ResolveVersion returns the commit hash of "version" of a repository in
+// lock.json, which is a tag or branch name, or a full commit hash.
+// It is looked up in the same order as ResolveCommit(), but abbreviated
+// hashes and revisions like "HEAD~1" are not allowed.
+func ResolveVersion(r *git.Repository, version string) (string, error) {
+	kind := "hash"
+	if !fullHashRx.MatchString(version) {
+		if _, ok := lookupRef(r, version); !ok {
+			return "", fmt.Errorf("could not resolve ref %q: no tag or branch was found", version)
+		}
+		kind = "ref"
+	}
+	hash, err := ResolveCommit(r, version)
+	if err != nil {
+		return "", fmt.Errorf("could not resolve %s %q: %s", kind, version, err.Error())
+	}
+	return hash, nil
+}
+
+// IsFullHash returns true if version is a full commit hash
+func IsFullHash(version string) bool {
+	return fullHashRx.MatchString(version)
+}
+
+// GetTreeHash returns the hash of the tree object of commit
+// (like "git rev-parse {commit}^{tree}").
+func GetTreeHash(r *git.Repository, commit string) (string, error) {
+	commitObj, err := r.CommitObject(plumbing.NewHash(commit))
+	if err != nil {
+		return "", errors.New("failed to get commit object " + commit + ": " + err.Error())
+	}
+	return commitObj.TreeHash.String(), nil
+}
+
+// Returns the first reference of refNameCandidates(r, rev) which exists
+func lookupRef(r *git.Repository, rev string) (*plumbing.Reference, bool) {
+	for _, name := range refNameCandidates(r, rev) {
+		ref, err := storer.ResolveReference(r.Storer, plumbing.ReferenceName(name))
+		if err == nil {
+			return ref, true
+		}
+	}
+	return nil, false
+}
+
+// Returns reference names which rev may mean, in the same order as
+// "git rev-parse" searches
+func refNameCandidates(r *git.Repository, rev string) []string {
+	names := []string{
+		rev,
+		"refs/" + rev,
+		"refs/tags/" + rev,
+		"refs/heads/" + rev,
+		"refs/remotes/" + rev,
+		"refs/remotes/" + rev + "/HEAD",
+	}
+	if remotes, err := r.Remotes(); err == nil {
+		for _, remote := range remotes {
+			names = append(names, "refs/remotes/"+remote.Config().Name+"/"+rev)
+		}
+	}
+	return names
+}
+
+// Returns the commit hash which hash points to.
+// If hash is an annotated tag, returns the tagged commit.
+func peelCommit(r *git.Repository, hash plumbing.Hash) (string, error) {
+	if tag, err := r.TagObject(hash); err == nil {
+		commit, err := tag.Commit()
+		if err != nil {
+			return "", errors.New("tag " + tag.Name + " does not point to a commit: " + err.Error())
+		}
+		return commit.Hash.String(), nil
+	}
+	if _, err := r.CommitObject(hash); err != nil {
+		return "", errors.New("failed to get commit object " + hash.String() + ": " + err.Error())
+	}
+	return hash.String(), nil
+}
+
+// Returns empty string if no commit has the prefix
+func resolveAbbrevCommit(r *git.Repository, prefix string) (string, error) {
+	iter, err := r.CommitObjects()
+	if err != nil {
+		return "", err
+	}
+	defer iter.Close()
+	var found string
+	err = iter.ForEach(func(commit *object.Commit) error {
+		hash := commit.Hash.String()
+		if !strings.HasPrefix(hash, prefix) || hash == found {
+			return nil
+		}
+		if found != "" {
+			return fmt.Errorf("short commit hash %q is ambiguous", prefix)
+		}
+		found = hash
+		return nil
+	})
+	return found, err
+}
@@ -0,0 +1,91 @@
+package gitutil
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+// Returns the bare repository on memory and a function which makes an
+// empty commit with the message and the parents
+func newMemoryRepos(t *testing.T) (*git.Repository, func(msg string, parents ...plumbing.Hash) plumbing.Hash) {
+	st := memory.NewStorage()
+	r, err := git.Init(st, nil)
+	if err != nil {
+		t.Fatal("git.Init() failed: " + err.Error())
+	}
+	commit := func(msg string, parents ...plumbing.Hash) plumbing.Hash {
+		treeObj := st.NewEncodedObject()
+		if err := (&object.Tree{}).Encode(treeObj); err != nil {
+			t.Fatal("failed to encode tree: " + err.Error())
+		}
+		treeHash, err := st.SetEncodedObject(treeObj)
+		if err != nil {
+			t.Fatal("failed to store tree: " + err.Error())
+		}
+		sig := object.Signature{Name: "volt", Email: "volt@example.com", When: time.Unix(0, 0)}
+		commitObj := st.NewEncodedObject()
+		c := &object.Commit{Author: sig, Committer: sig, Message: msg, TreeHash: treeHash, ParentHashes: parents}
+		if err := c.Encode(commitObj); err != nil {
+			t.Fatal("failed to encode commit: " + err.Error())
+		}
+		hash, err := st.SetEncodedObject(commitObj)
+		if err != nil {
+			t.Fatal("failed to store commit: " + err.Error())
+		}
+		return hash
+	}
+	return r, commit
+}
+
+func TestResolveOrder(t *testing.T) {
+	r, commit := newMemoryRepos(t)
+	a := commit("a")
+	b := commit("b", a)
+	for name, hash := range map[string]plumbing.Hash{
+		"refs/tags/v1.0":               a,
+		"refs/heads/master":            b,
+		"refs/heads/" + a.String():     b,
+		"refs/tags/" + a.String()[:7]:  b,
+		"refs/heads/" + b.String()[:7]: a,
+	} {
+		if err := r.Storer.SetReference(plumbing.NewHashReference(plumbing.ReferenceName(name), hash)); err != nil {
+			t.Fatal("failed to set reference: " + err.Error())
+		}
+	}
+
+	var tests = []struct {
+		rev     string
+		commit  string // expected result of ResolveCommit() ("" is error)
+		version string // expected result of ResolveVersion() ("" is error)
+	}{
+		// A full hash is looked up before the branch of the same name
+		{a.String(), a.String(), a.String()},
+		{"v1.0", a.String(), a.String()},
+		// Tags and branches are looked up before abbreviated hashes
+		{a.String()[:7], b.String(), b.String()},
+		{b.String()[:7], a.String(), a.String()},
+		// Abbreviated hashes and revisions are only for ResolveCommit()
+		{a.String()[:8], a.String(), ""},
+		{"HEAD~1", a.String(), ""},
+		{"v2.0", "", ""},
+	}
+	for _, tt := range tests {
+		hash, err := ResolveCommit(r, tt.rev)
+		if tt.commit == "" && err == nil {
+			t.Errorf("ResolveCommit(%q): expected error but got %s", tt.rev, hash)
+		} else if tt.commit != "" && (err != nil || hash != tt.commit) {
+			t.Errorf("ResolveCommit(%q): expected %s but got %s (err: %v)", tt.rev, tt.commit, hash, err)
+		}
+		hash, err = ResolveVersion(r, tt.rev)
+		if tt.version == "" && err == nil {
+			t.Errorf("ResolveVersion(%q): expected error but got %s", tt.rev, hash)
+		} else if tt.version != "" && (err != nil || hash != tt.version) {
+			t.Errorf("ResolveVersion(%q): expected %s but got %s (err: %v)", tt.rev, tt.version, hash, err)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package testutil
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -56,14 +57,22 @@ func SetUpEnv(t *testing.T) {
 			t.Fatalf("failed to set %s", env)
 		}
 	}
+	// The vim directory is under HOME
+	os.Unsetenv("VOLT_HOME")
 }
 
 func RunVolt(args ...string) ([]byte, error) {
-	cmd := exec.Command(voltCommand, args...)
+	cmd := VoltCommand(args...)
 	// cmd.Env = append(os.Environ(), "VOLTPATH="+voltpath)
 	return cmd.CombinedOutput()
 }
 
+// VoltCommand returns volt command which is not started yet.
+// Use this instead of RunVolt() to read stdout and stderr separately.
+func VoltCommand(args ...string) *exec.Cmd {
+	return exec.Command(voltCommand, args...)
+}
+
 func SuccessExit(t *testing.T, out []byte, err error) {
 	t.Helper()
 	outstr := string(out)
@@ -108,6 +117,10 @@ func GetCmdList() ([]string, error) {
 	cmdList := make([]string, 0, 20)
 	re := regexp.MustCompile(`^  (\S+)`)
 	for i := cmdidx; i < len(lines); i++ {
+		// The next section (e.g. "Environment variables")
+		if lines[i] != "" && !strings.HasPrefix(lines[i], " ") {
+			break
+		}
 		if m := re.FindStringSubmatch(lines[i]); len(m) != 0 && !dup[m[1]] {
 			cmdList = append(cmdList, m[1])
 			dup[m[1]] = true
@@ -154,7 +167,7 @@ func SetUpRepos(t *testing.T, testdataName string, rType lockjson.ReposType, rep
 				}
 				defer os.Setenv("VOLTPATH", voltpath)
 				os.MkdirAll(filepath.Dir(testRepos), 0777)
-				if err := fileutil.CopyDir(localSrcDir, testRepos, buf, 0777, 0); err != nil {
+				if err := fileutil.CopyDir(context.Background(), localSrcDir, testRepos, 0777, 0, runtime.NumCPU()); err != nil {
 					t.Fatalf("failed to copy %s to %s", localSrcDir, testRepos)
 				}
 				out, err := RunVolt("get", localName)
@@ -167,7 +180,7 @@ func SetUpRepos(t *testing.T, testdataName string, rType lockjson.ReposType, rep
 		// Copy repository
 		repos := filepath.Join(voltpath, "repos", reposPath.String())
 		os.MkdirAll(filepath.Dir(repos), 0777)
-		if err := fileutil.CopyDir(testRepos, repos, buf, 0777, os.FileMode(0)); err != nil {
+		if err := fileutil.CopyDir(context.Background(), testRepos, repos, 0777, os.FileMode(0), runtime.NumCPU()); err != nil {
 			t.Fatalf("failed to copy %s to %s", testRepos, repos)
 		}
 
@@ -6,21 +6,36 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
 	"strconv"
+	"strings"
 
+	"github.com/vim-volt/volt/config"
 	"github.com/vim-volt/volt/logger"
 	"github.com/vim-volt/volt/pathutil"
+	"github.com/vim-volt/volt/transaction"
 )
 
 type ReposList []Repos
 type ProfileList []Profile
 
 type LockJSON struct {
-	Version            int64       `json:"version"`
-	CurrentProfileName string      `json:"current_profile_name"`
-	Repos              ReposList   `json:"repos"`
-	Profiles           ProfileList `json:"profiles"`
+	Version            int64  `json:"version"`
+	CurrentProfileName string `json:"current_profile_name"`
+	// DefaultBuild is the strategy of "volt build" ("symlink" or "copy").
+	// If empty, "build.strategy" in config.toml is used.
+	DefaultBuild string `json:"default_build,omitempty"`
+	// PreBuild is the shell command which "volt build" runs in the vim
+	// directory before installing the repositories. The build is aborted if
+	// it failed.
+	PreBuild string `json:"pre_build,omitempty"`
+	// PostBuild is the shell command which "volt build" runs in the vim
+	// directory after the build succeeded. Its failure is only reported.
+	PostBuild string      `json:"post_build,omitempty"`
+	Repos     ReposList   `json:"repos"`
+	Profiles  ProfileList `json:"profiles"`
 }
 
 type ReposType string
@@ -29,12 +44,90 @@ const (
 	ReposGitType    ReposType = "git"
 	ReposStaticType ReposType = "static"
 	ReposSystemType ReposType = "system"
+	// ReposLocalType is a directory outside $VOLTPATH/repos (e.g. a plugin
+	// under development) which is installed like static repository
+	ReposLocalType ReposType = "local"
 )
 
 type Repos struct {
 	Type    ReposType          `json:"type"`
 	Path    pathutil.ReposPath `json:"path"`
 	Version string             `json:"version"`
+	// Description is why the user added the repository.
+	// It is shown by "volt list -long" and does not affect builds.
+	Description string `json:"description,omitempty"`
+	// Subdir is the directory (relative to the repository, slash-separated)
+	// which is installed as the plugin root.
+	// The whole repository is installed if empty.
+	Subdir string `json:"subdir,omitempty"`
+	// Source is the absolute path (or "file://" URL) of the directory of
+	// local repository, which is installed instead of $VOLTPATH/repos/{path}.
+	// It is given only for local repository.
+	Source string `json:"source,omitempty"`
+	// PostInstall is the symlinks and directories which are created
+	// after the repository was installed by "volt build".
+	PostInstall []PostInstall `json:"post_install,omitempty"`
+	// TreeHash is the expected hash of the tree object of Version.
+	// "volt build" refuses to install the repository if it differs.
+	TreeHash string `json:"tree_hash,omitempty"`
+	// Pinned is true if "volt update" must not update Version.
+	Pinned bool `json:"pinned,omitempty"`
+	// Placement is not saved to lock.json.
+	// It is set by GetReposListByProfile() according to the profile.
+	Placement ReposPlacement `json:"-"`
+}
+
+// PostInstall is a symlink or a directory which a plugin expects to exist
+// at a fixed path (e.g. "~/.cache/plugin")
+type PostInstall struct {
+	// Path is the slash-separated path under the home directory, which
+	// starts with "~/". Paths outside the home directory are not allowed.
+	Path string `json:"path"`
+	// Target is the slash-separated path relative to the installed
+	// directory of the repository, which Path links to.
+	// Path is created as a directory if empty.
+	Target string `json:"target,omitempty"`
+}
+
+// ReposPlacement is the directory under ~/.vim/pack/volt
+// where a repository is installed
+type ReposPlacement string
+
+const (
+	// ReposOptPlacement installs a repository to ~/.vim/pack/volt/opt
+	// and it is loaded by :packadd in bundled plugconf
+	ReposOptPlacement ReposPlacement = "opt"
+	// ReposStartPlacement installs a repository to ~/.vim/pack/volt/start
+	// and it is loaded by Vim automatically
+	ReposStartPlacement ReposPlacement = "start"
+)
+
+// Returns the installed directory of the repository
+func (repos *Repos) EncodedPath() string {
+	if repos.Placement == ReposStartPlacement {
+		return pathutil.EncodeReposPathTo(pathutil.VimVoltStartDir(), repos.Path)
+	}
+	return pathutil.EncodeReposPath(repos.Path)
+}
+
+// Returns the directory of the repository: "source" of local repository,
+// or $VOLTPATH/repos/{repos}
+func (repos *Repos) ReposDir() string {
+	if repos.Type == ReposLocalType {
+		return filepath.FromSlash(strings.TrimPrefix(repos.Source, "file://"))
+	}
+	return pathutil.FullReposPath(repos.Path)
+}
+
+// Returns the directory which is installed as the plugin root:
+// $VOLTPATH/repos/{repos}[/{subdir}] (or "source" of local repository
+// instead of $VOLTPATH/repos/{repos})
+func (repos *Repos) SourceDir() string {
+	src := repos.ReposDir()
+	if repos.Subdir == "" {
+		return src
+	}
+	return filepath.Join(src, filepath.FromSlash(repos.Subdir))
 }
 
 type profReposPath []pathutil.ReposPath
@@ -42,9 +135,15 @@ type profReposPath []pathutil.ReposPath
 type Profile struct {
 	Name      string        `json:"name"`
 	ReposPath profReposPath `json:"repos_path"`
+	// StartReposPath is the subset of ReposPath
+	// which are installed under ~/.vim/pack/volt/start on this profile
+	StartReposPath profReposPath `json:"start_repos_path,omitempty"`
+	// GenerateHelptags is false if ":helptags" is not run for the
+	// repositories of this profile (true if not set)
+	GenerateHelptags *bool `json:"generate_helptags,omitempty"`
 }
 
-const lockJSONVersion = 2
+const lockJSONVersion = 3
 
 func initialLockJSON() *LockJSON {
 	return &LockJSON{
@@ -86,10 +185,17 @@ func read(doLog bool) (*LockJSON, error) {
 		return nil, err
 	}
 
-	if lockJSON.Version < lockJSONVersion {
+	// lock.json of the first version may not have "version"
+	if lockJSON.Version == 0 {
+		lockJSON.Version = 1
+	} else if lockJSON.Version < 0 {
+		return nil, fmt.Errorf("validation failed: lock.json: lock.json version is '%d' (must be 1 or greater)", lockJSON.Version)
+	}
+
+	migrated := lockJSON.Version < lockJSONVersion
+	if migrated {
 		if doLog {
 			logger.Warnf("Performing auto-migration of lock.json: v%d -> v%d", lockJSON.Version, lockJSONVersion)
-			logger.Warn("Please run 'volt migrate' to migrate explicitly if it's not updated by after operations")
 		}
 		err = migrate(bytes, &lockJSON)
 		if err != nil {
@@ -103,9 +209,24 @@ func read(doLog bool) (*LockJSON, error) {
 		return nil, errors.New("validation failed: lock.json: " + err.Error())
 	}
 
+	// Write migrated lock.json back not to migrate it on every read.
+	// It is written only in the transaction (e.g. WithLock()), so the
+	// commands which do not change anything (e.g. 'volt status') keep it.
+	if migrated {
+		if transaction.Owned() {
+			if err := lockJSON.Write(); err != nil {
+				logger.Warn("Could not write migrated lock.json: " + err.Error())
+			}
+		} else if doLog {
+			logger.Warn("Please run 'volt migrate' to migrate explicitly if it's not updated by after operations")
+		}
+	}
+
 	return &lockJSON, nil
 }
 
+var treeHashRx = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
 func validate(lockJSON *LockJSON) error {
 	if lockJSON.Version < 1 {
 		return fmt.Errorf("lock.json version is '%d' (must be 1 or greater)", lockJSON.Version)
@@ -128,6 +249,37 @@ func validate(lockJSON *LockJSON) error {
 		if _, err := pathutil.NormalizeRepos(repos.Path.String()); err != nil {
 			return errors.New("'" + repos.Path.String() + "' is invalid repos path")
 		}
+		// Validate if repos[]/subdir is a relative path in the repository
+		if repos.Subdir != "" && !isValidSubdir(repos.Subdir) {
+			return errors.New("'" + repos.Subdir + "' (subdir of '" + repos.Path.String() + "') is invalid subdir")
+		}
+		// Validate if repos[]/post_install[] are under the home directory
+		// and link to the installed directory
+		for _, p := range repos.PostInstall {
+			if !strings.HasPrefix(p.Path, "~/") || !isValidSubdir(strings.TrimPrefix(p.Path, "~/")) {
+				return errors.New("'" + p.Path + "' (post_install path of '" + repos.Path.String() + "') must be a path under the home directory like '~/.cache/plugin'")
+			}
+			if p.Target != "" && !isValidSubdir(p.Target) && p.Target != "." {
+				return errors.New("'" + p.Target + "' (post_install target of '" + repos.Path.String() + "') is not a relative path in the repository")
+			}
+		}
+		// Validate if repos[]/source is an absolute path of local repository
+		if repos.Type == ReposLocalType {
+			if !filepath.IsAbs(repos.ReposDir()) {
+				return errors.New("'" + repos.Source + "' (source of '" + repos.Path.String() + "') must be an absolute path")
+			}
+		} else if repos.Source != "" {
+			return errors.New("source of '" + repos.Path.String() + "' is given, but it is not a local repository")
+		}
+		// Validate if repos[]/tree_hash is a hash of git repository
+		if repos.TreeHash != "" {
+			if repos.Type != ReposGitType {
+				return errors.New("tree_hash of '" + repos.Path.String() + "' is given, but it is not a git repository")
+			}
+			if !treeHashRx.MatchString(repos.TreeHash) {
+				return errors.New("'" + repos.TreeHash + "' (tree_hash of '" + repos.Path.String() + "') is invalid hash")
+			}
+		}
 		// Validate if duplicate repos[]/path exist
 		if _, exists := dup[repos.Path.String()]; exists {
 			return errors.New("duplicate repos '" + repos.Path.String() + "'")
@@ -159,6 +311,25 @@ func validate(lockJSON *LockJSON) error {
 			}
 			dup[reposPath.String()] = true
 		}
+		startDup := make(map[string]bool, len(profile.StartReposPath))
+		for _, reposPath := range profile.StartReposPath {
+			// Validate if profiles[]/start_repos_path[] exists in profiles[]/repos_path[]
+			if !dup[reposPath.String()] {
+				return errors.New("'" + reposPath.String() + "' (start_repos_path) is not in repos_path of profile '" + profile.Name + "'")
+			}
+			// Validate if duplicate profiles[]/start_repos_path[] exist
+			if startDup[reposPath.String()] {
+				return errors.New("duplicate '" + reposPath.String() + "' (start_repos_path) in profile '" + profile.Name + "'")
+			}
+			startDup[reposPath.String()] = true
+		}
+	}
+
+	// Validate if default_build is valid strategy
+	if lockJSON.DefaultBuild != "" &&
+		lockJSON.DefaultBuild != config.SymlinkBuilder &&
+		lockJSON.DefaultBuild != config.CopyBuilder {
+		return fmt.Errorf("default_build is %q: valid values are %q or %q", lockJSON.DefaultBuild, config.SymlinkBuilder, config.CopyBuilder)
 	}
 
 	// Validate if current_profile_name exists in profiles[]/name
@@ -193,6 +364,15 @@ func validate(lockJSON *LockJSON) error {
 	return nil
 }
 
+// Returns true if subdir is a normalized slash-separated relative path
+// which does not go up to the parent directory (e.g. "vim", "editors/vim")
+func isValidSubdir(subdir string) bool {
+	if path.IsAbs(subdir) || strings.Contains(subdir, "\\") || path.Clean(subdir) != subdir {
+		return false
+	}
+	return subdir != "." && subdir != ".." && !strings.HasPrefix(subdir, "../")
+}
+
 func validateMissing(lockJSON *LockJSON) error {
 	if lockJSON.Version == 0 {
 		return errors.New("missing: version")
@@ -212,10 +392,13 @@ func validateMissing(lockJSON *LockJSON) error {
 				return errors.New("missing: repos[" + strconv.Itoa(i) + "].version")
 			}
 			fallthrough
-		case ReposStaticType:
+		case ReposStaticType, ReposLocalType:
 			if repos.Path.String() == "" {
 				return errors.New("missing: repos[" + strconv.Itoa(i) + "].path")
 			}
+			if repos.Type == ReposLocalType && repos.Source == "" {
+				return errors.New("missing: repos[" + strconv.Itoa(i) + "].source")
+			}
 		default:
 			return errors.New("repos[" + strconv.Itoa(i) + "].type is invalid type: " + string(repos.Type))
 		}
@@ -256,12 +439,62 @@ func (lockJSON *LockJSON) Write() error {
 		}
 	}
 
-	// Write to lock.json
-	bytes, err := json.MarshalIndent(lockJSON, "", "  ")
+	// Write to lock.json.
+	// Rename the written file not to leave broken lock.json on failure
+	bytes, err := lockJSON.marshal()
 	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile(pathutil.LockJSON(), bytes, 0644)
+	tmp := lockfile + ".tmp"
+	err = ioutil.WriteFile(tmp, bytes, 0644)
+	if err == nil {
+		err = os.Rename(tmp, lockfile)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// WithLock reads lock.json, passes it to update, and writes it to lock.json
+// in a transaction.
+// lock.json is not written if update returns false or an error, so update
+// can change many parts of lock.json and fail midway without leaving them
+// partially changed.
+func WithLock(update func(lockJSON *LockJSON) (bool, error)) error {
+	// Begin transaction
+	err := transaction.Create()
+	if err != nil {
+		return err
+	}
+	defer transaction.Remove()
+
+	lockJSON, err := Read()
+	if err != nil {
+		return errors.New("could not read lock.json: " + err.Error())
+	}
+	write, err := update(lockJSON)
+	if err != nil || !write {
+		return err
+	}
+	err = lockJSON.Write()
+	if err != nil {
+		return errors.New("could not write to lock.json: " + err.Error())
+	}
+	return nil
+}
+
+// Marshal validates lockJSON and returns the content which Write() writes
+// to lock.json
+func (lockJSON *LockJSON) Marshal() ([]byte, error) {
+	if err := validate(lockJSON); err != nil {
+		return nil, err
+	}
+	return lockJSON.marshal()
+}
+
+func (lockJSON *LockJSON) marshal() ([]byte, error) {
+	return json.MarshalIndent(lockJSON, "", "  ")
 }
 
 func (profs *ProfileList) FindByName(name string) (*Profile, error) {
@@ -282,6 +515,17 @@ func (profs *ProfileList) FindIndexByName(name string) int {
 	return -1
 }
 
+// Returns names of the profiles which have reposPath in profiles[]/repos_path[]
+func (profs *ProfileList) ProfilesContaining(reposPath pathutil.ReposPath) []string {
+	names := make([]string, 0, len(*profs))
+	for i := range *profs {
+		if (*profs)[i].ReposPath.Contains(reposPath) {
+			names = append(names, (*profs)[i].Name)
+		}
+	}
+	return names
+}
+
 func (profs *ProfileList) RemoveAllReposPath(reposPath pathutil.ReposPath) error {
 	removed := false
 	for i := range *profs {
@@ -296,6 +540,12 @@ func (profs *ProfileList) RemoveAllReposPath(reposPath pathutil.ReposPath) error
 			}
 			j++
 		}
+		if k := (*profs)[i].StartReposPath.IndexOf(reposPath); k >= 0 {
+			(*profs)[i].StartReposPath = append(
+				(*profs)[i].StartReposPath[:k],
+				(*profs)[i].StartReposPath[k+1:]...,
+			)
+		}
 	}
 	if !removed {
 		return errors.New("no matching profiles[]/repos_path[]: " + reposPath.String())
@@ -328,6 +578,49 @@ func (reposList *ReposList) RemoveAllByPath(reposPath pathutil.ReposPath) error
 	return errors.New("no matching repos[]/path: " + reposPath.String())
 }
 
+// ReposListDiff is the difference between two repos lists
+type ReposListDiff struct {
+	// Repositories which are only in the former list
+	Removed ReposList
+	// Repositories which are only in the latter list
+	Added ReposList
+	// Repositories which are in both lists, but the type, version or
+	// placement differs
+	Changed []ReposChange
+}
+
+// ReposChange is the pair of the same repository in two repos lists
+type ReposChange struct {
+	Old Repos
+	New Repos
+}
+
+// Returns the difference between reposList and other.
+// Each list of the result is in the order of reposList (or other for Added).
+func (reposList *ReposList) Diff(other ReposList) *ReposListDiff {
+	diff := &ReposListDiff{
+		Removed: make(ReposList, 0, len(*reposList)),
+		Added:   make(ReposList, 0, len(other)),
+		Changed: make([]ReposChange, 0, len(*reposList)),
+	}
+	for i := range *reposList {
+		repos := &(*reposList)[i]
+		r, err := other.FindByPath(repos.Path)
+		switch {
+		case err != nil:
+			diff.Removed = append(diff.Removed, *repos)
+		case r.Type != repos.Type, r.Version != repos.Version, r.Placement != repos.Placement:
+			diff.Changed = append(diff.Changed, ReposChange{Old: *repos, New: *r})
+		}
+	}
+	for i := range other {
+		if !reposList.Contains(other[i].Path) {
+			diff.Added = append(diff.Added, other[i])
+		}
+	}
+	return diff
+}
+
 func (reposPathList *profReposPath) Contains(reposPath pathutil.ReposPath) bool {
 	return reposPathList.IndexOf(reposPath) >= 0
 }
@@ -341,6 +634,8 @@ func (reposPathList *profReposPath) IndexOf(reposPath pathutil.ReposPath) int {
 	return -1
 }
 
+// Returns repos list of the profile.
+// Placement of each repos is set to the effective placement on the profile.
 func (lockJSON *LockJSON) GetReposListByProfile(profile *Profile) (ReposList, error) {
 	reposList := make(ReposList, 0, len(profile.ReposPath))
 	for _, reposPath := range profile.ReposPath {
@@ -348,7 +643,22 @@ func (lockJSON *LockJSON) GetReposListByProfile(profile *Profile) (ReposList, er
 		if err != nil {
 			return nil, err
 		}
-		reposList = append(reposList, *repos)
+		r := *repos
+		r.Placement = profile.PlacementOf(reposPath)
+		reposList = append(reposList, r)
 	}
 	return reposList, nil
 }
+
+// Returns false if "generate_helptags" of the profile is false
+func (profile *Profile) GeneratesHelptags() bool {
+	return profile.GenerateHelptags == nil || *profile.GenerateHelptags
+}
+
+// Returns the placement of reposPath on the profile
+func (profile *Profile) PlacementOf(reposPath pathutil.ReposPath) ReposPlacement {
+	if profile.StartReposPath.Contains(reposPath) {
+		return ReposStartPlacement
+	}
+	return ReposOptPlacement
+}
@@ -0,0 +1,219 @@
+package lockjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vim-volt/volt/pathutil"
+)
+
+func TestWithLock(t *testing.T) {
+	_, cleanup := setUpVoltpath(t)
+	defer cleanup()
+
+	lockJSON := initialLockJSON()
+	lockJSON.Repos = append(lockJSON.Repos, Repos{
+		Type:    ReposGitType,
+		Path:    "github.com/tyru/caw.vim",
+		Version: "0123456789abcdef0123456789abcdef01234567",
+	})
+	lockJSON.Profiles[0].ReposPath = append(lockJSON.Profiles[0].ReposPath, "github.com/tyru/caw.vim")
+	if err := lockJSON.Write(); err != nil {
+		t.Fatal("lockJSON.Write() failed: " + err.Error())
+	}
+	original, err := ioutil.ReadFile(pathutil.LockJSON())
+	if err != nil {
+		t.Fatal("failed to read lock.json: " + err.Error())
+	}
+
+	// Changes many parts of lock.json
+	mutate := func(lockJSON *LockJSON) {
+		lockJSON.Repos = append(lockJSON.Repos, Repos{
+			Type:    ReposGitType,
+			Path:    "github.com/tyru/open-browser.vim",
+			Version: "89abcdef0123456789abcdef0123456789abcdef",
+		})
+		lockJSON.Profiles = append(lockJSON.Profiles, Profile{
+			Name:      "work",
+			ReposPath: []pathutil.ReposPath{"github.com/tyru/open-browser.vim"},
+		})
+		lockJSON.CurrentProfileName = "work"
+	}
+	errFailure := errors.New("failure")
+
+	for _, tt := range []struct {
+		name   string
+		update func(*LockJSON) (bool, error)
+		err    bool
+	}{
+		{"error midway", func(lockJSON *LockJSON) (bool, error) {
+			mutate(lockJSON)
+			return true, errFailure
+		}, true},
+		{"invalid lock.json", func(lockJSON *LockJSON) (bool, error) {
+			mutate(lockJSON)
+			lockJSON.Repos = append(lockJSON.Repos, Repos{Path: "github.com/tyru/eskk.vim"})
+			return true, nil
+		}, true},
+		{"no write", func(lockJSON *LockJSON) (bool, error) {
+			mutate(lockJSON)
+			return false, nil
+		}, false},
+	} {
+		err := WithLock(tt.update)
+		if tt.err && err == nil {
+			t.Errorf("[%s] expected error but got nil", tt.name)
+		} else if !tt.err && err != nil {
+			t.Errorf("[%s] expected no error but got: %s", tt.name, err.Error())
+		}
+		content, err := ioutil.ReadFile(pathutil.LockJSON())
+		if err != nil {
+			t.Fatal("failed to read lock.json: " + err.Error())
+		}
+		if !bytes.Equal(content, original) {
+			t.Errorf("[%s] lock.json was changed: %s", tt.name, string(content))
+		}
+		for _, path := range []string{pathutil.TrxLock(), pathutil.LockJSON() + ".tmp"} {
+			if pathutil.Exists(path) {
+				t.Errorf("[%s] %s was left", tt.name, path)
+			}
+		}
+	}
+
+	// Does not call update if the transaction could not be begun
+	if err := ioutil.WriteFile(pathutil.TrxLock(), []byte("-1"), 0644); err != nil {
+		t.Fatal("failed to write trx.lock: " + err.Error())
+	}
+	called := false
+	err = WithLock(func(lockJSON *LockJSON) (bool, error) {
+		called = true
+		return true, nil
+	})
+	if err == nil || called {
+		t.Errorf("expected error without calling update but got %v (called = %v)", err, called)
+	}
+	os.Remove(pathutil.TrxLock())
+
+	// Writes all changes
+	err = WithLock(func(lockJSON *LockJSON) (bool, error) {
+		mutate(lockJSON)
+		return true, nil
+	})
+	if err != nil {
+		t.Fatal("WithLock() failed: " + err.Error())
+	}
+	lockJSON, err = Read()
+	if err != nil {
+		t.Fatal("Read() failed: " + err.Error())
+	}
+	if len(lockJSON.Repos) != 2 || len(lockJSON.Profiles) != 2 || lockJSON.CurrentProfileName != "work" {
+		t.Errorf("lock.json was not changed: %+v", lockJSON)
+	}
+	if pathutil.Exists(pathutil.TrxLock()) {
+		t.Errorf("%s was left", pathutil.TrxLock())
+	}
+}
+
+func TestReadMigration(t *testing.T) {
+	_, cleanup := setUpVoltpath(t)
+	defer cleanup()
+	os.MkdirAll(filepath.Dir(pathutil.LockJSON()), 0755)
+
+	for _, tt := range []struct {
+		content string
+		err     string
+	}{
+		// v1 without "version"
+		{`{"active_profile": "default", "repos": [], "profiles": [{"name": "default", "repos_path": []}]}`, ""},
+		{`{"version": 1, "active_profile": "default", "repos": [], "profiles": [{"name": "default", "repos_path": []}]}`, ""},
+		{`{"version": 99, "current_profile_name": "default", "repos": [], "profiles": [{"name": "default", "repos_path": []}]}`, "please upgrade volt"},
+		{`{"version": -1, "current_profile_name": "default", "repos": [], "profiles": [{"name": "default", "repos_path": []}]}`, "must be 1 or greater"},
+	} {
+		if err := ioutil.WriteFile(pathutil.LockJSON(), []byte(tt.content), 0644); err != nil {
+			t.Fatal("failed to write lock.json: " + err.Error())
+		}
+		lockJSON, err := ReadNoMigrationMsg()
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: expected error %q but got %v", tt.content, tt.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: Read() failed: %s", tt.content, err.Error())
+			continue
+		}
+		if lockJSON.Version != lockJSONVersion || lockJSON.CurrentProfileName != "default" || lockJSON.DefaultBuild != "" {
+			t.Errorf("%s: lock.json was not migrated: %+v", tt.content, lockJSON)
+		}
+	}
+}
+
+func TestReadMigrationWritesBack(t *testing.T) {
+	_, cleanup := setUpVoltpath(t)
+	defer cleanup()
+	os.MkdirAll(filepath.Dir(pathutil.LockJSON()), 0755)
+
+	content := `{"version": 2, "current_profile_name": "default", "repos": [], "profiles": [{"name": "default", "repos_path": []}]}`
+	if err := ioutil.WriteFile(pathutil.LockJSON(), []byte(content), 0644); err != nil {
+		t.Fatal("failed to write lock.json: " + err.Error())
+	}
+	readVersion := func() int64 {
+		t.Helper()
+		b, err := ioutil.ReadFile(pathutil.LockJSON())
+		if err != nil {
+			t.Fatal("failed to read lock.json: " + err.Error())
+		}
+		var j struct {
+			Version int64 `json:"version"`
+		}
+		if err := json.Unmarshal(b, &j); err != nil {
+			t.Fatal("failed to parse lock.json: " + err.Error())
+		}
+		return j.Version
+	}
+
+	// Not written without the transaction
+	if _, err := ReadNoMigrationMsg(); err != nil {
+		t.Fatal("ReadNoMigrationMsg() failed: " + err.Error())
+	}
+	if v := readVersion(); v != 2 {
+		t.Errorf("expected lock.json is not written but got version %d", v)
+	}
+
+	// Written in the transaction even if update does not change it
+	err := WithLock(func(*LockJSON) (bool, error) {
+		return false, nil
+	})
+	if err != nil {
+		t.Fatal("WithLock() failed: " + err.Error())
+	}
+	if v := readVersion(); v != lockJSONVersion {
+		t.Errorf("expected version %d but got %d", lockJSONVersion, v)
+	}
+	if pathutil.Exists(pathutil.LockJSON() + ".tmp") {
+		t.Errorf("%s.tmp was left", pathutil.LockJSON())
+	}
+}
+
+// Sets VOLTPATH to a new temporary directory, and returns it and the function
+// which restores VOLTPATH and removes the directory
+func setUpVoltpath(t *testing.T) (string, func()) {
+	t.Helper()
+	voltpath, err := ioutil.TempDir("", "volt-test-")
+	if err != nil {
+		t.Fatal("failed to create temp dir")
+	}
+	orig := os.Getenv("VOLTPATH")
+	os.Setenv("VOLTPATH", voltpath)
+	return voltpath, func() {
+		os.Setenv("VOLTPATH", orig)
+		os.RemoveAll(voltpath)
+	}
+}
@@ -7,7 +7,7 @@ import (
 )
 
 func migrate(rawJSON []byte, lockJSON *LockJSON) error {
-	// lockJSON.Version must be greater than 0 because it was validated
+	// lockJSON.Version must be greater than 0 because read() checked it
 	var err error
 	max := int64(len(migrateFunc))
 	for lockJSON.Version-1 < max {
@@ -22,6 +22,7 @@ func migrate(rawJSON []byte, lockJSON *LockJSON) error {
 
 var migrateFunc = []func([]byte, *LockJSON) error{
 	migrate1To2,
+	migrate2To3,
 }
 
 // Rename 'active_profile' to 'current_profile_name'
@@ -39,3 +40,12 @@ func migrate1To2(rawJSON []byte, lockJSON *LockJSON) error {
 
 	return nil
 }
+
+// v3 has optional 'default_build'.
+// It is left empty so that 'volt build' keeps following 'build.strategy'
+// of config.toml
+func migrate2To3(rawJSON []byte, lockJSON *LockJSON) error {
+	lockJSON.Version += 1
+
+	return nil
+}
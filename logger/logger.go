@@ -47,6 +47,18 @@ func init() {
 
 var logLevel = InfoLevel
 
+type LogFormat int
+
+const (
+	// DefaultFormat shows all messages
+	DefaultFormat LogFormat = iota
+	// CompactFormat suppresses per-item progress messages (see Progress()).
+	// Errors, warnings and the other messages are shown as DefaultFormat.
+	CompactFormat
+)
+
+var logFormat = DefaultFormat
+
 func Errorf(format string, msgs ...interface{}) {
 	if logLevel < ErrorLevel {
 		return
@@ -110,6 +122,31 @@ func Info(msgs ...interface{}) {
 	out.Println(msgs...)
 }
 
+// Progressf is same as Infof() but the message is not shown in CompactFormat.
+// Use this for messages printed per repository (e.g. "Installing ... Done.").
+func Progressf(format string, msgs ...interface{}) {
+	if logLevel < InfoLevel || logFormat == CompactFormat {
+		return
+	}
+	m.Lock()
+	defer m.Unlock()
+	msgs = append([]interface{}{getDebugPrefix()}, msgs...)
+	out.Printf(infoLabel+"%s "+format+"\n", msgs...)
+}
+
+// Progress is same as Info() but the message is not shown in CompactFormat.
+// Use this for messages printed per repository (e.g. "Installing ... Done.").
+func Progress(msgs ...interface{}) {
+	if logLevel < InfoLevel || logFormat == CompactFormat {
+		return
+	}
+	m.Lock()
+	defer m.Unlock()
+	cmsg := getDebugPrefix()
+	msgs = append([]interface{}{infoLabel + cmsg}, msgs...)
+	out.Println(msgs...)
+}
+
 func Debugf(format string, msgs ...interface{}) {
 	if logLevel < DebugLevel {
 		return
@@ -147,3 +184,7 @@ func getDebugPrefix() string {
 func SetLevel(level LogLevel) {
 	logLevel = level
 }
+
+func SetFormat(format LogFormat) {
+	logFormat = format
+}
@@ -17,6 +17,13 @@ func Main() int {
 	if os.Getenv("VOLT_DEBUG") != "" {
 		logger.SetLevel(logger.DebugLevel)
 	}
+	switch os.Getenv("VOLT_LOG_FORMAT") {
+	case "", "default":
+	case "compact":
+		logger.SetFormat(logger.CompactFormat)
+	default:
+		logger.Warn("Unknown VOLT_LOG_FORMAT value: " + os.Getenv("VOLT_LOG_FORMAT"))
+	}
 	if len(os.Args) <= 1 {
 		os.Args = append(os.Args, "help")
 	}
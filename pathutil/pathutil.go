@@ -1,13 +1,19 @@
 package pathutil
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"regexp"
 	"runtime"
 	"strings"
+	"sync"
 )
 
 var rxReposPath = regexp.MustCompile(
@@ -44,6 +50,44 @@ func NormalizeRepos(rawReposPath string) (ReposPath, error) {
 	return ReposPath(strings.Join(hostUserName, "/")), nil
 }
 
+// Characters allowed in ref of NormalizeReposWithRef()
+var rxReposRef = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.+/-]*$`)
+
+// Normalize "{repository}[@{ref}]" (e.g. "user/name@v2") into the
+// repository path (see NormalizeRepos()) and ref (tag, branch or commit hash).
+// ref is empty if "@{ref}" is not given.
+func NormalizeReposWithRef(rawReposPath string) (ReposPath, string, error) {
+	p := filepath.ToSlash(rawReposPath)
+	// Find "@" after the host part (e.g. not "https://user@host/...").
+	// ref may have "/" (e.g. "user/name@feature/foo")
+	start := 0
+	if i := strings.Index(p, "://"); i >= 0 {
+		start = i + len("://")
+	}
+	at := -1
+	for i := start; i < len(p); i++ {
+		if p[i] == '@' && strings.Contains(p[start:i], "/") {
+			at = i
+			break
+		}
+	}
+	if at < 0 {
+		reposPath, err := NormalizeRepos(rawReposPath)
+		return reposPath, "", err
+	}
+	ref := p[at+1:]
+	if !rxReposRef.MatchString(ref) || strings.Contains(ref, "..") ||
+		strings.Contains(ref, "//") || strings.HasSuffix(ref, "/") ||
+		strings.HasSuffix(ref, ".") || strings.HasSuffix(ref, ".lock") {
+		return "", "", errors.New("invalid ref of repository: " + rawReposPath)
+	}
+	reposPath, err := NormalizeRepos(p[:at])
+	if err != nil {
+		return "", "", err
+	}
+	return reposPath, ref, nil
+}
+
 type ReposPath string
 type ReposPathList []ReposPath
 
@@ -117,6 +161,13 @@ func Plugconf(reposPath ReposPath) string {
 	return filepath.Join(paths...)
 }
 
+// $HOME/volt/repos/{site}/{user}/{name}/plugconf.vim
+// The default plugconf shipped with the repository itself.
+// It is used unless the user's plugconf (Plugconf()) exists.
+func ReposPlugconf(reposPath ReposPath) string {
+	return filepath.Join(FullReposPath(reposPath), "plugconf.vim")
+}
+
 const ProfileVimrc = "vimrc.vim"
 const ProfileGvimrc = "gvimrc.vim"
 const Vimrc = "vimrc"
@@ -127,6 +178,18 @@ func RCDir(profileName string) string {
 	return filepath.Join([]string{VoltPath(), "rc", profileName}...)
 }
 
+// $HOME/volt/rc/{profileName}/plugconf/{site}/{user}/{name}.vim
+// The plugconf which is used only while the profile is current.
+// It wins over the user's plugconf (Plugconf()).
+func ProfilePlugconf(profileName string, reposPath ReposPath) string {
+	filenameList := strings.Split(filepath.ToSlash(reposPath.String()+".vim"), "/")
+	paths := make([]string, 0, len(filenameList)+2)
+	paths = append(paths, RCDir(profileName))
+	paths = append(paths, "plugconf")
+	paths = append(paths, filenameList...)
+	return filepath.Join(paths...)
+}
+
 var packer = strings.NewReplacer("_", "__", "/", "_")
 var unpacker1 = strings.NewReplacer("_", "/")
 var unpacker2 = strings.NewReplacer("//", "_")
@@ -134,17 +197,106 @@ var unpacker2 = strings.NewReplacer("//", "_")
 // Encode repos path to directory name.
 // The directory name is: ~/.vim/pack/volt/opt/{name}
 func EncodeReposPath(reposPath ReposPath) string {
-	path := packer.Replace(reposPath.String())
-	return filepath.Join(VimVoltOptDir(), path)
+	return EncodeReposPathTo(VimVoltOptDir(), reposPath)
+}
+
+// Encode repos path to directory name under dir.
+// The directory name is: {dir}/{name}
+// If {name} is longer than maxEncodedNameLen, the hashed name is used
+// instead (see encodeLongName()).
+func EncodeReposPathTo(dir string, reposPath ReposPath) string {
+	name := packer.Replace(reposPath.String())
+	if len(name) > maxEncodedNameLen {
+		name = encodeLongName(reposPath)
+	}
+	return filepath.Join(dir, name)
 }
 
 // Decode name to repos path.
 // name is directory name: ~/.vim/pack/volt/opt/{name}
+// The hashed name is decoded by the mapping in EncodedNamesJSON()
+// (see RecordEncodedName()).
+// If the mapping is not found, the hashed name is returned as is.
 func DecodeReposPath(name string) ReposPath {
 	name = filepath.Base(name)
+	if strings.HasPrefix(name, hashedNamePrefix) {
+		if reposPath, ok := readEncodedNames()[name]; ok {
+			return reposPath
+		}
+		return ReposPath(name)
+	}
 	return ReposPath(unpacker2.Replace(unpacker1.Replace(name)))
 }
 
+// The encoded names longer than this are replaced with hashed names.
+// A file name is limited to 255 bytes on most filesystems, and a whole path
+// is limited to 260 characters on Windows by default.
+const maxEncodedNameLen = 100
+
+// Hashed names start with this. Other encoded names never start with "~"
+// because repos path starts with a host name.
+const hashedNamePrefix = "~"
+
+var encodedNamesMu sync.Mutex
+
+// Returns the hashed name of reposPath: "~{hash}_{name}", where {hash} is
+// the first 16 digits of SHA-1 of reposPath, and {name} is the last
+// component of reposPath (truncated to 32 bytes).
+// The name is decoded by the mapping which RecordEncodedName() writes.
+func encodeLongName(reposPath ReposPath) string {
+	sum := sha1.Sum([]byte(reposPath))
+	base := packer.Replace(path.Base(reposPath.String()))
+	if len(base) > 32 {
+		base = base[:32]
+	}
+	return hashedNamePrefix + hex.EncodeToString(sum[:])[:16] + "_" + base
+}
+
+// Add the hashed name of reposPath to EncodedNamesJSON() unless it was
+// already added, so that DecodeReposPath() can decode it.
+// It is called when the repository is installed, and does nothing if the
+// encoded name of reposPath is not hashed.
+// The file is checked every time because it is removed by full build.
+func RecordEncodedName(reposPath ReposPath) error {
+	if len(packer.Replace(reposPath.String())) <= maxEncodedNameLen {
+		return nil
+	}
+	name := encodeLongName(reposPath)
+
+	encodedNamesMu.Lock()
+	defer encodedNamesMu.Unlock()
+
+	file := EncodedNamesJSON()
+	names := readEncodedNamesFile(file)
+	if names[name] == reposPath {
+		return nil
+	}
+	names[name] = reposPath
+	b, err := json.MarshalIndent(names, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, b, 0644)
+}
+
+// Returns the mapping from hashed names to repos paths
+func readEncodedNames() map[string]ReposPath {
+	encodedNamesMu.Lock()
+	defer encodedNamesMu.Unlock()
+	return readEncodedNamesFile(EncodedNamesJSON())
+}
+
+func readEncodedNamesFile(file string) map[string]ReposPath {
+	names := make(map[string]ReposPath)
+	if b, err := ioutil.ReadFile(file); err == nil {
+		json.Unmarshal(b, &names)
+	}
+	return names
+}
+
 // $HOME/volt/lock.json
 func LockJSON() string {
 	return filepath.Join(VoltPath(), "lock.json")
@@ -180,9 +332,15 @@ func VimExecutable() (string, error) {
 	return exec.LookPath(exeName)
 }
 
-// Windows: $HOME/vimfiles
-// Otherwise: $HOME/.vim
+// $VOLT_HOME if VOLT_HOME environment variable is set (e.g. to use
+// $XDG_DATA_HOME/vim, or an isolated directory for testing).
+// Otherwise:
+//   Windows  : $HOME/vimfiles
+//   Otherwise: $HOME/.vim
 func VimDir() string {
+	if dir := os.Getenv("VOLT_HOME"); dir != "" {
+		return dir
+	}
 	if runtime.GOOS == "windows" {
 		return filepath.Join(HomeDir(), "vimfiles")
 	} else {
@@ -190,19 +348,50 @@ func VimDir() string {
 	}
 }
 
+// The default name of the package which volt manages: (vim dir)/pack/volt
+const DefaultPackageName = "volt"
+
+var packageName = DefaultPackageName
+
+var rxPackageName = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+
+// Returns error if name cannot be used as the package name.
+// name must be one path segment (e.g. "myvolt") which does not start with ".".
+func ValidatePackageName(name string) error {
+	if !rxPackageName.MatchString(name) {
+		return errors.New("invalid package name: " + name)
+	}
+	return nil
+}
+
+// Change the package name (DefaultPackageName by default) of
+// VimVoltDir(), VimVoltOptDir(), VimVoltStartDir() and the paths under them.
+func SetPackageName(name string) error {
+	if err := ValidatePackageName(name); err != nil {
+		return err
+	}
+	packageName = name
+	return nil
+}
+
+// The name of the package which volt manages
+func PackageName() string {
+	return packageName
+}
+
 // (vim dir)/pack/volt
 func VimVoltDir() string {
-	return filepath.Join(VimDir(), "pack", "volt")
+	return filepath.Join(VimDir(), "pack", packageName)
 }
 
 // (vim dir)/pack/volt/opt
 func VimVoltOptDir() string {
-	return filepath.Join(VimDir(), "pack", "volt", "opt")
+	return filepath.Join(VimVoltDir(), "opt")
 }
 
 // (vim dir)/pack/volt/start
 func VimVoltStartDir() string {
-	return filepath.Join(VimDir(), "pack", "volt", "start")
+	return filepath.Join(VimVoltDir(), "start")
 }
 
 // (vim dir)/pack/volt/build-info.json
@@ -210,6 +399,24 @@ func BuildInfoJSON() string {
 	return filepath.Join(VimVoltDir(), "build-info.json")
 }
 
+// (vim dir)/volt-backups
+// It is not under "pack" directory not to load the kept plugins.
+func VoltBackupsDir() string {
+	return filepath.Join(VimDir(), "volt-backups")
+}
+
+// (vim dir)/pack/volt/build-checkpoint.json
+func BuildCheckpointJSON() string {
+	return filepath.Join(VimVoltDir(), "build-checkpoint.json")
+}
+
+// (vim dir)/pack/volt/encoded-names.json
+// This has the mapping from hashed names of installed directories
+// to repos paths (see EncodeReposPathTo())
+func EncodedNamesJSON() string {
+	return filepath.Join(VimVoltDir(), "encoded-names.json")
+}
+
 // (vim dir)/pack/volt/start/system/plugin/bundled_plugconf.vim
 func BundledPlugConf() string {
 	return filepath.Join(VimVoltStartDir(), "system", "plugin", "bundled_plugconf.vim")
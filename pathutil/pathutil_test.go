@@ -1,6 +1,12 @@
 package pathutil
 
-import "testing"
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
 
 func TestNormalizeRepos(t *testing.T) {
 	var tests = []struct {
@@ -52,3 +58,218 @@ func TestNormalizeReposError(t *testing.T) {
 		}
 	}
 }
+
+func TestNormalizeReposWithRef(t *testing.T) {
+	var tests = []struct {
+		in   string
+		path ReposPath
+		ref  string
+	}{
+		{"user/name", ReposPath("github.com/user/name"), ""},
+		{"user/name@v2", ReposPath("github.com/user/name"), "v2"},
+		{"user/name.git@v2.0.1", ReposPath("github.com/user/name"), "v2.0.1"},
+		{"github.com/user/name@feature/foo", ReposPath("github.com/user/name"), "feature/foo"},
+		{"https://github.com/user/name@3a12b4c", ReposPath("github.com/user/name"), "3a12b4c"},
+		{"https://user@github.com/user/name", ReposPath("user@github.com/user/name"), ""},
+	}
+	for _, tt := range tests {
+		path, ref, err := NormalizeReposWithRef(tt.in)
+		if err != nil {
+			t.Errorf("in:%s, err:%s", tt.in, err.Error())
+			continue
+		}
+		if path != tt.path || ref != tt.ref {
+			t.Errorf("in:%s, got:(%s, %s), expected:(%s, %s)", tt.in, path, ref, tt.path, tt.ref)
+		}
+	}
+}
+
+func TestNormalizeReposWithRefError(t *testing.T) {
+	var tests = []string{
+		"user/name@",
+		"user/name@@v2",
+		"user/name@v1@v2",
+		"user/name@-v2",
+		"user/name@v2/",
+		"user/name@v2..v3",
+		"user/name@v2.lock",
+		"user/name@v 2",
+		"user/@v2",
+		"ftp://github.com/user/name@v2",
+	}
+	for _, tt := range tests {
+		_, _, err := NormalizeReposWithRef(tt)
+		if err == nil {
+			t.Errorf("in:%s -> expected error but no error", tt)
+		}
+	}
+}
+
+func TestSetPackageName(t *testing.T) {
+	defer SetPackageName(DefaultPackageName)
+	if err := SetPackageName("myvolt"); err != nil {
+		t.Fatal("SetPackageName() failed: " + err.Error())
+	}
+	if PackageName() != "myvolt" {
+		t.Errorf("PackageName() = %s, expected myvolt", PackageName())
+	}
+	pkgDir := filepath.Join(VimDir(), "pack", "myvolt")
+	var tests = []struct {
+		name string
+		path string
+	}{
+		{"VimVoltDir()", VimVoltDir()},
+		{"VimVoltOptDir()", VimVoltOptDir()},
+		{"VimVoltStartDir()", VimVoltStartDir()},
+		{"BuildInfoJSON()", BuildInfoJSON()},
+		{"BundledPlugConf()", BundledPlugConf()},
+		{"EncodeReposPath()", EncodeReposPath("github.com/tyru/caw.vim")},
+	}
+	for _, tt := range tests {
+		if tt.path != pkgDir && !strings.HasPrefix(tt.path, pkgDir+string(filepath.Separator)) {
+			t.Errorf("%s = %s, expected under %s", tt.name, tt.path, pkgDir)
+		}
+	}
+	// The encoding of repository directories is unchanged
+	if base := filepath.Base(EncodeReposPath("github.com/tyru/caw.vim")); base != "github.com_tyru_caw.vim" {
+		t.Errorf("EncodeReposPath() base = %s, expected github.com_tyru_caw.vim", base)
+	}
+}
+
+func TestSetPackageNameError(t *testing.T) {
+	defer SetPackageName(DefaultPackageName)
+	var tests = []string{
+		"",
+		".",
+		"..",
+		".volt",
+		"my/volt",
+		"my\\volt",
+		"my volt",
+	}
+	for _, tt := range tests {
+		if err := SetPackageName(tt); err == nil {
+			t.Errorf("in:%q -> expected error but no error", tt)
+		}
+	}
+	if PackageName() != DefaultPackageName {
+		t.Errorf("PackageName() = %s, expected %s", PackageName(), DefaultPackageName)
+	}
+}
+
+func TestVimDirVoltHome(t *testing.T) {
+	voltHome, err := ioutil.TempDir("", "volt-test-")
+	if err != nil {
+		t.Fatal("failed to create temp dir")
+	}
+	defer os.RemoveAll(voltHome)
+	defer os.Setenv("VOLT_HOME", os.Getenv("VOLT_HOME"))
+	os.Setenv("VOLT_HOME", voltHome)
+
+	if VimDir() != voltHome {
+		t.Errorf("VimDir() = %s, expected %s", VimDir(), voltHome)
+	}
+	vimrc := filepath.Join(voltHome, "vimrc")
+	if err := ioutil.WriteFile(vimrc, []byte(""), 0644); err != nil {
+		t.Fatal("failed to write " + vimrc)
+	}
+	var tests = []struct {
+		name string
+		path string
+	}{
+		{"VimVoltDir()", VimVoltDir()},
+		{"VimVoltOptDir()", VimVoltOptDir()},
+		{"VimVoltStartDir()", VimVoltStartDir()},
+		{"BuildInfoJSON()", BuildInfoJSON()},
+		{"BuildCheckpointJSON()", BuildCheckpointJSON()},
+		{"EncodedNamesJSON()", EncodedNamesJSON()},
+		{"BundledPlugConf()", BundledPlugConf()},
+		{"EncodeReposPath()", EncodeReposPath("github.com/tyru/caw.vim")},
+	}
+	for _, tt := range tests {
+		if !strings.HasPrefix(tt.path, voltHome+string(filepath.Separator)) {
+			t.Errorf("%s = %s, expected under %s", tt.name, tt.path, voltHome)
+		}
+	}
+	found := false
+	for _, path := range LookUpVimrc() {
+		found = found || path == vimrc
+	}
+	if !found {
+		t.Errorf("LookUpVimrc() = %v, expected to have %s", LookUpVimrc(), vimrc)
+	}
+
+	// $HOME/.vim is used if VOLT_HOME is empty
+	os.Setenv("VOLT_HOME", "")
+	if VimDir() == voltHome {
+		t.Errorf("VimDir() = %s, expected the default", VimDir())
+	}
+}
+
+func TestEncodeReposPathLong(t *testing.T) {
+	home, err := ioutil.TempDir("", "volt-test-")
+	if err != nil {
+		t.Fatal("failed to create temp dir: " + err.Error())
+	}
+	defer os.RemoveAll(home)
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", home)
+
+	short := ReposPath("github.com/tyru/caw.vim")
+	long := ReposPath("example.com/" + strings.Repeat("very-long-group-name/", 5) + "a-plugin-with-a-long-name.vim")
+
+	// The encoding of short path is unchanged and no mapping is written
+	if base := filepath.Base(EncodeReposPath(short)); base != "github.com_tyru_caw.vim" {
+		t.Errorf("EncodeReposPath(%s) base = %s, expected github.com_tyru_caw.vim", short, base)
+	}
+	if Exists(EncodedNamesJSON()) {
+		t.Errorf("%s was written for short path", EncodedNamesJSON())
+	}
+
+	encoded := EncodeReposPath(long)
+	name := filepath.Base(encoded)
+	if filepath.Dir(encoded) != VimVoltOptDir() {
+		t.Errorf("EncodeReposPath(%s) = %s, expected under %s", long, encoded, VimVoltOptDir())
+	}
+	if len(name) > maxEncodedNameLen || !strings.HasPrefix(name, hashedNamePrefix) {
+		t.Errorf("EncodeReposPath(%s) base = %s, expected hashed name", long, name)
+	}
+	// The same name is returned for the same path in any directory
+	if other := filepath.Base(EncodeReposPathTo(VimVoltStartDir(), long)); other != name {
+		t.Errorf("EncodeReposPathTo() base = %s, expected %s", other, name)
+	}
+
+	// The mapping is written only by RecordEncodedName()
+	if Exists(EncodedNamesJSON()) {
+		t.Errorf("%s was written by EncodeReposPath()", EncodedNamesJSON())
+	}
+	if err := RecordEncodedName(short); err != nil {
+		t.Errorf("RecordEncodedName(%s) failed: %s", short, err.Error())
+	}
+	if Exists(EncodedNamesJSON()) {
+		t.Errorf("%s was written for short path", EncodedNamesJSON())
+	}
+	if err := RecordEncodedName(long); err != nil {
+		t.Errorf("RecordEncodedName(%s) failed: %s", long, err.Error())
+	}
+
+	// Round-trip through the mapping
+	if decoded := DecodeReposPath(encoded); decoded != long {
+		t.Errorf("DecodeReposPath(%s) = %s, expected %s", encoded, decoded, long)
+	}
+	if decoded := DecodeReposPath(EncodeReposPath(short)); decoded != short {
+		t.Errorf("DecodeReposPath() = %s, expected %s", decoded, short)
+	}
+
+	// The mapping is written again after it was removed (e.g. by full build)
+	os.RemoveAll(VimVoltDir())
+	if decoded := DecodeReposPath(encoded); decoded != ReposPath(name) {
+		t.Errorf("DecodeReposPath(%s) = %s without mapping, expected %s", encoded, decoded, name)
+	}
+	if err := RecordEncodedName(long); err != nil {
+		t.Errorf("RecordEncodedName(%s) failed: %s", long, err.Error())
+	}
+	if decoded := DecodeReposPath(encoded); decoded != long {
+		t.Errorf("DecodeReposPath(%s) = %s, expected %s", encoded, decoded, long)
+	}
+}
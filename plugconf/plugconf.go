@@ -16,6 +16,7 @@ import (
 	"github.com/vim-volt/volt/httputil"
 	"github.com/vim-volt/volt/lockjson"
 	"github.com/vim-volt/volt/pathutil"
+	"github.com/vim-volt/volt/vimutil"
 
 	"github.com/haya14busa/go-vimlparser"
 	"github.com/haya14busa/go-vimlparser/ast"
@@ -30,6 +31,10 @@ const (
 	loadOnExcmd               = "(loadOnExcmd)"
 )
 
+// The prefix of s:config_profile_{profile}() functions, which are invoked
+// after s:config() only in the profile
+const configProfileFuncPrefix = "s:config_profile_"
+
 const (
 	excmdLoadPlugin   = "s:__volt_excmd_load_plugin"
 	lazyLoadExcmdFunc = "s:__volt_lazy_load_excmd"
@@ -42,44 +47,81 @@ func isProhibitedFuncName(name string) bool {
 }
 
 type Plugconf struct {
-	reposID     int
-	reposPath   pathutil.ReposPath
-	functions   []string
-	configFunc  string
-	loadOnFunc  string
-	loadOn      loadOnType
-	loadOnArg   string
-	dependsFunc string
-	depends     pathutil.ReposPathList
+	reposID            int
+	reposPath          pathutil.ReposPath
+	functions          []string
+	configFunc         string
+	profileConfigFuncs map[string]string
+	loadOnFunc         string
+	loadOn             loadOnType
+	loadOnArg          string
+	dependsFunc        string
+	depends            pathutil.ReposPathList
+	requiresFunc       string
+	requires           []string
+}
+
+// ParseError is the error of the plugconf of a repository.
+// Line and Column are 0 if the position is unknown.
+type ParseError struct {
+	ReposPath pathutil.ReposPath
+	// The path of the plugconf file
+	Filename string
+	Line     int
+	Column   int
+	Msg      string
+}
+
+func (e *ParseError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("plugconf for %s: %d:%d: %s", e.ReposPath, e.Line, e.Column, e.Msg)
+	}
+	return fmt.Sprintf("plugconf for %s: %s", e.ReposPath, e.Msg)
 }
 
+// ParsePlugconfFile parses the plugconf file of reposPath.
+// The returned error is *ParseError.
 func ParsePlugconfFile(plugConf string, reposID int, reposPath pathutil.ReposPath) (*Plugconf, error) {
 	content, err := ioutil.ReadFile(plugConf)
 	if err != nil {
-		return nil, err
+		return nil, &ParseError{ReposPath: reposPath, Filename: plugConf, Msg: err.Error()}
 	}
 	src := string(content)
 	file, err := vimlparser.ParseFile(strings.NewReader(src), plugConf, nil)
 	if err != nil {
-		return nil, err
+		perr := &ParseError{ReposPath: reposPath, Filename: plugConf, Msg: err.Error()}
+		if e, ok := err.(*vimlparser.ErrVimlParser); ok {
+			perr.Line, perr.Column, perr.Msg = e.Line, e.Column, e.Msg
+		}
+		return nil, perr
 	}
 	parsed, err := ParsePlugconf(file, src)
 	if err != nil {
-		return nil, fmt.Errorf("parse error in %s: %s", plugConf, err.Error())
+		perr := &ParseError{ReposPath: reposPath, Filename: plugConf, Msg: err.Error()}
+		if e, ok := err.(*ParseError); ok {
+			perr.Line, perr.Column, perr.Msg = e.Line, e.Column, e.Msg
+		}
+		return nil, perr
 	}
 	parsed.reposID = reposID
 	parsed.reposPath = reposPath
 	return parsed, nil
 }
 
+// ParsePlugconf parses the plugconf. If the error is in a function, the
+// returned error is *ParseError which has the position of the invalid node
+// or the function (ReposPath and Filename are empty).
 func ParsePlugconf(file *ast.File, src string) (*Plugconf, error) {
 	var loadOn loadOnType = loadOnStart
 	var loadOnArg string
 	var loadOnFunc string
 	var configFunc string
+	var profileConfigFuncs map[string]string
 	var functions []string
 	var dependsFunc string
 	var depends pathutil.ReposPathList
+	var requiresFunc string
+	var requires []string
 	var parseErr error
 
 	// Inspect nodes and get above values from plugconf script
@@ -107,24 +149,42 @@ func ParsePlugconf(file *ast.File, src string) (*Plugconf, error) {
 				var err error
 				loadOn, loadOnArg, err = inspectReturnValue(fn)
 				if err != nil {
-					parseErr = err
+					parseErr = errorAt(fn, err)
 				}
 			}
 		case name == "s:config":
 			if !isEmptyFunc(fn) {
 				configFunc = extractBody(fn, src)
 			}
+		case strings.HasPrefix(name, configProfileFuncPrefix) &&
+			len(name) > len(configProfileFuncPrefix):
+			if !isEmptyFunc(fn) {
+				if profileConfigFuncs == nil {
+					profileConfigFuncs = make(map[string]string)
+				}
+				profileName := name[len(configProfileFuncPrefix):]
+				profileConfigFuncs[profileName] = extractBody(fn, src)
+			}
 		case name == "s:depends":
 			if !isEmptyFunc(fn) {
 				dependsFunc = extractBody(fn, src)
 				var err error
 				depends, err = getDependencies(fn, src)
 				if err != nil {
-					parseErr = err
+					parseErr = errorAt(fn, err)
+				}
+			}
+		case name == "s:requires":
+			if !isEmptyFunc(fn) {
+				requiresFunc = extractBody(fn, src)
+				var err error
+				requires, err = getRequirements(fn)
+				if err != nil {
+					parseErr = errorAt(fn, err)
 				}
 			}
 		case isProhibitedFuncName(name):
-			parseErr = fmt.Errorf("'%s' is prohibited function name. Please use other function name.", name)
+			parseErr = errorAt(fn, fmt.Errorf("'%s' is prohibited function name. Please use other function name.", name))
 		default:
 			functions = append(functions, extractBody(fn, src))
 		}
@@ -137,13 +197,16 @@ func ParsePlugconf(file *ast.File, src string) (*Plugconf, error) {
 	}
 
 	return &Plugconf{
-		functions:   functions,
-		configFunc:  configFunc,
-		loadOnFunc:  loadOnFunc,
-		loadOn:      loadOn,
-		loadOnArg:   loadOnArg,
-		dependsFunc: dependsFunc,
-		depends:     depends,
+		functions:          functions,
+		configFunc:         configFunc,
+		profileConfigFuncs: profileConfigFuncs,
+		loadOnFunc:         loadOnFunc,
+		loadOn:             loadOn,
+		loadOnArg:          loadOnArg,
+		dependsFunc:        dependsFunc,
+		depends:            depends,
+		requiresFunc:       requiresFunc,
+		requires:           requires,
 	}, nil
 }
 
@@ -174,18 +237,32 @@ func inspectReturnValue(fn *ast.Function) (loadOnType, string, error) {
 				loadOn = loadOnExcmd
 				loadOnArg = strings.TrimPrefix(value, "excmd=")
 			} else {
-				err = errors.New("Invalid rhs of ':return': " + rhs.Value)
+				err = errorAt(rhs, errors.New("Invalid rhs of ':return': "+rhs.Value))
 			}
 		}
 
 		return true
 	})
+	if err != nil {
+		return "", "", err
+	}
 	if string(loadOn) == "" {
 		return "", "", errors.New("can't detect return value of s:loaded_on()")
 	}
 	return loadOn, loadOnArg, err
 }
 
+// Returns *ParseError which has the position of node.
+// If err is already *ParseError, it is returned as is because it has more
+// precise position.
+func errorAt(node ast.Node, err error) error {
+	if _, ok := err.(*ParseError); ok {
+		return err
+	}
+	pos := node.Pos()
+	return &ParseError{Line: pos.Line, Column: pos.Column, Msg: err.Error()}
+}
+
 // Returns true if fn.Body is empty or has only comment nodes
 func isEmptyFunc(fn *ast.Function) bool {
 	for i := range fn.Body {
@@ -236,7 +313,7 @@ func getDependencies(fn *ast.Function, src string) (pathutil.ReposPathList, erro
 					if str.Kind == token.STRING {
 						reposPath, err := pathutil.NormalizeRepos(str.Value[1 : len(str.Value)-1])
 						if err != nil {
-							parseErr = err
+							parseErr = errorAt(str, err)
 							return false
 						}
 						deps = append(deps, reposPath)
@@ -250,8 +327,45 @@ func getDependencies(fn *ast.Function, src string) (pathutil.ReposPathList, erro
 	return deps, parseErr
 }
 
-// s:loaded_on() function is not included
-func makeBundledPlugconf(reposList []lockjson.Repos, plugconf map[pathutil.ReposPath]*Plugconf) ([]byte, error) {
+// Returns the elements of list literal returned by s:requires()
+func getRequirements(fn *ast.Function) ([]string, error) {
+	var requires []string
+	var parseErr error
+
+	ast.Inspect(fn, func(node ast.Node) bool {
+		// Cast to return node (return if it's not a return node)
+		ret, ok := node.(*ast.Return)
+		if !ok {
+			return true
+		}
+		list, ok := ret.Result.(*ast.List)
+		if !ok {
+			parseErr = errorAt(ret, errors.New("the argument of ':return' in s:requires() must be list literal"))
+			return false
+		}
+		for i := range list.Values {
+			str, ok := list.Values[i].(*ast.BasicLit)
+			if !ok || str.Kind != token.STRING {
+				parseErr = errorAt(list.Values[i], errors.New("the elements of s:requires() must be string literal"))
+				return false
+			}
+			requirement := str.Value[1 : len(str.Value)-1]
+			if err := vimutil.ValidateRequirement(requirement); err != nil {
+				parseErr = errorAt(str, err)
+				return false
+			}
+			requires = append(requires, requirement)
+		}
+		return true
+	})
+
+	return requires, parseErr
+}
+
+// s:loaded_on() function is not included.
+// s:config_profile_{profileName}() functions are included only for
+// profileName.
+func makeBundledPlugconf(profileName string, reposList []lockjson.Repos, plugconf map[pathutil.ReposPath]*Plugconf) ([]byte, error) {
 	functions := make([]string, 0, 64)
 	loadCmds := make([]string, 0, len(reposList))
 	lazyExcmd := make(map[string]string, len(reposList))
@@ -262,17 +376,26 @@ func makeBundledPlugconf(reposList []lockjson.Repos, plugconf map[pathutil.Repos
 		optName := filepath.Base(pathutil.EncodeReposPath(repos.Path))
 		packadd := fmt.Sprintf("packadd %s", optName)
 
-		// s:config() and invoked command
-		var invokedCmd string
+		// s:config(), s:config_profile_{profileName}() and invoked command
+		var configCalls []string
 		if hasPlugconf && p.configFunc != "" {
 			functions = append(functions, convertToDecodableFunc(p.configFunc, p.reposPath, p.reposID))
-			invokedCmd = fmt.Sprintf("call s:config_%d() | %s", p.reposID, packadd)
-		} else {
-			invokedCmd = packadd
+			configCalls = append(configCalls, fmt.Sprintf("call s:config_%d()", p.reposID))
 		}
+		if hasPlugconf && p.profileConfigFuncs[profileName] != "" {
+			functions = append(functions, convertToDecodableFunc(p.profileConfigFuncs[profileName], p.reposPath, p.reposID))
+			configCalls = append(configCalls, fmt.Sprintf("call %s%s_%d()", configProfileFuncPrefix, profileName, p.reposID))
+		}
+		invokedCmd := strings.Join(append(configCalls, packadd), " | ")
 
 		// Bootstrap statements
 		switch {
+		case repos.Placement == lockjson.ReposStartPlacement:
+			// Vim loads the repository in start directory automatically,
+			// so only s:config() (and s:config_profile_{profileName}()) is invoked
+			if len(configCalls) > 0 {
+				loadCmds = append(loadCmds, "  "+strings.Join(configCalls, " | "))
+			}
 		case !hasPlugconf || p.loadOn == loadOnStart:
 			loadCmds = append(loadCmds, "  "+invokedCmd)
 		case p.loadOn == loadOnFileType:
@@ -303,6 +426,7 @@ let g:loaded_volt_system_bundled_plugconf = 1`)
 		buf.WriteString(strings.Join(functions, "\n\n"))
 	}
 	if len(lazyExcmd) > 0 {
+		// json.Marshal() sorts map keys, so the output is stable
 		lazyExcmdJSON, err := json.Marshal(lazyExcmd)
 		if err != nil {
 			return nil, err
@@ -383,18 +507,24 @@ type reposDepNode struct {
 	dependedBy []reposDepNode
 }
 
-func GenerateBundlePlugconf(reposList []lockjson.Repos) ([]byte, *multierror.Error) {
-	plugconfMap, merr := parsePlugconfAsMap(reposList)
+// Generates the bundled plugconf of reposList.
+// The profile plugconf of profileName is used if it exists
+// (see LookUpPlugconf()).
+func GenerateBundlePlugconf(profileName string, reposList []lockjson.Repos) ([]byte, *multierror.Error) {
+	plugconfMap, merr := parsePlugconfAsMap(profileName, reposList)
 	if merr.ErrorOrNil() != nil {
 		return nil, merr
 	}
 	sortByDepends(reposList, plugconfMap)
-	content, err := makeBundledPlugconf(reposList, plugconfMap)
+	content, err := makeBundledPlugconf(profileName, reposList, plugconfMap)
 	return content, multierror.Append(nil, err)
 }
 
+// Returns the repositories which depend on reposPath.
+// Profile plugconfs are not looked up because reposList may be
+// the repositories of all profiles.
 func RdepsOf(reposPath pathutil.ReposPath, reposList []lockjson.Repos) (pathutil.ReposPathList, error) {
-	plugconfMap, merr := parsePlugconfAsMap(reposList)
+	plugconfMap, merr := parsePlugconfAsMap("", reposList)
 	if merr.ErrorOrNil() != nil {
 		return nil, merr
 	}
@@ -406,16 +536,54 @@ func RdepsOf(reposPath pathutil.ReposPath, reposList []lockjson.Repos) (pathutil
 	return rdeps, nil
 }
 
+// Returns the requirements of Vim (the return value of s:requires() in
+// plugconf) of each repository. The repositories which do not have
+// s:requires() are not included.
+func RequirementsOf(profileName string, reposList []lockjson.Repos) (map[pathutil.ReposPath][]string, *multierror.Error) {
+	plugconfMap, merr := parsePlugconfAsMap(profileName, reposList)
+	if merr.ErrorOrNil() != nil {
+		return nil, merr
+	}
+	requires := make(map[pathutil.ReposPath][]string, len(plugconfMap))
+	for reposPath, p := range plugconfMap {
+		if len(p.requires) > 0 {
+			requires[reposPath] = p.requires
+		}
+	}
+	return requires, nil
+}
+
+// Returns the plugconf path of reposPath.
+// The profile plugconf ($VOLTPATH/rc/{profileName}/plugconf/{repos}.vim)
+// wins over user's plugconf ($VOLTPATH/plugconf/{repos}.vim), and user's
+// plugconf always wins over the plugconf shipped with the repository
+// ($VOLTPATH/repos/{repos}/plugconf.vim).
+// The profile plugconf is not looked up if profileName is empty.
+// Returns empty string if all do not exist.
+func LookUpPlugconf(profileName string, reposPath pathutil.ReposPath) string {
+	paths := make([]string, 0, 3)
+	if profileName != "" {
+		paths = append(paths, pathutil.ProfilePlugconf(profileName, reposPath))
+	}
+	paths = append(paths, pathutil.Plugconf(reposPath), pathutil.ReposPlugconf(reposPath))
+	for _, path := range paths {
+		if pathutil.Exists(path) {
+			return path
+		}
+	}
+	return ""
+}
+
 // Parse plugconf of reposList and return parsed plugconf info as map
-func parsePlugconfAsMap(reposList []lockjson.Repos) (map[pathutil.ReposPath]*Plugconf, *multierror.Error) {
+func parsePlugconfAsMap(profileName string, reposList []lockjson.Repos) (map[pathutil.ReposPath]*Plugconf, *multierror.Error) {
 	var merr *multierror.Error
 	plugconfMap := make(map[pathutil.ReposPath]*Plugconf, len(reposList))
 	reposID := 1
 	for _, repos := range reposList {
 		var parsed *Plugconf
 		var err error
-		path := pathutil.Plugconf(repos.Path)
-		if pathutil.Exists(path) {
+		path := LookUpPlugconf(profileName, repos.Path)
+		if path != "" {
 			parsed, err = ParsePlugconfFile(path, reposID, repos.Path)
 		} else {
 			continue
@@ -443,7 +611,9 @@ func sortByDepends(reposList []lockjson.Repos, plugconfMap map[pathutil.ReposPat
 			}
 		}
 	}
-	sort.Slice(reposList, func(i, j int) bool {
+	// Keep the order of reposList between the repositories of the same rank
+	// to generate the same bundled plugconf every time
+	sort.SliceStable(reposList, func(i, j int) bool {
 		return rank[reposList[i].Path] < rank[reposList[j].Path]
 	})
 }
@@ -581,6 +751,18 @@ func GenPlugconfByTemplate(tmplPlugconf string, filename string) ([]byte, error)
 	if err != nil {
 		return nil, err
 	}
+	// s:config_profile_{profile}()
+	profileNames := make([]string, 0, len(parsed.profileConfigFuncs))
+	for name := range parsed.profileConfigFuncs {
+		profileNames = append(profileNames, name)
+	}
+	sort.Strings(profileNames)
+	for _, name := range profileNames {
+		_, err = buf.WriteString(parsed.profileConfigFuncs[name] + "\n\n")
+		if err != nil {
+			return nil, err
+		}
+	}
 	// s:loaded_on()
 	if parsed.loadOnFunc != "" {
 		_, err = buf.WriteString(parsed.loadOnFunc)
@@ -603,6 +785,13 @@ func GenPlugconfByTemplate(tmplPlugconf string, filename string) ([]byte, error)
 	if err != nil {
 		return nil, err
 	}
+	// s:requires()
+	if parsed.requiresFunc != "" {
+		_, err = buf.WriteString("\n\n" + parsed.requiresFunc)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	return buf.Bytes(), nil
 }
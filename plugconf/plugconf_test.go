@@ -0,0 +1,197 @@
+package plugconf
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vim-volt/volt/lockjson"
+	"github.com/vim-volt/volt/pathutil"
+)
+
+func TestGenerateBundlePlugconfIsDeterministic(t *testing.T) {
+	_, cleanup := setUpVoltpath(t)
+	defer cleanup()
+
+	// Many repositories which have the same rank (no dependencies),
+	// lazy-loaded Ex commands, and dependencies
+	plugconfs := map[pathutil.ReposPath]string{
+		"github.com/tyru/open-browser.vim": `function! s:loaded_on()
+  return 'excmd=OpenBrowser,OpenBrowserSearch,OpenBrowserSmartSearch'
+endfunction`,
+		"github.com/tyru/open-browser-github.vim": `function! s:loaded_on()
+  return 'excmd=OpenGithubFile,OpenGithubIssue,OpenGithubPullReq'
+endfunction
+
+function! s:depends()
+  return ['github.com/tyru/open-browser.vim']
+endfunction`,
+		"github.com/tyru/caw.vim": `function! s:config()
+  let g:caw_no_default_keymappings = 1
+endfunction`,
+		"github.com/tyru/eskk.vim": `function! s:loaded_on()
+  return 'filetype=text,markdown'
+endfunction`,
+	}
+	reposList := make([]lockjson.Repos, 0, 32)
+	for reposPath, content := range plugconfs {
+		path := pathutil.Plugconf(reposPath)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal("failed to write " + path)
+		}
+	}
+	for _, name := range strings.Fields("a b c d e f g h i j k l m n o p") {
+		reposList = append(reposList, lockjson.Repos{Path: pathutil.ReposPath("github.com/user/" + name)})
+	}
+	reposList = append(reposList,
+		lockjson.Repos{Path: "github.com/tyru/open-browser-github.vim"},
+		lockjson.Repos{Path: "github.com/tyru/caw.vim"},
+		lockjson.Repos{Path: "github.com/tyru/open-browser.vim"},
+		lockjson.Repos{Path: "github.com/tyru/eskk.vim"},
+	)
+
+	var expected []byte
+	for i := 0; i < 100; i++ {
+		list := make([]lockjson.Repos, len(reposList))
+		copy(list, reposList)
+		content, merr := GenerateBundlePlugconf("", list)
+		if merr.ErrorOrNil() != nil {
+			t.Fatal("GenerateBundlePlugconf() failed: " + merr.Error())
+		}
+		if i == 0 {
+			expected = content
+			continue
+		}
+		if !bytes.Equal(content, expected) {
+			t.Fatalf("different output at %d:\n=== expected ===\n%s\n=== got ===\n%s", i, expected, content)
+		}
+	}
+
+	// The repositories of the same rank are in the order of reposList
+	var names []string
+	for _, line := range strings.Split(string(expected), "\n") {
+		if strings.HasPrefix(line, "  packadd github.com_user_") {
+			names = append(names, strings.TrimPrefix(line, "  packadd github.com_user_"))
+		}
+	}
+	if strings.Join(names, " ") != "a b c d e f g h i j k l m n o p" {
+		t.Errorf("the order of reposList was not kept: %v", names)
+	}
+	// open-browser.vim is loaded before open-browser-github.vim
+	if bytes.Index(expected, []byte("github.com_tyru_open-browser.vim")) > bytes.Index(expected, []byte("github.com_tyru_open-browser-github.vim")) {
+		t.Errorf("dependency is loaded after the dependent plugin:\n%s", expected)
+	}
+}
+
+func TestGenerateBundlePlugconfProfileConfig(t *testing.T) {
+	_, cleanup := setUpVoltpath(t)
+	defer cleanup()
+
+	reposPath := pathutil.ReposPath("github.com/tyru/caw.vim")
+	path := pathutil.Plugconf(reposPath)
+	os.MkdirAll(filepath.Dir(path), 0755)
+	content := `function! s:config()
+  let g:caw_no_default_keymappings = 1
+endfunction
+
+function! s:config_profile_work()
+  let g:caw_work = 1
+endfunction
+
+function! s:config_profile_home()
+  let g:caw_home = 1
+endfunction`
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal("failed to write " + path)
+	}
+
+	for _, tt := range []struct {
+		profileName string
+		included    []string
+		excluded    []string
+	}{
+		{"work", []string{"let g:caw_work = 1", "| call s:config_profile_work_"}, []string{"g:caw_home", "s:config_profile_home"}},
+		{"home", []string{"let g:caw_home = 1", "| call s:config_profile_home_"}, []string{"g:caw_work", "s:config_profile_work"}},
+		{"default", nil, []string{"g:caw_work", "g:caw_home", "s:config_profile_"}},
+	} {
+		reposList := []lockjson.Repos{{Path: reposPath}}
+		bundle, merr := GenerateBundlePlugconf(tt.profileName, reposList)
+		if merr.ErrorOrNil() != nil {
+			t.Fatal("GenerateBundlePlugconf() failed: " + merr.Error())
+		}
+		// s:config() is included in all profiles
+		for _, s := range append(tt.included, "let g:caw_no_default_keymappings = 1") {
+			if !bytes.Contains(bundle, []byte(s)) {
+				t.Errorf("[%s] expected %q is included but got:\n%s", tt.profileName, s, bundle)
+			}
+		}
+		for _, s := range tt.excluded {
+			if bytes.Contains(bundle, []byte(s)) {
+				t.Errorf("[%s] expected %q is not included but got:\n%s", tt.profileName, s, bundle)
+			}
+		}
+	}
+}
+
+func TestGenerateBundlePlugconfParseError(t *testing.T) {
+	_, cleanup := setUpVoltpath(t)
+	defer cleanup()
+
+	var reposList []lockjson.Repos
+	for _, tt := range []struct {
+		reposPath pathutil.ReposPath
+		content   string
+	}{
+		{"localhost/local/valid", "function! s:config()\nendfunction\n"},
+		{"localhost/local/syntax", "function! s:config()\n  let g:foo = \nendfunction\n"},
+		{"localhost/local/loaded-on", "\" comment\nfunction! s:loaded_on()\n  return 'invalid'\nendfunction\n"},
+		{"localhost/local/requires", "function! s:requires()\n  return ['has(\"nvim\")', 1]\nendfunction\n"},
+	} {
+		path := pathutil.Plugconf(tt.reposPath)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(tt.content), 0644); err != nil {
+			t.Fatal("failed to write " + path)
+		}
+		reposList = append(reposList, lockjson.Repos{Path: tt.reposPath})
+	}
+
+	_, merr := GenerateBundlePlugconf("", reposList)
+	if merr.ErrorOrNil() == nil {
+		t.Fatal("GenerateBundlePlugconf() did not return error")
+	}
+	if len(merr.Errors) != 3 {
+		t.Fatalf("expected 3 errors but got %d: %s", len(merr.Errors), merr.Error())
+	}
+	for i, prefix := range []string{
+		"plugconf for localhost/local/syntax: 2:",
+		"plugconf for localhost/local/loaded-on: 3:10: Invalid rhs of ':return': 'invalid'",
+		"plugconf for localhost/local/requires: 2:",
+	} {
+		if !strings.HasPrefix(merr.Errors[i].Error(), prefix) {
+			t.Errorf("expected error starts with %q but got %q", prefix, merr.Errors[i].Error())
+		}
+		if _, ok := merr.Errors[i].(*ParseError); !ok {
+			t.Errorf("expected *ParseError but got %T", merr.Errors[i])
+		}
+	}
+}
+
+// Sets VOLTPATH to a new temporary directory, and returns it and the function
+// which restores VOLTPATH and removes the directory
+func setUpVoltpath(t *testing.T) (string, func()) {
+	t.Helper()
+	voltpath, err := ioutil.TempDir("", "volt-test-")
+	if err != nil {
+		t.Fatal("failed to create temp dir")
+	}
+	orig := os.Getenv("VOLTPATH")
+	os.Setenv("VOLTPATH", voltpath)
+	return voltpath, func() {
+		os.Setenv("VOLTPATH", orig)
+		os.RemoveAll(voltpath)
+	}
+}
@@ -45,6 +45,12 @@ func Create() error {
 	return nil
 }
 
+// Returns true if $VOLTPATH/trx.lock was created by this process
+func Owned() bool {
+	pid, err := ioutil.ReadFile(pathutil.TrxLock())
+	return err == nil && string(pid) == strconv.Itoa(os.Getpid())
+}
+
 // Remove $VOLTPATH/trx.lock file
 func Remove() {
 	// Read pid from trx.lock file
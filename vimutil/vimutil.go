@@ -0,0 +1,209 @@
+package vimutil
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The oldest Vim version which supports packages (:help packages)
+const (
+	MinMajor = 8
+	MinMinor = 0
+)
+
+type VersionInfo struct {
+	// true if the executable is Neovim
+	Neovim bool
+	Major  int
+	Minor  int
+	// The largest number of "Included patches" (0 if not shown)
+	Patch int
+	// key: feature name (e.g. "packages"), value: included (+) or not (-)
+	Features map[string]bool
+}
+
+var rxVimVersion = regexp.MustCompile(`^VIM - Vi IMproved (\d+)\.(\d+)`)
+var rxNvimVersion = regexp.MustCompile(`^NVIM v(\d+)\.(\d+)(?:\.(\d+))?`)
+var rxPatches = regexp.MustCompile(`^Included patches: (.+)`)
+var rxFeature = regexp.MustCompile(`^([+-])+(\w+)`)
+
+// Parse the output of "vim --version"
+func ParseVersion(out string) (*VersionInfo, error) {
+	lines := strings.Split(strings.Replace(out, "\r\n", "\n", -1), "\n")
+	info := &VersionInfo{Features: make(map[string]bool, 128)}
+
+	// Parse the first line
+	firstLine := strings.TrimSpace(lines[0])
+	if m := rxVimVersion.FindStringSubmatch(firstLine); len(m) != 0 {
+		info.Major, _ = strconv.Atoi(m[1])
+		info.Minor, _ = strconv.Atoi(m[2])
+	} else if m := rxNvimVersion.FindStringSubmatch(firstLine); len(m) != 0 {
+		info.Neovim = true
+		info.Major, _ = strconv.Atoi(m[1])
+		info.Minor, _ = strconv.Atoi(m[2])
+		info.Patch, _ = strconv.Atoi(m[3])
+		return info, nil
+	} else {
+		return nil, fmt.Errorf("could not detect vim version from: %q", firstLine)
+	}
+
+	inFeatures := false
+	for _, line := range lines[1:] {
+		if m := rxPatches.FindStringSubmatch(line); len(m) != 0 {
+			// e.g. "1-1378, 1499, 1532"
+			for _, patches := range strings.Split(m[1], ",") {
+				ranges := strings.Split(strings.TrimSpace(patches), "-")
+				n, err := strconv.Atoi(ranges[len(ranges)-1])
+				if err == nil && n > info.Patch {
+					info.Patch = n
+				}
+			}
+			continue
+		}
+		if strings.Contains(line, "Features included (+) or not (-)") {
+			inFeatures = true
+			continue
+		}
+		if !inFeatures {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 || !rxFeature.MatchString(fields[0]) {
+			// End of features list (e.g. "   system vimrc file: ...")
+			inFeatures = false
+			continue
+		}
+		for _, field := range fields {
+			if m := rxFeature.FindStringSubmatch(field); len(m) != 0 {
+				info.Features[m[2]] = m[1] == "+"
+			}
+		}
+	}
+	return info, nil
+}
+
+// Returns the version like "vim 8.2.1234" or "nvim 0.9.1"
+func (info *VersionInfo) String() string {
+	name := "vim"
+	if info.Neovim {
+		name = "nvim"
+	}
+	return fmt.Sprintf("%s %d.%d.%d", name, info.Major, info.Minor, info.Patch)
+}
+
+var rxVersionString = regexp.MustCompile(`^(n?vim) (\d+)\.`)
+
+// Returns true if version (the result of String()) is the same editor
+// (Vim or Neovim) and the same major version as info.
+// Returns true if version cannot be parsed, because it is unknown.
+func (info *VersionInfo) SameMajor(version string) bool {
+	m := rxVersionString.FindStringSubmatch(version)
+	if len(m) == 0 {
+		return true
+	}
+	major, _ := strconv.Atoi(m[2])
+	return (m[1] == "nvim") == info.Neovim && major == info.Major
+}
+
+// Returns error if volt's pack-based layout (~/.vim/pack/volt) does not work
+// with the vim
+func (info *VersionInfo) Supported() error {
+	if info.Neovim {
+		return nil
+	}
+	if info.Major < MinMajor || info.Major == MinMajor && info.Minor < MinMinor {
+		return fmt.Errorf("vim %d.%d is too old (volt requires vim %d.%d or later)", info.Major, info.Minor, MinMajor, MinMinor)
+	}
+	if included, exists := info.Features["packages"]; exists && !included {
+		return errors.New("vim does not have +packages feature")
+	}
+	return nil
+}
+
+var rxVersionRequirement = regexp.MustCompile(`^vim>=(\d+)\.(\d+)(?:\.(\d+))?$`)
+var rxFeatureRequirement = regexp.MustCompile(`^\+(\w+)$`)
+
+// Returns error if requirement has invalid format.
+// requirement is "+{feature}" (e.g. "+python3") which means vim must have
+// the feature, or "vim>={major}.{minor}[.{patch}]" (e.g. "vim>=8.0.1453")
+// which means vim must be the version or later.
+func ValidateRequirement(requirement string) error {
+	if rxFeatureRequirement.MatchString(requirement) || rxVersionRequirement.MatchString(requirement) {
+		return nil
+	}
+	return fmt.Errorf("invalid requirement %q: must be \"+{feature}\" or \"vim>={major}.{minor}[.{patch}]\"", requirement)
+}
+
+// Returns error if the vim does not satisfy requirement
+// (see ValidateRequirement() for the format).
+// Neovim always satisfies requirements because its features and version
+// are not comparable with Vim's ones.
+func (info *VersionInfo) Satisfies(requirement string) error {
+	if err := ValidateRequirement(requirement); err != nil {
+		return err
+	}
+	if info.Neovim {
+		return nil
+	}
+	if m := rxFeatureRequirement.FindStringSubmatch(requirement); len(m) != 0 {
+		if !info.Features[m[1]] {
+			return fmt.Errorf("vim does not have +%s feature", m[1])
+		}
+		return nil
+	}
+	m := rxVersionRequirement.FindStringSubmatch(requirement)
+	var required [3]int
+	for i := range required {
+		required[i], _ = strconv.Atoi(m[i+1])
+	}
+	actual := [3]int{info.Major, info.Minor, info.Patch}
+	for i := range actual {
+		if actual[i] > required[i] {
+			return nil
+		}
+		if actual[i] < required[i] {
+			return fmt.Errorf("vim %d.%d.%d is older than %d.%d.%d",
+				actual[0], actual[1], actual[2], required[0], required[1], required[2])
+		}
+	}
+	return nil
+}
+
+type checkResult struct {
+	info *VersionInfo
+	err  error
+}
+
+var checkCache = make(map[string]checkResult)
+var checkMutex sync.Mutex
+
+// Run "{vimExePath} --version" and check if the vim works with volt.
+// The result is cached per vimExePath while volt is running.
+func CheckVersion(vimExePath string) (*VersionInfo, error) {
+	checkMutex.Lock()
+	defer checkMutex.Unlock()
+
+	if result, exists := checkCache[vimExePath]; exists {
+		return result.info, result.err
+	}
+	info, err := checkVersion(vimExePath)
+	checkCache[vimExePath] = checkResult{info, err}
+	return info, err
+}
+
+func checkVersion(vimExePath string) (*VersionInfo, error) {
+	out, err := exec.Command(vimExePath, "--version").Output()
+	if err != nil {
+		return nil, errors.New("failed to run '" + vimExePath + " --version': " + err.Error())
+	}
+	info, err := ParseVersion(string(out))
+	if err != nil {
+		return nil, err
+	}
+	return info, info.Supported()
+}
@@ -0,0 +1,183 @@
+package vimutil
+
+import "testing"
+
+const vim90 = `VIM - Vi IMproved 9.0 (2022 Jun 28, compiled Feb 16 2025 05:23:41)
+Included patches: 1-1378, 1499, 1532, 1848, 1858, 1873, 1969, 2142
+Modified by team+vim@tracker.debian.org
+Compiled by team+vim@tracker.debian.org
+Huge version without GUI.  Features included (+) or not (-):
++acl               +file_in_path      +mouse_urxvt       -tag_any_white
+-balloon_eval      +fork()            +netbeans_intg     +termresponse
+-browse            -hangul_input      +packages          +textprop
+++builtin_terms    +iconv             +path_extra        +timers
+   system vimrc file: "$VIM/vimrc"
+     user vimrc file: "$HOME/.vimrc"
+`
+
+const vim80NoPackages = `VIM - Vi IMproved 8.0 (2016 Sep 12, compiled Jan 01 2017 00:00:00)
+Included patches: 1-1453
+Small version without GUI.  Features included (+) or not (-):
++acl             -farsi           -mouse_sgr       -tag_old_static
+-arabic          -file_in_path    -mouse_sysmouse  -tag_any_white
+-autocmd         -find_in_path    -mouse_urxvt     -tcl
+-packages        -float           -mouse_xterm     -termguicolors
+   system vimrc file: "$VIM/vimrc"
+`
+
+const vim74 = `VIM - Vi IMproved 7.4 (2013 Aug 10, compiled Nov 24 2016 16:44:48)
+Included patches: 1-1689
+Extra patches: 8.0.0056
+Huge version without GUI.  Features included (+) or not (-):
++acl             +farsi           +mouse_netterm   +tag_binary
++arabic          +file_in_path    +mouse_sgr       +tag_old_static
+`
+
+const vim81Windows = "VIM - Vi IMproved 8.1 (2018 May 18, compiled May 18 2018 14:47:21)\r\n" +
+	"MS-Windows 64-bit GUI version with OLE support\r\n" +
+	"Included patches: 1\r\n" +
+	"Big version with GUI.  Features included (+) or not (-):\r\n" +
+	"+acl               +file_in_path      +mouse             +tag_binary\r\n" +
+	"+packages          +float             -mouse_dec         -tag_old_static\r\n" +
+	"   system vimrc file: \"$VIM\\vimrc\"\r\n"
+
+const nvim = `NVIM v0.3.1
+Build type: Release
+LuaJIT 2.0.5
+Features: +acl +iconv +jemalloc +tui
+`
+
+func TestParseVersion(t *testing.T) {
+	var tests = []struct {
+		name      string
+		out       string
+		neovim    bool
+		major     int
+		minor     int
+		patch     int
+		features  map[string]bool
+		supported bool
+	}{
+		{"vim 9.0", vim90, false, 9, 0, 2142, map[string]bool{"acl": true, "tag_any_white": false, "fork": true, "builtin_terms": true, "packages": true}, true},
+		{"vim 8.0 -packages", vim80NoPackages, false, 8, 0, 1453, map[string]bool{"acl": true, "packages": false}, false},
+		{"vim 7.4", vim74, false, 7, 4, 1689, map[string]bool{"acl": true}, false},
+		{"vim 8.1 (windows)", vim81Windows, false, 8, 1, 1, map[string]bool{"packages": true, "mouse_dec": false}, true},
+		{"neovim", nvim, true, 0, 3, 1, map[string]bool{}, true},
+	}
+	for _, tt := range tests {
+		info, err := ParseVersion(tt.out)
+		if err != nil {
+			t.Errorf("%s: err:%s", tt.name, err.Error())
+			continue
+		}
+		if info.Neovim != tt.neovim || info.Major != tt.major || info.Minor != tt.minor || info.Patch != tt.patch {
+			t.Errorf("%s: got:(%v,%d,%d,%d), expected:(%v,%d,%d,%d)", tt.name,
+				info.Neovim, info.Major, info.Minor, info.Patch,
+				tt.neovim, tt.major, tt.minor, tt.patch)
+		}
+		for name, included := range tt.features {
+			if got, exists := info.Features[name]; !exists || got != included {
+				t.Errorf("%s: feature %q: got:(%v,%v), expected:%v", tt.name, name, got, exists, included)
+			}
+		}
+		if _, exists := info.Features["system"]; exists {
+			t.Errorf("%s: lines after features list must not be parsed", tt.name)
+		}
+		if err := info.Supported(); (err == nil) != tt.supported {
+			t.Errorf("%s: got:%v, expected supported:%v", tt.name, err, tt.supported)
+		}
+	}
+}
+
+func TestParseVersionError(t *testing.T) {
+	var tests = []string{
+		"",
+		"vim: command not found",
+		"Vi IMproved 8.0",
+	}
+	for _, out := range tests {
+		if info, err := ParseVersion(out); err == nil {
+			t.Errorf("in:%q, expected error but got:%+v", out, info)
+		}
+	}
+}
+
+func TestSatisfies(t *testing.T) {
+	var tests = []struct {
+		out         string
+		requirement string
+		satisfied   bool
+	}{
+		{vim90, "+packages", true},
+		{vim90, "+timers", true},
+		{vim90, "+tag_any_white", false},
+		{vim90, "+python3", false},
+		{vim90, "vim>=8.0", true},
+		{vim90, "vim>=9.0", true},
+		{vim90, "vim>=9.0.2142", true},
+		{vim90, "vim>=9.0.2143", false},
+		{vim90, "vim>=9.1", false},
+		{vim90, "vim>=10.0", false},
+		{vim80NoPackages, "vim>=7.4.9999", true},
+		{vim80NoPackages, "vim>=8.0.1453", true},
+		{vim80NoPackages, "vim>=8.0.1454", false},
+		{nvim, "+python3", true},
+		{nvim, "vim>=9.0", true},
+	}
+	for _, tt := range tests {
+		info, err := ParseVersion(tt.out)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if err := info.Satisfies(tt.requirement); (err == nil) != tt.satisfied {
+			t.Errorf("vim:%d.%d.%d, requirement:%q, got:%v, expected satisfied:%v", info.Major, info.Minor, info.Patch, tt.requirement, err, tt.satisfied)
+		}
+	}
+}
+
+func TestValidateRequirement(t *testing.T) {
+	var tests = []struct {
+		requirement string
+		valid       bool
+	}{
+		{"+python3", true},
+		{"vim>=8.0", true},
+		{"vim>=8.0.1453", true},
+		{"python3", false},
+		{"+", false},
+		{"-python3", false},
+		{"vim>=8", false},
+		{"vim>8.0", false},
+		{"nvim>=0.3", false},
+	}
+	for _, tt := range tests {
+		if err := ValidateRequirement(tt.requirement); (err == nil) != tt.valid {
+			t.Errorf("requirement:%q, got:%v, expected valid:%v", tt.requirement, err, tt.valid)
+		}
+	}
+}
+
+func TestSameMajor(t *testing.T) {
+	var tests = []struct {
+		out     string
+		version string
+		same    bool
+	}{
+		{vim90, "vim 9.0.2142", true},
+		{vim90, "vim 9.1.0", true},
+		{vim90, "vim 8.2.1000", false},
+		{vim90, "nvim 9.0.0", false},
+		{nvim, "nvim 0.9.1", true},
+		{nvim, "vim 0.9.1", false},
+		{vim90, "unknown", true},
+	}
+	for _, tt := range tests {
+		info, err := ParseVersion(tt.out)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if got := info.SameMajor(tt.version); got != tt.same {
+			t.Errorf("vim:%s, version:%q, got:%v, expected:%v", info, tt.version, got, tt.same)
+		}
+	}
+}